@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/backup"
+	"github.com/OpenListTeam/OpenList/v4/internal/bootstrap"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOutput     string
+	backupPassphrase string
+	backupMode       string
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export or import the configuration",
+}
+
+var exportBackupCmd = &cobra.Command{
+	Use:     "export",
+	Short:   "Export settings, users, storages, metas, sharings and ssh keys to a file",
+	Example: `openlist backup export -o backup.zip --passphrase 123456`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bootstrap.Init()
+		defer bootstrap.Release()
+		b, err := backup.Export(backupPassphrase)
+		if err != nil {
+			return fmt.Errorf("failed to export: %+v", err)
+		}
+		if backupOutput == "" {
+			backupOutput = "openlist-backup-" + b.CreatedAt.Format("20060102-150405") + ".json"
+		}
+		f, err := os.OpenFile(backupOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %+v", err)
+		}
+		defer f.Close()
+		if err = b.Write(f, strings.HasSuffix(strings.ToLower(backupOutput), ".zip")); err != nil {
+			return fmt.Errorf("failed to write backup: %+v", err)
+		}
+		utils.Log.Infof("Backup has been exported to [%s] from CLI", backupOutput)
+		fmt.Printf("Backup has been exported to %s\n", backupOutput)
+		return nil
+	},
+}
+
+var importBackupCmd = &cobra.Command{
+	Use:     "import [file]",
+	Short:   "Import a backup, the server should be restarted afterwards",
+	Example: `openlist backup import backup.zip --mode replace --passphrase 123456`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("file is required")
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open file: %+v", err)
+		}
+		defer f.Close()
+		b, err := backup.Read(f)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %+v", err)
+		}
+		bootstrap.Init()
+		defer bootstrap.Release()
+		res, err := backup.Import(b, backupMode, backupPassphrase)
+		if err != nil {
+			return fmt.Errorf("failed to import: %+v", err)
+		}
+		utils.Log.Infof("Backup [%s] has been imported from CLI", args[0])
+		fmt.Printf("Imported %d settings, %d users, %d storages, %d metas, %d sharings and %d ssh keys\n",
+			res.Settings, res.Users, res.Storages, res.Metas, res.Sharings, res.SSHKeys)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(exportBackupCmd)
+	backupCmd.AddCommand(importBackupCmd)
+	backupCmd.PersistentFlags().StringVar(&backupPassphrase, "passphrase", "", "passphrase to encrypt or decrypt the confidential fields of storages")
+	exportBackupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "output file, zipped if it ends with .zip")
+	importBackupCmd.Flags().StringVar(&backupMode, "mode", backup.ModeMerge, "import mode: merge or replace")
+}
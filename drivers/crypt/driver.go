@@ -54,32 +54,41 @@ func (d *Crypt) Init(ctx context.Context) error {
 		return fmt.Errorf("failed to obfuscate salt: %w", err)
 	}
 
+	c, err := d.Addition.newCipher()
+	if err != nil {
+		return err
+	}
+	d.cipher = c
+
+	return nil
+}
+
+// newCipher checks the settings and creates the cipher, the password and salt must be obfuscated
+func (a *Addition) newCipher() (*rcCrypt.Cipher, error) {
 	isCryptExt := regexp.MustCompile(`^[.][A-Za-z0-9-_]{2,}$`).MatchString
-	if !isCryptExt(d.EncryptedSuffix) {
-		return fmt.Errorf("EncryptedSuffix is Illegal")
+	if !isCryptExt(a.EncryptedSuffix) {
+		return nil, fmt.Errorf("EncryptedSuffix is Illegal")
 	}
-	d.FileNameEncoding = utils.GetNoneEmpty(d.FileNameEncoding, "base64")
-	d.EncryptedSuffix = utils.GetNoneEmpty(d.EncryptedSuffix, ".bin")
-	d.RemotePath = utils.FixAndCleanPath(d.RemotePath)
+	a.FileNameEncoding = utils.GetNoneEmpty(a.FileNameEncoding, "base64")
+	a.EncryptedSuffix = utils.GetNoneEmpty(a.EncryptedSuffix, ".bin")
+	a.RemotePath = utils.FixAndCleanPath(a.RemotePath)
 
-	p, _ := strings.CutPrefix(d.Password, obfuscatedPrefix)
-	p2, _ := strings.CutPrefix(d.Salt, obfuscatedPrefix)
+	p, _ := strings.CutPrefix(a.Password, obfuscatedPrefix)
+	p2, _ := strings.CutPrefix(a.Salt, obfuscatedPrefix)
 	config := configmap.Simple{
 		"password":                  p,
 		"password2":                 p2,
-		"filename_encryption":       d.FileNameEnc,
-		"directory_name_encryption": d.DirNameEnc,
-		"filename_encoding":         d.FileNameEncoding,
-		"suffix":                    d.EncryptedSuffix,
+		"filename_encryption":       a.FileNameEnc,
+		"directory_name_encryption": a.DirNameEnc,
+		"filename_encoding":         a.FileNameEncoding,
+		"suffix":                    a.EncryptedSuffix,
 		"pass_bad_blocks":           "",
 	}
 	c, err := rcCrypt.NewCipher(config)
 	if err != nil {
-		return fmt.Errorf("failed to create Cipher: %w", err)
+		return nil, fmt.Errorf("failed to create Cipher: %w", err)
 	}
-	d.cipher = c
-
-	return nil
+	return c, nil
 }
 
 func (d *Crypt) updateObfusParm(str *string) error {
@@ -0,0 +1,489 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	stdpath "path"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/tache"
+	rcCrypt "github.com/rclone/rclone/backend/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+var MigrateTaskManager *tache.Manager[*MigrateTask]
+
+// MigrateTask re-encrypts the remote of a crypt storage with new settings into another folder,
+// or encrypts the plaintext files found in its remote in place.
+// The files already done are skipped, so a retried or restored task resumes where it stopped.
+type MigrateTask struct {
+	task.TaskExtension
+	Status    string `json:"-"`
+	MountPath string `json:"mount_path"`
+	// Target holds the new settings of a re-keying, the plaintext files are encrypted in place if it is nil
+	Target *Addition `json:"target,omitempty"`
+	// Verify reads back each re-encrypted file, encrypting in place always verifies before removing the plaintext
+	Verify bool `json:"verify"`
+	// Apply switches the storage to the target settings after the re-keying
+	Apply bool `json:"apply"`
+
+	total, done int64
+}
+
+type migrateFile struct {
+	// rawPath is the path of the plaintext file in the remote storage when encrypting in place
+	rawPath  string
+	dir      string
+	name     string
+	size     int64
+	modified time.Time
+}
+
+func (t *MigrateTask) GetName() string {
+	if t.Target == nil {
+		return fmt.Sprintf("encrypt plaintext files of crypt [%s]", t.MountPath)
+	}
+	return fmt.Sprintf("re-key crypt [%s] into [%s]", t.MountPath, t.Target.RemotePath)
+}
+
+func (t *MigrateTask) GetStatus() string {
+	return t.Status
+}
+
+func (t *MigrateTask) Run() error {
+	t.ClearEndTime()
+	t.SetStartTime(time.Now())
+	defer func() { t.SetEndTime(time.Now()) }()
+	d, err := getCrypt(t.MountPath)
+	if err != nil {
+		return err
+	}
+	t.total, t.done = 0, 0
+	if t.Target == nil {
+		return t.encryptInPlace(d)
+	}
+	return t.rekey(d)
+}
+
+// progress reports the done bytes plus the part of the current file
+func (t *MigrateTask) progress(f migrateFile) driver.UpdateProgress {
+	return func(percentage float64) {
+		if t.total > 0 {
+			t.SetProgress((float64(t.done) + percentage/100*float64(f.size)) * 100 / float64(t.total))
+		}
+	}
+}
+
+func (t *MigrateTask) fileDone(f migrateFile) {
+	t.done += f.size
+	t.progress(f)(0)
+}
+
+func (t *MigrateTask) rekey(d *Crypt) error {
+	c, err := t.Target.newCipher()
+	if err != nil {
+		return err
+	}
+	t.Status = "listing"
+	var files []migrateFile
+	if err = t.walk(d, "/", &files); err != nil {
+		return err
+	}
+	t.SetTotalBytes(t.total)
+	for i, f := range files {
+		if err = t.Ctx().Err(); err != nil {
+			return err
+		}
+		t.Status = fmt.Sprintf("re-keying %d/%d %s", i+1, len(files), stdpath.Join(f.dir, f.name))
+		if err = t.rekeyFile(d, c, f); err != nil {
+			return err
+		}
+		t.fileDone(f)
+	}
+	if t.Apply {
+		t.Status = "switching the storage to the new settings"
+		storage := *d.GetStorage()
+		storage.Addition, err = utils.Json.MarshalToString(t.Target)
+		if err != nil {
+			return err
+		}
+		if err = op.UpdateStorage(context.WithoutCancel(t.Ctx()), storage); err != nil {
+			return fmt.Errorf("failed to apply the new settings: %w", err)
+		}
+	}
+	t.Status = fmt.Sprintf("re-keyed %d files", len(files))
+	return nil
+}
+
+// walk collects the files of the crypt storage below dir
+func (t *MigrateTask) walk(d *Crypt, dir string, files *[]migrateFile) error {
+	objs, err := op.List(t.Ctx(), d, dir, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return fmt.Errorf("failed to list [%s]: %w", dir, err)
+	}
+	for _, obj := range objs {
+		if model.ObjHasMask(obj, model.Virtual) {
+			continue
+		}
+		if obj.IsDir() {
+			if err = t.walk(d, stdpath.Join(dir, obj.GetName()), files); err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, migrateFile{dir: dir, name: obj.GetName(), size: obj.GetSize(), modified: obj.ModTime()})
+		t.total += obj.GetSize()
+	}
+	return nil
+}
+
+func (t *MigrateTask) rekeyFile(d *Crypt, c *rcCrypt.Cipher, f migrateFile) error {
+	ctx := context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{})
+	dstStorage, dstDir, err := op.GetStorageAndActualPath(stdpath.Join(t.Target.RemotePath, c.EncryptDirName(f.dir)))
+	if err != nil {
+		return err
+	}
+	name := c.EncryptFileName(f.name)
+	size := c.EncryptedSize(f.size)
+	dstPath := stdpath.Join(dstDir, name)
+	if obj, err := op.Get(ctx, dstStorage, dstPath); err == nil && obj.GetSize() == size {
+		// done by an earlier run
+		return nil
+	}
+	src, err := openStream(ctx, d, stdpath.Join(f.dir, f.name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	h := md5.New()
+	encrypted, err := c.EncryptData(io.TeeReader(src, h))
+	if err != nil {
+		return fmt.Errorf("failed to EncryptData: %w", err)
+	}
+	err = op.Put(ctx, dstStorage, dstDir, &stream.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     size,
+			Modified: f.modified,
+		},
+		Reader:            encrypted,
+		Mimetype:          "application/octet-stream",
+		ForceStreamUpload: true,
+	}, t.progress(f))
+	if err != nil {
+		return fmt.Errorf("failed to put [%s]: %w", dstPath, err)
+	}
+	if !t.Verify {
+		return nil
+	}
+	return verifyEncrypted(ctx, c, dstStorage, dstPath, h.Sum(nil))
+}
+
+func (t *MigrateTask) encryptInPlace(d *Crypt) error {
+	remoteStorage, remoteDir, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return err
+	}
+	t.Status = "listing"
+	var files []migrateFile
+	var plainDirs []string
+	if err = t.walkPlain(d, remoteStorage, remoteDir, "/", &files, &plainDirs); err != nil {
+		return err
+	}
+	t.SetTotalBytes(t.total)
+	for i, f := range files {
+		if err = t.Ctx().Err(); err != nil {
+			return err
+		}
+		t.Status = fmt.Sprintf("encrypting %d/%d %s", i+1, len(files), stdpath.Join(f.dir, f.name))
+		if err = t.encryptFile(d, remoteStorage, remoteDir, f); err != nil {
+			return err
+		}
+		t.fileDone(f)
+	}
+	// the plaintext folders were replaced by encrypted ones, the deepest are removed first
+	ctx := context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{})
+	for _, dir := range plainDirs {
+		objs, err := op.List(ctx, remoteStorage, dir, model.ListArgs{Refresh: true, SkipHook: true})
+		if err == nil && len(objs) == 0 {
+			err = op.Remove(ctx, remoteStorage, dir)
+		}
+		if err != nil {
+			log.Warnf("failed to remove plaintext folder [%s]: %+v", dir, err)
+		}
+	}
+	t.Status = fmt.Sprintf("encrypted %d files", len(files))
+	return nil
+}
+
+// walkPlain collects the plaintext files below the remote dir, plainDir is the matching folder of the crypt storage.
+// A file whose name can be decrypted is considered encrypted. Unless the names are encrypted with standard,
+// a plaintext name can be decrypted too, e.g. one ending with the encrypted suffix when the encryption is off,
+// so the header of its content is checked.
+func (t *MigrateTask) walkPlain(d *Crypt, remoteStorage driver.Driver, rawDir, plainDir string, files *[]migrateFile, plainDirs *[]string) error {
+	objs, err := op.List(t.Ctx(), remoteStorage, rawDir, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return fmt.Errorf("failed to list [%s]: %w", rawDir, err)
+	}
+	for _, obj := range objs {
+		if model.ObjHasMask(obj, model.Virtual) {
+			continue
+		}
+		rawName := model.UnwrapObjName(obj).GetName()
+		rawPath := stdpath.Join(rawDir, rawName)
+		if obj.IsDir() {
+			name, err := d.cipher.DecryptDirName(rawName)
+			plain := err != nil
+			if plain {
+				name = rawName
+			}
+			if err = t.walkPlain(d, remoteStorage, rawPath, stdpath.Join(plainDir, name), files, plainDirs); err != nil {
+				return err
+			}
+			if plain {
+				*plainDirs = append(*plainDirs, rawPath)
+			}
+			continue
+		}
+		if _, err := d.cipher.DecryptFileName(rawName); err == nil {
+			if d.FileNameEnc == "standard" {
+				continue
+			}
+			encrypted, err := hasEncryptedHeader(t.Ctx(), remoteStorage, rawPath)
+			if err != nil {
+				return err
+			}
+			if encrypted {
+				continue
+			}
+		}
+		*files = append(*files, migrateFile{rawPath: rawPath, dir: plainDir, name: rawName, size: obj.GetSize(), modified: obj.ModTime()})
+		t.total += obj.GetSize()
+	}
+	return nil
+}
+
+func (t *MigrateTask) encryptFile(d *Crypt, remoteStorage driver.Driver, remoteDir string, f migrateFile) error {
+	ctx := context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{})
+	plainPath := stdpath.Join(f.dir, f.name)
+	// the encrypted copy is looked up in the remote, the crypt storage may find the plaintext under the same path
+	encPath := stdpath.Join(remoteDir, d.encryptPath(plainPath, false))
+	var sum []byte
+	if obj, err := op.Get(ctx, remoteStorage, encPath); err != nil || obj.GetSize() != d.cipher.EncryptedSize(f.size) {
+		src, err := openStream(ctx, remoteStorage, f.rawPath)
+		if err != nil {
+			return err
+		}
+		h := md5.New()
+		err = op.Put(ctx, d, f.dir, &stream.FileStream{
+			Obj: &model.Object{
+				Name:     f.name,
+				Size:     f.size,
+				Modified: f.modified,
+			},
+			Reader:   io.TeeReader(src, h),
+			Mimetype: utils.GetMimeType(f.name),
+		}, t.progress(f))
+		_ = src.Close()
+		if err != nil {
+			return fmt.Errorf("failed to put [%s]: %w", plainPath, err)
+		}
+		sum = h.Sum(nil)
+	} else {
+		// uploaded by an earlier run which stopped before removing the plaintext
+		var err error
+		if sum, err = hashStream(ctx, remoteStorage, f.rawPath); err != nil {
+			return err
+		}
+	}
+	got, err := hashStream(ctx, d, plainPath)
+	if err != nil {
+		return fmt.Errorf("failed to read back [%s]: %w", plainPath, err)
+	}
+	if !bytes.Equal(got, sum) {
+		if err = op.Remove(ctx, remoteStorage, encPath); err != nil {
+			log.Warnf("failed to remove corrupted [%s]: %+v", plainPath, err)
+		}
+		return fmt.Errorf("verify [%s] failed, content mismatch", plainPath)
+	}
+	return op.Remove(ctx, remoteStorage, f.rawPath)
+}
+
+func openStream(ctx context.Context, storage driver.Driver, actualPath string) (*stream.SeekableStream, error) {
+	link, obj, err := op.Link(ctx, storage, actualPath, model.LinkArgs{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link [%s]: %w", actualPath, err)
+	}
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Obj: obj, Ctx: ctx}, link)
+	if err != nil {
+		_ = link.Close()
+		return nil, fmt.Errorf("failed to open [%s]: %w", actualPath, err)
+	}
+	return ss, nil
+}
+
+// encryptedMagic starts the content of the files encrypted by rclone
+const encryptedMagic = "RCLONE\x00\x00"
+
+func hasEncryptedHeader(ctx context.Context, storage driver.Driver, actualPath string) (bool, error) {
+	ss, err := openStream(ctx, storage, actualPath)
+	if err != nil {
+		return false, err
+	}
+	defer ss.Close()
+	if ss.GetSize() < fileHeaderSize {
+		return false, nil
+	}
+	r, err := ss.RangeRead(http_range.Range{Length: int64(len(encryptedMagic))})
+	if err != nil {
+		return false, fmt.Errorf("failed to read [%s]: %w", actualPath, err)
+	}
+	header := make([]byte, len(encryptedMagic))
+	if _, err = io.ReadFull(r, header); err != nil {
+		return false, fmt.Errorf("failed to read [%s]: %w", actualPath, err)
+	}
+	return string(header) == encryptedMagic, nil
+}
+
+func hashStream(ctx context.Context, storage driver.Driver, actualPath string) ([]byte, error) {
+	ss, err := openStream(ctx, storage, actualPath)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+	h := md5.New()
+	if _, err = utils.CopyWithBuffer(h, ss); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyEncrypted decrypts the file and compares it with the md5 of the plaintext, the file is removed on mismatch
+// so a retry of the task encrypts it again
+func verifyEncrypted(ctx context.Context, c *rcCrypt.Cipher, storage driver.Driver, actualPath string, sum []byte) error {
+	ss, err := openStream(ctx, storage, actualPath)
+	if err != nil {
+		return err
+	}
+	defer ss.Close()
+	rc, err := c.DecryptData(io.NopCloser(ss))
+	if err != nil {
+		return fmt.Errorf("failed to DecryptData [%s]: %w", actualPath, err)
+	}
+	defer rc.Close()
+	h := md5.New()
+	_, err = utils.CopyWithBuffer(h, rc)
+	if err == nil && bytes.Equal(h.Sum(nil), sum) {
+		return nil
+	}
+	if rerr := op.Remove(ctx, storage, actualPath); rerr != nil {
+		log.Warnf("failed to remove corrupted [%s]: %+v", actualPath, rerr)
+	}
+	if err != nil {
+		return fmt.Errorf("verify [%s] failed: %w", actualPath, err)
+	}
+	return fmt.Errorf("verify [%s] failed, content mismatch", actualPath)
+}
+
+func getCrypt(mountPath string) (*Crypt, error) {
+	storage, err := op.GetStorageByMountPath(mountPath)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := storage.(*Crypt)
+	if !ok {
+		return nil, fmt.Errorf("[%s] is not a crypt storage", mountPath)
+	}
+	return d, nil
+}
+
+// RekeyArgs are the new settings of a re-keying, the empty ones keep the current value
+type RekeyArgs struct {
+	// RemotePath is the folder the files are re-encrypted into, it must not overlap the current remote
+	RemotePath       string `json:"remote_path"`
+	Password         string `json:"password"`
+	Salt             string `json:"salt"`
+	FileNameEnc      string `json:"filename_encryption"`
+	DirNameEnc       string `json:"directory_name_encryption"`
+	FileNameEncoding string `json:"filename_encoding"`
+	EncryptedSuffix  string `json:"encrypted_suffix"`
+	Verify           bool   `json:"verify"`
+	Apply            bool   `json:"apply"`
+}
+
+// Rekey adds a task re-encrypting the files of the crypt storage with new settings
+func Rekey(ctx context.Context, mountPath string, args RekeyArgs) (task.TaskExtensionInfo, error) {
+	d, err := getCrypt(mountPath)
+	if err != nil {
+		return nil, err
+	}
+	target := d.Addition
+	target.RemotePath = utils.FixAndCleanPath(args.RemotePath)
+	if args.RemotePath == "" || utils.IsSubPath(target.RemotePath, d.RemotePath) || utils.IsSubPath(d.RemotePath, target.RemotePath) ||
+		utils.IsSubPath(d.MountPath, target.RemotePath) {
+		return nil, errors.New("the new remote path must not overlap the remote or the mount path of the storage")
+	}
+	if args.Password != "" {
+		target.Password = args.Password
+	}
+	if args.Salt != "" {
+		target.Salt = args.Salt
+	}
+	if err = d.updateObfusParm(&target.Password); err != nil {
+		return nil, fmt.Errorf("failed to obfuscate password: %w", err)
+	}
+	if err = d.updateObfusParm(&target.Salt); err != nil {
+		return nil, fmt.Errorf("failed to obfuscate salt: %w", err)
+	}
+	target.FileNameEnc = utils.GetNoneEmpty(args.FileNameEnc, target.FileNameEnc)
+	target.DirNameEnc = utils.GetNoneEmpty(args.DirNameEnc, target.DirNameEnc)
+	target.FileNameEncoding = utils.GetNoneEmpty(args.FileNameEncoding, target.FileNameEncoding)
+	target.EncryptedSuffix = utils.GetNoneEmpty(args.EncryptedSuffix, target.EncryptedSuffix)
+	if _, err = target.newCipher(); err != nil {
+		return nil, err
+	}
+	t := &MigrateTask{
+		TaskExtension: task.TaskExtension{
+			ApiUrl: common.GetApiUrl(ctx),
+		},
+		MountPath: d.MountPath,
+		Target:    &target,
+		Verify:    args.Verify,
+		Apply:     args.Apply,
+	}
+	t.Creator, _ = ctx.Value(conf.UserKey).(*model.User)
+	MigrateTaskManager.Add(t)
+	return t, nil
+}
+
+// EncryptPlaintext adds a task encrypting the plaintext files in the remote of the crypt storage,
+// each plaintext file is removed once its encrypted copy is verified
+func EncryptPlaintext(ctx context.Context, mountPath string) (task.TaskExtensionInfo, error) {
+	d, err := getCrypt(mountPath)
+	if err != nil {
+		return nil, err
+	}
+	t := &MigrateTask{
+		TaskExtension: task.TaskExtension{
+			ApiUrl: common.GetApiUrl(ctx),
+		},
+		MountPath: d.MountPath,
+		Verify:    true,
+	}
+	t.Creator, _ = ctx.Value(conf.UserKey).(*model.User)
+	MigrateTaskManager.Add(t)
+	return t, nil
+}
@@ -0,0 +1,241 @@
+package crypt
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+// newMigrateStorages mounts a local storage at /<test name>/remote, a crypt storage of it at /<test name>/crypt
+// and a second local storage at /<test name>/target, and returns their roots
+func newMigrateStorages(t *testing.T) (*Crypt, string, string) {
+	conf.Conf.TempDir = t.TempDir()
+	remote, target := t.TempDir(), t.TempDir()
+	base := "/" + t.Name()
+	for mount, root := range map[string]string{base + "/remote": remote, base + "/target": target} {
+		addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+		if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: mount, Addition: addition}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addition, _ := utils.Json.MarshalToString(Addition{
+		FileNameEnc:      "off",
+		DirNameEnc:       "false",
+		RemotePath:       base + "/remote",
+		Password:         "password",
+		Salt:             "salt",
+		EncryptedSuffix:  ".bin",
+		FileNameEncoding: "base64",
+	})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Crypt", MountPath: base + "/crypt", Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := getCrypt(base + "/crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, remote, target
+}
+
+func runMigrate(m *MigrateTask) error {
+	m.SetCtx(context.Background())
+	return m.Run()
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readCrypt reads a file through the crypt storage
+func readCrypt(t *testing.T, d *Crypt, p string) string {
+	t.Helper()
+	ss, err := openStream(context.Background(), d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	data, err := io.ReadAll(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func TestEncryptInPlace(t *testing.T) {
+	d, remote, _ := newMigrateStorages(t)
+	writeFiles(t, remote, map[string]string{"a.txt": "hello", "sub/b.txt": "world"})
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{"/a.txt": "hello", "/sub/b.txt": "world"} {
+		if got := readCrypt(t, d, p); got != want {
+			t.Errorf("%s: got %q, want %q", p, got, want)
+		}
+		if exists(filepath.Join(remote, p)) {
+			t.Errorf("%s: the plaintext was not removed", p)
+		}
+	}
+}
+
+func TestEncryptInPlaceResume(t *testing.T) {
+	d, remote, _ := newMigrateStorages(t)
+	writeFiles(t, remote, map[string]string{"a.txt": "hello"})
+	// an earlier run uploaded the encrypted copy and stopped before removing the plaintext
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, remote, map[string]string{"a.txt": "hello"})
+	before, err := os.Stat(filepath.Join(remote, "a.txt.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(filepath.Join(remote, "a.txt.bin"))
+	if err != nil || !os.SameFile(before, after) {
+		t.Errorf("the encrypted copy was uploaded again: %v", err)
+	}
+	if exists(filepath.Join(remote, "a.txt")) {
+		t.Errorf("the plaintext was not removed")
+	}
+}
+
+func TestEncryptInPlaceVerifyMismatch(t *testing.T) {
+	d, remote, _ := newMigrateStorages(t)
+	// the encrypted copy left by an earlier run has the size but not the content of the plaintext
+	writeFiles(t, remote, map[string]string{"a.txt": "XXXXX"})
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, remote, map[string]string{"a.txt": "hello"})
+	err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true})
+	if err == nil || !strings.Contains(err.Error(), "content mismatch") {
+		t.Fatalf("expected a verify mismatch, got %v", err)
+	}
+	if exists(filepath.Join(remote, "a.txt.bin")) {
+		t.Errorf("the mismatching encrypted copy was not removed")
+	}
+	if !exists(filepath.Join(remote, "a.txt")) {
+		t.Fatalf("the plaintext was removed")
+	}
+	// a retry encrypts the file again
+	if err = runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCrypt(t, d, "/a.txt"); got != "hello" {
+		t.Errorf("got %q after the retry", got)
+	}
+}
+
+func TestEncryptInPlaceSuffixCollision(t *testing.T) {
+	d, remote, _ := newMigrateStorages(t)
+	// with filename encryption off, photo.bin decrypts to the name photo but it is a plaintext file
+	writeFiles(t, remote, map[string]string{"photo.bin": strings.Repeat("p", 100), "a.txt": "hello"})
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCrypt(t, d, "/photo.bin"); got != strings.Repeat("p", 100) {
+		t.Errorf("photo.bin: got %q", got)
+	}
+	if exists(filepath.Join(remote, "photo.bin")) || !exists(filepath.Join(remote, "photo.bin.bin")) {
+		t.Errorf("photo.bin was not encrypted")
+	}
+	// the files encrypted by the first run end with the suffix too, they are left alone
+	before, _ := os.Stat(filepath.Join(remote, "a.txt.bin"))
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(filepath.Join(remote, "a.txt.bin"))
+	if !os.SameFile(before, after) || exists(filepath.Join(remote, "a.txt.bin.bin")) {
+		t.Errorf("an encrypted file was encrypted again")
+	}
+}
+
+func TestRekeyResume(t *testing.T) {
+	d, remote, target := newMigrateStorages(t)
+	writeFiles(t, remote, map[string]string{"a.txt": "hello", "sub/b.txt": "world"})
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	newTarget := func() *Addition {
+		a := d.Addition
+		a.RemotePath = "/" + t.Name() + "/target"
+		a.Password = "new password"
+		if err := d.updateObfusParm(&a.Password); err != nil {
+			t.Fatal(err)
+		}
+		return &a
+	}
+	if err := runMigrate(&MigrateTask{MountPath: d.MountPath, Target: newTarget(), Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(filepath.Join(target, "a.txt.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the files done by the earlier run are skipped
+	if err = os.Remove(filepath.Join(target, "sub", "b.txt.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err = runMigrate(&MigrateTask{MountPath: d.MountPath, Target: newTarget(), Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(filepath.Join(target, "a.txt.bin"))
+	if err != nil || !os.SameFile(before, after) {
+		t.Errorf("a re-keyed file was uploaded again: %v", err)
+	}
+	c, err := newTarget().newCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{"a.txt.bin": "hello", "sub/b.txt.bin": "world"} {
+		f, err := os.Open(filepath.Join(target, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := c.DecryptData(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", p, got, err)
+		}
+	}
+}
@@ -405,6 +405,10 @@ func (d *Local) Remove(ctx context.Context, obj model.Obj) error {
 	return nil
 }
 
+func (d *Local) SetModTime(ctx context.Context, obj model.Obj, modified time.Time) error {
+	return os.Chtimes(obj.GetPath(), modified, modified)
+}
+
 func (d *Local) Put(ctx context.Context, dstDir model.Obj, stream model.FileStreamer, up driver.UpdateProgress) error {
 	fullPath := filepath.Join(dstDir.GetPath(), stream.GetName())
 	out, err := os.Create(fullPath)
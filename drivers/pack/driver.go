@@ -0,0 +1,669 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	stdpath "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/pkg/errgroup"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/avast/retry-go"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pack stores the content of the files as deduplicated chunks in the remote.
+// The remote holds a files folder mirroring the tree, with a manifest listing the chunks in place of each file,
+// and a chunks folder with the chunks named by their sha256 in subfolders by the first two characters.
+// Removing a file only removes its manifest, the chunks no longer referenced are removed by the garbage collection.
+type Pack struct {
+	model.Storage
+	Addition
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	cron    *cron.Cron
+
+	mu sync.Mutex
+	// known chunks by the first two characters of the hash, the value tells if the chunk is compressed
+	chunks    map[string]map[string]bool
+	manifests map[string]cachedManifest
+}
+
+const (
+	// eventGC is published to the other nodes of a cluster after a garbage collection, with the remote path
+	eventGC   = "pack_gc"
+	filesDir  = "files"
+	chunksDir = "chunks"
+	zstdExt   = ".zst"
+)
+
+func (d *Pack) Config() driver.Config {
+	return config
+}
+
+func (d *Pack) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Pack) Init(ctx context.Context) error {
+	if d.AvgChunkSize < 64 {
+		return errors.New("average chunk size must be at least 64 KB")
+	}
+	d.RemotePath = utils.FixAndCleanPath(d.RemotePath)
+	var err error
+	if d.encoder, err = zstd.NewWriter(nil); err != nil {
+		return err
+	}
+	if d.decoder, err = zstd.NewReader(nil); err != nil {
+		return err
+	}
+	d.chunks = make(map[string]map[string]bool)
+	d.manifests = make(map[string]cachedManifest)
+	if d.GCInterval > 0 {
+		d.cron = cron.NewCron(time.Hour * time.Duration(d.GCInterval))
+		d.cron.Do(func() {
+			if !coord.IsLeader() {
+				return
+			}
+			res, err := d.scan(context.Background(), true)
+			if err != nil {
+				log.Errorf("failed to collect garbage of pack [%s]: %+v", d.MountPath, err)
+				return
+			}
+			log.Infof("pack [%s] removed %d unreferenced chunks, %d bytes", d.MountPath, res.Removed, res.RemovedSize)
+		})
+	}
+	return nil
+}
+
+func (d *Pack) Drop(ctx context.Context) error {
+	if d.cron != nil {
+		d.cron.Stop()
+		d.cron = nil
+	}
+	if d.encoder != nil {
+		_ = d.encoder.Close()
+	}
+	if d.decoder != nil {
+		d.decoder.Close()
+	}
+	return nil
+}
+
+func (Addition) GetRootPath() string {
+	return "/"
+}
+
+func (d *Pack) remote() (driver.Driver, string, error) {
+	return op.GetStorageAndActualPath(d.RemotePath)
+}
+
+func (d *Pack) Get(ctx context.Context, path string) (model.Obj, error) {
+	remoteStorage, remoteActualPath, err := d.remote()
+	if err != nil {
+		return nil, err
+	}
+	remotePath := stdpath.Join(remoteActualPath, filesDir, path)
+	remoteObj, err := op.Get(ctx, remoteStorage, remotePath)
+	if err != nil {
+		if utils.PathEqual(path, "/") && errs.IsObjectNotFound(err) {
+			// nothing stored yet
+			return &model.Object{Path: "/", Name: "root", IsFolder: true}, nil
+		}
+		return nil, err
+	}
+	return d.toObj(ctx, remoteStorage, remotePath, path, remoteObj)
+}
+
+func (d *Pack) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	remoteStorage, remoteActualPath, err := d.remote()
+	if err != nil {
+		return nil, err
+	}
+	remoteDir := stdpath.Join(remoteActualPath, filesDir, dir.GetPath())
+	remoteObjs, err := op.List(ctx, remoteStorage, remoteDir, model.ListArgs{Refresh: args.Refresh})
+	if err != nil {
+		if utils.PathEqual(dir.GetPath(), "/") && errs.IsObjectNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := make([]model.Obj, len(remoteObjs))
+	listG, listCtx := errgroup.NewGroupWithContext(ctx, 5, retry.Attempts(3))
+	for i, obj := range remoteObjs {
+		if utils.IsCanceled(listCtx) {
+			break
+		}
+		listG.Go(func(ctx context.Context) error {
+			name := obj.GetName()
+			res, err := d.toObj(ctx, remoteStorage, stdpath.Join(remoteDir, name), stdpath.Join(dir.GetPath(), name), obj)
+			if err != nil {
+				// not written by this driver
+				log.Warnf("pack [%s] skips [%s]: %+v", d.MountPath, name, err)
+				return nil
+			}
+			result[i] = res
+			return nil
+		})
+	}
+	if err = listG.Wait(); err != nil {
+		return nil, err
+	}
+	return utils.SliceFilter(result, func(obj model.Obj) bool { return obj != nil }), nil
+}
+
+func (d *Pack) toObj(ctx context.Context, remoteStorage driver.Driver, remotePath, path string, remoteObj model.Obj) (model.Obj, error) {
+	if remoteObj.IsDir() {
+		return &model.Object{
+			Path:     path,
+			Name:     remoteObj.GetName(),
+			Modified: remoteObj.ModTime(),
+			Ctime:    remoteObj.CreateTime(),
+			IsFolder: true,
+		}, nil
+	}
+	m, err := d.readManifest(ctx, remoteStorage, remotePath, remoteObj)
+	if err != nil {
+		return nil, err
+	}
+	modified := m.Modified
+	if modified.IsZero() {
+		modified = remoteObj.ModTime()
+	}
+	return &packObject{
+		Object: model.Object{
+			Path:     path,
+			Name:     remoteObj.GetName(),
+			Size:     m.Size,
+			Modified: modified,
+			Ctime:    remoteObj.CreateTime(),
+			HashInfo: utils.NewHashInfo(utils.MD5, m.MD5),
+		},
+		m: m,
+	}, nil
+}
+
+// readManifest reads the manifest, it is cached as long as the size and the time of the remote file are unchanged
+func (d *Pack) readManifest(ctx context.Context, remoteStorage driver.Driver, remotePath string, remoteObj model.Obj) (*manifest, error) {
+	d.mu.Lock()
+	c, ok := d.manifests[remotePath]
+	d.mu.Unlock()
+	if ok && c.size == remoteObj.GetSize() && c.modified.Equal(remoteObj.ModTime()) {
+		return c.m, nil
+	}
+	data, err := readRemote(ctx, remoteStorage, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err = utils.Json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	d.mu.Lock()
+	d.manifests[remotePath] = cachedManifest{size: remoteObj.GetSize(), modified: remoteObj.ModTime(), m: m}
+	d.mu.Unlock()
+	return m, nil
+}
+
+func (d *Pack) forgetManifest(remotePath string) {
+	d.mu.Lock()
+	delete(d.manifests, remotePath)
+	d.mu.Unlock()
+}
+
+func readRemote(ctx context.Context, remoteStorage driver.Driver, remotePath string) ([]byte, error) {
+	rc, err := openRemote(ctx, remoteStorage, remotePath, http_range.Range{Length: -1})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func openRemote(ctx context.Context, remoteStorage driver.Driver, remotePath string, r http_range.Range) (io.ReadCloser, error) {
+	l, obj, err := op.Link(ctx, remoteStorage, remotePath, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	size := l.ContentLength
+	if size <= 0 {
+		size = obj.GetSize()
+	}
+	rrf, err := stream.GetRangeReaderFromLink(size, l)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	rc, err := rrf.RangeRead(ctx, r)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	cs := utils.NewClosers(rc, l)
+	return utils.ReadCloser{Reader: rc, Closer: &cs}, nil
+}
+
+func chunkPath(remoteActualPath string, c chunkRef) string {
+	name := c.Hash
+	if c.Zstd {
+		name += zstdExt
+	}
+	return stdpath.Join(remoteActualPath, chunksDir, c.Hash[:2], name)
+}
+
+func (d *Pack) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	remoteStorage, remoteActualPath, err := d.remote()
+	if err != nil {
+		return nil, err
+	}
+	pf, ok := file.(*packObject)
+	if !ok {
+		obj, err := d.Get(ctx, file.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		if pf, ok = obj.(*packObject); !ok {
+			return nil, errs.NotFile
+		}
+	}
+	m := pf.m
+	// offsets[i] is where the chunk i starts in the file
+	offsets := make([]int64, len(m.Chunks)+1)
+	for i, c := range m.Chunks {
+		offsets[i+1] = offsets[i] + c.Size
+	}
+	if offsets[len(m.Chunks)] != m.Size {
+		return nil, fmt.Errorf("manifest of [%s] is corrupted", file.GetPath())
+	}
+	return &model.Link{
+		RangeReader: stream.RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+			if httpRange.Length < 0 || httpRange.Start+httpRange.Length > m.Size {
+				httpRange.Length = m.Size - httpRange.Start
+			}
+			return &chunksReader{
+				ctx:     ctx,
+				d:       d,
+				storage: remoteStorage,
+				root:    remoteActualPath,
+				m:       m,
+				offsets: offsets,
+				pos:     httpRange.Start,
+				end:     httpRange.Start + httpRange.Length,
+			}, nil
+		}),
+	}, nil
+}
+
+// chunksReader reads the chunks covering the range one after another
+type chunksReader struct {
+	ctx      context.Context
+	d        *Pack
+	storage  driver.Driver
+	root     string
+	m        *manifest
+	offsets  []int64
+	pos, end int64
+	cur      io.ReadCloser
+}
+
+func (r *chunksReader) Read(p []byte) (int, error) {
+	for r.pos < r.end {
+		if r.cur == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.cur.Read(p[:min(int64(len(p)), r.end-r.pos)])
+		r.pos += int64(n)
+		if err == io.EOF {
+			_ = r.cur.Close()
+			r.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// open opens the chunk containing pos until the end of the chunk or of the range
+func (r *chunksReader) open() error {
+	i := sort.Search(len(r.m.Chunks), func(i int) bool { return r.offsets[i+1] > r.pos })
+	c := r.m.Chunks[i]
+	from := r.pos - r.offsets[i]
+	to := min(r.end, r.offsets[i+1]) - r.offsets[i]
+	if !c.Zstd {
+		rc, err := openRemote(r.ctx, r.storage, chunkPath(r.root, c), http_range.Range{Start: from, Length: to - from})
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %w", c.Hash, err)
+		}
+		r.cur = rc
+		return nil
+	}
+	data, err := readRemote(r.ctx, r.storage, chunkPath(r.root, c))
+	if err == nil {
+		data, err = r.d.decoder.DecodeAll(data, nil)
+	}
+	if err == nil && int64(len(data)) != c.Size {
+		err = errors.New("size mismatch")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chunk %s: %w", c.Hash, err)
+	}
+	r.cur = io.NopCloser(bytes.NewReader(data[from:to]))
+	return nil
+}
+
+func (r *chunksReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+func (d *Pack) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	return fs.MakeDir(ctx, stdpath.Join(d.RemotePath, filesDir, parentDir.GetPath(), dirName))
+}
+
+func (d *Pack) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	src := stdpath.Join(d.RemotePath, filesDir, srcObj.GetPath())
+	dst := stdpath.Join(d.RemotePath, filesDir, dstDir.GetPath())
+	_, err := fs.Move(ctx, src, dst)
+	return err
+}
+
+func (d *Pack) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	return fs.Rename(ctx, stdpath.Join(d.RemotePath, filesDir, srcObj.GetPath()), newName)
+}
+
+// Copy only copies the manifest, the chunks are shared
+func (d *Pack) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	src := stdpath.Join(d.RemotePath, filesDir, srcObj.GetPath())
+	dst := stdpath.Join(d.RemotePath, filesDir, dstDir.GetPath())
+	_, err := fs.Copy(ctx, src, dst)
+	return err
+}
+
+func (d *Pack) Remove(ctx context.Context, obj model.Obj) error {
+	return fs.Remove(ctx, stdpath.Join(d.RemotePath, filesDir, obj.GetPath()))
+}
+
+func (d *Pack) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) error {
+	remoteStorage, remoteActualPath, err := d.remote()
+	if err != nil {
+		return err
+	}
+	// the garbage collection of every pack storage on the remote path, on any node, waits for the upload,
+	// so a chunk is never removed between the upload finding it and its manifest being written
+	ctx, unlock, err := coord.RLock(ctx, d.gcLockKey())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	skipHookCtx := context.WithValue(ctx, conf.SkipHookKey, struct{}{})
+	m := &manifest{Version: 1, Modified: file.ModTime()}
+	h := md5.New()
+	ck := newChunker(io.TeeReader(&driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	}, h), d.AvgChunkSize*1024)
+	for {
+		data, err := ck.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		c, err := d.storeChunk(skipHookCtx, remoteStorage, remoteActualPath, data)
+		if err != nil {
+			return err
+		}
+		m.Chunks = append(m.Chunks, c)
+		m.Size += c.Size
+	}
+	m.MD5 = hex.EncodeToString(h.Sum(nil))
+	data, err := utils.Json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	remoteDir := stdpath.Join(remoteActualPath, filesDir, dstDir.GetPath())
+	d.forgetManifest(stdpath.Join(remoteDir, file.GetName()))
+	return op.Put(ctx, remoteStorage, remoteDir, &stream.FileStream{
+		Obj: &model.Object{
+			Name:     file.GetName(),
+			Size:     int64(len(data)),
+			Modified: file.ModTime(),
+		},
+		Mimetype: "application/json",
+		Reader:   bytes.NewReader(data),
+	}, nil)
+}
+
+// storeChunk uploads the chunk unless the remote already has it
+func (d *Pack) storeChunk(ctx context.Context, remoteStorage driver.Driver, remoteActualPath string, data []byte) (chunkRef, error) {
+	sum := sha256.Sum256(data)
+	c := chunkRef{Hash: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	known, err := d.knownChunks(ctx, remoteStorage, remoteActualPath, c.Hash[:2])
+	if err != nil {
+		return c, err
+	}
+	d.mu.Lock()
+	z, ok := known[c.Hash]
+	d.mu.Unlock()
+	if ok {
+		c.Zstd = z
+		return c, nil
+	}
+	stored := data
+	if d.Compression == "zstd" {
+		if compressed := d.encoder.EncodeAll(data, nil); len(compressed) < len(data) {
+			stored, c.Zstd = compressed, true
+		}
+	}
+	p := chunkPath(remoteActualPath, c)
+	err = op.Put(ctx, remoteStorage, stdpath.Dir(p), &stream.FileStream{
+		Obj: &model.Object{
+			Name:     stdpath.Base(p),
+			Size:     int64(len(stored)),
+			Modified: time.Now(),
+		},
+		Mimetype: "application/octet-stream",
+		Reader:   bytes.NewReader(stored),
+	}, nil)
+	if err != nil {
+		return c, fmt.Errorf("failed to upload chunk %s: %w", c.Hash, err)
+	}
+	d.mu.Lock()
+	known[c.Hash] = c.Zstd
+	d.mu.Unlock()
+	return c, nil
+}
+
+// knownChunks returns the chunks stored in the subfolder, they are listed once and then kept up to date
+func (d *Pack) knownChunks(ctx context.Context, remoteStorage driver.Driver, remoteActualPath, prefix string) (map[string]bool, error) {
+	d.mu.Lock()
+	known, ok := d.chunks[prefix]
+	d.mu.Unlock()
+	if ok {
+		return known, nil
+	}
+	objs, err := op.List(ctx, remoteStorage, stdpath.Join(remoteActualPath, chunksDir, prefix), model.ListArgs{Refresh: true})
+	if err != nil && !errs.IsObjectNotFound(err) {
+		return nil, err
+	}
+	known = make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		if !obj.IsDir() {
+			hash, z := strings.CutSuffix(obj.GetName(), zstdExt)
+			known[hash] = z
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if k, ok := d.chunks[prefix]; ok {
+		return k, nil
+	}
+	d.chunks[prefix] = known
+	return known, nil
+}
+
+// scan counts the files and chunks, the chunks no longer referenced by a manifest are removed if remove is set
+func (d *Pack) scan(ctx context.Context, remove bool) (*ScanResult, error) {
+	remoteStorage, remoteActualPath, err := d.remote()
+	if err != nil {
+		return nil, err
+	}
+	if remove {
+		var unlock func()
+		if ctx, unlock, err = coord.Lock(ctx, d.gcLockKey()); err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	res := &ScanResult{}
+	referenced := make(map[string]struct{})
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		objs, err := op.List(ctx, remoteStorage, dir, model.ListArgs{Refresh: true})
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			p := stdpath.Join(dir, obj.GetName())
+			if obj.IsDir() {
+				if err = walk(p); err != nil {
+					return err
+				}
+				continue
+			}
+			m, err := d.readManifest(ctx, remoteStorage, p, obj)
+			if err != nil {
+				// a chunk may only be referenced by an unreadable manifest, so nothing is removed
+				return fmt.Errorf("failed to read manifest [%s]: %w", p, err)
+			}
+			res.Files++
+			res.Size += m.Size
+			for _, c := range m.Chunks {
+				referenced[c.Hash] = struct{}{}
+			}
+		}
+		return nil
+	}
+	if err = walk(stdpath.Join(remoteActualPath, filesDir)); err != nil && !errs.IsObjectNotFound(err) {
+		return nil, err
+	}
+	chunksPath := stdpath.Join(remoteActualPath, chunksDir)
+	prefixes, err := op.List(ctx, remoteStorage, chunksPath, model.ListArgs{Refresh: true})
+	if err != nil && !errs.IsObjectNotFound(err) {
+		return nil, err
+	}
+	skipHookCtx := context.WithValue(ctx, conf.SkipHookKey, struct{}{})
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() {
+			continue
+		}
+		dir := stdpath.Join(chunksPath, prefix.GetName())
+		objs, err := op.List(ctx, remoteStorage, dir, model.ListArgs{Refresh: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			hash, _ := strings.CutSuffix(obj.GetName(), zstdExt)
+			if _, ok := referenced[hash]; ok || !remove {
+				res.Chunks++
+				res.StoredSize += obj.GetSize()
+				continue
+			}
+			if err = op.Remove(skipHookCtx, remoteStorage, stdpath.Join(dir, obj.GetName())); err != nil {
+				return nil, err
+			}
+			res.Removed++
+			res.RemovedSize += obj.GetSize()
+		}
+	}
+	if remove {
+		forgetChunks(d.RemotePath)
+		coord.Publish(eventGC, d.RemotePath)
+	}
+	return res, nil
+}
+
+// gcLockKey is shared by the pack storages on the same remote path
+func (d *Pack) gcLockKey() string {
+	return "pack:" + d.RemotePath
+}
+
+func (d *Pack) forgetChunks() {
+	d.mu.Lock()
+	d.chunks = make(map[string]map[string]bool)
+	d.mu.Unlock()
+}
+
+// forgetChunks drops the known chunks of the pack storages on the remote path,
+// so a chunk removed by the garbage collection is uploaded again instead of being referenced
+func forgetChunks(remotePath string) {
+	for _, storage := range op.GetAllStorages() {
+		if d, ok := storage.(*Pack); ok && (remotePath == "" || d.RemotePath == remotePath) {
+			d.forgetChunks()
+		}
+	}
+}
+
+// Other supports the methods stats, which counts the files and chunks,
+// and gc, which also removes the chunks no longer referenced, both need an admin
+func (d *Pack) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
+	user, _ := ctx.Value(conf.UserKey).(*model.User)
+	if user == nil || !user.IsAdmin() {
+		return nil, errs.PermissionDenied
+	}
+	switch args.Method {
+	case "stats":
+		return d.scan(ctx, false)
+	case "gc":
+		return d.scan(ctx, true)
+	default:
+		return nil, errs.NotSupport
+	}
+}
+
+func (d *Pack) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	remoteStorage, err := fs.GetStorage(d.RemotePath, &fs.GetStoragesArgs{})
+	if err != nil {
+		return nil, errs.NotImplement
+	}
+	remoteDetails, err := op.GetStorageDetails(ctx, remoteStorage)
+	if err != nil {
+		return nil, err
+	}
+	return &model.StorageDetails{
+		DiskUsage: remoteDetails.DiskUsage,
+	}, nil
+}
+
+var _ driver.Driver = (*Pack)(nil)
+var _ driver.Other = (*Pack)(nil)
@@ -0,0 +1,192 @@
+package pack
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+// newPackStorages mounts a local storage at /<test name>/remote and n pack storages of it, and returns the root of the remote
+func newPackStorages(t *testing.T, n int) ([]*Pack, string) {
+	conf.Conf.TempDir = t.TempDir()
+	remote := t.TempDir()
+	base := "/" + t.Name()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": remote})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: base + "/remote", Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	packs := make([]*Pack, n)
+	for i := range packs {
+		addition, _ := utils.Json.MarshalToString(Addition{RemotePath: base + "/remote", AvgChunkSize: 64, Compression: "zstd"})
+		mount := base + "/pack" + string(rune('a'+i))
+		if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Pack", MountPath: mount, Addition: addition}); err != nil {
+			t.Fatal(err)
+		}
+		storage, err := op.GetStorageByMountPath(mount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packs[i] = storage.(*Pack)
+	}
+	return packs, remote
+}
+
+func putFile(t *testing.T, d *Pack, name, content string) {
+	t.Helper()
+	err := op.Put(context.Background(), d, "/", &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content)), Modified: time.Now()},
+		Reader: strings.NewReader(content),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, d *Pack, p string) string {
+	t.Helper()
+	obj, err := d.Get(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := d.Link(context.Background(), obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.RangeReader.RangeRead(context.Background(), http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func countChunks(t *testing.T, remote string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(filepath.Join(remote, chunksDir), func(p string, e os.DirEntry, err error) error {
+		if err == nil && !e.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPutDedup(t *testing.T) {
+	packs, remote := newPackStorages(t, 1)
+	d := packs[0]
+	content := strings.Repeat("0123456789abcdef", 1<<14)
+	putFile(t, d, "a.txt", content)
+	chunks := countChunks(t, remote)
+	putFile(t, d, "b.txt", content)
+	if n := countChunks(t, remote); n != chunks {
+		t.Errorf("the same content stored %d chunks, then %d", chunks, n)
+	}
+	for _, p := range []string{"/a.txt", "/b.txt"} {
+		if got := readFile(t, d, p); got != content {
+			t.Errorf("%s: read %d bytes, want %d", p, len(got), len(content))
+		}
+	}
+}
+
+func TestGCForgetsRemovedChunks(t *testing.T) {
+	packs, remote := newPackStorages(t, 2)
+	a, b := packs[0], packs[1]
+	putFile(t, a, "a.txt", "hello")
+	// b learns the chunk through its own upload
+	putFile(t, b, "b.txt", "hello")
+	if err := a.Remove(context.Background(), &model.Object{Path: "/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove(context.Background(), &model.Object{Path: "/b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.scan(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 1 || countChunks(t, remote) != 0 {
+		t.Fatalf("expected the chunk to be removed, got %+v", res)
+	}
+	// b uploads the chunk again instead of referencing the removed one
+	putFile(t, b, "c.txt", "hello")
+	if got := readFile(t, b, "/c.txt"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestGCWaitsForUploads(t *testing.T) {
+	packs, _ := newPackStorages(t, 2)
+	a, b := packs[0], packs[1]
+	putFile(t, a, "a.txt", "hello")
+	if err := a.Remove(context.Background(), &model.Object{Path: "/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	// b uploads the content of the removed file, it holds the chunk until its manifest is written
+	pr, pw := io.Pipe()
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- op.Put(context.Background(), b, "/", &stream.FileStream{
+			Obj:    &model.Object{Name: "b.txt", Size: 5, Modified: time.Now()},
+			Reader: pr,
+		}, nil)
+	}()
+	if _, err := pw.Write([]byte("hel")); err != nil {
+		t.Fatal(err)
+	}
+	collected := make(chan *ScanResult)
+	go func() {
+		res, err := a.scan(context.Background(), true)
+		if err != nil {
+			t.Error(err)
+		}
+		collected <- res
+	}()
+	select {
+	case <-collected:
+		t.Fatal("the garbage collection ran during an upload on the same remote")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, _ = pw.Write([]byte("lo"))
+	_ = pw.Close()
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+	if res := <-collected; res == nil || res.Removed != 0 {
+		t.Errorf("the chunk of the upload was removed: %+v", res)
+	}
+	if got := readFile(t, b, "/b.txt"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
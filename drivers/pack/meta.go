@@ -0,0 +1,37 @@
+package pack
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	RemotePath   string `json:"remote_path" required:"true" help:"where the chunks and the index of the files are stored"`
+	AvgChunkSize int    `json:"avg_chunk_size" type:"number" required:"true" default:"1024" help:"KB, the chunks are between a quarter and four times this size"`
+	Compression  string `json:"compression" type:"select" options:"none,zstd" default:"zstd" help:"a chunk is stored compressed only if it gets smaller"`
+	GCInterval   int    `json:"gc_interval" type:"number" default:"0" help:"hours between removals of the unreferenced chunks, 0 to only remove them by the gc method"`
+}
+
+var config = driver.Config{
+	Name:        "Pack",
+	LocalSort:   true,
+	OnlyProxy:   true,
+	NoCache:     true,
+	DefaultRoot: "/",
+	NoLinkURL:   true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Pack{
+			Addition: Addition{
+				AvgChunkSize: 1024,
+			},
+		}
+	})
+	coord.Handle(eventGC, forgetChunks)
+	coord.Handle(coord.Resync, func(string) {
+		forgetChunks("")
+	})
+}
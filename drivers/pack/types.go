@@ -0,0 +1,43 @@
+package pack
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+// manifest is stored in the files folder of the remote in place of each file
+type manifest struct {
+	Version  int        `json:"v"`
+	Size     int64      `json:"size"`
+	Modified time.Time  `json:"modified"`
+	MD5      string     `json:"md5"`
+	Chunks   []chunkRef `json:"chunks"`
+}
+
+type chunkRef struct {
+	Hash string `json:"h"`
+	Size int64  `json:"s"`
+	// Zstd is set if the chunk is stored compressed
+	Zstd bool `json:"z,omitempty"`
+}
+
+type packObject struct {
+	model.Object
+	m *manifest
+}
+
+type cachedManifest struct {
+	size     int64
+	modified time.Time
+	m        *manifest
+}
+
+type ScanResult struct {
+	Files       int   `json:"files"`
+	Size        int64 `json:"size"`
+	Chunks      int   `json:"chunks"`
+	StoredSize  int64 `json:"stored_size"`
+	Removed     int   `json:"removed"`
+	RemovedSize int64 `json:"removed_size"`
+}
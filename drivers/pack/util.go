@@ -0,0 +1,92 @@
+package pack
+
+import (
+	"io"
+	"math/bits"
+)
+
+// gear is the random table of the rolling hash, it must never change as it decides where the chunks are cut
+var gear [256]uint64
+
+func init() {
+	// splitmix64
+	x := uint64(0x5ca1ab1e0ddba11)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker splits a stream into content defined chunks with FastCDC,
+// the cut points only depend on the nearby bytes, so an insertion only changes the chunks around it
+type chunker struct {
+	r             io.Reader
+	buf           []byte
+	start, end    int
+	eof           bool
+	min, avg, max int
+	// the mask before avg is harder to match than after, which keeps the sizes close to avg
+	maskS, maskL uint64
+}
+
+func newChunker(r io.Reader, avg int) *chunker {
+	n := bits.Len(uint(avg)) - 1
+	return &chunker{
+		r:     r,
+		buf:   make([]byte, avg*4),
+		min:   avg / 4,
+		avg:   avg,
+		max:   avg * 4,
+		maskS: ^uint64(0) << (64 - n - 2),
+		maskL: ^uint64(0) << (64 - n + 2),
+	}
+}
+
+// next returns the next chunk, which is valid until the following call, or io.EOF at the end
+func (c *chunker) next() ([]byte, error) {
+	if c.end-c.start < c.max && !c.eof {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	n = min(n, c.max)
+	normal := min(n, c.avg)
+	var fp uint64
+	i := c.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
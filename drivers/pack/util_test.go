@@ -0,0 +1,61 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func chunkHashes(t *testing.T, data []byte, avg int) map[[32]byte]int {
+	t.Helper()
+	c := newChunker(bytes.NewReader(data), avg)
+	hashes := make(map[[32]byte]int)
+	var total int
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += len(chunk)
+		if len(chunk) > avg*4 || (len(chunk) < avg/4 && total != len(data)) {
+			t.Fatalf("chunk size %d out of bounds", len(chunk))
+		}
+		hashes[sha256.Sum256(chunk)]++
+	}
+	if total != len(data) {
+		t.Fatalf("chunks cover %d of %d bytes", total, len(data))
+	}
+	return hashes
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	const avg = 64 << 10
+	a := chunkHashes(t, data, avg)
+	if len(a) < 32 || len(a) > 128 {
+		t.Errorf("%d chunks for an average of %d", len(a), len(data)/avg)
+	}
+
+	// an insertion only changes the chunks around it
+	shifted := append([]byte("inserted"), data...)
+	b := chunkHashes(t, shifted, avg)
+	shared := 0
+	for h := range b {
+		if a[h] > 0 {
+			shared++
+		}
+	}
+	if shared < len(a)-2 {
+		t.Errorf("only %d of %d chunks are shared after an insertion", shared, len(a))
+	}
+
+	if len(chunkHashes(t, nil, avg)) != 0 {
+		t.Error("empty input has chunks")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
@@ -108,6 +109,13 @@ func (d *SFTP) Remove(ctx context.Context, obj model.Obj) error {
 	return d.remove(obj.GetPath())
 }
 
+func (d *SFTP) SetModTime(ctx context.Context, obj model.Obj, modified time.Time) error {
+	if err := d.clientReconnectOnConnectionError(); err != nil {
+		return err
+	}
+	return d.client.Chtimes(obj.GetPath(), modified, modified)
+}
+
 func (d *SFTP) Put(ctx context.Context, dstDir model.Obj, stream model.FileStreamer, up driver.UpdateProgress) error {
 	if err := d.clientReconnectOnConnectionError(); err != nil {
 		return err
@@ -6,6 +6,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
@@ -177,6 +178,18 @@ func (d *SMB) Remove(ctx context.Context, obj model.Obj) error {
 	return nil
 }
 
+func (d *SMB) SetModTime(ctx context.Context, obj model.Obj, modified time.Time) error {
+	if err := d.checkConn(ctx); err != nil {
+		return err
+	}
+	if err := d.fs.Chtimes(obj.GetPath(), modified, modified); err != nil {
+		d.cleanLastConnTime()
+		return err
+	}
+	d.updateLastConnTime()
+	return nil
+}
+
 func (d *SMB) Put(ctx context.Context, dstDir model.Obj, stream model.FileStreamer, up driver.UpdateProgress) error {
 	if err := d.checkConn(ctx); err != nil {
 		return err
@@ -0,0 +1,161 @@
+// Package backup exports the configuration of an instance to a file and imports it again,
+// also into an instance running on another database type.
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// Version of the backup format, backups of a newer version are refused
+const Version = 1
+
+// zipEntry is the name of the backup in a zip file
+const zipEntry = "backup.json"
+
+// User keeps the fields of the user which are hidden from the api
+type User struct {
+	model.User
+	PwdHash   string `json:"pwd_hash"`
+	PwdTS     int64  `json:"pwd_ts"`
+	Salt      string `json:"salt"`
+	OtpSecret string `json:"otp_secret"`
+	Authn     string `json:"authn"`
+}
+
+type Sharing struct {
+	model.SharingDB
+	FilesRaw  string `json:"files_raw"`
+	CreatorId uint   `json:"creator_id"`
+}
+
+type SSHKey struct {
+	model.SSHPublicKey
+	UserId uint   `json:"user_id"`
+	KeyStr string `json:"key_str"`
+}
+
+type Backup struct {
+	Version    int       `json:"version"`
+	AppVersion string    `json:"app_version"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Encryption is set when the confidential fields of the storage additions and the secrets are encrypted
+	Encryption *Encryption         `json:"encryption,omitempty"`
+	Settings   []model.SettingItem `json:"settings"`
+	Users      []User              `json:"users"`
+	Storages   []model.Storage     `json:"storages"`
+	Metas      []model.Meta        `json:"metas"`
+	Sharings   []Sharing           `json:"sharings"`
+	SSHKeys    []SSHKey            `json:"ssh_keys"`
+}
+
+// Export reads the configuration from the database,
+// the confidential fields of storages, the credentials of users, the secret settings
+// and the passwords of metas and sharings are encrypted with passphrase if it is not empty
+func Export(passphrase string) (*Backup, error) {
+	b := &Backup{
+		Version:    Version,
+		AppVersion: conf.Version,
+		CreatedAt:  time.Now(),
+	}
+	gdb := db.GetDb()
+	if err := gdb.Find(&b.Settings).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get settings")
+	}
+	var users []model.User
+	if err := gdb.Find(&users).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get users")
+	}
+	for _, u := range users {
+		b.Users = append(b.Users, User{User: u, PwdHash: u.PwdHash, PwdTS: u.PwdTS, Salt: u.Salt, OtpSecret: u.OtpSecret, Authn: u.Authn})
+	}
+	if err := gdb.Find(&b.Storages).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get storages")
+	}
+	if err := gdb.Find(&b.Metas).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get metas")
+	}
+	var sharings []model.SharingDB
+	if err := gdb.Find(&sharings).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get sharings")
+	}
+	for _, s := range sharings {
+		b.Sharings = append(b.Sharings, Sharing{SharingDB: s, FilesRaw: s.FilesRaw, CreatorId: s.CreatorId})
+	}
+	var keys []model.SSHPublicKey
+	if err := gdb.Find(&keys).Error; err != nil {
+		return nil, errors.Wrap(err, "failed get ssh keys")
+	}
+	for _, k := range keys {
+		b.SSHKeys = append(b.SSHKeys, SSHKey{SSHPublicKey: k, UserId: k.UserId, KeyStr: k.KeyStr})
+	}
+	if passphrase != "" {
+		if err := b.encrypt(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Write writes the backup as json, or as a zip holding the json
+func (b *Backup) Write(w io.Writer, zipped bool) error {
+	data, err := utils.Json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !zipped {
+		_, err = w.Write(data)
+		return errors.WithStack(err)
+	}
+	zw := zip.NewWriter(w)
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: zipEntry, Method: zip.Deflate, Modified: b.CreatedAt})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = f.Write(data); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(zw.Close())
+}
+
+// Read reads a backup written by Write, zip or json is told by the content
+func Read(r io.Reader) (*Backup, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid zip")
+		}
+		f, err := zr.Open(zipEntry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "no %s in zip", zipEntry)
+		}
+		data, err = io.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	var b Backup
+	if err = utils.Json.Unmarshal(data, &b); err != nil {
+		return nil, errors.Wrap(err, "invalid backup")
+	}
+	if b.Version == 0 {
+		return nil, errors.New("invalid backup: no version")
+	}
+	if b.Version > Version {
+		return nil, errors.Errorf("backup version %d is newer than the supported %d", b.Version, Version)
+	}
+	return &b, nil
+}
@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+func TestTaggedFields(t *testing.T) {
+	type inner struct {
+		Token string `json:"token" confidential:"true"`
+	}
+	type addition struct {
+		inner
+		Password string `json:"password,omitempty" confidential:"true"`
+		Name     string `json:"name"`
+	}
+	got := taggedFields(reflect.TypeOf(addition{}))
+	if !reflect.DeepEqual(got, []string{"token", "password"}) {
+		t.Errorf("unexpected fields: %v", got)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	u := &model.User{Username: "backup_user", PwdHash: "hash", Salt: "salt"}
+	if err := db.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.GetDb().Model(u).Update("allow_ldap", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMeta(&model.Meta{Path: "/backup", ReadUsers: []uint{u.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Export("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = b.Write(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	b, err = Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the user is gone and another one took its id, merging gives the user a new id
+	if err = db.DeleteUserById(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := db.GetMetaByPath("/backup")
+	if err = db.DeleteMetaById(meta.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateUser(&model.User{ID: u.ID, Username: "other_user"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Import(b, ModeMerge, ""); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := db.GetUserByName("backup_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID == u.ID || restored.PwdHash != "hash" || restored.Salt != "salt" || restored.AllowLdap {
+		t.Errorf("unexpected restored user: %+v", restored)
+	}
+	meta, err = db.GetMetaByPath("/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta.ReadUsers, []uint{restored.ID}) {
+		t.Errorf("read users of meta not remapped: %v", meta.ReadUsers)
+	}
+}
+
+func TestExportEncryptsSecrets(t *testing.T) {
+	u := &model.User{Username: "secret_user", PwdHash: "secret-pwd-hash", Salt: "secret-salt",
+		OtpSecret: "secret-otp", Authn: `["secret-authn"]`}
+	if err := db.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSettingItem(&model.SettingItem{Key: conf.Token, Value: "secret-token"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMeta(&model.Meta{Path: "/secret", Password: "secret-meta-pwd"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateSharing(&model.SharingDB{FilesRaw: `["/secret"]`, Pwd: "secret-sharing-pwd", CreatorId: u.ID}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Export("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = b.Write(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{"secret-pwd-hash", "secret-salt", "secret-otp", "secret-authn", "secret-token", "secret-meta-pwd", "secret-sharing-pwd"}
+	for _, s := range secrets {
+		if bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Errorf("%s is in the encrypted backup", s)
+		}
+	}
+
+	b, err = Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.decrypt("wrong"); err != ErrWrongPassphrase {
+		t.Fatalf("expected a wrong passphrase, got %v", err)
+	}
+	if err = b.decrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	if err = b.Write(&buf2, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range secrets {
+		if !bytes.Contains(buf2.Bytes(), []byte(s)) {
+			t.Errorf("%s is not restored", s)
+		}
+	}
+}
+
+func TestMergeSharingOfOtherUser(t *testing.T) {
+	u := &model.User{Username: "sharing_user"}
+	if err := db.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateSharing(&model.SharingDB{ID: "merge-sharing", FilesRaw: `["/mine"]`, CreatorId: u.ID}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Export("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another user has a sharing with the same id now, it is kept and the imported one gets a new id
+	if err = db.DeleteSharingById("merge-sharing"); err != nil {
+		t.Fatal(err)
+	}
+	other := &model.User{Username: "other_sharing_user"}
+	if err = db.CreateUser(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.CreateSharing(&model.SharingDB{ID: "merge-sharing", FilesRaw: `["/other"]`, CreatorId: other.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Import(b, ModeMerge, ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.GetSharingById("merge-sharing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CreatorId != other.ID || s.FilesRaw != `["/other"]` {
+		t.Errorf("sharing of the other user overwritten: %+v", s)
+	}
+	mine, _, err := db.GetSharingsByCreatorId(u.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 1 || mine[0].ID == "merge-sharing" || mine[0].FilesRaw != `["/mine"]` {
+		t.Errorf("unexpected imported sharings: %+v", mine)
+	}
+}
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encPrefix marks an encrypted value
+const encPrefix = "enc:"
+
+// secretSettings are the settings holding credentials
+var secretSettings = []string{
+	conf.Token, conf.Aria2Secret, conf.SSOClientSecret, conf.LdapManagerPassword, conf.S3SecretAccessKey,
+}
+
+// checkText is encrypted into the backup to tell a wrong passphrase apart from corrupted data
+const checkText = "openlist backup"
+
+var ErrWrongPassphrase = errors.New("wrong passphrase of backup")
+
+type Encryption struct {
+	KDF   string `json:"kdf"`
+	Salt  string `json:"salt"`
+	Check string `json:"check"`
+}
+
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.WithStack(err)
+}
+
+func seal(aead cipher.AEAD, plain []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func open(aead cipher.AEAD, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// confidentialFields returns the json names of the addition fields of the driver
+// tagged with confidential:"true"
+func confidentialFields(driverName string) []string {
+	driverNew, err := op.GetDriver(driverName)
+	if err != nil {
+		return nil
+	}
+	t := reflect.TypeOf(driverNew().GetAddition())
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return taggedFields(t)
+}
+
+func taggedFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Anonymous {
+			names = append(names, taggedFields(field.Type)...)
+			continue
+		}
+		if field.Tag.Get("confidential") != "true" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// mapAddition calls fn on the raw json of each confidential field present in the addition,
+// the other fields are kept as they are
+func mapAddition(driverName, addition string, fn func(raw json.RawMessage) (json.RawMessage, error)) (string, error) {
+	fields := confidentialFields(driverName)
+	if len(fields) == 0 || addition == "" {
+		return addition, nil
+	}
+	var m map[string]json.RawMessage
+	if err := utils.Json.UnmarshalFromString(addition, &m); err != nil {
+		return "", errors.Wrap(err, "invalid addition")
+	}
+	for _, name := range fields {
+		raw, ok := m[name]
+		if !ok {
+			continue
+		}
+		nv, err := fn(raw)
+		if err != nil {
+			return "", errors.WithMessagef(err, "field %s", name)
+		}
+		m[name] = nv
+	}
+	return utils.Json.MarshalToString(m)
+}
+
+// mapSecrets calls fn on the credentials of the users, the secret settings
+// and the passwords of metas and sharings, the storages are left to mapAddition
+func (b *Backup) mapSecrets(fn func(string) (string, error)) error {
+	var err error
+	apply := func(fields ...*string) {
+		for _, f := range fields {
+			if err == nil && *f != "" {
+				*f, err = fn(*f)
+			}
+		}
+	}
+	for i := range b.Settings {
+		if slices.Contains(secretSettings, b.Settings[i].Key) {
+			apply(&b.Settings[i].Value)
+		}
+	}
+	for i := range b.Users {
+		u := &b.Users[i]
+		apply(&u.PwdHash, &u.Salt, &u.OtpSecret, &u.Authn)
+		// the embedded user keeps copies of the hidden fields
+		u.User.PwdHash, u.User.Salt, u.User.OtpSecret, u.User.Authn = u.PwdHash, u.Salt, u.OtpSecret, u.Authn
+	}
+	for i := range b.Metas {
+		apply(&b.Metas[i].Password)
+	}
+	for i := range b.Sharings {
+		apply(&b.Sharings[i].Pwd)
+	}
+	return err
+}
+
+func (b *Backup) encrypt(passphrase string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.WithStack(err)
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	check, err := seal(aead, []byte(checkText))
+	if err != nil {
+		return err
+	}
+	b.Encryption = &Encryption{KDF: "scrypt", Salt: base64.StdEncoding.EncodeToString(salt), Check: check}
+	for i := range b.Storages {
+		s := &b.Storages[i]
+		s.Addition, err = mapAddition(s.Driver, s.Addition, func(raw json.RawMessage) (json.RawMessage, error) {
+			sealed, err := seal(aead, raw)
+			if err != nil {
+				return nil, err
+			}
+			return utils.Json.Marshal(encPrefix + sealed)
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "failed encrypt storage [%s]", s.MountPath)
+		}
+	}
+	err = b.mapSecrets(func(v string) (string, error) {
+		sealed, err := seal(aead, []byte(v))
+		return encPrefix + sealed, err
+	})
+	return errors.WithMessage(err, "failed encrypt secrets")
+}
+
+// decrypt restores the confidential fields and the secrets, it does nothing if the backup is not encrypted
+func (b *Backup) decrypt(passphrase string) error {
+	if b.Encryption == nil {
+		return nil
+	}
+	if passphrase == "" {
+		return errors.New("the backup is encrypted, a passphrase is required")
+	}
+	if b.Encryption.KDF != "scrypt" {
+		return errors.Errorf("unsupported kdf %s", b.Encryption.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(b.Encryption.Salt)
+	if err != nil {
+		return errors.Wrap(err, "invalid salt")
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if check, err := open(aead, b.Encryption.Check); err != nil || string(check) != checkText {
+		return ErrWrongPassphrase
+	}
+	for i := range b.Storages {
+		s := &b.Storages[i]
+		s.Addition, err = mapAddition(s.Driver, s.Addition, func(raw json.RawMessage) (json.RawMessage, error) {
+			var str string
+			if err := utils.Json.Unmarshal(raw, &str); err != nil || !strings.HasPrefix(str, encPrefix) {
+				return raw, nil
+			}
+			plain, err := open(aead, strings.TrimPrefix(str, encPrefix))
+			return plain, errors.WithStack(err)
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "failed decrypt storage [%s]", s.MountPath)
+		}
+	}
+	err = b.mapSecrets(func(v string) (string, error) {
+		if !strings.HasPrefix(v, encPrefix) {
+			return v, nil
+		}
+		plain, err := open(aead, strings.TrimPrefix(v, encPrefix))
+		return string(plain), errors.WithStack(err)
+	})
+	if err != nil {
+		return errors.WithMessage(err, "failed decrypt secrets")
+	}
+	b.Encryption = nil
+	return nil
+}
@@ -0,0 +1,264 @@
+package backup
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// ModeMerge keeps the existing records, those matching a record of the backup are overwritten by it.
+	// Records are matched by username, mount path, meta path, sharing id and key fingerprint,
+	// new records get new ids and the references to users are remapped.
+	ModeMerge = "merge"
+	// ModeReplace deletes the existing records first and keeps the ids of the backup.
+	// Settings are always merged, the ones missing in the backup keep their value.
+	ModeReplace = "replace"
+)
+
+type ImportResult struct {
+	Settings int `json:"settings"`
+	Users    int `json:"users"`
+	Storages int `json:"storages"`
+	Metas    int `json:"metas"`
+	Sharings int `json:"sharings"`
+	SSHKeys  int `json:"ssh_keys"`
+}
+
+type importer struct {
+	tx      *gorm.DB
+	b       *Backup
+	replace bool
+	// userIds maps the user ids of the backup to the ids in the database
+	userIds map[uint]uint
+	result  ImportResult
+}
+
+// Import writes the backup to the database in a single transaction.
+// Loaded storages are not touched, the caller reloads them.
+func Import(b *Backup, mode, passphrase string) (*ImportResult, error) {
+	if mode != ModeMerge && mode != ModeReplace {
+		return nil, errors.Errorf("unknown import mode: %s", mode)
+	}
+	if err := b.decrypt(passphrase); err != nil {
+		return nil, err
+	}
+	im := &importer{b: b, replace: mode == ModeReplace, userIds: make(map[uint]uint)}
+	err := db.GetDb().Transaction(func(tx *gorm.DB) error {
+		im.tx = tx
+		steps := []struct {
+			name string
+			fn   func() error
+		}{
+			{"settings", im.settings},
+			{"users", im.users},
+			{"storages", im.storages},
+			{"metas", im.metas},
+			{"sharings", im.sharings},
+			{"ssh keys", im.sshKeys},
+		}
+		for _, step := range steps {
+			if err := step.fn(); err != nil {
+				return errors.WithMessagef(err, "failed import %s", step.name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range b.Settings {
+		if _, err := op.HandleSettingItemHook(&b.Settings[i]); err != nil {
+			log.Warnf("failed to execute hook on %s: %+v", b.Settings[i].Key, err)
+		}
+	}
+	op.SettingCacheUpdate()
+	return &im.result, nil
+}
+
+// create inserts the record with all fields, without keepId the id is left to the database
+func (im *importer) create(value any, keepId bool) error {
+	if keepId {
+		return db.CreateAll(im.tx, value)
+	}
+	return db.CreateAll(im.tx, value, "id")
+}
+
+// clear deletes all records of the model in replace mode
+func (im *importer) clear(value any) error {
+	if !im.replace {
+		return nil
+	}
+	return db.DeleteAll(im.tx, value)
+}
+
+// fixSequence moves the id sequence past the ids kept in replace mode
+func (im *importer) fixSequence(value any) error {
+	if !im.replace {
+		return nil
+	}
+	return db.FixSequence(im.tx, value)
+}
+
+// find reads into exist the record whose columns equal the values, in merge mode
+func (im *importer) find(exist any, columns map[string]any) (bool, error) {
+	if im.replace {
+		return false, nil
+	}
+	return db.TakeWhere(im.tx, exist, columns)
+}
+
+func (im *importer) settings() error {
+	for i := range im.b.Settings {
+		if err := db.Save(im.tx, &im.b.Settings[i]); err != nil {
+			return err
+		}
+		im.result.Settings++
+	}
+	return nil
+}
+
+func (im *importer) users() error {
+	if err := im.clear(&model.User{}); err != nil {
+		return err
+	}
+	for _, bu := range im.b.Users {
+		u := bu.User
+		u.PwdHash, u.PwdTS, u.Salt, u.OtpSecret, u.Authn = bu.PwdHash, bu.PwdTS, bu.Salt, bu.OtpSecret, bu.Authn
+		var exist model.User
+		found, err := im.find(&exist, map[string]any{"username": u.Username})
+		switch {
+		case err != nil:
+		case im.replace:
+			err = im.create(&u, true)
+		case found:
+			u.ID = exist.ID
+			err = db.Save(im.tx, &u)
+		default:
+			err = im.create(&u, false)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "user [%s]", u.Username)
+		}
+		im.userIds[bu.ID] = u.ID
+		im.result.Users++
+	}
+	return im.fixSequence(&model.User{})
+}
+
+func (im *importer) userId(id uint) uint {
+	if newId, ok := im.userIds[id]; ok {
+		return newId
+	}
+	return id
+}
+
+func (im *importer) storages() error {
+	if err := im.clear(&model.Storage{}); err != nil {
+		return err
+	}
+	for _, s := range im.b.Storages {
+		var exist model.Storage
+		found, err := im.find(&exist, map[string]any{"mount_path": s.MountPath})
+		switch {
+		case err != nil:
+		case im.replace:
+			err = im.create(&s, true)
+		case found:
+			s.ID = exist.ID
+			err = db.Save(im.tx, &s)
+		default:
+			err = im.create(&s, false)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "storage [%s]", s.MountPath)
+		}
+		im.result.Storages++
+	}
+	return im.fixSequence(&model.Storage{})
+}
+
+func (im *importer) metas() error {
+	if err := im.clear(&model.Meta{}); err != nil {
+		return err
+	}
+	for _, m := range im.b.Metas {
+		for i := range m.ReadUsers {
+			m.ReadUsers[i] = im.userId(m.ReadUsers[i])
+		}
+		for i := range m.WriteUsers {
+			m.WriteUsers[i] = im.userId(m.WriteUsers[i])
+		}
+		var exist model.Meta
+		found, err := im.find(&exist, map[string]any{"path": m.Path})
+		switch {
+		case err != nil:
+		case im.replace:
+			err = im.create(&m, true)
+		case found:
+			m.ID = exist.ID
+			err = db.Save(im.tx, &m)
+		default:
+			err = im.create(&m, false)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "meta [%s]", m.Path)
+		}
+		im.result.Metas++
+	}
+	return im.fixSequence(&model.Meta{})
+}
+
+func (im *importer) sharings() error {
+	if err := im.clear(&model.SharingDB{}); err != nil {
+		return err
+	}
+	for _, bs := range im.b.Sharings {
+		s := bs.SharingDB
+		s.FilesRaw, s.CreatorId = bs.FilesRaw, im.userId(bs.CreatorId)
+		// the id of a sharing is part of its url, it is kept unless another user has a sharing with it
+		var exist model.SharingDB
+		found, err := im.find(&exist, map[string]any{"id": s.ID})
+		if err == nil && found && exist.CreatorId != s.CreatorId {
+			s.ID, err = db.NewSharingId(im.tx)
+		}
+		if err == nil {
+			err = db.Save(im.tx, &s)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "sharing [%s]", s.ID)
+		}
+		im.result.Sharings++
+	}
+	return nil
+}
+
+func (im *importer) sshKeys() error {
+	if err := im.clear(&model.SSHPublicKey{}); err != nil {
+		return err
+	}
+	for _, bk := range im.b.SSHKeys {
+		k := bk.SSHPublicKey
+		k.UserId, k.KeyStr = im.userId(bk.UserId), bk.KeyStr
+		var exist model.SSHPublicKey
+		found, err := im.find(&exist, map[string]any{"user_id": k.UserId, "fingerprint": k.Fingerprint})
+		switch {
+		case err != nil:
+		case im.replace:
+			err = im.create(&k, true)
+		case found:
+			k.ID = exist.ID
+			err = db.Save(im.tx, &k)
+		default:
+			err = im.create(&k, false)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "ssh key [%s]", k.Title)
+		}
+		im.result.SSHKeys++
+	}
+	return im.fixSequence(&model.SSHPublicKey{})
+}
@@ -0,0 +1,34 @@
+package bootstrap
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// InitCluster joins the cluster if a shared backend is configured,
+// the directory cache and the login counters are shared and the caches are invalidated on every node
+func InitCluster() {
+	c := conf.Conf.Cluster
+	if c.Redis == "" {
+		return
+	}
+	// the persisted tasks of a node are found by its name, so it must not change on restart
+	if c.Node == "" {
+		utils.Log.Fatalf("cluster.node is required when cluster.redis is set, it must stay the same across restarts")
+	}
+	backend, err := coord.NewRedis(c.Redis)
+	if err != nil {
+		utils.Log.Fatalf("failed init cluster backend: %+v", err)
+	}
+	coord.Init(backend, c.Node, c.Prefix)
+	op.Cache.SetDirStore(coord.NewStore("dir"))
+	model.LoginCache = coord.NewLoginCounter()
+	utils.Log.Infof("joined cluster as node %s", c.Node)
+}
+
+func releaseCluster() {
+	coord.Close()
+}
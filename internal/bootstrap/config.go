@@ -9,8 +9,11 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
 	"github.com/OpenListTeam/OpenList/v4/drivers/base"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
 	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/resumable"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/webdav"
 	"github.com/caarlos0/env/v9"
 	"github.com/shirou/gopsutil/v4/mem"
 	log "github.com/sirupsen/logrus"
@@ -135,6 +138,7 @@ func InitConfig() {
 	convertAbsPath(&conf.Conf.TempDir)
 	convertAbsPath(&conf.Conf.BleveDir)
 	convertAbsPath(&conf.Conf.DistDir)
+	convertAbsPath(&conf.Conf.ReadCache.Dir)
 
 	err := os.MkdirAll(conf.Conf.TempDir, 0o777)
 	if err != nil {
@@ -179,6 +183,18 @@ func CleanTempDir() {
 		log.Errorln("failed list temp file: ", err)
 	}
 	for _, file := range files {
+		if file.Name() == resumable.DirName {
+			// unfinished resumable uploads are cleaned by their expiration
+			continue
+		}
+		if file.Name() == fs.WriteBackDirName {
+			// staged uploads are put again by fs.RecoverStaged
+			continue
+		}
+		if file.Name() == webdav.UploadsDirName {
+			// the chunked uploads of the ownCloud clients are resumed or expire
+			continue
+		}
 		if err := os.RemoveAll(filepath.Join(conf.Conf.TempDir, file.Name())); err != nil {
 			log.Errorln("failed delete temp file: ", err)
 		}
@@ -180,6 +180,9 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.HandleHookAfterWriting, Value: "false", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE},
 		{Key: conf.HandleHookRateLimit, Value: "0", Type: conf.TypeNumber, Group: model.GLOBAL, Flag: model.PRIVATE},
 		{Key: conf.IgnoreSystemFiles, Value: "false", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `When enabled, ignores common system files during upload (.DS_Store, desktop.ini, Thumbs.db, and files starting with ._)`},
+		{Key: conf.ResumableUploadExpire, Value: "24", Type: conf.TypeNumber, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `hours an unfinished resumable upload is kept since its last write`},
+		{Key: conf.StorageHealthInterval, Value: "30", Type: conf.TypeNumber, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `minutes between health checks of each storage, a failing storage is checked sooner; 0 to disable`},
+		{Key: conf.StorageHealthWebhook, Value: "", Type: conf.TypeString, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `URL receiving a JSON POST when a storage turns unhealthy or recovers`},
 
 		// single settings
 		{Key: conf.Token, Value: token, Type: conf.TypeString, Group: model.SINGLE, Flag: model.PRIVATE},
@@ -221,6 +224,7 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.S3AccessKeyId, Value: "", Type: conf.TypeString, Group: model.S3, Flag: model.PRIVATE},
 		{Key: conf.S3SecretAccessKey, Value: "", Type: conf.TypeString, Group: model.S3, Flag: model.PRIVATE},
 		{Key: conf.S3Buckets, Value: "[]", Type: conf.TypeString, Group: model.S3, Flag: model.PRIVATE},
+		{Key: conf.S3ListFromIndex, Value: "false", Type: conf.TypeBool, Group: model.S3, Flag: model.PRIVATE},
 
 		// ftp settings
 		{Key: conf.FTPPublicHost, Value: "127.0.0.1", Type: conf.TypeString, Group: model.FTP, Flag: model.PRIVATE},
@@ -238,6 +242,12 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.TaskCopyThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.Copy.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.TaskDecompressDownloadThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.Decompress.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.TaskDecompressUploadThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.DecompressUpload.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
+		{Key: conf.TaskOfflineDownloadToolThreadsNum, Value: "{}", Type: conf.TypeText, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `max concurrent downloads per tool, e.g. {"aria2": 2, "qBittorrent": 1}`},
+		{Key: conf.TaskOfflineDownloadTimeWindow, Value: "", Type: conf.TypeString, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `time of day offline downloads may run, e.g. 22:00-07:00,12:00-13:00, empty means any time`},
+		{Key: conf.TaskOfflineDownloadTransferTimeWindow, Value: "", Type: conf.TypeString, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `time of day offline download transfers may run, same format as offline_download_time_window`},
+		{Key: conf.TaskVerifyTransfer, Value: "false", Type: conf.TypeBool, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `compare size and checksum of each file after copy or move, computing the checksum from content when a side can not report it`},
+		{Key: conf.WebdavAsyncTransferThreshold, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `size in MB above which a WebDAV copy or move across storages runs as a background task and is answered with 202 Accepted, -1 to always wait for it`},
+		{Key: conf.WebdavOwnCloudCompat, Value: "false", Type: conf.TypeBool, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `serve /remote.php/dav, status.php and the ocs capabilities so the ownCloud and Nextcloud sync clients can connect with basic auth`},
 		{Key: conf.StreamMaxClientDownloadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxClientUploadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxServerDownloadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
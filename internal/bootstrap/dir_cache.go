@@ -0,0 +1,48 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+var dirDiskCache *cache.DiskCache
+
+// InitDirCache opens the persistent tier of the directory cache if it is enabled,
+// the directory listings cached in it are reused after a restart
+func InitDirCache() {
+	c := conf.Conf.DirCache
+	if !c.Persist {
+		return
+	}
+	if coord.Enabled() {
+		utils.Log.Infof("the directory cache is shared by the cluster, the persistent directory cache is not used")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.File), 0o700); err != nil {
+		utils.Log.Errorf("failed create dir of directory cache: %+v", err)
+		return
+	}
+	var err error
+	dirDiskCache, err = cache.OpenDiskCache(c.File, int64(c.MaxSizeMB)*utils.MB)
+	if err != nil {
+		utils.Log.Errorf("failed init persistent directory cache, only the memory is used: %+v", err)
+		return
+	}
+	op.Cache.SetDirStore(dirDiskCache)
+	utils.Log.Infof("persistent directory cache: %s, size: %d bytes", c.File, dirDiskCache.Size())
+}
+
+func releaseDirCache() {
+	if dirDiskCache == nil {
+		return
+	}
+	if err := dirDiskCache.Close(); err != nil {
+		utils.Log.Errorf("failed close persistent directory cache: %+v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package bootstrap
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// InitReadCache opens the disk cache of the proxied content, the storages enable it with read_cache
+func InitReadCache() {
+	c := conf.Conf.ReadCache
+	if c.MaxSizeMB <= 0 || c.Dir == "" {
+		return
+	}
+	cache, err := stream.NewBlockCache(c.Dir, int64(c.BlockSizeKB)*utils.KB, int64(c.MaxSizeMB)*utils.MB)
+	if err != nil {
+		utils.Log.Errorf("failed init read cache: %+v", err)
+		return
+	}
+	stream.ReadCache = cache
+	_, _, size := cache.Stats()
+	utils.Log.Infof("read cache: %s, size: %d bytes", c.Dir, size)
+}
@@ -15,10 +15,12 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/db"
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/resumable"
+	"github.com/OpenListTeam/OpenList/v4/internal/watch"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server"
 	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
-	"github.com/OpenListTeam/sftpd-openlist"
+	"github.com/OpenListTeam/OpenList/v4/server/sftp"
 	ftpserver "github.com/fclairamb/ftpserverlib"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -40,6 +42,8 @@ func Init() {
 }
 
 func Release() {
+	releaseCluster()
+	releaseDirCache()
 	db.Close()
 }
 
@@ -59,7 +63,7 @@ var (
 	ftpServer    *ftpserver.FtpServer
 	ftpRunning   bool
 	sftpDriver   *server.SftpDriver
-	sftpServer   *sftpd.SftpServer
+	sftpServer   *sftp.Server
 	sftpRunning  bool
 )
 
@@ -90,8 +94,15 @@ func Start() {
 		time.Sleep(time.Duration(conf.Conf.DelayedStart) * time.Second)
 	}
 	InitOfflineDownloadTools()
+	InitCluster()
+	InitDirCache()
+	InitReadCache()
 	LoadStorages()
+	InitStorageHealthCheck()
 	InitTaskManager()
+	go fs.RecoverStaged()
+	watch.Init()
+	resumable.Init()
 	if !flags.Debug && !flags.Dev {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -255,7 +266,7 @@ func Start() {
 			fmt.Printf("start sftp server on %s", conf.Conf.SFTP.Listen)
 			utils.Log.Infof("start sftp server on %s", conf.Conf.SFTP.Listen)
 			go func() {
-				sftpServer = sftpd.NewSftpServer(sftpDriver)
+				sftpServer = sftp.NewServer(sftpDriver)
 				sftpRunning = true
 				err = sftpServer.RunServer()
 				sftpRunning = false
@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+var healthCron *cron.Cron
+
+type storageHealthEvent struct {
+	Event          string              `json:"event"`
+	PreviousStatus string              `json:"previous_status"`
+	Storage        model.StorageHealth `json:"storage"`
+}
+
+// sendHealthWebhook posts the change of a storage to the configured webhook
+func sendHealthWebhook(prev, cur model.StorageHealth) {
+	url := setting.GetStr(conf.StorageHealthWebhook)
+	if url == "" {
+		return
+	}
+	event := "storage_unhealthy"
+	if cur.Healthy {
+		event = "storage_recovered"
+	}
+	body, err := utils.Json.Marshal(storageHealthEvent{Event: event, PreviousStatus: prev.Status, Storage: cur})
+	if err != nil {
+		utils.Log.Errorf("failed marshal storage health event: %+v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		utils.Log.Errorf("failed create storage health webhook request: %+v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := net.NewHttpClient().Do(req)
+	if err != nil {
+		utils.Log.Warnf("failed send storage health webhook: %+v", err)
+		return
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= 400 {
+		utils.Log.Warnf("storage health webhook responded %s", res.Status)
+	}
+}
+
+// InitStorageHealthCheck checks the storages which are due every minute
+func InitStorageHealthCheck() {
+	op.RegisterStorageHealthHook(func(prev, cur model.StorageHealth) {
+		// every node checks its own storages, only the leader notifies
+		if coord.IsLeader() {
+			go sendHealthWebhook(prev, cur)
+		}
+	})
+	healthCron = cron.NewCron(time.Minute)
+	healthCron.Do(func() {
+		interval := setting.GetInt(conf.StorageHealthInterval, 30)
+		if interval <= 0 || !conf.StoragesLoaded {
+			return
+		}
+		op.CheckStoragesHealth(context.Background(), time.Duration(interval)*time.Minute)
+	})
+}
@@ -1,12 +1,18 @@
 package bootstrap
 
 import (
+	"math"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/crypt"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
 	"github.com/OpenListTeam/OpenList/v4/internal/db"
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/tache"
 )
 
@@ -17,31 +23,57 @@ func taskFilterNegative(num int) int64 {
 	return int64(num)
 }
 
+// taskKey is the key of the persisted tasks, in a cluster each node restores only its own tasks.
+// The tasks persisted before the cluster was enabled are taken over by the first node starting.
+func taskKey(name string) string {
+	if !coord.Enabled() {
+		return name
+	}
+	key := name + "@" + coord.NodeID()
+	if err := db.MoveTaskData(name, key); err != nil {
+		utils.Log.Warnf("failed take over the %s tasks: %+v", name, err)
+	}
+	return key
+}
+
+// persistTasks stores the tasks of the manager under the key of name
+func persistTasks(name string, enabled bool) tache.Option {
+	if !enabled {
+		return tache.WithPersistFunction(nil, nil)
+	}
+	key := taskKey(name)
+	return tache.WithPersistFunction(db.GetTaskDataFunc(key, enabled), db.UpdateTaskDataFunc(key, enabled))
+}
+
 func InitTaskManager() {
 	fs.UploadTaskManager = tache.NewManager[*fs.UploadTask](tache.WithWorks(setting.GetInt(conf.TaskUploadThreadsNum, conf.Conf.Tasks.Upload.Workers)), tache.WithMaxRetry(conf.Conf.Tasks.Upload.MaxRetry)) //upload will not support persist
 	op.RegisterSettingChangingCallback(func() {
 		fs.UploadTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskUploadThreadsNum, conf.Conf.Tasks.Upload.Workers)))
 	})
-	fs.CopyTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithWorks(setting.GetInt(conf.TaskCopyThreadsNum, conf.Conf.Tasks.Copy.Workers)), tache.WithPersistFunction(db.GetTaskDataFunc("copy", conf.Conf.Tasks.Copy.TaskPersistant), db.UpdateTaskDataFunc("copy", conf.Conf.Tasks.Copy.TaskPersistant)), tache.WithMaxRetry(conf.Conf.Tasks.Copy.MaxRetry))
+	fs.WriteBackTaskManager = tache.NewManager[*fs.UploadTask](tache.WithWorks(conf.Conf.Tasks.WriteBack.Workers), tache.WithMaxRetry(conf.Conf.Tasks.WriteBack.MaxRetry)) // restored from the staged files by fs.RecoverStaged
+	fs.CopyTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithWorks(setting.GetInt(conf.TaskCopyThreadsNum, conf.Conf.Tasks.Copy.Workers)), persistTasks("copy", conf.Conf.Tasks.Copy.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.Copy.MaxRetry))
 	op.RegisterSettingChangingCallback(func() {
 		fs.CopyTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskCopyThreadsNum, conf.Conf.Tasks.Copy.Workers)))
 	})
-	fs.MoveTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithWorks(setting.GetInt(conf.TaskMoveThreadsNum, conf.Conf.Tasks.Move.Workers)), tache.WithPersistFunction(db.GetTaskDataFunc("move", conf.Conf.Tasks.Move.TaskPersistant), db.UpdateTaskDataFunc("move", conf.Conf.Tasks.Move.TaskPersistant)), tache.WithMaxRetry(conf.Conf.Tasks.Move.MaxRetry))
+	fs.MoveTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithWorks(setting.GetInt(conf.TaskMoveThreadsNum, conf.Conf.Tasks.Move.Workers)), persistTasks("move", conf.Conf.Tasks.Move.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.Move.MaxRetry))
 	op.RegisterSettingChangingCallback(func() {
 		fs.MoveTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskMoveThreadsNum, conf.Conf.Tasks.Move.Workers)))
 	})
-	tool.DownloadTaskManager = tache.NewManager[*tool.DownloadTask](tache.WithWorks(setting.GetInt(conf.TaskOfflineDownloadThreadsNum, conf.Conf.Tasks.Download.Workers)), tache.WithPersistFunction(db.GetTaskDataFunc("download", conf.Conf.Tasks.Download.TaskPersistant), db.UpdateTaskDataFunc("download", conf.Conf.Tasks.Download.TaskPersistant)), tache.WithMaxRetry(conf.Conf.Tasks.Download.MaxRetry))
-	op.RegisterSettingChangingCallback(func() {
-		tool.DownloadTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskOfflineDownloadThreadsNum, conf.Conf.Tasks.Download.Workers)))
-	})
-	tool.TransferTaskManager = tache.NewManager[*tool.TransferTask](tache.WithWorks(setting.GetInt(conf.TaskOfflineDownloadTransferThreadsNum, conf.Conf.Tasks.Transfer.Workers)), tache.WithPersistFunction(db.GetTaskDataFunc("transfer", conf.Conf.Tasks.Transfer.TaskPersistant), db.UpdateTaskDataFunc("transfer", conf.Conf.Tasks.Transfer.TaskPersistant)), tache.WithMaxRetry(conf.Conf.Tasks.Transfer.MaxRetry))
+	// the number of running downloads is limited by tool.Scheduler, which also handles priorities and time windows
+	tool.Scheduler.Refresh()
+	op.RegisterSettingChangingCallback(tool.Scheduler.Refresh)
+	tool.DownloadTaskManager = tache.NewManager[*tool.DownloadTask](tache.WithWorks(conf.Conf.Tasks.Download.Workers), persistTasks("download", conf.Conf.Tasks.Download.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.Download.MaxRetry))
+	// the waiting downloads hold a worker, the pool creates more workers on demand once the active count is raised
+	tool.DownloadTaskManager.SetWorkersNumActive(math.MaxInt32)
+	tool.TransferTaskManager = tache.NewManager[*tool.TransferTask](tache.WithWorks(setting.GetInt(conf.TaskOfflineDownloadTransferThreadsNum, conf.Conf.Tasks.Transfer.Workers)), persistTasks("transfer", conf.Conf.Tasks.Transfer.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.Transfer.MaxRetry))
 	op.RegisterSettingChangingCallback(func() {
 		tool.TransferTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskOfflineDownloadTransferThreadsNum, conf.Conf.Tasks.Transfer.Workers)))
 	})
 	if len(tool.TransferTaskManager.GetAll()) == 0 { //prevent offline downloaded files from being deleted
 		CleanTempDir()
 	}
-	fs.ArchiveDownloadTaskManager = tache.NewManager[*fs.ArchiveDownloadTask](tache.WithWorks(setting.GetInt(conf.TaskDecompressDownloadThreadsNum, conf.Conf.Tasks.Decompress.Workers)), tache.WithPersistFunction(db.GetTaskDataFunc("decompress", conf.Conf.Tasks.Decompress.TaskPersistant), db.UpdateTaskDataFunc("decompress", conf.Conf.Tasks.Decompress.TaskPersistant)), tache.WithMaxRetry(conf.Conf.Tasks.Decompress.MaxRetry))
+	fs.VerifyTaskManager = tache.NewManager[*fs.VerifyTask](tache.WithWorks(conf.Conf.Tasks.Verify.Workers), tache.WithMaxRetry(conf.Conf.Tasks.Verify.MaxRetry)) //verify will not support persist
+	fs.ArchiveDownloadTaskManager = tache.NewManager[*fs.ArchiveDownloadTask](tache.WithWorks(setting.GetInt(conf.TaskDecompressDownloadThreadsNum, conf.Conf.Tasks.Decompress.Workers)), persistTasks("decompress", conf.Conf.Tasks.Decompress.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.Decompress.MaxRetry))
 	op.RegisterSettingChangingCallback(func() {
 		fs.ArchiveDownloadTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskDecompressDownloadThreadsNum, conf.Conf.Tasks.Decompress.Workers)))
 	})
@@ -49,4 +81,15 @@ func InitTaskManager() {
 	op.RegisterSettingChangingCallback(func() {
 		fs.ArchiveContentUploadTaskManager.SetWorkersNumActive(taskFilterNegative(setting.GetInt(conf.TaskDecompressUploadThreadsNum, conf.Conf.Tasks.DecompressUpload.Workers)))
 	})
+	crypt.MigrateTaskManager = tache.NewManager[*crypt.MigrateTask](tache.WithWorks(conf.Conf.Tasks.CryptMigrate.Workers), persistTasks("crypt_migrate", conf.Conf.Tasks.CryptMigrate.TaskPersistant), tache.WithMaxRetry(conf.Conf.Tasks.CryptMigrate.MaxRetry))
+	metrics.RegisterTaskManager("upload", fs.UploadTaskManager)
+	metrics.RegisterTaskManager("write_back", fs.WriteBackTaskManager)
+	metrics.RegisterTaskManager("copy", fs.CopyTaskManager)
+	metrics.RegisterTaskManager("move", fs.MoveTaskManager)
+	metrics.RegisterTaskManager("offline_download", tool.DownloadTaskManager)
+	metrics.RegisterTaskManager("offline_download_transfer", tool.TransferTaskManager)
+	metrics.RegisterTaskManager("verify", fs.VerifyTaskManager)
+	metrics.RegisterTaskManager("decompress", fs.ArchiveDownloadTaskManager)
+	metrics.RegisterTaskManager("decompress_upload", fs.ArchiveContentUploadTaskManager.Manager)
+	metrics.RegisterTaskManager("crypt_migrate", crypt.MigrateTaskManager)
 }
@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var diskBucket = []byte("entries")
+
+var _ Store = (*DiskCache)(nil)
+
+// DiskCache is a persistent key value cache in a bbolt file.
+// Each value is stored with its expiration time, when the size of the entries exceeds maxSize
+// the entries expiring first are evicted.
+type DiskCache struct {
+	db      *bolt.DB
+	maxSize int64
+	size    atomic.Int64
+	// evicting is set while an eviction runs
+	evicting atomic.Bool
+	gcMu     sync.Mutex
+}
+
+// corrupted reports whether the error of bolt.Open means that the file is not a valid cache file
+func corrupted(err error) bool {
+	return errors.Is(err, bolt.ErrInvalid) || errors.Is(err, bolt.ErrVersionMismatch) ||
+		errors.Is(err, bolt.ErrChecksum) || errors.Is(err, bolt.ErrInvalidMapping)
+}
+
+// OpenDiskCache opens the cache file, a corrupted file is replaced
+func OpenDiskCache(path string, maxSize int64) (*DiskCache, error) {
+	opts := &bolt.Options{Timeout: time.Second, NoSync: true, NoFreelistSync: true}
+	db, err := bolt.Open(path, 0o600, opts)
+	if corrupted(err) {
+		log.Warnf("failed open disk cache %s, create a new one: %+v", path, err)
+		if err = os.Remove(path); err == nil {
+			db, err = bolt.Open(path, 0o600, opts)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed open disk cache %s", path)
+	}
+	c := &DiskCache{db: db, maxSize: maxSize}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(diskBucket)
+		if err != nil {
+			return err
+		}
+		var size int64
+		err = b.ForEach(func(k, v []byte) error {
+			size += int64(len(k) + len(v))
+			return nil
+		})
+		c.size.Store(size)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.WithStack(err)
+	}
+	gcFuncs = append(gcFuncs, c.GC)
+	return c, nil
+}
+
+func (c *DiskCache) Close() error {
+	return c.db.Close()
+}
+
+// Size returns the total size of the keys and values in bytes
+func (c *DiskCache) Size() int64 {
+	return c.size.Load()
+}
+
+func (c *DiskCache) Get(key string) ([]byte, time.Time, bool) {
+	var data []byte
+	var exp time.Time
+	err := c.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(diskBucket).Get([]byte(key))
+		if len(v) < 8 {
+			return nil
+		}
+		exp = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+		data = bytes.Clone(v[8:])
+		return nil
+	})
+	if err != nil {
+		log.Warnf("failed get %s from disk cache: %+v", key, err)
+		return nil, exp, false
+	}
+	if data == nil || time.Now().After(exp) {
+		return nil, exp, false
+	}
+	return data, exp, true
+}
+
+func (c *DiskCache) Set(key string, data []byte, exp time.Time) {
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(exp.UnixNano()))
+	copy(v[8:], data)
+	// Batch may call the function again, so the size is changed after the commit
+	var delta int64
+	err := c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		delta = int64(len(key) + len(v))
+		if old := b.Get([]byte(key)); old != nil {
+			delta -= int64(len(key) + len(old))
+		}
+		return b.Put([]byte(key), v)
+	})
+	if err != nil {
+		log.Warnf("failed set %s to disk cache: %+v", key, err)
+		return
+	}
+	c.size.Add(delta)
+	if c.maxSize > 0 && c.size.Load() > c.maxSize && c.evicting.CompareAndSwap(false, true) {
+		go func() {
+			defer c.evicting.Store(false)
+			c.GC()
+		}()
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	c.deleteWhere([]byte(key), func(k []byte) bool { return string(k) == key })
+}
+
+// DeletePrefix deletes the key and all keys below it, the key itself is included
+func (c *DiskCache) DeletePrefix(key string) {
+	prefix := []byte(key)
+	if !bytes.HasSuffix(prefix, []byte("/")) {
+		prefix = append(prefix, '/')
+	}
+	c.Delete(key)
+	c.deleteWhere(prefix, func(k []byte) bool { return bytes.HasPrefix(k, prefix) })
+}
+
+// deleteWhere deletes the keys from seek on as long as match returns true
+func (c *DiskCache) deleteWhere(seek []byte, match func(k []byte) bool) {
+	var delta int64
+	err := c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		delta = 0
+		var keys [][]byte
+		cur := b.Cursor()
+		for k, v := cur.Seek(seek); k != nil && match(k); k, v = cur.Next() {
+			keys = append(keys, k)
+			delta -= int64(len(k) + len(v))
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("failed delete %s from disk cache: %+v", seek, err)
+		return
+	}
+	c.size.Add(delta)
+}
+
+func (c *DiskCache) Clear() {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(diskBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(diskBucket)
+		return err
+	})
+	if err != nil {
+		log.Warnf("failed clear disk cache: %+v", err)
+		return
+	}
+	c.size.Store(0)
+}
+
+// GC deletes the expired entries, then evicts the entries expiring first
+// until the size is below 90% of the max size
+func (c *DiskCache) GC() {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+	type entry struct {
+		key  string
+		exp  int64
+		size int64
+	}
+	var expired, alive []entry
+	now := time.Now().UnixNano()
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).ForEach(func(k, v []byte) error {
+			e := entry{key: string(k), size: int64(len(k) + len(v))}
+			if len(v) >= 8 {
+				e.exp = int64(binary.BigEndian.Uint64(v))
+			}
+			if e.exp < now {
+				expired = append(expired, e)
+			} else {
+				alive = append(alive, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Warnf("failed scan disk cache: %+v", err)
+		return
+	}
+	evict := expired
+	if c.maxSize > 0 {
+		size := c.size.Load()
+		for _, e := range expired {
+			size -= e.size
+		}
+		if target := c.maxSize / 10 * 9; size > target {
+			slices.SortFunc(alive, func(a, b entry) int { return cmp.Compare(a.exp, b.exp) })
+			for _, e := range alive {
+				if size <= target {
+					break
+				}
+				evict = append(evict, e)
+				size -= e.size
+			}
+		}
+	}
+	if len(evict) == 0 {
+		return
+	}
+	var delta int64
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		for _, e := range evict {
+			v := b.Get([]byte(e.key))
+			if v == nil {
+				continue
+			}
+			delta -= int64(len(e.key) + len(v))
+			if err := b.Delete([]byte(e.key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("failed evict disk cache: %+v", err)
+		return
+	}
+	c.size.Add(delta)
+	log.Debugf("evicted %d entries of disk cache, size: %d", len(evict), c.size.Load())
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "cache.db")
+	if err := os.WriteFile(name, []byte("not a bolt file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenDiskCache(name, 0)
+	if err != nil {
+		t.Fatalf("corrupted file not replaced: %v", err)
+	}
+	c.Set("k", []byte("v"), time.Now().Add(time.Hour))
+	if v, _, ok := c.Get("k"); !ok || string(v) != "v" {
+		t.Errorf("unexpected value %q", v)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file which can not be opened is kept
+	name = filepath.Join(dir, "folder")
+	if err = os.Mkdir(name, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = OpenDiskCache(name, 0); err == nil {
+		_ = c.Close()
+		t.Fatal("opened a folder as cache")
+	}
+	if fi, err := os.Stat(name); err != nil || !fi.IsDir() {
+		t.Errorf("folder removed: %v", err)
+	}
+}
@@ -16,3 +16,14 @@ type CacheEntry[T any] struct {
 	Expirable
 	data T
 }
+
+// Store is a tier below an in-memory cache keeping serialized values,
+// it is either a local file or shared by the instances of a cluster
+type Store interface {
+	Get(key string) ([]byte, time.Time, bool)
+	Set(key string, data []byte, exp time.Time)
+	Delete(key string)
+	// DeletePrefix deletes the key and all keys below it
+	DeletePrefix(key string)
+	Clear()
+}
@@ -73,6 +73,9 @@ type TasksConfig struct {
 	Move               TaskConfig `json:"move" envPrefix:"MOVE_"`
 	Decompress         TaskConfig `json:"decompress" envPrefix:"DECOMPRESS_"`
 	DecompressUpload   TaskConfig `json:"decompress_upload" envPrefix:"DECOMPRESS_UPLOAD_"`
+	Verify             TaskConfig `json:"verify" envPrefix:"VERIFY_"`
+	WriteBack          TaskConfig `json:"write_back" envPrefix:"WRITE_BACK_"`
+	CryptMigrate       TaskConfig `json:"crypt_migrate" envPrefix:"CRYPT_MIGRATE_"`
 	AllowRetryCanceled bool       `json:"allow_retry_canceled" env:"ALLOW_RETRY_CANCELED"`
 }
 
@@ -104,6 +107,34 @@ type FTP struct {
 type SFTP struct {
 	Enable bool   `json:"enable" env:"ENABLE"`
 	Listen string `json:"listen" env:"LISTEN"`
+	// Exec serves a restricted set of commands, e.g. md5sum, cp and scp, over the ssh exec channel, it is off by default
+	Exec bool `json:"exec" env:"EXEC"`
+}
+
+type Metrics struct {
+	Enable bool   `json:"enable" env:"ENABLE"`
+	Token  string `json:"token" env:"TOKEN"`
+}
+
+type DirCache struct {
+	Persist   bool   `json:"persist" env:"PERSIST"`
+	File      string `json:"file" env:"FILE"`
+	MaxSizeMB int    `json:"max_sizeMB" env:"MAX_SIZE_MB"`
+}
+
+type ReadCache struct {
+	Dir         string `json:"dir" env:"DIR"`
+	MaxSizeMB   int    `json:"max_sizeMB" env:"MAX_SIZE_MB"`
+	BlockSizeKB int    `json:"block_sizeKB" env:"BLOCK_SIZE_KB"`
+}
+
+type Cluster struct {
+	// Redis is the url of the shared backend, redis://[user:password@]host:port[/db], empty to run standalone
+	Redis string `json:"redis" env:"REDIS"`
+	// Node identifies this instance, it is required with Redis and must stay the same across restarts
+	Node string `json:"node" env:"NODE"`
+	// Prefix is prepended to all keys and channels, so several deployments can share one server
+	Prefix string `json:"prefix" env:"PREFIX"`
 }
 
 type Config struct {
@@ -130,6 +161,10 @@ type Config struct {
 	S3                    S3          `json:"s3" envPrefix:"S3_"`
 	FTP                   FTP         `json:"ftp" envPrefix:"FTP_"`
 	SFTP                  SFTP        `json:"sftp" envPrefix:"SFTP_"`
+	Metrics               Metrics     `json:"metrics" envPrefix:"METRICS_"`
+	DirCache              DirCache    `json:"dir_cache" envPrefix:"DIR_CACHE_"`
+	ReadCache             ReadCache   `json:"read_cache" envPrefix:"READ_CACHE_"`
+	Cluster               Cluster     `json:"cluster" envPrefix:"CLUSTER_"`
 	LastLaunchedVersion   string      `json:"last_launched_version"`
 	ProxyAddress          string      `json:"proxy_address" env:"PROXY_ADDRESS"`
 }
@@ -139,6 +174,8 @@ func DefaultConfig(dataDir string) *Config {
 	indexDir := filepath.Join(dataDir, "bleve")
 	logPath := filepath.Join(dataDir, "log/log.log")
 	dbPath := filepath.Join(dataDir, "data.db")
+	dirCachePath := filepath.Join(dataDir, "dir_cache.db")
+	readCacheDir := filepath.Join(dataDir, "read_cache")
 	return &Config{
 		Scheme: Scheme{
 			Address:    "0.0.0.0",
@@ -216,6 +253,18 @@ func DefaultConfig(dataDir string) *Config {
 				Workers:  5,
 				MaxRetry: 2,
 			},
+			Verify: TaskConfig{
+				Workers: 2,
+			},
+			WriteBack: TaskConfig{
+				Workers:  3,
+				MaxRetry: 5,
+			},
+			CryptMigrate: TaskConfig{
+				Workers:  1,
+				MaxRetry: 2,
+				// TaskPersistant: true,
+			},
 			AllowRetryCanceled: false,
 		},
 		Cors: Cors{
@@ -243,6 +292,26 @@ func DefaultConfig(dataDir string) *Config {
 		SFTP: SFTP{
 			Enable: false,
 			Listen: ":5222",
+			Exec:   false,
+		},
+		Metrics: Metrics{
+			Enable: false,
+			Token:  "",
+		},
+		DirCache: DirCache{
+			Persist:   false,
+			File:      dirCachePath,
+			MaxSizeMB: 256,
+		},
+		ReadCache: ReadCache{
+			Dir:         readCacheDir,
+			MaxSizeMB:   2048,
+			BlockSizeKB: 1024,
+		},
+		Cluster: Cluster{
+			Redis:  "",
+			Node:   "",
+			Prefix: "openlist:",
 		},
 		LastLaunchedVersion: "",
 		ProxyAddress:        "",
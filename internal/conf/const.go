@@ -59,6 +59,9 @@ const (
 	HandleHookAfterWriting  = "handle_hook_after_writing"
 	HandleHookRateLimit     = "handle_hook_rate_limit"
 	IgnoreSystemFiles       = "ignore_system_files"
+	ResumableUploadExpire   = "resumable_upload_expire"
+	StorageHealthInterval   = "storage_health_check_interval"
+	StorageHealthWebhook    = "storage_health_webhook"
 
 	// index
 	SearchIndex     = "search_index"
@@ -131,6 +134,7 @@ const (
 	S3Buckets         = "s3_buckets"
 	S3AccessKeyId     = "s3_access_key_id"
 	S3SecretAccessKey = "s3_secret_access_key"
+	S3ListFromIndex   = "s3_list_from_index"
 
 	// qbittorrent
 	QbittorrentUrl      = "qbittorrent_url"
@@ -157,6 +161,12 @@ const (
 	TaskMoveThreadsNum                    = "move_task_threads_num"
 	TaskDecompressDownloadThreadsNum      = "decompress_download_task_threads_num"
 	TaskDecompressUploadThreadsNum        = "decompress_upload_task_threads_num"
+	TaskOfflineDownloadToolThreadsNum     = "offline_download_tool_threads_num"
+	TaskOfflineDownloadTimeWindow         = "offline_download_time_window"
+	TaskOfflineDownloadTransferTimeWindow = "offline_download_transfer_time_window"
+	TaskVerifyTransfer                    = "verify_copy_move"
+	WebdavAsyncTransferThreshold          = "webdav_async_transfer_threshold"
+	WebdavOwnCloudCompat                  = "webdav_owncloud_compat"
 	StreamMaxClientDownloadSpeed          = "max_client_download_speed"
 	StreamMaxClientUploadSpeed            = "max_client_upload_speed"
 	StreamMaxServerDownloadSpeed          = "max_server_download_speed"
@@ -191,4 +201,5 @@ const (
 	PathKey
 	SharingIDKey
 	SkipHookKey
+	OwnCloudKey
 )
@@ -0,0 +1,146 @@
+// Package coord coordinates the instances of a cluster sharing one database.
+// Caches are invalidated on the other instances when one of them writes,
+// and the scheduled jobs only run on the instance elected as leader.
+// Without a backend every function works for a standalone instance.
+package coord
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Backend is the shared storage of the cluster
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value, a ttl <= 0 keeps it forever
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	DelPrefix(ctx context.Context, prefix string) error
+	// Incr increments the counter, the ttl is set when the counter is created
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	Publish(ctx context.Context, channel string, msg []byte) error
+	// Subscribe calls handler for each message until ctx is done or the connection fails
+	Subscribe(ctx context.Context, channel string, handler func(msg []byte)) error
+	// TryLock takes or extends the lock, it reports whether owner holds the lock
+	TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases the lock if owner holds it
+	Unlock(ctx context.Context, key, owner string) error
+	// TryRLock takes or extends a shared lease of owner on key, a new lease is refused while the lock of key is held
+	TryRLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// RUnlock releases the shared lease of owner
+	RUnlock(ctx context.Context, key, owner string) error
+	// Readers counts the shared leases on key which have not expired
+	Readers(ctx context.Context, key string) (int64, error)
+	Close() error
+}
+
+const (
+	opTimeout = 3 * time.Second
+	// LeaderTTL is how long the leadership lasts without being renewed
+	LeaderTTL = 30 * time.Second
+)
+
+var (
+	backend Backend
+	nodeID  string
+	prefix  string
+	leader  atomic.Bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+)
+
+// Init starts the coordination with the backend, the keys and channels are prefixed with keyPrefix
+func Init(b Backend, node, keyPrefix string) {
+	backend, nodeID, prefix = b, node, keyPrefix
+	events = make(chan event, 1024)
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	// the leader is known before the scheduled jobs start
+	elect(ctx)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		publishLoop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		subscribeLoop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		electLoop(ctx)
+	}()
+}
+
+// Close stops the coordination and gives up the leadership
+func Close() {
+	if backend == nil {
+		return
+	}
+	cancel()
+	wg.Wait()
+	if leader.Swap(false) {
+		ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+		defer cancel()
+		if err := backend.Unlock(ctx, Key("leader"), nodeID); err != nil {
+			log.Warnf("failed release leadership: %+v", err)
+		}
+	}
+	if err := backend.Close(); err != nil {
+		log.Warnf("failed close coordination backend: %+v", err)
+	}
+	backend = nil
+}
+
+// Enabled reports whether the instance is part of a cluster
+func Enabled() bool {
+	return backend != nil
+}
+
+func NodeID() string {
+	return nodeID
+}
+
+// Key prefixes the key with the namespace of the deployment
+func Key(key string) string {
+	return prefix + key
+}
+
+// IsLeader reports whether the scheduled jobs should run on this instance,
+// a standalone instance is always the leader
+func IsLeader() bool {
+	return backend == nil || leader.Load()
+}
+
+func electLoop(ctx context.Context) {
+	ticker := time.NewTicker(LeaderTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			elect(ctx)
+		}
+	}
+}
+
+func elect(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, opTimeout)
+	defer cancel()
+	ok, err := backend.TryLock(ctx, Key("leader"), nodeID, LeaderTTL)
+	if err != nil {
+		// the lock may expire meanwhile and be taken by another node, so the leadership is given up
+		log.Warnf("failed renew leadership: %+v", err)
+		ok = false
+	}
+	if leader.Swap(ok) != ok {
+		utils.Log.Infof("node %s is leader: %v", nodeID, ok)
+	}
+}
@@ -0,0 +1,253 @@
+package coord
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *Redis) {
+	srv := miniredis.RunT(t)
+	r, err := NewRedis("redis://" + srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, r
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	_, r := newTestRedis(t)
+	defer r.Close()
+
+	if _, ok, err := r.Get(ctx, "missing"); ok || err != nil {
+		t.Fatalf("get missing key: %v %v", ok, err)
+	}
+	for _, k := range []string{"dir:/a*", "dir:/a*/b", "dir:/ab"} {
+		if err := r.Set(ctx, k, []byte(k), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.DelPrefix(ctx, "dir:/a*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := r.Get(ctx, "dir:/a*/b"); ok {
+		t.Error("key with prefix is not deleted")
+	}
+	if v, ok, _ := r.Get(ctx, "dir:/ab"); !ok || string(v) != "dir:/ab" {
+		t.Error("prefix is not matched literally")
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		if n, err := r.Incr(ctx, "count", time.Minute); err != nil || n != i {
+			t.Fatalf("incr: %d %v", n, err)
+		}
+	}
+
+	if ok, _ := r.TryLock(ctx, "lock", "a", time.Minute); !ok {
+		t.Fatal("a can not lock")
+	}
+	if ok, _ := r.TryLock(ctx, "lock", "b", time.Minute); ok {
+		t.Fatal("b takes the lock of a")
+	}
+	if ok, _ := r.TryLock(ctx, "lock", "a", time.Minute); !ok {
+		t.Fatal("a can not extend its lock")
+	}
+	_ = r.Unlock(ctx, "lock", "b")
+	if ok, _ := r.TryLock(ctx, "lock", "b", time.Minute); ok {
+		t.Fatal("b releases the lock of a")
+	}
+	_ = r.Unlock(ctx, "lock", "a")
+	if ok, _ := r.TryLock(ctx, "lock", "b", time.Minute); !ok {
+		t.Fatal("b can not lock after a released")
+	}
+}
+
+func TestRedisLockExpire(t *testing.T) {
+	ctx := context.Background()
+	srv, r := newTestRedis(t)
+	defer r.Close()
+
+	if ok, err := r.TryLock(ctx, "lock", "a", time.Second); !ok || err != nil {
+		t.Fatalf("a can not lock: %v", err)
+	}
+	// extending the lock renews its ttl
+	srv.FastForward(600 * time.Millisecond)
+	if ok, _ := r.TryLock(ctx, "lock", "a", time.Second); !ok {
+		t.Fatal("a can not extend its lock")
+	}
+	srv.FastForward(600 * time.Millisecond)
+	if ok, _ := r.TryLock(ctx, "lock", "b", time.Second); ok {
+		t.Fatal("b takes the extended lock of a")
+	}
+	srv.FastForward(time.Second)
+	if ok, _ := r.TryLock(ctx, "lock", "b", time.Second); !ok {
+		t.Fatal("b can not lock after the lock of a expired")
+	}
+	if ok, _ := r.TryLock(ctx, "lock", "a", time.Second); ok {
+		t.Fatal("a extends the lock it lost")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	srv, r := newTestRedis(t)
+	received := make(chan string, 10)
+	Handle("test", func(key string) {
+		received <- key
+	})
+	Init(r, "a", "test:")
+	defer Close()
+	if !Enabled() || !IsLeader() {
+		t.Fatal("the only node is not the leader")
+	}
+
+	other, err := NewRedis("redis://" + srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	ctx := context.Background()
+	if ok, _ := other.TryLock(ctx, Key("leader"), "b", LeaderTTL); ok {
+		t.Fatal("two nodes are leaders")
+	}
+
+	// wait for the subscription of node a
+	publish := func(node, key string) {
+		data, _ := utils.Json.Marshal(event{Node: node, Kind: "test", Key: key})
+		if err := other.Publish(ctx, Key("events"), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		publish("b", "ready")
+		select {
+		case <-received:
+		case <-time.After(50 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("no event received")
+			}
+			continue
+		}
+		break
+	}
+	publish("a", "own")
+	publish("b", "/x")
+	for key := ""; key != "/x"; {
+		select {
+		case key = <-received:
+			if key == "own" {
+				t.Fatal("own event is dispatched")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("event not received")
+		}
+	}
+
+	s := NewStore("dir")
+	s.Set("/x", []byte("1"), time.Now().Add(time.Minute))
+	s.Set("/x/y", []byte("2"), time.Now().Add(time.Minute))
+	if v, _, ok := s.Get("/x/y"); !ok || string(v) != "2" {
+		t.Fatal("store get failed")
+	}
+	s.DeletePrefix("/x")
+	if _, _, ok := s.Get("/x/y"); ok {
+		t.Fatal("store delete prefix failed")
+	}
+
+	c := NewLoginCounter()
+	c.Incr("1.2.3.4")
+	c.Incr("1.2.3.4")
+	if n, ok := c.Get("1.2.3.4"); !ok || n != 2 {
+		t.Fatalf("login count: %d", n)
+	}
+	c.Del("1.2.3.4")
+	if _, ok := c.Get("1.2.3.4"); ok {
+		t.Fatal("login count is not reset")
+	}
+}
+
+func TestRedisRLock(t *testing.T) {
+	ctx := context.Background()
+	srv, r := newTestRedis(t)
+	defer r.Close()
+
+	if ok, _ := r.TryRLock(ctx, "lock", "a", time.Second); !ok {
+		t.Fatal("a can not take a lease")
+	}
+	if ok, _ := r.TryLock(ctx, "lock", "gc", time.Minute); !ok {
+		t.Fatal("the lock is not taken while a lease is held")
+	}
+	if n, _ := r.Readers(ctx, "lock"); n != 1 {
+		t.Fatalf("%d readers, want 1", n)
+	}
+	// the lock waits for a, which still extends its lease, but no one else gets one
+	if ok, _ := r.TryRLock(ctx, "lock", "b", time.Second); ok {
+		t.Fatal("b takes a lease while the lock is held")
+	}
+	if ok, _ := r.TryRLock(ctx, "lock", "a", time.Second); !ok {
+		t.Fatal("a can not extend its lease")
+	}
+	_ = r.RUnlock(ctx, "lock", "a")
+	if n, _ := r.Readers(ctx, "lock"); n != 0 {
+		t.Fatalf("%d readers after the release", n)
+	}
+	_ = r.Unlock(ctx, "lock", "gc")
+
+	if ok, _ := r.TryRLock(ctx, "lock", "b", time.Second); !ok {
+		t.Fatal("b can not take a lease after the lock is released")
+	}
+	srv.FastForward(2 * time.Second)
+	if n, _ := r.Readers(ctx, "lock"); n != 0 {
+		t.Fatalf("%d readers after the lease expired", n)
+	}
+}
+
+func TestLockWaitsForLeases(t *testing.T) {
+	_, r := newTestRedis(t)
+	defer r.Close()
+	backend, nodeID, prefix, lockPoll = r, "a", "test:", 10*time.Millisecond
+	defer func() {
+		backend, lockPoll = nil, time.Second
+	}()
+
+	ctx := context.Background()
+	_, runlock, err := RLock(ctx, "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		_, unlock, err := Lock(ctx, "gc")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the lock is taken while a lease is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the lock is pending, so a new lease waits for it
+	rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, _, err = RLock(rctx, "gc"); err == nil {
+		t.Fatal("a lease is taken while the lock is pending")
+	}
+	runlock()
+	var unlock func()
+	select {
+	case unlock = <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock is not taken after the lease is released")
+	}
+	unlock()
+	if _, runlock, err = RLock(ctx, "gc"); err != nil {
+		t.Fatal(err)
+	}
+	runlock()
+}
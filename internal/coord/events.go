@@ -0,0 +1,98 @@
+package coord
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Resync is dispatched when the subscription is interrupted,
+// the events published until it is restored are lost so everything cached may be stale
+const Resync = "resync"
+
+type event struct {
+	Node string `json:"node"`
+	Kind string `json:"kind"`
+	Key  string `json:"key,omitempty"`
+}
+
+var (
+	events     chan event
+	handlersMu sync.RWMutex
+	handlers   = make(map[string][]func(key string))
+)
+
+// Handle registers fn for the events of kind published by the other nodes
+func Handle(kind string, fn func(key string)) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = append(handlers[kind], fn)
+}
+
+// Publish notifies the other nodes, it does not block and keeps the order of the events
+func Publish(kind, key string) {
+	if backend == nil {
+		return
+	}
+	select {
+	case events <- event{Node: nodeID, Kind: kind, Key: key}:
+	default:
+		log.Warnf("coordination event queue is full, drop %s event of %s", kind, key)
+	}
+}
+
+func dispatch(kind, key string) {
+	handlersMu.RLock()
+	fns := handlers[kind]
+	handlersMu.RUnlock()
+	for _, fn := range fns {
+		fn(key)
+	}
+}
+
+func publishLoop(ctx context.Context) {
+	channel := Key("events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			data, err := utils.Json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			pctx, cancel := context.WithTimeout(ctx, opTimeout)
+			err = backend.Publish(pctx, channel, data)
+			cancel()
+			if err != nil {
+				log.Warnf("failed publish %s event of %s: %+v", e.Kind, e.Key, err)
+			}
+		}
+	}
+}
+
+func subscribeLoop(ctx context.Context) {
+	channel := Key("events")
+	for {
+		err := backend.Subscribe(ctx, channel, func(msg []byte) {
+			var e event
+			if err := utils.Json.Unmarshal(msg, &e); err != nil || e.Node == nodeID {
+				return
+			}
+			dispatch(e.Kind, e.Key)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("coordination subscription interrupted, retry in 1s: %+v", err)
+		dispatch(Resync, "")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package coord
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// LockTTL is how long a lock or a shared lease lasts without being renewed
+const LockTTL = 30 * time.Second
+
+// lockPoll is the interval between the attempts to take a lock held by another node
+var lockPoll = time.Second
+
+var (
+	localLocksMu sync.Mutex
+	localLocks   = make(map[string]*sync.RWMutex)
+)
+
+func localLock(key string) *sync.RWMutex {
+	localLocksMu.Lock()
+	defer localLocksMu.Unlock()
+	l, ok := localLocks[key]
+	if !ok {
+		l = &sync.RWMutex{}
+		localLocks[key] = l
+	}
+	return l
+}
+
+// RLock takes a shared lease on key, held by any number of callers of every node but never together with Lock.
+// The lease is renewed until unlock is called, the returned context is canceled if it is lost meanwhile.
+func RLock(ctx context.Context, key string) (context.Context, func(), error) {
+	if backend == nil {
+		l := localLock(key)
+		l.RLock()
+		return ctx, l.RUnlock, nil
+	}
+	key, owner := Key(key), nodeID+"/"+random.String(16)
+	renew := func(ctx context.Context) (bool, error) {
+		return backend.TryRLock(ctx, key, owner, LockTTL)
+	}
+	if err := acquire(ctx, renew); err != nil {
+		return nil, nil, err
+	}
+	lockCtx, unlock := hold(ctx, key, renew, func(ctx context.Context) error {
+		return backend.RUnlock(ctx, key, owner)
+	})
+	return lockCtx, unlock, nil
+}
+
+// Lock takes key exclusively on every node, it waits for the shared leases to be released.
+// The lock is renewed until unlock is called, the returned context is canceled if it is lost meanwhile.
+func Lock(ctx context.Context, key string) (context.Context, func(), error) {
+	if backend == nil {
+		l := localLock(key)
+		l.Lock()
+		return ctx, l.Unlock, nil
+	}
+	key, owner := Key(key), nodeID+"/"+random.String(16)
+	renew := func(ctx context.Context) (bool, error) {
+		return backend.TryLock(ctx, key, owner, LockTTL)
+	}
+	if err := acquire(ctx, renew); err != nil {
+		return nil, nil, err
+	}
+	// no new lease is given from now on, the ones taken before are waited for
+	lockCtx, unlock := hold(ctx, key, renew, func(ctx context.Context) error {
+		return backend.Unlock(ctx, key, owner)
+	})
+	err := acquire(lockCtx, func(ctx context.Context) (bool, error) {
+		n, err := backend.Readers(ctx, key)
+		return n == 0, err
+	})
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return lockCtx, unlock, nil
+}
+
+// acquire calls try until it succeeds
+func acquire(ctx context.Context, try func(ctx context.Context) (bool, error)) error {
+	for {
+		tctx, cancel := context.WithTimeout(ctx, opTimeout)
+		ok, err := try(tctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// hold renews the lock until the returned func is called, and cancels the context if the renewal fails
+func hold(ctx context.Context, key string, renew func(ctx context.Context) (bool, error), release func(ctx context.Context) error) (context.Context, func()) {
+	lockCtx, cancel := context.WithCancel(ctx)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(LockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				rctx, rcancel := context.WithTimeout(context.Background(), opTimeout)
+				ok, err := renew(rctx)
+				rcancel()
+				if !ok || err != nil {
+					log.Warnf("lost lock %s: %+v", key, err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return lockCtx, func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+			cancel()
+			rctx, rcancel := context.WithTimeout(context.Background(), opTimeout)
+			defer rcancel()
+			if err := release(rctx); err != nil {
+				log.Warnf("failed release lock %s: %+v", key, err)
+			}
+		})
+	}
+}
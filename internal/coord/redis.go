@@ -0,0 +1,198 @@
+package coord
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is the Backend on a redis server
+type Redis struct {
+	client *redis.Client
+}
+
+var _ Backend = (*Redis)(nil)
+
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid redis url")
+	}
+	r := &Redis{client: redis.NewClient(opts)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = r.client.Ping(ctx).Err(); err != nil {
+		_ = r.client.Close()
+		return nil, errors.Wrapf(err, "failed connect redis %s", opts.Addr)
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return v, err == nil, errors.WithStack(err)
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errors.WithStack(r.client.Set(ctx, key, value, max(ttl, 0)).Err())
+}
+
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return errors.WithStack(r.client.Del(ctx, keys...).Err())
+}
+
+func (r *Redis) DelPrefix(ctx context.Context, prefix string) error {
+	iter := r.client.Scan(ctx, 0, globEscaper.Replace(prefix)+"*", 1000).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 1000 {
+			if err := r.Del(ctx, keys...); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return r.Del(ctx, keys...)
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if n == 1 && ttl > 0 {
+		err = r.Expire(ctx, key, ttl)
+	}
+	return n, err
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return errors.WithStack(r.client.PExpire(ctx, key, ttl).Err())
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, msg []byte) error {
+	return errors.WithStack(r.client.Publish(ctx, channel, msg).Err())
+}
+
+func (r *Redis) Subscribe(ctx context.Context, channel string, handler func(msg []byte)) error {
+	sub := r.client.Subscribe(ctx, channel)
+	// a blocking receive isn't interrupted by ctx, closing the subscription ends it
+	stop := context.AfterFunc(ctx, func() { _ = sub.Close() })
+	defer func() {
+		stop()
+		_ = sub.Close()
+	}()
+	// wait for the confirmation, so a failed connection is reported to the caller
+	if _, err := sub.Receive(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	for {
+		msg, err := sub.ReceiveMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		handler([]byte(msg.Payload))
+	}
+}
+
+// lockScript takes the lock if it is free and extends it if owner holds it, in one step
+var lockScript = redis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if cur == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// unlockScript deletes the lock only if owner holds it
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (r *Redis) TryLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := lockScript.Run(ctx, r.client, []string{key}, owner, ttl.Milliseconds()).Int()
+	return n == 1, errors.WithStack(err)
+}
+
+func (r *Redis) Unlock(ctx context.Context, key, owner string) error {
+	return errors.WithStack(unlockScript.Run(ctx, r.client, []string{key}, owner).Err())
+}
+
+// the shared leases of a key are the set KEYS[2] of their owners, each one with a key holding its ttl
+
+// rlockScript extends the lease of owner, or takes it if the lock is free
+var rlockScript = redis.NewScript(`
+local lease = KEYS[2] .. ":" .. ARGV[1]
+if redis.call("EXISTS", lease) == 0 and redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("SET", lease, 1, "PX", ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[1])
+return 1
+`)
+
+var runlockScript = redis.NewScript(`
+redis.call("DEL", KEYS[1] .. ":" .. ARGV[1])
+return redis.call("SREM", KEYS[1], ARGV[1])
+`)
+
+// readersScript drops the expired leases and counts the others
+var readersScript = redis.NewScript(`
+local n = 0
+for _, owner in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+	if redis.call("EXISTS", KEYS[1] .. ":" .. owner) == 1 then
+		n = n + 1
+	else
+		redis.call("SREM", KEYS[1], owner)
+	end
+end
+return n
+`)
+
+func readersKey(key string) string {
+	return key + ":readers"
+}
+
+func (r *Redis) TryRLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := rlockScript.Run(ctx, r.client, []string{key, readersKey(key)}, owner, ttl.Milliseconds()).Int()
+	return n == 1, errors.WithStack(err)
+}
+
+func (r *Redis) RUnlock(ctx context.Context, key, owner string) error {
+	return errors.WithStack(runlockScript.Run(ctx, r.client, []string{readersKey(key)}, owner).Err())
+}
+
+func (r *Redis) Readers(ctx context.Context, key string) (int64, error) {
+	n, err := readersScript.Run(ctx, r.client, []string{readersKey(key)}).Int64()
+	return n, errors.WithStack(err)
+}
+
+func (r *Redis) Close() error {
+	return errors.WithStack(r.client.Close())
+}
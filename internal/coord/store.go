@@ -0,0 +1,143 @@
+package coord
+
+import (
+	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store is a cache.Store on the backend, the values are stored with their expiration time
+type Store struct {
+	ns string
+}
+
+var _ cache.Store = (*Store)(nil)
+
+// NewStore returns the store of the namespace, which is a part of the keys
+func NewStore(namespace string) *Store {
+	return &Store{ns: namespace + ":"}
+}
+
+func (s *Store) key(key string) string {
+	return Key(s.ns + key)
+}
+
+func (s *Store) Get(key string) ([]byte, time.Time, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	v, ok, err := backend.Get(ctx, s.key(key))
+	if err != nil {
+		log.Warnf("failed get %s from shared cache: %+v", key, err)
+	}
+	if !ok || len(v) < 8 {
+		return nil, time.Time{}, false
+	}
+	exp := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+	if time.Now().After(exp) {
+		return nil, exp, false
+	}
+	return v[8:], exp, true
+}
+
+func (s *Store) Set(key string, data []byte, exp time.Time) {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return
+	}
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(exp.UnixNano()))
+	copy(v[8:], data)
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := backend.Set(ctx, s.key(key), v, ttl); err != nil {
+		log.Warnf("failed set %s to shared cache: %+v", key, err)
+	}
+}
+
+func (s *Store) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := backend.Del(ctx, s.key(key)); err != nil {
+		log.Warnf("failed delete %s from shared cache: %+v", key, err)
+	}
+}
+
+func (s *Store) DeletePrefix(key string) {
+	s.Delete(key)
+	if len(key) == 0 || key[len(key)-1] != '/' {
+		key += "/"
+	}
+	s.deletePrefix(key)
+}
+
+func (s *Store) Clear() {
+	s.deletePrefix("")
+}
+
+func (s *Store) deletePrefix(prefix string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := backend.DelPrefix(ctx, s.key(prefix)); err != nil {
+		log.Warnf("failed delete %s from shared cache: %+v", prefix, err)
+	}
+}
+
+// loginCounter is the model.LoginCounter on the backend,
+// the counters of the ips which never reach the limit expire after a day
+type loginCounter struct{}
+
+var _ model.LoginCounter = loginCounter{}
+
+const loginCounterTTL = 24 * time.Hour
+
+// NewLoginCounter returns the counter of failed logins shared by the nodes
+func NewLoginCounter() model.LoginCounter {
+	return loginCounter{}
+}
+
+func (loginCounter) key(ip string) string {
+	return Key("login:" + ip)
+}
+
+func (c loginCounter) Get(ip string) (int, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	v, ok, err := backend.Get(ctx, c.key(ip))
+	if err != nil {
+		log.Warnf("failed get login count of %s: %+v", ip, err)
+	}
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(v))
+	return n, err == nil
+}
+
+func (c loginCounter) Incr(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if _, err := backend.Incr(ctx, c.key(ip), loginCounterTTL); err != nil {
+		log.Warnf("failed count login of %s: %+v", ip, err)
+	}
+}
+
+func (c loginCounter) Expire(ip string, d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := backend.Expire(ctx, c.key(ip), d); err != nil {
+		log.Warnf("failed expire login count of %s: %+v", ip, err)
+	}
+}
+
+func (c loginCounter) Del(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := backend.Del(ctx, c.key(ip)); err != nil {
+		log.Warnf("failed reset login count of %s: %+v", ip, err)
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// davPropsInTree returns the props of the object at path and of the objects under it
+func davPropsInTree(tx *gorm.DB, path string) ([]model.DavProp, error) {
+	var props []model.DavProp
+	q := tx.Model(&model.DavProp{})
+	if path != "/" {
+		q = q.Where(fmt.Sprintf("%s = ?", columnName("path")), path).
+			Or(fmt.Sprintf("%s LIKE ?", columnName("path")), path+"/%")
+	}
+	if err := q.Find(&props).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if path == "/" {
+		return props, nil
+	}
+	// LIKE also matches the paths where the _ or % of path is another character
+	res := props[:0]
+	for _, p := range props {
+		if p.Path == path || strings.HasPrefix(p.Path, path+"/") {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func deleteDavProps(tx *gorm.DB, props []model.DavProp) error {
+	if len(props) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(props))
+	for i := range props {
+		ids[i] = props[i].ID
+	}
+	return errors.WithStack(tx.Delete(&model.DavProp{}, ids).Error)
+}
+
+func GetDavProps(path string) ([]model.DavProp, error) {
+	var props []model.DavProp
+	if err := db.Where(fmt.Sprintf("%s = ?", columnName("path")), path).Order(columnName("id")).Find(&props).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return props, nil
+}
+
+// PatchDavProps sets and removes the props of the object at path, either all or none are applied
+func PatchDavProps(path string, set, remove []model.DavProp) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range append(remove, set...) {
+			err := tx.Where(map[string]interface{}{"path": path, "namespace": p.Namespace, "name": p.Name}).
+				Delete(&model.DavProp{}).Error
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		for _, p := range set {
+			p.ID = 0
+			p.Path = path
+			if err := tx.Create(&p).Error; err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+// MoveDavProps moves the props of the object at src and of the objects under it to dst,
+// the props already under dst are dropped
+func MoveDavProps(src, dst string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		old, err := davPropsInTree(tx, dst)
+		if err != nil {
+			return err
+		}
+		if err = deleteDavProps(tx, old); err != nil {
+			return err
+		}
+		props, err := davPropsInTree(tx, src)
+		if err != nil {
+			return err
+		}
+		for _, p := range props {
+			newPath := dst + strings.TrimPrefix(p.Path, src)
+			if err = tx.Model(&p).Update("path", newPath).Error; err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteDavProps removes the props of the object at path and of the objects under it
+func DeleteDavProps(path string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		props, err := davPropsInTree(tx, path)
+		if err != nil {
+			return err
+		}
+		return deleteDavProps(tx, props)
+	})
+}
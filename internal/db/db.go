@@ -12,20 +12,26 @@ var db *gorm.DB
 
 func Init(d *gorm.DB) {
 	db = d
-	err := AutoMigrate(new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey), new(model.SharingDB))
+	err := AutoMigrate(Models()...)
 	if err != nil {
 		log.Fatalf("failed migrate database: %s", err.Error())
 	}
 }
 
+// Models returns the models of all tables created by Init
+func Models() []interface{} {
+	return []interface{}{new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey), new(model.SharingDB), new(model.WatchRule), new(model.WatchHandled), new(model.UploadSession), new(model.DavProp), new(model.S3ObjectMeta), new(model.S3ObjectVersion)}
+}
+
 func AutoMigrate(dst ...interface{}) error {
-	var err error
-	if conf.Conf.Database.Type == "mysql" {
-		err = db.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8mb4").AutoMigrate(dst...)
-	} else {
-		err = db.AutoMigrate(dst...)
+	return autoMigrate(db, conf.Conf.Database.Type, dst...)
+}
+
+func autoMigrate(d *gorm.DB, dbType string, dst ...interface{}) error {
+	if dbType == "mysql" {
+		return d.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8mb4").AutoMigrate(dst...)
 	}
-	return err
+	return d.AutoMigrate(dst...)
 }
 
 func GetDb() *gorm.DB {
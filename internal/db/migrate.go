@@ -0,0 +1,137 @@
+package db
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MigrateDB is one side of a migration, Type is sqlite3, mysql or postgres
+type MigrateDB struct {
+	DB   *gorm.DB
+	Type string
+}
+
+type MigrateOptions struct {
+	// DryRun only counts the rows and checks that the target tables are empty
+	DryRun bool
+	// Clean deletes the rows of the target tables first instead of refusing to copy into them
+	Clean     bool
+	BatchSize int
+}
+
+type MigrateTable struct {
+	Table  string `json:"table"`
+	Source int64  `json:"source"`
+	Target int64  `json:"target"`
+}
+
+// Migrate copies the tables of Models from src to dst keeping the primary keys.
+// The table names are resolved by the naming strategy of each side, so the table prefixes may differ.
+// The rows are copied in a single transaction which is rolled back if a row count does not match.
+func Migrate(src, dst MigrateDB, opts MigrateOptions) ([]MigrateTable, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	models := Models()
+	tables := make([]MigrateTable, len(models))
+	for i, m := range models {
+		t := &tables[i]
+		var err error
+		if t.Table, err = tableName(dst.DB, m); err != nil {
+			return nil, err
+		}
+		if err = src.DB.Model(m).Count(&t.Source).Error; err != nil {
+			return nil, errors.Wrapf(err, "failed count source table of %s", t.Table)
+		}
+		if !dst.DB.Migrator().HasTable(m) {
+			continue
+		}
+		if err = dst.DB.Model(m).Count(&t.Target).Error; err != nil {
+			return nil, errors.Wrapf(err, "failed count table %s", t.Table)
+		}
+		if t.Target > 0 && !opts.Clean {
+			return tables[:i+1], errors.Errorf("table %s of the target has %d rows, clean it first", t.Table, t.Target)
+		}
+	}
+	if opts.DryRun {
+		return tables, nil
+	}
+	if err := autoMigrate(dst.DB, dst.Type, models...); err != nil {
+		return nil, errors.Wrap(err, "failed migrate target tables")
+	}
+	err := dst.DB.Transaction(func(tx *gorm.DB) error {
+		for i, m := range models {
+			t := &tables[i]
+			if opts.Clean {
+				if err := DeleteAll(tx, m); err != nil {
+					return errors.WithMessagef(err, "failed clean table %s", t.Table)
+				}
+			}
+			if err := copyTable(src.DB, tx, m, opts.BatchSize); err != nil {
+				return errors.WithMessagef(err, "failed copy table %s", t.Table)
+			}
+			if err := tx.Model(m).Count(&t.Target).Error; err != nil {
+				return errors.Wrapf(err, "failed count table %s", t.Table)
+			}
+			if t.Target != t.Source {
+				return errors.Errorf("table %s has %d rows after copy, but %d in the source", t.Table, t.Target, t.Source)
+			}
+			if err := FixSequence(tx, m); err != nil {
+				return errors.WithMessagef(err, "failed fix sequence of table %s", t.Table)
+			}
+			log.Infof("copied %d rows of table %s", t.Target, t.Table)
+		}
+		return nil
+	})
+	return tables, err
+}
+
+func tableName(d *gorm.DB, m interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: d}
+	if err := stmt.Parse(m); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return stmt.Schema.Table, nil
+}
+
+// copyTable streams the rows of the model from src and inserts them into dst in batches
+func copyTable(src, dst *gorm.DB, m interface{}, batchSize int) error {
+	rows, err := src.Model(m).Rows()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	typ := reflect.TypeOf(m).Elem()
+	batch := reflect.MakeSlice(reflect.SliceOf(typ), 0, batchSize)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		ptr := reflect.New(batch.Type())
+		ptr.Elem().Set(batch)
+		if err := CreateAll(dst, ptr.Interface()); err != nil {
+			return err
+		}
+		batch = batch.Slice(0, 0)
+		return nil
+	}
+	for rows.Next() {
+		item := reflect.New(typ)
+		if err = src.ScanRows(rows, item.Interface()); err != nil {
+			return errors.WithStack(err)
+		}
+		batch = reflect.Append(batch, item.Elem())
+		if batch.Len() >= batchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return flush()
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func openSqlite(t *testing.T, name, prefix string) *gorm.DB {
+	d, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{TablePrefix: prefix},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMigrate(t *testing.T) {
+	conf.Conf = conf.DefaultConfig("data")
+	src := MigrateDB{DB: openSqlite(t, "src.db", "x_"), Type: "sqlite3"}
+	dst := MigrateDB{DB: openSqlite(t, "dst.db", "y_"), Type: "sqlite3"}
+	if err := autoMigrate(src.DB, src.Type, Models()...); err != nil {
+		t.Fatal(err)
+	}
+	users := []model.User{{ID: 3, Username: "a"}, {ID: 8, Username: "b", Disabled: true}}
+	if err := CreateAll(src.DB, &users); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateAll(src.DB, &model.Meta{ID: 5, Path: "/a", ReadUsers: []uint{3, 8}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := Migrate(src, dst, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.DB.Migrator().HasTable(&model.User{}) {
+		t.Fatal("dry run created the target tables")
+	}
+	if tables, err = Migrate(src, dst, MigrateOptions{BatchSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int64)
+	for _, table := range tables {
+		if table.Source != table.Target {
+			t.Errorf("table %s has %d rows, %d in the source", table.Table, table.Target, table.Source)
+		}
+		counts[table.Table] = table.Target
+	}
+	if counts["y_users"] != 2 || counts["y_meta"] != 1 {
+		t.Errorf("unexpected row counts: %v", counts)
+	}
+	var b model.User
+	if err = dst.DB.Where(columnName("username")+" = ?", "b").Take(&b).Error; err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 8 || !b.Disabled {
+		t.Errorf("unexpected copied user: %+v", b)
+	}
+	// new rows get ids past the copied ones
+	c := model.User{Username: "c"}
+	if err = dst.DB.Create(&c).Error; err != nil {
+		t.Fatal(err)
+	}
+	if c.ID <= 8 {
+		t.Errorf("new user got id %d, which may be taken", c.ID)
+	}
+
+	if _, err = Migrate(src, dst, MigrateOptions{}); err == nil {
+		t.Error("copied into a target having rows")
+	}
+	if _, err = Migrate(src, dst, MigrateOptions{Clean: true}); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err = dst.DB.Model(&model.User{}).Count(&n).Error; err != nil || n != 2 {
+		t.Errorf("expected the 2 users of the source after clean, got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// s3ObjectMetaInTree returns the paths of the object at path and of the objects under it which have S3 metadata
+func s3ObjectMetaInTree(tx *gorm.DB, path string) ([]string, error) {
+	var paths []string
+	q := tx.Model(&model.S3ObjectMeta{})
+	if path != "/" {
+		q = q.Where(fmt.Sprintf("%s = ?", columnName("path")), path).
+			Or(fmt.Sprintf("%s LIKE ?", columnName("path")), path+"/%")
+	}
+	if err := q.Pluck("path", &paths).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if path == "/" {
+		return paths, nil
+	}
+	// LIKE also matches the paths where the _ or % of path is another character
+	res := paths[:0]
+	for _, p := range paths {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+func GetS3ObjectMeta(path string) (*model.S3ObjectMeta, error) {
+	var m model.S3ObjectMeta
+	if err := db.Where(fmt.Sprintf("%s = ?", columnName("path")), path).First(&m).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get s3 object meta")
+	}
+	return &m, nil
+}
+
+func SaveS3ObjectMeta(m *model.S3ObjectMeta) error {
+	return errors.WithStack(db.Save(m).Error)
+}
+
+// MoveS3ObjectMeta moves the S3 metadata of the object at src and of the objects under it to dst,
+// the metadata already under dst is dropped
+func MoveS3ObjectMeta(src, dst string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		old, err := s3ObjectMetaInTree(tx, dst)
+		if err != nil {
+			return err
+		}
+		if len(old) > 0 {
+			if err = tx.Delete(&model.S3ObjectMeta{}, fmt.Sprintf("%s IN ?", columnName("path")), old).Error; err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		paths, err := s3ObjectMetaInTree(tx, src)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			err = tx.Model(&model.S3ObjectMeta{}).Where(fmt.Sprintf("%s = ?", columnName("path")), p).Update("path", dst+strings.TrimPrefix(p, src)).Error
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteS3ObjectMeta removes the S3 metadata of the object at path and of the objects under it
+func DeleteS3ObjectMeta(path string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		paths, err := s3ObjectMetaInTree(tx, path)
+		if err != nil || len(paths) == 0 {
+			return err
+		}
+		return errors.WithStack(tx.Delete(&model.S3ObjectMeta{}, fmt.Sprintf("%s IN ?", columnName("path")), paths).Error)
+	})
+}
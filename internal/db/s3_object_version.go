@@ -0,0 +1,51 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+)
+
+func CreateS3ObjectVersion(v *model.S3ObjectVersion) error {
+	return errors.WithStack(db.Create(v).Error)
+}
+
+func GetS3ObjectVersion(path, versionID string) (*model.S3ObjectVersion, error) {
+	var v model.S3ObjectVersion
+	err := db.Where(fmt.Sprintf("%s = ? AND %s = ?", columnName("path"), columnName("version_id")), path, versionID).First(&v).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed get s3 object version")
+	}
+	return &v, nil
+}
+
+// GetS3ObjectVersions returns the noncurrent versions and the delete markers of the object at path, the newest first
+func GetS3ObjectVersions(path string) ([]model.S3ObjectVersion, error) {
+	var versions []model.S3ObjectVersion
+	err := db.Where(fmt.Sprintf("%s = ?", columnName("path")), path).Order(fmt.Sprintf("%s DESC", columnName("id"))).Find(&versions).Error
+	return versions, errors.WithStack(err)
+}
+
+// GetS3ObjectVersionsByPrefix returns the versions of the objects whose paths start with prefix, sorted by path and the newest first
+func GetS3ObjectVersionsByPrefix(prefix string) ([]model.S3ObjectVersion, error) {
+	var versions []model.S3ObjectVersion
+	err := db.Where(fmt.Sprintf("%s LIKE ?", columnName("path")), prefix+"%").
+		Order(fmt.Sprintf("%s, %s DESC", columnName("path"), columnName("id"))).Find(&versions).Error
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// LIKE also matches the paths where the _ or % of prefix is another character
+	res := versions[:0]
+	for _, v := range versions {
+		if strings.HasPrefix(v.Path, prefix) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func DeleteS3ObjectVersion(id uint) error {
+	return errors.WithStack(db.Delete(&model.S3ObjectVersion{}, id).Error)
+}
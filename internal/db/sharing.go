@@ -4,6 +4,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
 	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
 func GetSharingById(id string) (*model.SharingDB, error) {
@@ -37,20 +38,29 @@ func GetSharingsByCreatorId(creator uint, pageIndex, pageSize int) (sharings []m
 	return sharings, count, nil
 }
 
+// NewSharingId returns a random id that no sharing has yet
+func NewSharingId(tx *gorm.DB) (string, error) {
+	id := random.String(8)
+	for len(id) < 12 {
+		old := model.SharingDB{
+			ID: id,
+		}
+		if err := tx.Where(old).First(&old).Error; err != nil {
+			return id, nil
+		}
+		id += random.String(1)
+	}
+	return "", errors.New("failed find valid id")
+}
+
 func CreateSharing(s *model.SharingDB) (string, error) {
 	if s.ID == "" {
-		id := random.String(8)
-		for len(id) < 12 {
-			old := model.SharingDB{
-				ID: id,
-			}
-			if err := db.Where(old).First(&old).Error; err != nil {
-				s.ID = id
-				return id, errors.WithStack(db.Create(s).Error)
-			}
-			id += random.String(1)
+		id, err := NewSharingId(db)
+		if err != nil {
+			return "", err
 		}
-		return "", errors.New("failed find valid id")
+		s.ID = id
+		return id, errors.WithStack(db.Create(s).Error)
 	} else {
 		query := model.SharingDB{ID: s.ID}
 		if err := db.Where(query).First(&query).Error; err == nil {
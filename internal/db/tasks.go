@@ -4,6 +4,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
 func GetTaskDataByType(type_s string) (*model.TaskItem, error) {
@@ -15,20 +16,51 @@ func GetTaskDataByType(type_s string) (*model.TaskItem, error) {
 }
 
 func UpdateTaskData(t *model.TaskItem) error {
-	return errors.WithStack(db.Model(&model.TaskItem{}).Where("key = ?", t.Key).Update("persist_data", t.PersistData).Error)
+	return errors.WithStack(db.Model(&model.TaskItem{}).Where(columnName("key")+" = ?", t.Key).Update("persist_data", t.PersistData).Error)
 }
 
 func CreateTaskData(t *model.TaskItem) error {
 	return errors.WithStack(db.Create(t).Error)
 }
 
+// MoveTaskData hands the persisted tasks of the key from to the key to, if to has none yet.
+// When several instances try at once, only one of them gets the tasks.
+func MoveTaskData(from, to string) error {
+	return errors.WithStack(db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(columnName("key")+" = ?", to).First(&model.TaskItem{}).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var src model.TaskItem
+		err = tx.Where(columnName("key")+" = ?", from).First(&src).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		res := tx.Model(&model.TaskItem{}).Where(columnName("key")+" = ? AND "+columnName("persist_data")+" = ?", from, src.PersistData).Update("persist_data", "[]")
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// taken by another instance meanwhile
+			src.PersistData = "[]"
+		}
+		return tx.Create(&model.TaskItem{Key: to, PersistData: src.PersistData}).Error
+	}))
+}
+
 func GetTaskDataFunc(type_s string, enabled bool) func() ([]byte, error) {
 	if !enabled {
 		return nil
 	}
 	task, err := GetTaskDataByType(type_s)
 	if err != nil {
-		return nil
+		// the keys of the nodes of a cluster are created on first start
+		task = &model.TaskItem{Key: type_s, PersistData: "[]"}
+		if err = CreateTaskData(task); err != nil {
+			return nil
+		}
 	}
 	return func() ([]byte, error) {
 		<-conf.StoragesLoadSignal()
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+)
+
+func GetUploadSessionById(id string) (*model.UploadSession, error) {
+	s := model.UploadSession{ID: id}
+	if err := db.Where(s).First(&s).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get upload session")
+	}
+	return &s, nil
+}
+
+func CreateUploadSession(s *model.UploadSession) error {
+	return errors.WithStack(db.Create(s).Error)
+}
+
+func UpdateUploadSession(s *model.UploadSession) error {
+	return errors.WithStack(db.Save(s).Error)
+}
+
+func DeleteUploadSessionById(id string) error {
+	return errors.WithStack(db.Delete(&model.UploadSession{ID: id}).Error)
+}
+
+func GetExpiredUploadSessions(now time.Time) ([]model.UploadSession, error) {
+	var sessions []model.UploadSession
+	if err := db.Where(fmt.Sprintf("%s < ?", columnName("expires_at")), now).Find(&sessions).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sessions, nil
+}
+
+func GetUploadSessionIds() ([]string, error) {
+	var ids []string
+	if err := db.Model(&model.UploadSession{}).Pluck("id", &ids).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ids, nil
+}
@@ -2,9 +2,14 @@ package db
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 func columnName(name string) string {
@@ -17,3 +22,101 @@ func columnName(name string) string {
 func addStorageOrder(db *gorm.DB) *gorm.DB {
 	return db.Order(fmt.Sprintf("%s, %s", columnName("order"), columnName("id")))
 }
+
+// CreateAll inserts the record, or the records of a slice, with all fields except omit.
+// gorm writes the default of a field with a default tag instead of its zero value even if it is selected,
+// so the records having such fields zero are updated afterwards.
+func CreateAll(tx *gorm.DB, value interface{}, omit ...string) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return errors.WithStack(err)
+	}
+	var defaults []*schema.Field
+	for _, field := range stmt.Schema.Fields {
+		if field.DefaultValueInterface != nil {
+			defaults = append(defaults, field)
+		}
+	}
+	var items []reflect.Value
+	if rv := reflect.Indirect(reflect.ValueOf(value)); rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, reflect.Indirect(rv.Index(i)))
+		}
+	} else {
+		items = append(items, rv)
+	}
+	zeros := make([][]string, len(items))
+	for i, item := range items {
+		for _, field := range defaults {
+			if _, isZero := field.ValueOf(tx.Statement.Context, item); isZero {
+				zeros[i] = append(zeros[i], field.Name)
+			}
+		}
+	}
+	if err := tx.Select("*").Omit(omit...).Create(value).Error; err != nil {
+		return errors.WithStack(err)
+	}
+	for i, item := range items {
+		if len(zeros[i]) == 0 {
+			continue
+		}
+		for _, name := range zeros[i] {
+			field := stmt.Schema.LookUpField(name)
+			if err := field.Set(tx.Statement.Context, item, reflect.Zero(field.FieldType).Interface()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		ptr := item.Addr().Interface()
+		if err := tx.Model(ptr).Select(zeros[i]).Updates(ptr).Error; err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// TakeWhere reads into dest the first record whose columns equal the values, it reports whether there is one
+func TakeWhere(tx *gorm.DB, dest interface{}, columns map[string]interface{}) (bool, error) {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	q := tx
+	for _, name := range names {
+		q = q.Where(columnName(name)+" = ?", columns[name])
+	}
+	err := q.Take(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, errors.WithStack(err)
+}
+
+// Save updates the record with all fields, or inserts it if there is none with its primary key
+func Save(tx *gorm.DB, value interface{}) error {
+	return errors.WithStack(tx.Save(value).Error)
+}
+
+// DeleteAll deletes all records of the model
+func DeleteAll(tx *gorm.DB, value interface{}) error {
+	return errors.WithStack(tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(value).Error)
+}
+
+// FixSequence moves the sequence of an auto increment id past the ids in the table,
+// postgres does not advance it when ids are inserted explicitly, the other databases do
+func FixSequence(tx *gorm.DB, value interface{}) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return errors.WithStack(err)
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil || (field.DataType != schema.Uint && field.DataType != schema.Int) {
+		return nil
+	}
+	table := stmt.Schema.Table
+	return errors.WithStack(tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE((SELECT MAX(?) FROM ?), 0) + 1, false)",
+		table, field.DBName, clause.Column{Name: field.DBName}, clause.Table{Name: table}).Error)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetWatchRuleById(id uint) (*model.WatchRule, error) {
+	var r model.WatchRule
+	if err := db.First(&r, id).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get watch rule")
+	}
+	return &r, nil
+}
+
+func CreateWatchRule(r *model.WatchRule) error {
+	return errors.WithStack(db.Create(r).Error)
+}
+
+func UpdateWatchRule(r *model.WatchRule) error {
+	return errors.WithStack(db.Save(r).Error)
+}
+
+func GetWatchRules(pageIndex, pageSize int) (rules []model.WatchRule, count int64, err error) {
+	ruleDB := db.Model(&model.WatchRule{})
+	if err = ruleDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get watch rules count")
+	}
+	if err = ruleDB.Order(columnName("id")).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&rules).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get find watch rules")
+	}
+	return rules, count, nil
+}
+
+func GetEnabledWatchRules() ([]model.WatchRule, error) {
+	var rules []model.WatchRule
+	if err := db.Where(fmt.Sprintf("%s = ?", columnName("disabled")), false).Find(&rules).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rules, nil
+}
+
+func DeleteWatchRuleById(id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.WatchRule{}, id).Error; err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(tx.Where(fmt.Sprintf("%s = ?", columnName("rule_id")), id).Delete(&model.WatchHandled{}).Error)
+	})
+}
+
+func GetWatchHandled(ruleID uint) ([]model.WatchHandled, error) {
+	var handled []model.WatchHandled
+	if err := db.Where(fmt.Sprintf("%s = ?", columnName("rule_id")), ruleID).Find(&handled).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get handled files of watch rule")
+	}
+	return handled, nil
+}
+
+func SaveWatchHandled(handled []model.WatchHandled) error {
+	if len(handled) == 0 {
+		return nil
+	}
+	return errors.WithStack(db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(handled, 100).Error)
+}
+
+func DeleteWatchHandled(ruleID uint, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	for chunk := range slices.Chunk(paths, 500) {
+		err := db.Where(fmt.Sprintf("%s = ? AND %s IN ?", columnName("rule_id"), columnName("path")), ruleID, chunk).
+			Delete(&model.WatchHandled{}).Error
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -10,12 +10,14 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
 	"github.com/OpenListTeam/OpenList/v4/internal/task_group"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/OpenListTeam/tache"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -43,7 +45,9 @@ const (
 type FileTransferTask struct {
 	TaskData
 	TaskType taskType
-	groupID  string
+	// TransferID is shared by the tasks of one copy or move, the tasks of the objects in a folder inherit it
+	TransferID string `json:"transfer_id"`
+	groupID    string
 }
 
 func (t *FileTransferTask) GetName() string {
@@ -110,21 +114,31 @@ func transfer(ctx context.Context, taskType taskType, srcObjPath, dstDirPath str
 		return nil, errors.WithMessage(err, "failed get dst storage")
 	}
 
+	// a pending write-back upload is put to the destination instead, the ones in a folder follow it
+	dstObjPath := stdpath.Join(dstDirPath, stdpath.Base(srcObjPath))
+	keepStaged := taskType != move
+	if ok, err := transferStaged(ctx, srcObjPath, dstObjPath, keepStaged); ok || err != nil {
+		return nil, err
+	}
+
 	if srcStorage.GetStorage() == dstStorage.GetStorage() {
 		if utils.IsBool(skipHook...) {
 			ctx = context.WithValue(ctx, conf.SkipHookKey, struct{}{})
 		}
 		if taskType == copy || taskType == merge {
 			err = op.Copy(ctx, srcStorage, srcObjActualPath, dstDirActualPath)
-			if !errors.Is(err, errs.NotImplement) && !errors.Is(err, errs.NotSupport) {
-				return nil, err
-			}
 		} else {
 			err = op.Move(ctx, srcStorage, srcObjActualPath, dstDirActualPath)
-			if !errors.Is(err, errs.NotImplement) && !errors.Is(err, errs.NotSupport) {
-				return nil, err
-			}
 		}
+		if err == nil {
+			return nil, transferStagedUnder(ctx, srcObjPath, dstObjPath, keepStaged)
+		}
+		if !errors.Is(err, errs.NotImplement) && !errors.Is(err, errs.NotSupport) {
+			return nil, err
+		}
+	}
+	if err = transferStagedUnder(ctx, srcObjPath, dstObjPath, keepStaged); err != nil {
+		return nil, err
 	}
 
 	// not in the same storage
@@ -137,7 +151,8 @@ func transfer(ctx context.Context, taskType taskType, srcObjPath, dstDirPath str
 			SrcStorageMp:  srcStorage.GetStorage().MountPath,
 			DstStorageMp:  dstStorage.GetStorage().MountPath,
 		},
-		TaskType: taskType,
+		TaskType:   taskType,
+		TransferID: uuid.NewString(),
 	}
 
 	t.groupID = stdpath.Join(t.DstStorageMp, t.DstActualPath)
@@ -234,7 +249,8 @@ func (t *FileTransferTask) RunWithNextTaskCallback(f func(nextTask *FileTransfer
 					SrcStorageMp:  t.SrcStorageMp,
 					DstStorageMp:  t.DstStorageMp,
 				},
-				groupID: t.groupID,
+				TransferID: t.TransferID,
+				groupID:    t.groupID,
 			})
 			if err != nil {
 				return err
@@ -259,8 +275,29 @@ func (t *FileTransferTask) RunWithNextTaskCallback(f func(nextTask *FileTransfer
 		return errors.WithMessagef(err, "failed get [%s] stream", t.SrcActualPath)
 	}
 	t.SetTotalBytes(ss.GetSize())
+	verify := setting.GetBool(conf.TaskVerifyTransfer)
+	var hasher *utils.MultiHasher
+	if verify && len(srcObj.GetHash().Export()) == 0 {
+		// the source is hashed while it is uploaded, so it isn't downloaded again to verify
+		hasher = utils.NewMultiHasher([]*utils.HashType{utils.MD5, utils.SHA1, utils.SHA256})
+		ss.Tee(hasher)
+	}
 	t.Status = "uploading"
-	return op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.DstStorage, t.DstActualPath, ss, t.SetProgress)
+	err = op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.DstStorage, t.DstActualPath, ss, t.SetProgress)
+	if err != nil || !verify {
+		return err
+	}
+	t.Status = "verifying"
+	// the hashes are complete only if the driver read the whole stream once, not in ranges
+	if hasher != nil && hasher.Size() == srcObj.GetSize() {
+		srcObj = &model.Object{
+			Name:     srcObj.GetName(),
+			Size:     srcObj.GetSize(),
+			Modified: srcObj.ModTime(),
+			HashInfo: *hasher.GetHashInfo(),
+		}
+	}
+	return t.verifyTransfer(srcObj)
 }
 
 var (
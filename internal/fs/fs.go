@@ -3,6 +3,7 @@ package fs
 import (
 	"context"
 	"io"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/pkg/errors"
 )
 
@@ -108,6 +110,19 @@ func Remove(ctx context.Context, path string) error {
 	return err
 }
 
+// SetModTime sets the modification time of the object, errs.NotImplement is returned if the storage can't
+func SetModTime(ctx context.Context, path string, modified time.Time) error {
+	// a pending write-back upload is put with the new time
+	if setStagedModTime(utils.FixAndCleanPath(path), modified) {
+		return nil
+	}
+	storage, actualPath, err := op.GetStorageAndActualPath(path)
+	if err != nil {
+		return errors.WithMessage(err, "failed get storage")
+	}
+	return op.SetModTime(ctx, storage, actualPath, modified)
+}
+
 func PutDirectly(ctx context.Context, dstDirPath string, file model.FileStreamer, skipHook ...bool) error {
 	err := putDirectly(ctx, dstDirPath, file, skipHook...)
 	if err != nil {
@@ -116,8 +131,13 @@ func PutDirectly(ctx context.Context, dstDirPath string, file model.FileStreamer
 	return err
 }
 
-func PutAsTask(ctx context.Context, dstDirPath string, file model.FileStreamer) (task.TaskExtensionInfo, error) {
-	t, err := putAsTask(ctx, dstDirPath, file)
+// PutAsTask adds a task putting the file, onSucceeded is called once the file is put
+func PutAsTask(ctx context.Context, dstDirPath string, file model.FileStreamer, onSucceeded ...func()) (task.TaskExtensionInfo, error) {
+	var f func()
+	if len(onSucceeded) > 0 {
+		f = onSucceeded[0]
+	}
+	t, err := putAsTask(ctx, dstDirPath, file, f)
 	if err != nil {
 		log.Errorf("failed put %s: %+v", dstDirPath, err)
 	}
@@ -22,6 +22,9 @@ func get(ctx context.Context, path string, args *GetArgs) (model.Obj, error) {
 			}
 		}
 	}
+	if obj, ok := getStagedObj(path); ok {
+		return obj, nil
+	}
 	storage, actualPath, err := op.GetStorageAndActualPath(path)
 	if err != nil {
 		// if there are no storage prefix with path, maybe root folder
@@ -39,6 +39,8 @@ func list(ctx context.Context, path string, args *ListArgs) ([]model.Obj, error)
 		}
 	}
 
+	_objs = model.HideS3Versions(mergeStaged(path, _objs))
+
 	om := model.NewObjMerge()
 	if whetherHide(user, meta, path) {
 		om.InitHideReg(meta.Hide)
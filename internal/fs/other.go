@@ -2,6 +2,7 @@ package fs
 
 import (
 	"context"
+	stdpath "path"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
@@ -28,7 +29,15 @@ func rename(ctx context.Context, srcPath, dstName string, skipHook ...bool) erro
 	if utils.IsBool(skipHook...) {
 		ctx = context.WithValue(ctx, conf.SkipHookKey, struct{}{})
 	}
-	return op.Rename(ctx, storage, srcActualPath, dstName)
+	dstPath := stdpath.Join(stdpath.Dir(utils.FixAndCleanPath(srcPath)), dstName)
+	// a pending upload is put to the new name instead
+	if ok, err := transferStaged(ctx, srcPath, dstPath, false); ok || err != nil {
+		return err
+	}
+	if err = op.Rename(ctx, storage, srcActualPath, dstName); err != nil {
+		return err
+	}
+	return transferStagedUnder(ctx, srcPath, dstPath, false)
 }
 
 func remove(ctx context.Context, path string) error {
@@ -36,6 +45,8 @@ func remove(ctx context.Context, path string) error {
 	if err != nil {
 		return errors.WithMessage(err, "failed get storage")
 	}
+	// a pending upload is dropped, an older version on the storage is removed as well
+	cancelStaged(utils.FixAndCleanPath(path))
 	return op.Remove(ctx, storage, actualPath)
 }
 
@@ -25,6 +25,10 @@ type UploadTask struct {
 	storage          driver.Driver
 	dstDirActualPath string
 	file             model.FileStreamer
+	// staged is set for a write-back upload, the content is read from the staged file on each run
+	staged *stagedUpload
+	// onSucceeded is called once the file is put
+	onSucceeded func()
 }
 
 func (t *UploadTask) GetName() string {
@@ -39,10 +43,27 @@ func (t *UploadTask) Run() error {
 	t.ClearEndTime()
 	t.SetStartTime(time.Now())
 	defer func() { t.SetEndTime(time.Now()) }()
-	return op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.storage, t.dstDirActualPath, t.file, t.SetProgress)
+	file := t.file
+	if t.staged != nil {
+		// replaced by a newer upload or removed
+		if !t.staged.current() {
+			return nil
+		}
+		var err error
+		if file, err = t.staged.open(); err != nil {
+			return err
+		}
+	}
+	return op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.storage, t.dstDirActualPath, file, t.SetProgress)
 }
 
 func (t *UploadTask) OnSucceeded() {
+	if t.staged != nil {
+		t.staged.done()
+	}
+	if t.onSucceeded != nil {
+		t.onSucceeded()
+	}
 	task_group.TransferCoordinator.Done(context.WithoutCancel(t.Ctx()), stdpath.Join(t.storage.GetStorage().MountPath, t.dstDirActualPath), true)
 }
 
@@ -61,7 +82,7 @@ func (t *UploadTask) SetRetry(retry int, maxRetry int) {
 var UploadTaskManager *tache.Manager[*UploadTask]
 
 // putAsTask add as a put task and return immediately
-func putAsTask(ctx context.Context, dstDirPath string, file model.FileStreamer) (task.TaskExtensionInfo, error) {
+func putAsTask(ctx context.Context, dstDirPath string, file model.FileStreamer, onSucceeded func()) (task.TaskExtensionInfo, error) {
 	storage, dstDirActualPath, err := op.GetStorageAndActualPath(dstDirPath)
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed get storage")
@@ -86,6 +107,7 @@ func putAsTask(ctx context.Context, dstDirPath string, file model.FileStreamer)
 		storage:          storage,
 		dstDirActualPath: dstDirActualPath,
 		file:             file,
+		onSucceeded:      onSucceeded,
 	}
 	t.SetTotalBytes(file.GetSize())
 	task_group.TransferCoordinator.AddTask(stdpath.Join(storage.GetStorage().MountPath, dstDirActualPath), nil)
@@ -0,0 +1,295 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/tache"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// hashObj computes the hash of the object by reading its content
+func hashObj(ctx context.Context, storage driver.Driver, actualPath string, ht *utils.HashType) (string, error) {
+	link, obj, err := op.Link(ctx, storage, actualPath, model.LinkArgs{})
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed get [%s] link", actualPath)
+	}
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Obj: obj, Ctx: ctx}, link)
+	if err != nil {
+		_ = link.Close()
+		return "", errors.WithMessagef(err, "failed get [%s] stream", actualPath)
+	}
+	defer ss.Close()
+	return utils.HashReader(ht, ss, obj.GetSize())
+}
+
+type verifySide struct {
+	storage    driver.Driver
+	actualPath string
+	obj        model.Obj
+}
+
+func (s verifySide) hash(ctx context.Context, ht *utils.HashType) (string, error) {
+	if v := s.obj.GetHash().GetHash(ht); v != "" {
+		return v, nil
+	}
+	return hashObj(ctx, s.storage, s.actualPath, ht)
+}
+
+// compareObj returns a description of the difference between two files, or an empty string if they match.
+// Size and a hash reported by both sides are always compared, if deep is true and the two sides
+// have no hash type in common, the missing hash is computed from the content.
+func compareObj(ctx context.Context, src, dst verifySide, deep bool) (string, error) {
+	if src.obj.GetSize() != dst.obj.GetSize() {
+		return fmt.Sprintf("size mismatch: %d != %d", src.obj.GetSize(), dst.obj.GetSize()), nil
+	}
+	dstHash := dst.obj.GetHash()
+	var ht *utils.HashType
+	for t, v := range src.obj.GetHash().All() {
+		if d := dstHash.GetHash(t); d != "" {
+			if !strings.EqualFold(v, d) {
+				return fmt.Sprintf("%s mismatch: %s != %s", t.Name, v, d), nil
+			}
+			return "", nil
+		}
+		ht = t
+	}
+	if !deep {
+		return "", nil
+	}
+	for t := range dstHash.All() {
+		ht = t
+		break
+	}
+	if ht == nil {
+		ht = utils.MD5
+	}
+	sv, err := src.hash(ctx, ht)
+	if err != nil {
+		return "", err
+	}
+	dv, err := dst.hash(ctx, ht)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(sv, dv) {
+		return fmt.Sprintf("%s mismatch: %s != %s", ht.Name, sv, dv), nil
+	}
+	return "", nil
+}
+
+// getFresh gets the object bypassing the cache, so what the driver really stored is checked
+func getFresh(ctx context.Context, storage driver.Driver, actualPath string) (model.Obj, error) {
+	dir, name := stdpath.Split(actualPath)
+	objs, err := op.List(ctx, storage, dir, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.GetName() == name {
+			return obj, nil
+		}
+	}
+	return nil, errors.WithStack(errs.ObjectNotFound)
+}
+
+// verifyTransfer checks the uploaded file against the source, the destination is removed on mismatch
+// so a retry of the task uploads it again
+func (t *FileTransferTask) verifyTransfer(srcObj model.Obj) error {
+	dstPath := stdpath.Join(t.DstActualPath, srcObj.GetName())
+	dstObj, err := getFresh(t.Ctx(), t.DstStorage, dstPath)
+	if err != nil {
+		return errors.WithMessagef(err, "failed get uploaded [%s] file", dstPath)
+	}
+	diff, err := compareObj(t.Ctx(),
+		verifySide{storage: t.SrcStorage, actualPath: t.SrcActualPath, obj: srcObj},
+		verifySide{storage: t.DstStorage, actualPath: dstPath, obj: dstObj}, true)
+	if err != nil {
+		return errors.WithMessage(err, "failed verify")
+	}
+	if diff == "" {
+		return nil
+	}
+	if err = op.Remove(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.DstStorage, dstPath); err != nil {
+		log.Warnf("failed remove corrupted [%s]: %+v", dstPath, err)
+	}
+	return errors.Errorf("verify [%s] failed, %s", dstPath, diff)
+}
+
+type VerifyDiff struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type VerifyReport struct {
+	Checked int          `json:"checked"`
+	Missing []string     `json:"missing"`
+	Extra   []string     `json:"extra"`
+	Differ  []VerifyDiff `json:"differ"`
+}
+
+// VerifyTask compares two directory trees and reports missing, extra and differing files
+type VerifyTask struct {
+	task.TaskExtension
+	Status  string `json:"-"`
+	SrcPath string `json:"src_path"`
+	DstPath string `json:"dst_path"`
+	// Deep computes hashes from content when both sides have no hash type in common
+	Deep bool `json:"deep"`
+
+	mu     sync.Mutex
+	report VerifyReport
+}
+
+func (t *VerifyTask) GetName() string {
+	return fmt.Sprintf("verify [%s] against [%s]", t.DstPath, t.SrcPath)
+}
+
+func (t *VerifyTask) GetStatus() string {
+	return t.Status
+}
+
+// GetReport returns a copy of the current report, it grows while the task is running
+func (t *VerifyTask) GetReport() VerifyReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.report
+	r.Missing = append([]string(nil), r.Missing...)
+	r.Extra = append([]string(nil), r.Extra...)
+	r.Differ = append([]VerifyDiff(nil), r.Differ...)
+	return r
+}
+
+func (t *VerifyTask) Run() error {
+	t.ClearEndTime()
+	t.SetStartTime(time.Now())
+	defer func() { t.SetEndTime(time.Now()) }()
+	t.mu.Lock()
+	t.report = VerifyReport{}
+	t.mu.Unlock()
+	srcStorage, srcActualPath, err := op.GetStorageAndActualPath(t.SrcPath)
+	if err != nil {
+		return errors.WithMessage(err, "failed get src storage")
+	}
+	dstStorage, dstActualPath, err := op.GetStorageAndActualPath(t.DstPath)
+	if err != nil {
+		return errors.WithMessage(err, "failed get dst storage")
+	}
+	if err = t.verifyDir(srcStorage, srcActualPath, dstStorage, dstActualPath, "/"); err != nil {
+		return err
+	}
+	r := t.GetReport()
+	t.Status = fmt.Sprintf("checked %d files, %d missing, %d extra, %d differ", r.Checked, len(r.Missing), len(r.Extra), len(r.Differ))
+	return nil
+}
+
+func (t *VerifyTask) verifyDir(srcStorage driver.Driver, srcDir string, dstStorage driver.Driver, dstDir, rel string) error {
+	t.Status = fmt.Sprintf("comparing %s", rel)
+	srcObjs, err := op.List(t.Ctx(), srcStorage, srcDir, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return errors.WithMessagef(err, "failed list src [%s]", srcDir)
+	}
+	dstObjs, err := op.List(t.Ctx(), dstStorage, dstDir, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return errors.WithMessagef(err, "failed list dst [%s]", dstDir)
+	}
+	dstMap := make(map[string]model.Obj, len(dstObjs))
+	for _, obj := range dstObjs {
+		dstMap[obj.GetName()] = obj
+	}
+	for _, srcObj := range srcObjs {
+		if err := t.Ctx().Err(); err != nil {
+			return err
+		}
+		name := srcObj.GetName()
+		p := stdpath.Join(rel, name)
+		dstObj, ok := dstMap[name]
+		delete(dstMap, name)
+		if !ok || dstObj.IsDir() != srcObj.IsDir() {
+			t.addMissing(p)
+			if ok {
+				t.addExtra(p)
+			}
+			continue
+		}
+		if srcObj.IsDir() {
+			err = t.verifyDir(srcStorage, stdpath.Join(srcDir, name), dstStorage, stdpath.Join(dstDir, name), p)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		diff, err := compareObj(t.Ctx(),
+			verifySide{storage: srcStorage, actualPath: stdpath.Join(srcDir, name), obj: srcObj},
+			verifySide{storage: dstStorage, actualPath: stdpath.Join(dstDir, name), obj: dstObj}, t.Deep)
+		if err != nil {
+			diff = err.Error()
+		}
+		t.addChecked(p, diff)
+	}
+	for name := range dstMap {
+		t.addExtra(stdpath.Join(rel, name))
+	}
+	return nil
+}
+
+func (t *VerifyTask) addMissing(p string) {
+	t.mu.Lock()
+	t.report.Missing = append(t.report.Missing, p)
+	t.mu.Unlock()
+}
+
+func (t *VerifyTask) addExtra(p string) {
+	t.mu.Lock()
+	t.report.Extra = append(t.report.Extra, p)
+	t.mu.Unlock()
+}
+
+func (t *VerifyTask) addChecked(p, diff string) {
+	t.mu.Lock()
+	t.report.Checked++
+	if diff != "" {
+		t.report.Differ = append(t.report.Differ, VerifyDiff{Path: p, Reason: diff})
+	}
+	t.mu.Unlock()
+}
+
+// VerifyTree adds a task comparing the tree of dstPath with srcPath
+func VerifyTree(ctx context.Context, srcPath, dstPath string, deep bool) (task.TaskExtensionInfo, error) {
+	for _, p := range []string{srcPath, dstPath} {
+		obj, err := Get(ctx, p, &GetArgs{NoLog: true})
+		if err != nil {
+			return nil, err
+		}
+		if !obj.IsDir() {
+			return nil, errors.WithStack(errs.NotFolder)
+		}
+	}
+	t := &VerifyTask{
+		TaskExtension: task.TaskExtension{
+			ApiUrl: common.GetApiUrl(ctx),
+		},
+		SrcPath: srcPath,
+		DstPath: dstPath,
+		Deep:    deep,
+	}
+	t.Creator, _ = ctx.Value(conf.UserKey).(*model.User)
+	VerifyTaskManager.Add(t)
+	return t, nil
+}
+
+var VerifyTaskManager *tache.Manager[*VerifyTask]
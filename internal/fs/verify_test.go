@@ -0,0 +1,37 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+func TestCompareObj(t *testing.T) {
+	side := func(size int64, hi utils.HashInfo) verifySide {
+		return verifySide{obj: &model.Object{Name: "a.bin", Size: size, HashInfo: hi}}
+	}
+	md5 := func(v string) utils.HashInfo { return utils.NewHashInfo(utils.MD5, v) }
+	tests := []struct {
+		name     string
+		src, dst verifySide
+		differ   bool
+	}{
+		{"size mismatch", side(10, md5("aa")), side(9, md5("aa")), true},
+		{"hash mismatch", side(10, md5("aa")), side(10, md5("bb")), true},
+		{"hash case insensitive", side(10, md5("aa")), side(10, md5("AA")), false},
+		{"no common hash", side(10, md5("aa")), side(10, utils.NewHashInfo(utils.SHA1, "cc")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := compareObj(context.Background(), tt.src, tt.dst, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (diff != "") != tt.differ {
+				t.Errorf("unexpected result %q", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/internal/task_group"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/tache"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// WriteBackDirName is the folder in the temp dir holding the write-back uploads, it is kept by CleanTempDir.
+// Each upload is a .data file with the content and a .json file describing it,
+// they are queued again after a restart until the put succeeds.
+const WriteBackDirName = "write_back"
+
+var WriteBackTaskManager *tache.Manager[*UploadTask]
+
+type stagedUpload struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Mimetype string    `json:"mimetype"`
+	Creator  string    `json:"creator"`
+	id       string
+	taskID   string
+	// moved is set once the upload is staged to another path, a put finishing afterwards is removed again
+	moved bool
+	// the time the running put uses, Modified is set on the storage after the put if it changed since
+	putModified time.Time
+}
+
+var (
+	stagedMu sync.Mutex
+	// staged uploads by destination path, a newer upload to the same path replaces the older one
+	staged = make(map[string]*stagedUpload)
+)
+
+func writeBackDir() string {
+	return filepath.Join(conf.Conf.TempDir, WriteBackDirName)
+}
+
+func (u *stagedUpload) dataFile() string {
+	return filepath.Join(writeBackDir(), u.id+".data")
+}
+
+func (u *stagedUpload) metaFile() string {
+	return filepath.Join(writeBackDir(), u.id+".json")
+}
+
+func (u *stagedUpload) object() model.Obj {
+	return &model.Object{
+		Path:     u.Path,
+		Name:     stdpath.Base(u.Path),
+		Size:     u.Size,
+		Modified: u.Modified,
+		Ctime:    u.Modified,
+		Mask:     model.Pending,
+	}
+}
+
+func (u *stagedUpload) current() bool {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	return staged[u.Path] == u
+}
+
+// open returns the stream of the staged content for a run of the upload task
+func (u *stagedUpload) open() (model.FileStreamer, error) {
+	f, err := os.Open(u.dataFile())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	stagedMu.Lock()
+	obj := u.object()
+	u.putModified = u.Modified
+	stagedMu.Unlock()
+	s := &stream.FileStream{
+		Obj:          obj,
+		Mimetype:     u.Mimetype,
+		WebPutAsTask: true,
+		Reader:       f,
+	}
+	s.Add(f)
+	return s, nil
+}
+
+func (u *stagedUpload) removeFiles() {
+	for _, name := range []string{u.dataFile(), u.metaFile()} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed remove staged upload %s: %+v", name, err)
+		}
+	}
+}
+
+// cancel stops the task of an upload which is no longer registered
+func (u *stagedUpload) cancel() {
+	stagedMu.Lock()
+	id := u.taskID
+	stagedMu.Unlock()
+	WriteBackTaskManager.Cancel(id)
+	u.removeFiles()
+}
+
+// done drops the upload after the put succeeded
+func (u *stagedUpload) done() {
+	stagedMu.Lock()
+	if staged[u.Path] == u {
+		delete(staged, u.Path)
+	}
+	modified, changed, moved := u.Modified, !u.Modified.Equal(u.putModified), u.moved
+	stagedMu.Unlock()
+	u.removeFiles()
+	if moved {
+		if err := removeStorageObj(context.Background(), u.Path); err != nil {
+			log.Warnf("failed remove %s put after it was moved: %+v", u.Path, err)
+		}
+		return
+	}
+	if changed {
+		if err := SetModTime(context.Background(), u.Path, modified); err != nil && !errors.Is(err, errs.NotImplement) {
+			log.Warnf("failed set modification time of %s: %+v", u.Path, err)
+		}
+	}
+}
+
+// IsWriteBack reports whether the uploads to the dir are staged and put in the background
+func IsWriteBack(dstDirPath string) bool {
+	storage, _, err := op.GetStorageAndActualPath(dstDirPath)
+	return err == nil && storage.GetStorage().WriteBack && !storage.Config().NoUpload && WriteBackTaskManager != nil
+}
+
+// CreateStageFile creates the file the content of a write-back upload is written to
+func CreateStageFile() (*os.File, error) {
+	if err := os.MkdirAll(writeBackDir(), 0o700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f, err := os.CreateTemp(writeBackDir(), "*.data")
+	return f, errors.WithStack(err)
+}
+
+// CommitStage syncs the file created by CreateStageFile to the disk and queues the put to dstPath,
+// the file is closed and owned by the stage afterwards
+func CommitStage(ctx context.Context, dstPath string, f *os.File, modified time.Time, mimetype string) error {
+	err := f.Sync()
+	var info os.FileInfo
+	if err == nil {
+		info, err = f.Stat()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if mimetype == "" {
+		mimetype = utils.GetMimeType(dstPath)
+	}
+	u := &stagedUpload{
+		Path:     utils.FixAndCleanPath(dstPath),
+		Size:     info.Size(),
+		Modified: modified,
+		Mimetype: mimetype,
+		id:       strings.TrimSuffix(filepath.Base(f.Name()), ".data"),
+	}
+	if user, ok := ctx.Value(conf.UserKey).(*model.User); ok {
+		u.Creator = user.Username
+	}
+	if err = writeStageMeta(u); err != nil {
+		u.removeFiles()
+		return err
+	}
+	if err = stage(ctx, u); err != nil {
+		u.removeFiles()
+		return err
+	}
+	return nil
+}
+
+// StageUpload writes the content to a staged file and queues the put to dstPath,
+// size is checked if it is not negative
+func StageUpload(ctx context.Context, dstPath string, r io.Reader, size int64, modified time.Time, mimetype string) error {
+	f, err := CreateStageFile()
+	if err != nil {
+		return err
+	}
+	n, err := utils.CopyWithBuffer(f, r)
+	if err == nil && size >= 0 && n != size {
+		err = errors.Errorf("received %d bytes, expected %d", n, size)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.WithMessage(err, "failed stage upload")
+	}
+	return CommitStage(ctx, dstPath, f, modified, mimetype)
+}
+
+func writeStageMeta(u *stagedUpload) error {
+	data, err := utils.Json.Marshal(u)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(u.metaFile(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.WithStack(err)
+}
+
+// stage registers the upload and adds its task, an older upload to the same path is canceled
+func stage(ctx context.Context, u *stagedUpload) error {
+	dstDirPath := stdpath.Dir(u.Path)
+	storage, dstDirActualPath, err := op.GetStorageAndActualPath(dstDirPath)
+	if err != nil {
+		return errors.WithMessage(err, "failed get storage")
+	}
+	taskCreator, _ := ctx.Value(conf.UserKey).(*model.User)
+	t := &UploadTask{
+		TaskExtension: task.TaskExtension{
+			Creator: taskCreator,
+			ApiUrl:  common.GetApiUrl(ctx),
+		},
+		storage:          storage,
+		dstDirActualPath: dstDirActualPath,
+		file:             &stream.FileStream{Obj: u.object(), Mimetype: u.Mimetype},
+		staged:           u,
+	}
+	t.SetTotalBytes(u.Size)
+	task_group.TransferCoordinator.AddTask(stdpath.Join(storage.GetStorage().MountPath, dstDirActualPath), nil)
+	stagedMu.Lock()
+	old := staged[u.Path]
+	staged[u.Path] = u
+	WriteBackTaskManager.Add(t)
+	u.taskID = t.GetID()
+	stagedMu.Unlock()
+	if old != nil {
+		old.cancel()
+	}
+	op.Cache.DeleteDirectory(storage, dstDirActualPath)
+	return nil
+}
+
+// setStagedModTime changes the time a pending write-back upload is put with, it reports whether there is one
+func setStagedModTime(path string, modified time.Time) bool {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	u, ok := staged[path]
+	if !ok {
+		return false
+	}
+	u.Modified = modified
+	if err := writeStageMeta(u); err != nil {
+		log.Warnf("failed update staged upload %s: %+v", u.id, err)
+	}
+	return true
+}
+
+func getStaged(path string) (*stagedUpload, bool) {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	u, ok := staged[path]
+	return u, ok
+}
+
+func getStagedObj(path string) (model.Obj, bool) {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	if u, ok := staged[path]; ok {
+		return u.object(), true
+	}
+	return nil, false
+}
+
+// stagedObjs returns the pending uploads in the dir
+func stagedObjs(dirPath string) []model.Obj {
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	var objs []model.Obj
+	for p, u := range staged {
+		if stdpath.Dir(p) == dirPath {
+			objs = append(objs, u.object())
+		}
+	}
+	return objs
+}
+
+// mergeStaged shows the pending uploads in the listing, replacing the objects they overwrite
+func mergeStaged(dirPath string, objs []model.Obj) []model.Obj {
+	pending := stagedObjs(utils.FixAndCleanPath(dirPath))
+	if len(pending) == 0 {
+		return objs
+	}
+	names := make(map[string]int, len(objs))
+	for i, obj := range objs {
+		names[obj.GetName()] = i
+	}
+	for _, obj := range pending {
+		if i, ok := names[obj.GetName()]; ok {
+			objs[i] = obj
+		} else {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// stagedLink reads the content of a pending upload
+func stagedLink(u *stagedUpload) (*model.Link, model.Obj, error) {
+	f, err := os.Open(u.dataFile())
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	link := &model.Link{
+		RangeReader:   stream.GetRangeReaderFromMFile(u.Size, f),
+		ContentLength: u.Size,
+	}
+	link.Add(f)
+	stagedMu.Lock()
+	defer stagedMu.Unlock()
+	return link, u.object(), nil
+}
+
+// cancelStaged drops the pending upload to path, it reports whether there was one
+func cancelStaged(path string) bool {
+	stagedMu.Lock()
+	u, ok := staged[path]
+	delete(staged, path)
+	stagedMu.Unlock()
+	if ok {
+		u.cancel()
+	}
+	return ok
+}
+
+var errStagedDone = errors.New("staged upload is done")
+
+// transferStaged stages the content of the pending upload to srcPath to dstPath, it reports whether there is one.
+// Unless keep is set the upload is moved, the version of srcPath on the storage, if any, is removed.
+func transferStaged(ctx context.Context, srcPath, dstPath string, keep bool) (bool, error) {
+	u, ok := getStaged(utils.FixAndCleanPath(srcPath))
+	if !ok {
+		return false, nil
+	}
+	err := restage(ctx, u, utils.FixAndCleanPath(dstPath), keep)
+	if errors.Is(err, errStagedDone) {
+		// the put finished meanwhile, the object is on the storage
+		return false, nil
+	}
+	if err != nil || keep {
+		return true, err
+	}
+	return true, removeStorageObj(ctx, u.Path)
+}
+
+// transferStagedUnder stages the pending uploads in the folder srcDir to the same paths in dstDir,
+// it is called once the folder itself is copied or moved on the storage
+func transferStagedUnder(ctx context.Context, srcDir, dstDir string, keep bool) error {
+	srcDir, dstDir = utils.FixAndCleanPath(srcDir), utils.FixAndCleanPath(dstDir)
+	stagedMu.Lock()
+	var pending []*stagedUpload
+	for p, u := range staged {
+		if strings.HasPrefix(p, srcDir+"/") {
+			pending = append(pending, u)
+		}
+	}
+	stagedMu.Unlock()
+	for _, u := range pending {
+		err := restage(ctx, u, stdpath.Join(dstDir, strings.TrimPrefix(u.Path, srcDir)), keep)
+		if err != nil && !errors.Is(err, errStagedDone) {
+			return err
+		}
+	}
+	return nil
+}
+
+// restage queues a new upload of the content of u to dstPath, the data file is taken over unless keep is set
+func restage(ctx context.Context, u *stagedUpload, dstPath string, keep bool) error {
+	f, err := CreateStageFile()
+	if err != nil {
+		return err
+	}
+	stagedMu.Lock()
+	if staged[u.Path] != u {
+		stagedMu.Unlock()
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errStagedDone
+	}
+	modified, mimetype := u.Modified, u.Mimetype
+	var src *os.File
+	if keep {
+		// the open file stays readable if the put finishes and removes it
+		src, err = os.Open(u.dataFile())
+	} else if err = os.Rename(u.dataFile(), f.Name()); err == nil {
+		delete(staged, u.Path)
+		u.moved = true
+	}
+	stagedMu.Unlock()
+	if err == nil && keep {
+		_, err = utils.CopyWithBuffer(f, src)
+		_ = src.Close()
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if !keep {
+		// the handle still refers to the empty file replaced by the rename
+		_ = f.Close()
+		if f, err = os.OpenFile(f.Name(), os.O_RDWR, 0); err != nil {
+			return errors.WithStack(err)
+		}
+		WriteBackTaskManager.Cancel(u.taskID)
+		if err = os.Remove(u.metaFile()); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed remove staged upload %s: %+v", u.metaFile(), err)
+		}
+	}
+	return CommitStage(ctx, dstPath, f, modified, mimetype)
+}
+
+func removeStorageObj(ctx context.Context, path string) error {
+	storage, actualPath, err := op.GetStorageAndActualPath(path)
+	if err != nil {
+		return errors.WithMessage(err, "failed get storage")
+	}
+	return op.Remove(context.WithValue(ctx, conf.SkipHookKey, struct{}{}), storage, actualPath)
+}
+
+// RecoverStaged queues the write-back uploads left by the last run once the storages are loaded
+func RecoverStaged() {
+	entries, err := os.ReadDir(writeBackDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("failed list staged uploads: %+v", err)
+		}
+		return
+	}
+	<-conf.StoragesLoadSignal()
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		u := &stagedUpload{id: strings.TrimSuffix(e.Name(), ".json")}
+		data, err := os.ReadFile(u.metaFile())
+		if err == nil {
+			err = utils.Json.Unmarshal(data, u)
+		}
+		if err == nil {
+			_, err = os.Stat(u.dataFile())
+		}
+		if err != nil {
+			log.Errorf("drop broken staged upload %s: %+v", u.id, err)
+			u.removeFiles()
+			continue
+		}
+		ctx := context.Background()
+		if user, err := op.GetUserByName(u.Creator); err == nil {
+			ctx = context.WithValue(ctx, conf.UserKey, user)
+		}
+		if err = stage(ctx, u); err != nil {
+			log.Errorf("failed queue staged upload to %s: %+v", u.Path, err)
+			continue
+		}
+		log.Infof("queued staged upload to %s again", u.Path)
+	}
+	// the data files without description were not committed
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".data") {
+			if _, err := os.Stat(filepath.Join(writeBackDir(), strings.TrimSuffix(name, ".data")+".json")); os.IsNotExist(err) {
+				_ = os.Remove(filepath.Join(writeBackDir(), name))
+			}
+		}
+	}
+}
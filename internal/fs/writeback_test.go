@@ -0,0 +1,174 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/tache"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+// TestMain keeps one temp dir, a write-back upload may still be finishing when the next test starts
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fs_test")
+	if err != nil {
+		panic(err)
+	}
+	conf.Conf.TempDir = dir
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestMergeStaged(t *testing.T) {
+	staged["/a/b.txt"] = &stagedUpload{Path: "/a/b.txt", Size: 3}
+	staged["/a/c.txt"] = &stagedUpload{Path: "/a/c.txt", Size: 5}
+	staged["/a/d/e.txt"] = &stagedUpload{Path: "/a/d/e.txt"}
+	defer clear(staged)
+
+	objs := mergeStaged("/a/", []model.Obj{
+		&model.Object{Name: "b.txt", Size: 1},
+		&model.Object{Name: "d", IsFolder: true},
+	})
+	if len(objs) != 3 {
+		t.Fatalf("got %d objects, want 3", len(objs))
+	}
+	sizes := map[string]int64{}
+	for _, obj := range objs {
+		if obj.GetName() != "d" && !model.ObjHasMask(obj, model.Pending) {
+			t.Errorf("%s is not marked pending", obj.GetName())
+		}
+		sizes[obj.GetName()] = obj.GetSize()
+	}
+	if sizes["b.txt"] != 3 || sizes["c.txt"] != 5 {
+		t.Errorf("pending uploads are not listed: %v", sizes)
+	}
+}
+
+// newWriteBackStorage mounts a local storage at /<test name> whose write-back uploads wait until the returned func is called
+func newWriteBackStorage(t *testing.T) (context.Context, string, string, func()) {
+	root := t.TempDir()
+	mount := "/" + t.Name()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: mount, Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	WriteBackTaskManager = tache.NewManager[*UploadTask](tache.WithWorks(1), tache.WithRunning(false))
+	ctx := context.WithValue(context.Background(), conf.UserKey, &model.User{ID: 1, Role: model.ADMIN})
+	return ctx, root, mount, WriteBackTaskManager.Start
+}
+
+func stageFile(t *testing.T, ctx context.Context, path, content string) {
+	t.Helper()
+	if err := StageUpload(ctx, path, strings.NewReader(content), int64(len(content)), time.Now(), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitPut waits for the content to be put to p and for the staged files to be removed
+func waitPut(t *testing.T, p, content string) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(p)
+		entries, _ := os.ReadDir(writeBackDir())
+		pending := len(entries)
+		if err == nil && string(data) == content && pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not uploaded, got %q, %d pending: %v", p, data, pending, err)
+		}
+	}
+}
+
+func TestRenameStaged(t *testing.T) {
+	ctx, root, mount, start := newWriteBackStorage(t)
+	// an older version is on the storage
+	if err := os.WriteFile(filepath.Join(root, "a.tmp"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stageFile(t, ctx, mount+"/a.tmp", "hello")
+	if err := Rename(ctx, mount+"/a.tmp", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := Get(ctx, mount+"/a.txt", &GetArgs{})
+	if err != nil || obj.GetSize() != 5 || !model.ObjHasMask(obj, model.Pending) {
+		t.Fatalf("the renamed upload is not pending: %v %v", obj, err)
+	}
+	start()
+	waitPut(t, filepath.Join(root, "a.txt"), "hello")
+	if _, err = os.Stat(filepath.Join(root, "a.tmp")); !os.IsNotExist(err) {
+		t.Errorf("the old name is still on the storage: %v", err)
+	}
+}
+
+func TestMoveStaged(t *testing.T) {
+	ctx, root, mount, start := newWriteBackStorage(t)
+	if err := os.MkdirAll(filepath.Join(root, "dst"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stageFile(t, ctx, mount+"/a.txt", "hello")
+	ctx = context.WithValue(ctx, conf.NoTaskKey, struct{}{})
+	if _, err := Move(ctx, mount+"/a.txt", mount+"/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getStaged(mount + "/a.txt"); ok {
+		t.Error("the upload is still staged to the source")
+	}
+	start()
+	waitPut(t, filepath.Join(root, "dst", "a.txt"), "hello")
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("the source is put as well: %v", err)
+	}
+}
+
+func TestRenameFolderWithStaged(t *testing.T) {
+	ctx, root, mount, start := newWriteBackStorage(t)
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stageFile(t, ctx, mount+"/dir/a.txt", "hello")
+	if err := Rename(ctx, mount+"/dir", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	waitPut(t, filepath.Join(root, "renamed", "a.txt"), "hello")
+	if _, err := os.Stat(filepath.Join(root, "dir")); !os.IsNotExist(err) {
+		t.Errorf("the upload is put to the old folder: %v", err)
+	}
+}
+
+func TestCopyStaged(t *testing.T) {
+	ctx, root, mount, start := newWriteBackStorage(t)
+	if err := os.MkdirAll(filepath.Join(root, "dst"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stageFile(t, ctx, mount+"/a.txt", "hello")
+	ctx = context.WithValue(ctx, conf.NoTaskKey, struct{}{})
+	if _, err := Copy(ctx, mount+"/a.txt", mount+"/dst"); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	waitPut(t, filepath.Join(root, "dst", "a.txt"), "hello")
+	waitPut(t, filepath.Join(root, "a.txt"), "hello")
+}
@@ -0,0 +1,219 @@
+// Package metrics collects the prometheus metrics exposed on /metrics
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/tache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "openlist"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route group, method and status code.",
+	}, []string{"group", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time until the response of HTTP requests is complete, by route group.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"group"})
+	sessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions",
+		Help:      "Open FTP and SFTP sessions.",
+	}, []string{"protocol"})
+	driverDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "driver_call_duration_seconds",
+		Help:      "Latency of driver calls, by driver and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"driver", "op"})
+	driverErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "driver_call_errors_total",
+		Help:      "Failed driver calls, by driver and operation.",
+	}, []string{"driver", "op"})
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Lookups of the directory and link caches, by result.",
+	}, []string{"cache", "result"})
+	limiterBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "bytes_total"),
+		"Bytes passed through the bandwidth limiters.",
+		[]string{"limiter"}, nil)
+	limiterSpeed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "limit_bytes_per_second"),
+		"Configured speed of the bandwidth limiters, negative means unlimited.",
+		[]string{"limiter"}, nil)
+	readCacheBlocks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "read_cache", "blocks_total"),
+		"Blocks of proxied content read from the read cache or the upstream, by result.",
+		[]string{"result"}, nil)
+	readCacheSize = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "read_cache", "size_bytes"),
+		"Size of the blocks kept by the read cache.",
+		nil, nil)
+	taskDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tasks"),
+		"Tasks held by the task managers, by state.",
+		[]string{"manager", "state"}, nil)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, sessions, driverDuration, driverErrors, cacheLookups,
+		limiterCollector{}, readCacheCollector{}, tasks,
+	)
+}
+
+// Handler serves the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// methods are the request methods counted by name, the others are counted as other to bound the label values
+var methods = map[string]struct{}{
+	"GET": {}, "HEAD": {}, "POST": {}, "PUT": {}, "PATCH": {}, "DELETE": {}, "OPTIONS": {},
+	"PROPFIND": {}, "PROPPATCH": {}, "MKCOL": {}, "COPY": {}, "MOVE": {}, "LOCK": {}, "UNLOCK": {},
+}
+
+func methodLabel(method string) string {
+	if _, ok := methods[method]; ok {
+		return method
+	}
+	return "other"
+}
+
+func ObserveRequest(group, method string, code int, d time.Duration) {
+	httpRequests.WithLabelValues(group, methodLabel(method), strconv.Itoa(code)).Inc()
+	httpDuration.WithLabelValues(group).Observe(d.Seconds())
+}
+
+func SessionOpened(protocol string) {
+	sessions.WithLabelValues(protocol).Inc()
+}
+
+func SessionClosed(protocol string) {
+	sessions.WithLabelValues(protocol).Dec()
+}
+
+// ObserveDriverCall records a call of op on driver started at start
+func ObserveDriverCall(driver, op string, start time.Time, err error) {
+	driverDuration.WithLabelValues(driver, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		driverErrors.WithLabelValues(driver, op).Inc()
+	}
+}
+
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// limiterCollector reads the counters of the limiters in stream when scraped
+type limiterCollector struct{}
+
+func (limiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- limiterBytes
+	ch <- limiterSpeed
+}
+
+func (limiterCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range stream.LimiterStats() {
+		ch <- prometheus.MustNewConstMetric(limiterBytes, prometheus.CounterValue, float64(s.Total), s.Name)
+		speed := float64(s.Speed)
+		if speed > 0 {
+			speed *= 1024
+		}
+		ch <- prometheus.MustNewConstMetric(limiterSpeed, prometheus.GaugeValue, speed, s.Name)
+	}
+}
+
+// readCacheCollector reads the counters of the read cache when scraped
+type readCacheCollector struct{}
+
+func (readCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- readCacheBlocks
+	ch <- readCacheSize
+}
+
+func (readCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	if stream.ReadCache == nil {
+		return
+	}
+	hits, misses, size := stream.ReadCache.Stats()
+	ch <- prometheus.MustNewConstMetric(readCacheBlocks, prometheus.CounterValue, float64(hits), "hit")
+	ch <- prometheus.MustNewConstMetric(readCacheBlocks, prometheus.CounterValue, float64(misses), "miss")
+	ch <- prometheus.MustNewConstMetric(readCacheSize, prometheus.GaugeValue, float64(size))
+}
+
+var stateNames = map[tache.State]string{
+	tache.StatePending:      "pending",
+	tache.StateRunning:      "running",
+	tache.StateSucceeded:    "succeeded",
+	tache.StateCanceling:    "canceling",
+	tache.StateCanceled:     "canceled",
+	tache.StateErrored:      "errored",
+	tache.StateFailing:      "failing",
+	tache.StateFailed:       "failed",
+	tache.StateWaitingRetry: "waiting_retry",
+	tache.StateBeforeRetry:  "before_retry",
+}
+
+// taskCollector counts the tasks of the registered managers by state when scraped
+type taskCollector struct {
+	managers []taskManager
+}
+
+type taskManager struct {
+	name   string
+	states func() []tache.State
+}
+
+var tasks = &taskCollector{}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- taskDesc
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.managers {
+		counts := make(map[tache.State]int, len(stateNames))
+		for _, s := range m.states() {
+			counts[s]++
+		}
+		for state, name := range stateNames {
+			ch <- prometheus.MustNewConstMetric(taskDesc, prometheus.GaugeValue, float64(counts[state]), m.name, name)
+		}
+	}
+}
+
+// RegisterTaskManager reports the tasks of m under name, it is called once the managers are created
+func RegisterTaskManager[T tache.Task](name string, m *tache.Manager[T]) {
+	tasks.managers = append(tasks.managers, taskManager{name: name, states: func() []tache.State {
+		all := m.GetAll()
+		states := make([]tache.State, len(all))
+		for i, t := range all {
+			states[i] = t.GetState()
+		}
+		return states
+	}})
+}
@@ -0,0 +1,11 @@
+package model
+
+// DavProp is a dead property set by a WebDAV PROPPATCH, it is moved and removed along with the object
+type DavProp struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Path      string `json:"path" gorm:"index"` // cleaned full path of the object
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Value     string `json:"value"` // raw inner xml
+}
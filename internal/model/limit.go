@@ -0,0 +1,8 @@
+package model
+
+// SpeedLimit is the bandwidth in KB/s shared by all transfers of a user, storage or sharing,
+// 0 means no limit besides the global ones
+type SpeedLimit struct {
+	MaxDownloadSpeed int `json:"max_download_speed"`
+	MaxUploadSpeed   int `json:"max_upload_speed"`
+}
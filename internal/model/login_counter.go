@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/go-cache"
+)
+
+// LoginCounter counts the failed logins of each ip
+type LoginCounter interface {
+	Get(ip string) (int, bool)
+	Incr(ip string)
+	Expire(ip string, d time.Duration)
+	Del(ip string)
+}
+
+type memLoginCounter struct {
+	c cache.ICache[int]
+}
+
+func NewMemLoginCounter() LoginCounter {
+	return &memLoginCounter{c: cache.NewMemCache[int]()}
+}
+
+func (m *memLoginCounter) Get(ip string) (int, bool) {
+	return m.c.Get(ip)
+}
+
+func (m *memLoginCounter) Incr(ip string) {
+	count, _ := m.c.Get(ip)
+	m.c.Set(ip, count+1)
+}
+
+func (m *memLoginCounter) Expire(ip string, d time.Duration) {
+	m.c.Expire(ip, d)
+}
+
+func (m *memLoginCounter) Del(ip string) {
+	m.c.Del(ip)
+}
@@ -250,6 +250,8 @@ const (
 	NoCopy
 	NoWrite
 	Temp
+	// Pending is set on write-back uploads which are not put to the storage yet
+	Pending
 )
 const (
 	Locked   = NoRename | NoRemove | NoMove
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3VersionsDirName is the folder next to the objects of a versioned bucket of the S3 server which keeps
+// their noncurrent versions, it is hidden from the listings and the search index
+const S3VersionsDirName = ".s3versions"
+
+// IsS3VersionsPath reports whether p is in a versions folder
+func IsS3VersionsPath(p string) bool {
+	return slices.Contains(strings.Split(p, "/"), S3VersionsDirName)
+}
+
+// HideS3Versions removes the versions folders from objs
+func HideS3Versions(objs []Obj) []Obj {
+	return slices.DeleteFunc(objs, func(obj Obj) bool {
+		return obj.GetName() == S3VersionsDirName
+	})
+}
+
+// S3ObjectMeta is the user metadata and the tags of an object put by the S3 server, it is moved and removed along with the object
+type S3ObjectMeta struct {
+	Path      string            `json:"path" gorm:"primaryKey"` // cleaned full path of the object
+	Metadata  map[string]string `json:"metadata" gorm:"serializer:json"`
+	Tags      map[string]string `json:"tags" gorm:"serializer:json"`
+	VersionID string            `json:"version_id"` // empty for the null version
+}
+
+// S3ObjectVersion is a noncurrent version or a delete marker of an object in a versioned bucket of the S3 server,
+// the content of a version is kept in the versions folder next to the object
+type S3ObjectVersion struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Path         string    `json:"path" gorm:"index"` // cleaned full path of the object
+	VersionID    string    `json:"version_id"`        // empty for the null version
+	DeleteMarker bool      `json:"delete_marker"`
+	Size         int64     `json:"size"`
+	Modified     time.Time `json:"modified"`
+	CreatedAt    time.Time `json:"created_at"` // when it became noncurrent
+}
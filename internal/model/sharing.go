@@ -15,6 +15,7 @@ type SharingDB struct {
 	Readme      string     `json:"readme" gorm:"type:text"`
 	Header      string     `json:"header" gorm:"type:text"`
 	Sort
+	SpeedLimit
 }
 
 type Sharing struct {
@@ -21,6 +21,7 @@ type Storage struct {
 	EnableSign          bool      `json:"enable_sign"`
 	Sort
 	Proxy
+	SpeedLimit
 }
 
 type Sort struct {
@@ -36,6 +37,10 @@ type Proxy struct {
 	DownProxyURL string `json:"down_proxy_url"`
 	// Disable sign for DownProxyURL
 	DisableProxySign bool `json:"disable_proxy_sign"`
+	// Cache the proxied byte ranges on the local disk
+	ReadCache bool `json:"read_cache"`
+	// Answer WebDAV, FTP and SFTP uploads once staged locally, the put is done by a task
+	WriteBack bool `json:"write_back"`
 }
 
 func (s *Storage) GetStorage() *Storage {
@@ -105,3 +110,18 @@ func GetStorageDetails(obj Obj) (*StorageDetails, bool) {
 	}
 	return nil, false
 }
+
+// StorageHealth is the result of the periodic checks of a storage, it is only kept in memory
+type StorageHealth struct {
+	ID          uint      `json:"id"`
+	MountPath   string    `json:"mount_path"`
+	Driver      string    `json:"driver"`
+	Status      string    `json:"status"`
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"failures"` // consecutive failed checks
+	LastCheck   time.Time `json:"last_check"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	NextCheck   time.Time `json:"next_check"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// UploadSession is a resumable upload staged in the temp dir until all bytes arrived
+type UploadSession struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Path      string    `json:"path"` // full path of the file to create
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Mimetype  string    `json:"mimetype"`
+	Overwrite bool      `json:"overwrite"`
+	Modified  time.Time `json:"modified"`
+	Metadata  string    `json:"metadata"` // raw Upload-Metadata header
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
-	"github.com/OpenListTeam/go-cache"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/pkg/errors"
 )
@@ -30,7 +29,8 @@ const (
 	GuestCannotGenerate2FA    = "Guest user can not generate 2FA code"
 )
 
-var LoginCache = cache.NewMemCache[int]()
+// LoginCache is replaced by a counter shared by the instances of a cluster
+var LoginCache = NewMemLoginCounter()
 
 var (
 	DefaultLockDuration   = time.Minute * 5
@@ -68,6 +68,7 @@ type User struct {
 	SsoID      string `json:"sso_id"` // unique by sso platform
 	Authn      string `gorm:"type:text" json:"-"`
 	AllowLdap  bool   `json:"allow_ldap" gorm:"default:true"`
+	SpeedLimit
 }
 
 func (u *User) IsGuest() bool {
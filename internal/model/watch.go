@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+const (
+	WatchActionCopy            = "copy"
+	WatchActionMove            = "move"
+	WatchActionDecompress      = "decompress"
+	WatchActionOfflineDownload = "offline_download"
+	WatchActionRename          = "rename"
+)
+
+type WatchRule struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+	// SrcPath is a mount path, or a path of the local file system if Local is true
+	SrcPath   string `json:"src_path" binding:"required"`
+	Local     bool   `json:"local"`
+	Recursive bool   `json:"recursive"`
+	// Interval of periodic listing in seconds, 0 means only react to update events
+	Interval int `json:"interval"`
+	// IgnoreExisting skips the objects found by the first listing after startup
+	IgnoreExisting bool `json:"ignore_existing"`
+
+	// filter
+	NameRegex  string `json:"name_regex"`
+	Extensions string `json:"extensions"` // comma separated, without dot
+	MinSize    int64  `json:"min_size"`
+	MaxSize    int64  `json:"max_size"` // 0 means unlimited
+
+	Action  string `json:"action" binding:"required"`
+	DstPath string `json:"dst_path"`
+	// RenameTemplate is used by the rename action, e.g. {date}_{name}
+	RenameTemplate string `json:"rename_template"`
+	// Tool is the offline download tool used by the offline_download action
+	Tool          string `json:"tool"`
+	ArchivePass   string `json:"archive_pass"`
+	PutIntoNewDir bool   `json:"put_into_new_dir"`
+}
+
+// WatchHandled is a file handled by a watch rule, it isn't handled again until its size or modified time changes
+type WatchHandled struct {
+	RuleID   uint      `json:"rule_id" gorm:"primaryKey;autoIncrement:false"`
+	Path     string    `json:"path" gorm:"primaryKey"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
@@ -121,7 +121,18 @@ func (a *Aria2) Status(task *tool.DownloadTask) (*tool.Status, error) {
 	return s, nil
 }
 
+func (a *Aria2) Pause(task *tool.DownloadTask) error {
+	_, err := a.client.Pause(task.GID)
+	return err
+}
+
+func (a *Aria2) Resume(task *tool.DownloadTask) error {
+	_, err := a.client.Unpause(task.GID)
+	return err
+}
+
 var _ tool.Tool = (*Aria2)(nil)
+var _ tool.Pauser = (*Aria2)(nil)
 
 func init() {
 	tool.Tools.Add(&Aria2{})
@@ -79,7 +79,16 @@ func (a *QBittorrent) Status(task *tool.DownloadTask) (*tool.Status, error) {
 	return s, nil
 }
 
+func (a *QBittorrent) Pause(task *tool.DownloadTask) error {
+	return a.client.Pause(task.GID)
+}
+
+func (a *QBittorrent) Resume(task *tool.DownloadTask) error {
+	return a.client.Resume(task.GID)
+}
+
 var _ tool.Tool = (*QBittorrent)(nil)
+var _ tool.Pauser = (*QBittorrent)(nil)
 
 func init() {
 	tool.Tools.Add(&QBittorrent{})
@@ -36,3 +36,11 @@ type Tool interface {
 	// Run for simple http download
 	Run(task *DownloadTask) error
 }
+
+// Pauser is implemented by tools that can suspend a download without removing it
+type Pauser interface {
+	// Pause the download of the task, the task keeps its GID
+	Pause(task *DownloadTask) error
+	// Resume the download paused by Pause
+	Resume(task *DownloadTask) error
+}
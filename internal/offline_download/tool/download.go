@@ -1,8 +1,10 @@
 package tool
 
 import (
+	"context"
 	"fmt"
 	"path"
+	"sync/atomic"
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
@@ -13,6 +15,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
 	"github.com/OpenListTeam/OpenList/v4/internal/task_group"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/tache"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -25,17 +28,17 @@ type DownloadTask struct {
 	TempDir           string       `json:"temp_dir"`
 	DeletePolicy      DeletePolicy `json:"delete_policy"`
 	Toolname          string       `json:"toolname"`
+	Priority          int          `json:"priority"`
+	Paused            bool         `json:"paused"`
 	Status            string       `json:"-"`
 	Signal            chan int     `json:"-"`
 	GID               string       `json:"-"`
 	tool              Tool
 	callStatusRetried int
+	slotHeld          atomic.Bool
 }
 
 func (t *DownloadTask) Run() error {
-	t.ClearEndTime()
-	t.SetStartTime(time.Now())
-	defer func() { t.SetEndTime(time.Now()) }()
 	if t.tool == nil {
 		tool, err := Tools.Get(t.Toolname)
 		if err != nil {
@@ -43,7 +46,31 @@ func (t *DownloadTask) Run() error {
 		}
 		t.tool = tool
 	}
-	if err := t.tool.Run(t); !errs.IsNotSupportError(err) {
+	if err := t.acquireSlot(); err != nil {
+		return err
+	}
+	defer t.releaseSlot()
+	t.ClearEndTime()
+	t.SetStartTime(time.Now())
+	defer func() { t.SetEndTime(time.Now()) }()
+	for {
+		err := t.download()
+		if !errors.Is(err, errSuspended) {
+			return err
+		}
+		// the tool can't pause, so the download starts over once the task may run again
+		t.releaseSlot()
+		if err = t.acquireSlot(); err != nil {
+			return err
+		}
+	}
+}
+
+// errSuspended is returned by download when the download was canceled because the task had to be suspended
+var errSuspended = errors.New("download suspended")
+
+func (t *DownloadTask) download() error {
+	if err := t.runTool(); !errs.IsNotSupportError(err) {
 		if err == nil {
 			return t.Transfer()
 		}
@@ -76,6 +103,12 @@ outer:
 				break outer
 			}
 		case <-time.After(time.Second * 3):
+			if err = t.suspendIfNeeded(); err != nil {
+				if utils.IsCanceled(t.Ctx()) {
+					return t.tool.Remove(t)
+				}
+				return err
+			}
 			ok, err = t.Update()
 			if ok {
 				break outer
@@ -211,6 +244,114 @@ func (t *DownloadTask) Transfer() error {
 	return transferStd(t.Ctx(), t.TempDir, t.DstDirPath, t.DeletePolicy)
 }
 
+func (t *DownloadTask) acquireSlot() error {
+	if err := Scheduler.Acquire(t.Ctx(), t); err != nil {
+		return err
+	}
+	t.slotHeld.Store(true)
+	t.Status = ""
+	return nil
+}
+
+func (t *DownloadTask) releaseSlot() {
+	if t.slotHeld.Swap(false) {
+		Scheduler.Release(t)
+	}
+}
+
+func (t *DownloadTask) mustSuspend() bool {
+	return Scheduler.IsPaused(t) || !Scheduler.InWindow()
+}
+
+// runTool runs the download of a tool which downloads by itself, it is canceled
+// when the task has to be suspended since these tools can't pause
+func (t *DownloadTask) runTool() error {
+	orig := t.Ctx()
+	ctx, cancel := context.WithCancel(orig)
+	t.SetCtx(ctx)
+	defer t.SetCtx(orig)
+	var suspended atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Second * 3):
+				if t.mustSuspend() {
+					suspended.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	err := t.tool.Run(t)
+	close(done)
+	cancel()
+	if suspended.Load() && orig.Err() == nil {
+		return errSuspended
+	}
+	return err
+}
+
+// suspendIfNeeded pauses the download in the tool when the user paused the task
+// or the time window closed, and waits until it may run again. The download is
+// removed from a tool which can't pause, and added again later from the start.
+func (t *DownloadTask) suspendIfNeeded() error {
+	if !t.mustSuspend() {
+		return nil
+	}
+	pauser, ok := t.tool.(Pauser)
+	if !ok {
+		if err := t.tool.Remove(t); err != nil {
+			log.Errorf("failed to remove %s: %+v", t.ID, err)
+		}
+		return errSuspended
+	}
+	if err := pauser.Pause(t); err != nil {
+		log.Errorf("failed to pause %s: %+v", t.ID, err)
+		return nil
+	}
+	t.releaseSlot()
+	// keep draining notifications so the tool is never blocked on the signal
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.Signal:
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := t.acquireSlot()
+	close(done)
+	if err != nil {
+		return err
+	}
+	return errors.WithMessage(pauser.Resume(t), "failed to resume download")
+}
+
+// Pause stops the task from taking a download slot. A running download is paused
+// through the tool, or canceled and started over on resume if the tool can't pause.
+func (t *DownloadTask) Pause() {
+	Scheduler.SetPaused(t, true)
+	t.Persist()
+}
+
+// Resume lets a paused task compete for a download slot again
+func (t *DownloadTask) Resume() {
+	Scheduler.SetPaused(t, false)
+	t.Persist()
+}
+
+// SetPriority changes the order in which waiting tasks get a download slot
+func (t *DownloadTask) SetPriority(priority int) {
+	Scheduler.SetPriority(t, priority)
+	t.Persist()
+}
+
 func (t *DownloadTask) GetName() string {
 	return fmt.Sprintf("download %s to (%s)", t.Url, t.DstDirPath)
 }
@@ -0,0 +1,260 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TimeWindows is a list of daily time ranges, in minutes from midnight.
+// A range whose end is before its start wraps around midnight.
+type TimeWindows [][2]int
+
+// ParseTimeWindows parses comma separated ranges such as "22:00-07:00,12:00-13:30".
+// An empty string means no restriction.
+func ParseTimeWindows(s string) (TimeWindows, error) {
+	var windows TimeWindows
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errors.Errorf("invalid time window: %s", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, [2]int{start, end})
+	}
+	return windows, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid time of day: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls into any of the windows
+func (w TimeWindows) Contains(t time.Time) bool {
+	if len(w) == 0 {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	for _, r := range w {
+		if r[0] <= r[1] {
+			if m >= r[0] && m < r[1] {
+				return true
+			}
+		} else if m >= r[0] || m < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func getTimeWindows(key string) TimeWindows {
+	windows, err := ParseTimeWindows(setting.GetStr(key))
+	if err != nil {
+		log.Warnf("ignore setting %s: %+v", key, err)
+		return nil
+	}
+	return windows
+}
+
+// WaitTimeWindow blocks until the current time falls into the windows configured by the setting key
+func WaitTimeWindow(ctx context.Context, key string, setStatus func(string)) error {
+	for !getTimeWindows(key).Contains(time.Now()) {
+		setStatus(fmt.Sprintf("waiting for time window %s", setting.GetStr(key)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Minute):
+		}
+	}
+	return nil
+}
+
+type waiter struct {
+	task *DownloadTask
+	seq  uint64
+}
+
+// DownloadScheduler decides which offline download may occupy a download slot.
+// Tasks are admitted by priority, then by the order they started waiting, as long
+// as the time window is open and neither the global nor the per-tool limit is reached.
+type DownloadScheduler struct {
+	mu          sync.Mutex
+	waiters     []*waiter
+	seq         uint64
+	running     map[string]int
+	total       int
+	workers     int
+	toolWorkers map[string]int
+	windows     TimeWindows
+	wake        chan struct{}
+}
+
+var Scheduler = &DownloadScheduler{
+	running: make(map[string]int),
+	wake:    make(chan struct{}),
+}
+
+// Refresh reloads the limits from settings and reconsiders the waiting tasks
+func (s *DownloadScheduler) Refresh() {
+	toolWorkers := make(map[string]int)
+	if str := setting.GetStr(conf.TaskOfflineDownloadToolThreadsNum); str != "" {
+		if err := utils.Json.UnmarshalFromString(str, &toolWorkers); err != nil {
+			log.Warnf("ignore setting %s: %+v", conf.TaskOfflineDownloadToolThreadsNum, err)
+		}
+	}
+	windows := getTimeWindows(conf.TaskOfflineDownloadTimeWindow)
+	workers := max(setting.GetInt(conf.TaskOfflineDownloadThreadsNum, conf.Conf.Tasks.Download.Workers), 0)
+	s.mu.Lock()
+	s.workers = workers
+	s.toolWorkers = toolWorkers
+	s.windows = windows
+	s.broadcast()
+	s.mu.Unlock()
+}
+
+// InWindow reports whether downloads are allowed to run now
+func (s *DownloadScheduler) InWindow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.windows.Contains(time.Now())
+}
+
+func (s *DownloadScheduler) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func (s *DownloadScheduler) hasSlot(t *DownloadTask) bool {
+	if s.total >= s.workers {
+		return false
+	}
+	limit, ok := s.toolWorkers[t.Toolname]
+	return !ok || limit <= 0 || s.running[t.Toolname] < limit
+}
+
+func (s *DownloadScheduler) eligible(t *DownloadTask, now time.Time) bool {
+	return !t.Paused && s.windows.Contains(now) && s.hasSlot(t)
+}
+
+// status explains why a waiting task is not admitted yet, must be called with lock held
+func (s *DownloadScheduler) status(t *DownloadTask, now time.Time) string {
+	switch {
+	case t.Paused:
+		return "paused"
+	case !s.windows.Contains(now):
+		return fmt.Sprintf("waiting for time window, priority %d", t.Priority)
+	default:
+		return fmt.Sprintf("queued, priority %d", t.Priority)
+	}
+}
+
+// tryAdmit must be called with lock held
+func (s *DownloadScheduler) tryAdmit(w *waiter) bool {
+	now := time.Now()
+	if !s.eligible(w.task, now) {
+		return false
+	}
+	for _, o := range s.waiters {
+		if o == w || !s.eligible(o.task, now) {
+			continue
+		}
+		if o.task.Priority > w.task.Priority || (o.task.Priority == w.task.Priority && o.seq < w.seq) {
+			return false
+		}
+	}
+	for i, o := range s.waiters {
+		if o == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			break
+		}
+	}
+	s.total++
+	s.running[w.task.Toolname]++
+	return true
+}
+
+// Acquire blocks until the task is allowed to occupy a download slot
+func (s *DownloadScheduler) Acquire(ctx context.Context, t *DownloadTask) error {
+	s.mu.Lock()
+	s.seq++
+	w := &waiter{task: t, seq: s.seq}
+	s.waiters = append(s.waiters, w)
+	for !s.tryAdmit(w) {
+		t.Status = s.status(t, time.Now())
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for i, o := range s.waiters {
+				if o == w {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+			s.broadcast()
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-wake:
+		case <-time.After(time.Minute):
+		}
+		s.mu.Lock()
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Release gives the slot acquired by Acquire back
+func (s *DownloadScheduler) Release(t *DownloadTask) {
+	s.mu.Lock()
+	s.total--
+	s.running[t.Toolname]--
+	s.broadcast()
+	s.mu.Unlock()
+}
+
+// SetPaused marks the task as paused or resumed by the user
+func (s *DownloadScheduler) SetPaused(t *DownloadTask, paused bool) {
+	s.mu.Lock()
+	t.Paused = paused
+	s.broadcast()
+	s.mu.Unlock()
+}
+
+// IsPaused reports whether the task has been paused by the user
+func (s *DownloadScheduler) IsPaused(t *DownloadTask) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return t.Paused
+}
+
+// SetPriority changes the priority of the task, higher runs first
+func (s *DownloadScheduler) SetPriority(t *DownloadTask, priority int) {
+	s.mu.Lock()
+	t.Priority = priority
+	s.broadcast()
+	s.mu.Unlock()
+}
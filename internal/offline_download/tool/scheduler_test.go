@@ -0,0 +1,69 @@
+package tool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimeWindows(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("15:04", clock)
+		return tm
+	}
+	windows, err := ParseTimeWindows("22:00-07:00, 12:00-13:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"23:15": true,
+		"03:00": true,
+		"07:00": false,
+		"12:30": true,
+		"13:30": false,
+		"18:00": false,
+	}
+	for clock, expected := range cases {
+		if got := windows.Contains(at(clock)); got != expected {
+			t.Errorf("%s: expected %v, got %v", clock, expected, got)
+		}
+	}
+	if !TimeWindows(nil).Contains(at("09:00")) {
+		t.Errorf("empty windows should not restrict anything")
+	}
+	if _, err = ParseTimeWindows("9-17"); err == nil {
+		t.Errorf("expected error for invalid window")
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := &DownloadScheduler{
+		running:     make(map[string]int),
+		workers:     1,
+		toolWorkers: map[string]int{},
+		wake:        make(chan struct{}),
+	}
+	first := &DownloadTask{Toolname: "aria2"}
+	if err := s.Acquire(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	low := &DownloadTask{Toolname: "aria2", Priority: 0}
+	high := &DownloadTask{Toolname: "aria2", Priority: 10}
+	admitted := make(chan *DownloadTask, 2)
+	for _, task := range []*DownloadTask{low, high} {
+		go func(task *DownloadTask) {
+			if err := s.Acquire(context.Background(), task); err == nil {
+				admitted <- task
+			}
+		}(task)
+		time.Sleep(50 * time.Millisecond)
+	}
+	s.Release(first)
+	if got := <-admitted; got != high {
+		t.Errorf("expected the task with higher priority to run first")
+	}
+	s.Release(high)
+	if got := <-admitted; got != low {
+		t.Errorf("expected the remaining task to run")
+	}
+}
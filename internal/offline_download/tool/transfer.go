@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
@@ -46,6 +48,11 @@ func (t *TransferTask) Run() error {
 			}
 		}
 	}
+	if err := WaitTimeWindow(t.Ctx(), conf.TaskOfflineDownloadTransferTimeWindow, func(status string) {
+		t.Status = status
+	}); err != nil {
+		return err
+	}
 	t.ClearEndTime()
 	t.SetStartTime(time.Now())
 	defer func() { t.SetEndTime(time.Now()) }()
@@ -132,28 +139,45 @@ func transferStd(ctx context.Context, tempDir, dstDirPath string, deletePolicy D
 	if err != nil {
 		return err
 	}
-	taskCreator, _ := ctx.Value(conf.UserKey).(*model.User)
 	for _, entry := range entries {
-		t := &TransferTask{
-			TaskData: fs.TaskData{
-				TaskExtension: task.TaskExtension{
-					Creator: taskCreator,
-					ApiUrl:  common.GetApiUrl(ctx),
-				},
-				SrcActualPath: stdpath.Join(tempDir, entry.Name()),
-				DstActualPath: dstDirActualPath,
-				DstStorage:    dstStorage,
-				DstStorageMp:  dstStorage.GetStorage().MountPath,
-			},
-			DeletePolicy: deletePolicy,
-		}
-		t.groupID = path.Join(t.DstStorageMp, t.DstActualPath)
-		task_group.TransferCoordinator.AddTask(t.groupID, nil)
-		TransferTaskManager.Add(t)
+		addStdTransferTask(ctx, stdpath.Join(tempDir, entry.Name()), dstStorage, dstDirActualPath, deletePolicy)
 	}
 	return nil
 }
 
+// TransferLocal uploads a file or folder of the local file system into dstDirPath as a transfer task
+func TransferLocal(ctx context.Context, srcPath, dstDirPath string, deletePolicy DeletePolicy) (task.TaskExtensionInfo, error) {
+	dstStorage, dstDirActualPath, err := op.GetStorageAndActualPath(dstDirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get dst storage")
+	}
+	if dstStorage.Config().NoUpload {
+		return nil, errors.WithStack(errs.UploadNotSupported)
+	}
+	return addStdTransferTask(ctx, srcPath, dstStorage, dstDirActualPath, deletePolicy), nil
+}
+
+func addStdTransferTask(ctx context.Context, srcPath string, dstStorage driver.Driver, dstDirActualPath string, deletePolicy DeletePolicy) *TransferTask {
+	taskCreator, _ := ctx.Value(conf.UserKey).(*model.User)
+	t := &TransferTask{
+		TaskData: fs.TaskData{
+			TaskExtension: task.TaskExtension{
+				Creator: taskCreator,
+				ApiUrl:  common.GetApiUrl(ctx),
+			},
+			SrcActualPath: srcPath,
+			DstActualPath: dstDirActualPath,
+			DstStorage:    dstStorage,
+			DstStorageMp:  dstStorage.GetStorage().MountPath,
+		},
+		DeletePolicy: deletePolicy,
+	}
+	t.groupID = path.Join(t.DstStorageMp, t.DstActualPath)
+	task_group.TransferCoordinator.AddTask(t.groupID, nil)
+	TransferTaskManager.Add(t)
+	return t
+}
+
 func transferStdPath(t *TransferTask) error {
 	t.Status = "getting src object"
 	info, err := os.Stat(t.SrcActualPath)
@@ -170,7 +170,24 @@ func (t *Transmission) Status(task *tool.DownloadTask) (*tool.Status, error) {
 	return s, nil
 }
 
+func (t *Transmission) Pause(task *tool.DownloadTask) error {
+	gid, err := strconv.ParseInt(task.GID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return t.client.TorrentStopIDs(context.TODO(), []int64{gid})
+}
+
+func (t *Transmission) Resume(task *tool.DownloadTask) error {
+	gid, err := strconv.ParseInt(task.GID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return t.client.TorrentStartIDs(context.TODO(), []int64{gid})
+}
+
 var _ tool.Tool = (*Transmission)(nil)
+var _ tool.Pauser = (*Transmission)(nil)
 
 func init() {
 	tool.Tools.Add(&Transmission{})
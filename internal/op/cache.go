@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 )
@@ -17,6 +19,7 @@ type CacheManager struct {
 	userCache    *cache.KeyedCache[*model.User]           // Cache for user data
 	settingCache *cache.KeyedCache[any]                   // Cache for settings
 	detailCache  *cache.KeyedCache[*model.StorageDetails] // Cache for storage details
+	dirStore     cache.Store                              // Optional persistent or shared tier of dirCache
 }
 
 func NewCacheManager() *CacheManager {
@@ -36,6 +39,23 @@ func Key(storage driver.Driver, path string) string {
 	return utils.GetFullPath(storage.GetStorage().MountPath, path)
 }
 
+// get directory from dirCache, falling back to the store tier
+func (cm *CacheManager) getDirectory(key string) (*directoryCache, bool) {
+	if dc, exists := cm.dirCache.Get(key); exists || cm.dirStore == nil {
+		return dc, exists
+	}
+	dc, exists := cm.loadDirectory(key)
+	metrics.CacheLookup("dir_store", exists)
+	return dc, exists
+}
+
+// cache directory listing in dirCache and the store tier
+func (cm *CacheManager) setDirectory(key string, objs []model.Obj, ttl time.Duration) {
+	dc := newDirectoryCache(objs, time.Now().Add(ttl))
+	cm.dirCache.SetWithTTL(key, dc, ttl)
+	cm.persistDirectory(key, dc)
+}
+
 // recursively delete directory and its children from dirCache
 func (cm *CacheManager) DeleteDirectoryTree(storage driver.Driver, dirPath string) {
 	if storage.Config().NoCache {
@@ -44,10 +64,17 @@ func (cm *CacheManager) DeleteDirectoryTree(storage driver.Driver, dirPath strin
 	cm.deleteDirectoryTree(Key(storage, dirPath))
 }
 func (cm *CacheManager) deleteDirectoryTree(key string) {
+	cm.deleteDirectoryTreeInMemory(key)
+	if cm.dirStore != nil {
+		cm.dirStore.DeletePrefix(key)
+	}
+	coord.Publish(eventDirTree, key)
+}
+func (cm *CacheManager) deleteDirectoryTreeInMemory(key string) {
 	if dirCache, exists := cm.dirCache.Pop(key); exists {
 		for _, obj := range dirCache.objs {
 			if obj.IsDir() {
-				cm.deleteDirectoryTree(stdpath.Join(key, obj.GetName()))
+				cm.deleteDirectoryTreeInMemory(stdpath.Join(key, obj.GetName()))
 			} else {
 				cm.linkCache.DeleteKey(stdpath.Join(key, obj.GetName()))
 			}
@@ -60,7 +87,12 @@ func (cm *CacheManager) DeleteDirectory(storage driver.Driver, dirPath string) {
 	if storage.Config().NoCache {
 		return
 	}
-	cm.dirCache.Delete(Key(storage, dirPath))
+	key := Key(storage, dirPath)
+	cm.dirCache.Delete(key)
+	if cm.dirStore != nil {
+		cm.dirStore.Delete(key)
+	}
+	coord.Publish(eventDir, key)
 }
 
 // remove object from dirCache.
@@ -69,20 +101,27 @@ func (cm *CacheManager) DeleteDirectory(storage driver.Driver, dirPath string) {
 func (cm *CacheManager) removeDirectoryObject(storage driver.Driver, dirPath string, obj model.Obj) {
 	key := Key(storage, dirPath)
 	if !obj.IsDir() {
-		cm.linkCache.DeleteKey(stdpath.Join(key, obj.GetName()))
+		cm.deleteLink(stdpath.Join(key, obj.GetName()))
 	}
 
 	if storage.Config().NoCache {
 		return
 	}
-	if cache, exist := cm.dirCache.Get(key); exist {
+	if cache, exist := cm.getDirectory(key); exist {
 		if obj.IsDir() {
 			cm.deleteDirectoryTree(stdpath.Join(key, obj.GetName()))
 		}
 		cache.RemoveObject(obj.GetName())
+		cm.persistDirectory(key, cache)
 	}
 }
 
+// remove the links of the file from linkCache
+func (cm *CacheManager) deleteLink(key string) {
+	cm.linkCache.DeleteKey(key)
+	coord.Publish(eventLink, key)
+}
+
 // cache user data
 func (cm *CacheManager) SetUser(username string, user *model.User) {
 	cm.userCache.Set(username, user)
@@ -96,6 +135,7 @@ func (cm *CacheManager) GetUser(username string) (*model.User, bool) {
 // remove user data from cache
 func (cm *CacheManager) DeleteUser(username string) {
 	cm.userCache.Delete(username)
+	coord.Publish(eventUser, username)
 }
 
 // caches setting
@@ -141,11 +181,21 @@ func (cm *CacheManager) GetStorageDetails(storage driver.Driver) (*model.Storage
 }
 
 func (cm *CacheManager) InvalidateStorageDetails(storage driver.Driver) {
-	cm.detailCache.Delete(utils.GetActualMountPath(storage.GetStorage().MountPath))
+	key := utils.GetActualMountPath(storage.GetStorage().MountPath)
+	cm.detailCache.Delete(key)
+	coord.Publish(eventDetails, key)
 }
 
 // clears all caches
 func (cm *CacheManager) ClearAll() {
+	cm.clearMemory()
+	if cm.dirStore != nil {
+		cm.dirStore.Clear()
+	}
+	coord.Publish(eventAll, "")
+}
+
+func (cm *CacheManager) clearMemory() {
 	cm.dirCache.Clear()
 	cm.linkCache.Clear()
 	cm.userCache.Clear()
@@ -154,9 +204,10 @@ func (cm *CacheManager) ClearAll() {
 }
 
 type directoryCache struct {
-	objs   []model.Obj
-	sorted []model.Obj
-	mu     sync.RWMutex
+	objs    []model.Obj
+	sorted  []model.Obj
+	expires time.Time
+	mu      sync.RWMutex
 
 	dirtyFlags uint8
 }
@@ -166,12 +217,13 @@ const (
 	dirtyUpdate                   // 对象更新：需要执行 full sort + extract
 )
 
-func newDirectoryCache(objs []model.Obj) *directoryCache {
+func newDirectoryCache(objs []model.Obj, expires time.Time) *directoryCache {
 	sorted := make([]model.Obj, len(objs))
 	copy(sorted, objs)
 	return &directoryCache{
-		objs:   objs,
-		sorted: sorted,
+		objs:    objs,
+		sorted:  sorted,
+		expires: expires,
 	}
 }
 
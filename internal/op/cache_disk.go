@@ -0,0 +1,201 @@
+package op
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// diskObj is an object of a directory listing in the store.
+// It holds what the generic getters of the object tell, the internal fields of the object types
+// of the drivers are lost, so the driver gets such an object listed again before it works with it.
+type diskObj struct {
+	Kind string `json:"k,omitempty"`
+	// Driver tells the object was of a type of the driver
+	Driver bool `json:"dr,omitempty"`
+	// Wraps are the name and mask wrappers around the object from the outside in
+	Wraps     []diskWrap    `json:"w,omitempty"`
+	ID        string        `json:"id,omitempty"`
+	Path      string        `json:"p,omitempty"`
+	Name      string        `json:"n"`
+	Size      int64         `json:"s,omitempty"`
+	Modified  time.Time     `json:"m"`
+	Ctime     time.Time     `json:"c"`
+	IsFolder  bool          `json:"d,omitempty"`
+	Hash      string        `json:"h,omitempty"`
+	Mask      model.ObjMask `json:"mask,omitempty"`
+	Thumbnail string        `json:"t,omitempty"`
+	Url       string        `json:"u,omitempty"`
+	Provider  string        `json:"pr,omitempty"`
+}
+
+type diskWrap struct {
+	Name string        `json:"n,omitempty"`
+	Mask model.ObjMask `json:"m,omitempty"`
+}
+
+const (
+	diskKindObject   = ""
+	diskKindThumb    = "thumb"
+	diskKindURL      = "url"
+	diskKindThumbURL = "thumb_url"
+	diskKindProvider = "provider"
+)
+
+// storedObj marks an object of a driver type restored from the store
+type storedObj struct {
+	model.Obj
+}
+
+func (o *storedObj) Unwrap() model.Obj {
+	return o.Obj
+}
+
+// isStoredObj tells whether the object lost the fields of its driver type in the store
+func isStoredObj(obj model.Obj) bool {
+	for {
+		switch o := obj.(type) {
+		case *storedObj:
+			return true
+		case model.ObjUnwrap:
+			obj = o.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+func toDiskObj(obj model.Obj) diskObj {
+	var d diskObj
+	for unwrapped := false; !unwrapped; {
+		switch w := obj.(type) {
+		case *model.ObjWrapName:
+			d.Wraps = append(d.Wraps, diskWrap{Name: w.Name})
+			obj = w.Obj
+		case *model.ObjWrapMask:
+			d.Wraps = append(d.Wraps, diskWrap{Mask: w.Mask})
+			obj = w.Obj
+		default:
+			unwrapped = true
+		}
+	}
+	switch obj.(type) {
+	case *model.Object, *model.ObjThumb, *model.ObjectURL, *model.ObjThumbURL, *model.ObjectProvider:
+	default:
+		d.Driver = true
+	}
+	d.ID, d.Path, d.Name, d.Size = obj.GetID(), obj.GetPath(), obj.GetName(), obj.GetSize()
+	d.Modified, d.Ctime, d.IsFolder, d.Mask = obj.ModTime(), obj.CreateTime(), obj.IsDir(), model.GetObjMask(obj)
+	if hash := obj.GetHash(); len(hash.Export()) > 0 {
+		d.Hash = hash.String()
+	}
+	thumb, hasThumb := model.GetThumb(obj)
+	url, hasURL := model.GetUrl(obj)
+	switch {
+	case hasThumb && hasURL:
+		d.Kind, d.Thumbnail, d.Url = diskKindThumbURL, thumb, url
+	case hasThumb:
+		d.Kind, d.Thumbnail = diskKindThumb, thumb
+	case hasURL:
+		d.Kind, d.Url = diskKindURL, url
+	default:
+		if provider, ok := model.GetProvider(obj); ok {
+			d.Kind, d.Provider = diskKindProvider, provider
+		}
+	}
+	return d
+}
+
+func (d diskObj) toObj() model.Obj {
+	o := model.Object{
+		ID:       d.ID,
+		Path:     d.Path,
+		Name:     d.Name,
+		Size:     d.Size,
+		Modified: d.Modified,
+		Ctime:    d.Ctime,
+		IsFolder: d.IsFolder,
+		Mask:     d.Mask,
+	}
+	if d.Hash != "" {
+		o.HashInfo = utils.FromString(d.Hash)
+	}
+	var obj model.Obj
+	switch d.Kind {
+	case diskKindThumb:
+		obj = &model.ObjThumb{Object: o, Thumbnail: model.Thumbnail{Thumbnail: d.Thumbnail}}
+	case diskKindURL:
+		obj = &model.ObjectURL{Object: o, Url: model.Url{Url: d.Url}}
+	case diskKindThumbURL:
+		obj = &model.ObjThumbURL{Object: o, Thumbnail: model.Thumbnail{Thumbnail: d.Thumbnail}, Url: model.Url{Url: d.Url}}
+	case diskKindProvider:
+		obj = &model.ObjectProvider{Object: o, Provider: model.Provider{Provider: d.Provider}}
+	default:
+		obj = &o
+	}
+	if d.Driver {
+		obj = &storedObj{Obj: obj}
+	}
+	for i := len(d.Wraps) - 1; i >= 0; i-- {
+		if d.Wraps[i].Name != "" {
+			obj = &model.ObjWrapName{Name: d.Wraps[i].Name, Obj: obj}
+		} else {
+			obj = &model.ObjWrapMask{Obj: obj, Mask: d.Wraps[i].Mask}
+		}
+	}
+	return obj
+}
+
+// SetDirStore adds the store as a second tier below the in-memory directory cache
+func (cm *CacheManager) SetDirStore(store cache.Store) {
+	cm.dirStore = store
+}
+
+// persistDirectory writes the directory to the store and tells the other nodes about the change
+func (cm *CacheManager) persistDirectory(key string, dc *directoryCache) {
+	defer coord.Publish(eventDir, key)
+	if cm.dirStore == nil {
+		return
+	}
+	dc.mu.RLock()
+	objs := make([]diskObj, 0, len(dc.objs))
+	for _, obj := range dc.objs {
+		objs = append(objs, toDiskObj(obj))
+	}
+	expires := dc.expires
+	dc.mu.RUnlock()
+	data, err := utils.Json.Marshal(objs)
+	if err != nil {
+		log.Warnf("failed marshal directory %s for store: %+v", key, err)
+		cm.dirStore.Delete(key)
+		return
+	}
+	cm.dirStore.Set(key, data, expires)
+}
+
+// loadDirectory reads the directory from the store and puts it into the memory
+func (cm *CacheManager) loadDirectory(key string) (*directoryCache, bool) {
+	data, expires, ok := cm.dirStore.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var objs []diskObj
+	if err := utils.Json.Unmarshal(data, &objs); err != nil {
+		log.Warnf("failed unmarshal directory %s from store: %+v", key, err)
+		cm.dirStore.Delete(key)
+		return nil, false
+	}
+	files := make([]model.Obj, len(objs))
+	for i := range objs {
+		files[i] = objs[i].toObj()
+	}
+	dc := newDirectoryCache(files, expires)
+	// the objects may have been changed after sorting, sort them again on first use
+	dc.dirtyFlags = dirtyUpdate
+	cm.dirCache.SetWithExpirable(key, dc, cache.ExpirationTime(expires))
+	return dc, true
+}
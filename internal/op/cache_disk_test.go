@@ -0,0 +1,185 @@
+package op_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// typedObj is an object type of a driver, with a field the driver needs for the link
+type typedObj struct {
+	model.Object
+	token string
+}
+
+func (o *typedObj) Thumb() string {
+	return "thumb/" + o.Name
+}
+
+type typedDriver struct {
+	model.Storage
+	driver.RootPath
+	listed int
+}
+
+func (d *typedDriver) Config() driver.Config {
+	return driver.Config{Name: "TypedObj", LocalSort: true, NoLinkURL: true}
+}
+
+func (d *typedDriver) Init(ctx context.Context) error { return nil }
+func (d *typedDriver) Drop(ctx context.Context) error { return nil }
+
+func (d *typedDriver) GetAddition() driver.Additional {
+	return &d.RootPath
+}
+
+func (d *typedDriver) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	d.listed++
+	return []model.Obj{&typedObj{
+		Object: model.Object{ID: "1", Name: "file.txt", Size: 3, Modified: time.Unix(1700000000, 0),
+			HashInfo: utils.NewHashInfo(utils.MD5, "900150983cd24fb0d6963f7d28e17f72")},
+		token: "secret",
+	}}, nil
+}
+
+func (d *typedDriver) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	if file.(*typedObj).token == "" {
+		return nil, errors.New("token lost")
+	}
+	return &model.Link{URL: "http://example.com/" + file.GetName()}, nil
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &typedDriver{}
+	})
+}
+
+func TestDirDiskCache(t *testing.T) {
+	disk, err := cache.OpenDiskCache(filepath.Join(t.TempDir(), "dir_cache.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	memory := op.Cache
+	defer func() { op.Cache = memory }()
+	// a new cache manager sharing the disk tier is what the next start sees
+	restart := func() {
+		op.Cache = op.NewCacheManager()
+		op.Cache.SetDirStore(disk)
+	}
+	restart()
+
+	ctx := context.Background()
+	// the virtual driver lists random names, a listing read again proves it comes from the cache
+	_, err = op.CreateStorage(ctx, model.Storage{Driver: "Virtual", MountPath: "/dir_cache", CacheExpiration: 30,
+		Addition: `{"num_file":3,"num_folder":2,"max_file_size":10,"min_file_size":1}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := op.GetStorageByMountPath("/dir_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(refresh bool) []string {
+		objs, err := op.List(ctx, storage, "/", model.ListArgs{Refresh: refresh})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	listed := names(false)
+	restart()
+	if got := names(false); !slices.Equal(got, listed) {
+		t.Fatalf("listing not restored from disk, expected %v, got %v", listed, got)
+	}
+
+	if err = op.MakeDir(ctx, storage, "/new_dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err = op.Remove(ctx, storage, "/"+listed[0]); err != nil {
+		t.Fatal(err)
+	}
+	restart()
+	want := slices.Concat(listed[1:], []string{"new_dir"})
+	slices.Sort(want)
+	if got := names(false); !slices.Equal(got, want) {
+		t.Errorf("changes not written through, expected %v, got %v", want, got)
+	}
+
+	op.Cache.DeleteDirectoryTree(storage, "/")
+	restart()
+	if got := names(false); slices.Equal(got, want) {
+		t.Errorf("listing still cached after delete: %v", got)
+	}
+}
+
+func TestDirDiskCacheDriverObj(t *testing.T) {
+	disk, err := cache.OpenDiskCache(filepath.Join(t.TempDir(), "dir_cache.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	memory := op.Cache
+	defer func() { op.Cache = memory }()
+	restart := func() {
+		op.Cache = op.NewCacheManager()
+		op.Cache.SetDirStore(disk)
+	}
+	restart()
+
+	ctx := context.Background()
+	_, err = op.CreateStorage(ctx, model.Storage{Driver: "TypedObj", MountPath: "/typed_obj", CacheExpiration: 30,
+		Addition: `{"root_folder_path":"/"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := op.GetStorageByMountPath("/typed_obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := storage.(*typedDriver)
+	if _, err = op.List(ctx, storage, "/", model.ListArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	restart()
+	objs, err := op.List(ctx, storage, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.listed != 1 || len(objs) != 1 {
+		t.Fatalf("listing not restored from disk, listed %d times, got %d objects", d.listed, len(objs))
+	}
+	obj := objs[0]
+	if obj.GetName() != "file.txt" || obj.GetSize() != 3 || obj.GetID() != "1" || obj.IsDir() ||
+		!obj.ModTime().Equal(time.Unix(1700000000, 0)) || obj.GetHash().GetHash(utils.MD5) != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Errorf("object not restored: %+v", obj)
+	}
+	if thumb, _ := model.GetThumb(obj); thumb != "thumb/file.txt" {
+		t.Errorf("expected the thumbnail to be restored, got %q", thumb)
+	}
+
+	// the driver gets its own object again, not the one restored without the token
+	link, _, err := op.Link(ctx, storage, "/file.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.URL != "http://example.com/file.txt" || d.listed != 2 {
+		t.Errorf("unexpected link %s after %d listings", link.URL, d.listed)
+	}
+}
@@ -0,0 +1,42 @@
+package op
+
+import "github.com/OpenListTeam/OpenList/v4/internal/coord"
+
+// the events of the caches published to the other nodes of a cluster,
+// a node receiving them only drops its own copy in memory since the store is shared
+const (
+	eventDir      = "dir"
+	eventDirTree  = "dir_tree"
+	eventLink     = "link"
+	eventUser     = "user"
+	eventDetails  = "details"
+	eventAll      = "all"
+	eventSettings = "settings"
+)
+
+func init() {
+	coord.Handle(eventDir, func(key string) {
+		Cache.dirCache.Delete(key)
+	})
+	coord.Handle(eventDirTree, func(key string) {
+		Cache.deleteDirectoryTreeInMemory(key)
+	})
+	coord.Handle(eventLink, func(key string) {
+		Cache.linkCache.DeleteKey(key)
+	})
+	coord.Handle(eventUser, func(key string) {
+		Cache.userCache.Delete(key)
+	})
+	coord.Handle(eventDetails, func(key string) {
+		Cache.detailCache.Delete(key)
+	})
+	coord.Handle(eventAll, func(string) {
+		Cache.clearMemory()
+	})
+	coord.Handle(eventSettings, func(string) {
+		runSettingChangingCallbacks()
+	})
+	coord.Handle(coord.Resync, func(string) {
+		Cache.clearMemory()
+	})
+}
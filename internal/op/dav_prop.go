@@ -0,0 +1,72 @@
+package op
+
+import (
+	"context"
+	stdpath "path"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetDavProps returns the WebDAV dead props of the object at the full path
+func GetDavProps(path string) ([]model.DavProp, error) {
+	return db.GetDavProps(utils.FixAndCleanPath(path))
+}
+
+func PatchDavProps(path string, set, remove []model.DavProp) error {
+	return db.PatchDavProps(utils.FixAndCleanPath(path), set, remove)
+}
+
+// MoveDavProps moves the dead props of the object at the full path srcPath, and of the objects under it, to dstPath
+func MoveDavProps(srcPath, dstPath string) error {
+	return db.MoveDavProps(utils.FixAndCleanPath(srcPath), utils.FixAndCleanPath(dstPath))
+}
+
+// moveObjectProps lets the dead props and the S3 metadata follow a moved or renamed object, a failure doesn't fail the move
+func moveObjectProps(storage driver.Driver, srcPath, dstPath string) {
+	mountPath := storage.GetStorage().MountPath
+	src, dst := utils.GetFullPath(mountPath, srcPath), utils.GetFullPath(mountPath, dstPath)
+	if err := db.MoveDavProps(src, dst); err != nil {
+		log.Errorf("failed move dav props of %s to %s: %+v", src, dst, err)
+	}
+	if err := db.MoveS3ObjectMeta(src, dst); err != nil {
+		log.Errorf("failed move s3 metadata of %s to %s: %+v", src, dst, err)
+	}
+}
+
+func removeObjectProps(storage driver.Driver, path string) {
+	fullPath := utils.GetFullPath(storage.GetStorage().MountPath, path)
+	if err := db.DeleteDavProps(fullPath); err != nil {
+		log.Errorf("failed remove dav props of %s: %+v", fullPath, err)
+	}
+	if err := db.DeleteS3ObjectMeta(fullPath); err != nil {
+		log.Errorf("failed remove s3 metadata of %s: %+v", fullPath, err)
+	}
+}
+
+// SetModTime sets the modification time of the object, errs.NotImplement is returned if the driver can't
+func SetModTime(ctx context.Context, storage driver.Driver, path string, modified time.Time) error {
+	if storage.Config().CheckStatus && storage.GetStorage().Status != WORK {
+		return errors.WithMessagef(errs.StorageNotInit, "storage status: %s", storage.GetStorage().Status)
+	}
+	s, ok := storage.(driver.SetModTime)
+	if !ok {
+		return errs.NotImplement
+	}
+	path = utils.FixAndCleanPath(path)
+	obj, err := GetUnwrap(ctx, storage, path)
+	if err != nil {
+		return errors.WithMessage(err, "failed to get object")
+	}
+	if err = s.SetModTime(ctx, obj, modified); err != nil {
+		return errors.WithStack(err)
+	}
+	Cache.DeleteDirectory(storage, stdpath.Dir(path))
+	return nil
+}
@@ -0,0 +1,44 @@
+package op_test
+
+import (
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+func TestDavProps(t *testing.T) {
+	prop := func(name, value string) model.DavProp {
+		return model.DavProp{Namespace: "urn:test:", Name: name, Value: value}
+	}
+	for _, path := range []string{"/dav/a", "/dav/a/b", "/dav/a_b", "/dav/c"} {
+		if err := op.PatchDavProps(path, []model.DavProp{prop("x", path), prop("y", "1")}, nil); err != nil {
+			t.Fatalf("failed patch props: %+v", err)
+		}
+	}
+	if err := op.PatchDavProps("/dav/a", []model.DavProp{prop("x", "new")}, []model.DavProp{prop("y", "")}); err != nil {
+		t.Fatalf("failed patch props: %+v", err)
+	}
+	props, err := op.GetDavProps("/dav/a")
+	if err != nil || len(props) != 1 || props[0].Value != "new" {
+		t.Fatalf("unexpected props of /dav/a: %+v, %+v", props, err)
+	}
+
+	// the props under the destination are replaced, /dav/a_b is not under /dav/a
+	if err = op.MoveDavProps("/dav/a", "/dav/c"); err != nil {
+		t.Fatalf("failed move props: %+v", err)
+	}
+	expect := map[string]int{"/dav/a": 0, "/dav/a/b": 0, "/dav/a_b": 2, "/dav/c": 1, "/dav/c/b": 2}
+	for path, n := range expect {
+		props, err := op.GetDavProps(path)
+		if err != nil {
+			t.Fatalf("failed get props: %+v", err)
+		}
+		if len(props) != n {
+			t.Errorf("expect %d props of %s, got %+v", n, path, props)
+		}
+	}
+	if props, _ = op.GetDavProps("/dav/c/b"); len(props) > 0 && props[0].Value != "/dav/a/b" {
+		t.Errorf("unexpected props of /dav/c/b: %+v", props)
+	}
+}
@@ -135,6 +135,20 @@ func getMainItems(config driver.Config) []driver.Item {
 			items = append(items, item)
 		}
 	}
+	items = append(items, driver.Item{
+		Name:    "read_cache",
+		Type:    conf.TypeBool,
+		Default: "false",
+		Help:    "Keep the proxied content on the local disk to serve repeated reads, the content of encrypted storages is stored decrypted",
+	})
+	if !config.NoUpload {
+		items = append(items, driver.Item{
+			Name:    "write_back",
+			Type:    conf.TypeBool,
+			Default: "false",
+			Help:    "Complete WebDAV, FTP and SFTP uploads once they are staged on the local disk, the upload to the storage is retried in the background",
+		})
+	}
 	items = append(items, driver.Item{
 		Name: "down_proxy_url",
 		Type: conf.TypeText,
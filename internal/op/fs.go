@@ -10,6 +10,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
@@ -35,7 +36,9 @@ func list(ctx context.Context, storage driver.Driver, path string, args model.Li
 	log.Debugf("op.List %s", path)
 	key := Key(storage, path)
 	if !args.Refresh {
-		if dirCache, exists := Cache.dirCache.Get(key); exists {
+		dirCache, exists := Cache.getDirectory(key)
+		metrics.CacheLookup("dir", exists)
+		if exists {
 			log.Debugf("use cache when list %s", path)
 			objs := dirCache.GetSortedObjects(storage)
 			if resultValidator != nil {
@@ -57,7 +60,9 @@ func list(ctx context.Context, storage driver.Driver, path string, args model.Li
 		if !dir.IsDir() {
 			return nil, errors.WithStack(errs.NotFolder)
 		}
+		start := time.Now()
 		files, err := storage.List(ctx, dir, args)
+		metrics.ObserveDriverCall(storage.Config().Name, "list", start, err)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to list objs")
 		}
@@ -106,7 +111,7 @@ func list(ctx context.Context, storage driver.Driver, path string, args model.Li
 				}
 
 				duration := time.Minute * time.Duration(ttl)
-				Cache.dirCache.SetWithTTL(key, newDirectoryCache(files), duration)
+				Cache.setDirectory(key, files, duration)
 			} else {
 				log.Debugf("del cache: %s", key)
 				Cache.deleteDirectoryTree(key)
@@ -135,44 +140,20 @@ func Get(ctx context.Context, storage driver.Driver, path string, excludeTempObj
 
 	// is root folder
 	if path == "/" {
-		if getRooter, ok := storage.(driver.GetRooter); ok {
-			rootObj, err := getRooter.GetRoot(ctx)
-			if err != nil {
-				return nil, errors.WithMessage(err, "failed get root obj")
-			}
-			return rootObj, nil
-		}
-		switch r := storage.(type) {
-		case driver.IRootId:
-			return &model.Object{
-				ID:       r.GetRootId(),
-				Name:     RootName,
-				Modified: storage.GetStorage().Modified,
-				IsFolder: true,
-				Mask:     model.Locked,
-			}, nil
-		case driver.IRootPath:
-			return &model.Object{
-				Path:     r.GetRootPath(),
-				Name:     RootName,
-				Modified: storage.GetStorage().Modified,
-				Mask:     model.Locked,
-				IsFolder: true,
-			}, nil
-		}
-		return nil, errors.New("please implement GetRooter or IRootPath or IRootId interface")
+		return getRoot(ctx, storage)
 	}
 
 	// try get from cache first
 	dir, name := stdpath.Split(path)
-	dirCache, dirCacheExists := Cache.dirCache.Get(Key(storage, dir))
+	dirCache, dirCacheExists := Cache.getDirectory(Key(storage, dir))
 	refreshList := false
 	excludeTemp := utils.IsBool(excludeTempObj...)
 	if dirCacheExists {
 		files := dirCache.GetSortedObjects(storage)
 		for _, f := range files {
 			if f.GetName() == name {
-				if excludeTemp && model.ObjHasMask(f, model.Temp) {
+				// a restored object lacks the fields the driver needs
+				if excludeTemp && model.ObjHasMask(f, model.Temp) || isStoredObj(f) {
 					refreshList = true
 					break
 				}
@@ -214,6 +195,35 @@ func Get(ctx context.Context, storage driver.Driver, path string, excludeTempObj
 	return nil, errors.WithStack(errs.ObjectNotFound)
 }
 
+func getRoot(ctx context.Context, storage driver.Driver) (model.Obj, error) {
+	if getRooter, ok := storage.(driver.GetRooter); ok {
+		rootObj, err := getRooter.GetRoot(ctx)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed get root obj")
+		}
+		return rootObj, nil
+	}
+	switch r := storage.(type) {
+	case driver.IRootId:
+		return &model.Object{
+			ID:       r.GetRootId(),
+			Name:     RootName,
+			Modified: storage.GetStorage().Modified,
+			IsFolder: true,
+			Mask:     model.Locked,
+		}, nil
+	case driver.IRootPath:
+		return &model.Object{
+			Path:     r.GetRootPath(),
+			Name:     RootName,
+			Modified: storage.GetStorage().Modified,
+			Mask:     model.Locked,
+			IsFolder: true,
+		}, nil
+	}
+	return nil, errors.New("please implement GetRooter or IRootPath or IRootId interface")
+}
+
 func GetUnwrap(ctx context.Context, storage driver.Driver, path string) (model.Obj, error) {
 	obj, err := Get(ctx, storage, path, true)
 	if err != nil {
@@ -245,9 +255,11 @@ func Link(ctx context.Context, storage driver.Driver, path string, args model.Li
 	if ol, exists := Cache.linkCache.GetType(key, typeKey); exists {
 		if ol.link.Expiration != nil ||
 			ol.link.SyncClosers.AcquireReference() || !ol.link.RequireReference {
+			metrics.CacheLookup("link", true)
 			return ol.link, ol.obj, nil
 		}
 	}
+	metrics.CacheLookup("link", false)
 
 	fn := func() (*objWithLink, error) {
 		file, err := GetUnwrap(ctx, storage, path)
@@ -258,7 +270,9 @@ func Link(ctx context.Context, storage driver.Driver, path string, args model.Li
 			return nil, errors.WithStack(errs.NotFile)
 		}
 
+		start := time.Now()
 		link, err := storage.Link(ctx, file, args)
+		metrics.ObserveDriverCall(storage.Config().Name, "link", start, err)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed get link")
 		}
@@ -349,7 +363,7 @@ func MakeDir(ctx context.Context, storage driver.Driver, path string) error {
 		if storage.Config().NoCache {
 			return nil, nil
 		}
-		if dirCache, exist := Cache.dirCache.Get(Key(storage, parentPath)); exist {
+		if dirCache, exist := Cache.getDirectory(Key(storage, parentPath)); exist {
 			if newObj == nil {
 				t := time.Now()
 				newObj = &model.Object{
@@ -361,6 +375,7 @@ func MakeDir(ctx context.Context, storage driver.Driver, path string) error {
 				}
 			}
 			dirCache.UpdateObject("", wrapObjName(storage, newObj))
+			Cache.persistDirectory(Key(storage, parentPath), dirCache)
 		}
 		return nil, nil
 	})
@@ -409,26 +424,30 @@ func Move(ctx context.Context, storage driver.Driver, srcPath, dstDirPath string
 		return errors.WithStack(err)
 	}
 
+	moveObjectProps(storage, srcPath, stdpath.Join(dstDirPath, srcRawObj.GetName()))
+
 	srcKey := Key(storage, srcDirPath)
 	dstKey := Key(storage, dstDirPath)
 	if !srcRawObj.IsDir() {
-		Cache.linkCache.DeleteKey(stdpath.Join(srcKey, srcRawObj.GetName()))
-		Cache.linkCache.DeleteKey(stdpath.Join(dstKey, srcRawObj.GetName()))
+		Cache.deleteLink(stdpath.Join(srcKey, srcRawObj.GetName()))
+		Cache.deleteLink(stdpath.Join(dstKey, srcRawObj.GetName()))
 	}
 	if !storage.Config().NoCache {
-		if cache, exist := Cache.dirCache.Get(srcKey); exist {
+		if cache, exist := Cache.getDirectory(srcKey); exist {
 			if srcRawObj.IsDir() {
 				Cache.deleteDirectoryTree(stdpath.Join(srcKey, srcRawObj.GetName()))
 			}
 			cache.RemoveObject(srcRawObj.GetName())
+			Cache.persistDirectory(srcKey, cache)
 		}
-		if cache, exist := Cache.dirCache.Get(dstKey); exist {
+		if cache, exist := Cache.getDirectory(dstKey); exist {
 			if newObj == nil {
 				newObj = &model.ObjWrapMask{Obj: srcRawObj, Mask: model.Temp}
 			} else {
 				newObj = wrapObjName(storage, newObj)
 			}
 			cache.UpdateObject(srcRawObj.GetName(), newObj)
+			Cache.persistDirectory(dstKey, cache)
 		}
 	}
 
@@ -473,13 +492,15 @@ func Rename(ctx context.Context, storage driver.Driver, srcPath, dstName string)
 		return errors.WithStack(err)
 	}
 
+	moveObjectProps(storage, srcPath, stdpath.Join(stdpath.Dir(srcPath), dstName))
+
 	dirKey := Key(storage, stdpath.Dir(srcPath))
 	if !srcRawObj.IsDir() {
-		Cache.linkCache.DeleteKey(stdpath.Join(dirKey, srcRawObj.GetName()))
-		Cache.linkCache.DeleteKey(stdpath.Join(dirKey, dstName))
+		Cache.deleteLink(stdpath.Join(dirKey, srcRawObj.GetName()))
+		Cache.deleteLink(stdpath.Join(dirKey, dstName))
 	}
 	if !storage.Config().NoCache {
-		if cache, exist := Cache.dirCache.Get(dirKey); exist {
+		if cache, exist := Cache.getDirectory(dirKey); exist {
 			if srcRawObj.IsDir() {
 				Cache.deleteDirectoryTree(stdpath.Join(dirKey, srcRawObj.GetName()))
 			}
@@ -488,6 +509,7 @@ func Rename(ctx context.Context, storage driver.Driver, srcPath, dstName string)
 			}
 			newObj = wrapObjName(storage, newObj)
 			cache.UpdateObject(srcRawObj.GetName(), newObj)
+			Cache.persistDirectory(dirKey, cache)
 		}
 	}
 
@@ -544,16 +566,17 @@ func Copy(ctx context.Context, storage driver.Driver, srcPath, dstDirPath string
 
 	dstKey := Key(storage, dstDirPath)
 	if !srcRawObj.IsDir() {
-		Cache.linkCache.DeleteKey(stdpath.Join(dstKey, srcRawObj.GetName()))
+		Cache.deleteLink(stdpath.Join(dstKey, srcRawObj.GetName()))
 	}
 	if !storage.Config().NoCache {
-		if cache, exist := Cache.dirCache.Get(dstKey); exist {
+		if cache, exist := Cache.getDirectory(dstKey); exist {
 			if newObj == nil {
 				newObj = &model.ObjWrapMask{Obj: srcRawObj, Mask: model.Temp}
 			} else {
 				newObj = wrapObjName(storage, newObj)
 			}
 			cache.UpdateObject(srcRawObj.GetName(), newObj)
+			Cache.persistDirectory(dstKey, cache)
 		}
 	}
 
@@ -595,6 +618,7 @@ func Remove(ctx context.Context, storage driver.Driver, path string) error {
 		err = s.Remove(ctx, model.UnwrapObjName(rawObj))
 		if err == nil {
 			Cache.removeDirectoryObject(storage, dirPath, rawObj)
+			removeObjectProps(storage, path)
 		}
 	default:
 		return errs.NotImplement
@@ -663,6 +687,7 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 	}
 
 	var newObj model.Obj
+	start := time.Now()
 	switch s := storage.(type) {
 	case driver.PutResult:
 		newObj, err = s.Put(ctx, parentDir, file, up)
@@ -671,10 +696,11 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 	default:
 		return errs.NotImplement
 	}
+	metrics.ObserveDriverCall(storage.Config().Name, "put", start, err)
 	if err == nil {
-		Cache.linkCache.DeleteKey(Key(storage, dstPath))
+		Cache.deleteLink(Key(storage, dstPath))
 		if !storage.Config().NoCache {
-			if cache, exist := Cache.dirCache.Get(Key(storage, dstDirPath)); exist {
+			if cache, exist := Cache.getDirectory(Key(storage, dstDirPath)); exist {
 				if newObj == nil {
 					newObj = &model.Object{
 						Name:     file.GetName(),
@@ -686,6 +712,7 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 				}
 				newObj = wrapObjName(storage, newObj)
 				cache.UpdateObject(newObj.GetName(), newObj)
+				Cache.persistDirectory(Key(storage, dstDirPath), cache)
 			}
 		}
 
@@ -740,9 +767,9 @@ func PutURL(ctx context.Context, storage driver.Driver, dstDirPath, dstName, url
 		return errors.WithStack(errs.NotImplement)
 	}
 	if err == nil {
-		Cache.linkCache.DeleteKey(Key(storage, dstPath))
+		Cache.deleteLink(Key(storage, dstPath))
 		if !storage.Config().NoCache {
-			if cache, exist := Cache.dirCache.Get(Key(storage, dstDirPath)); exist {
+			if cache, exist := Cache.getDirectory(Key(storage, dstDirPath)); exist {
 				if newObj == nil {
 					t := time.Now()
 					newObj = &model.Object{
@@ -754,6 +781,7 @@ func PutURL(ctx context.Context, storage driver.Driver, dstDirPath, dstName, url
 				}
 				newObj = wrapObjName(storage, newObj)
 				cache.UpdateObject(newObj.GetName(), newObj)
+				Cache.persistDirectory(Key(storage, dstDirPath), cache)
 			}
 
 			if ctx.Value(conf.SkipHookKey) == nil && needHandleObjsUpdateHook() {
@@ -0,0 +1,57 @@
+package op
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// GetS3ObjectMeta returns the S3 metadata of the object at the full path, nil if there is none
+func GetS3ObjectMeta(path string) (*model.S3ObjectMeta, error) {
+	m, err := db.GetS3ObjectMeta(utils.FixAndCleanPath(path))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return m, err
+}
+
+// SaveS3ObjectMeta replaces the S3 metadata of the object at the full path m.Path
+func SaveS3ObjectMeta(m *model.S3ObjectMeta) error {
+	m.Path = utils.FixAndCleanPath(m.Path)
+	return db.SaveS3ObjectMeta(m)
+}
+
+// MoveS3ObjectMeta moves the S3 metadata of the object at the full path srcPath, and of the objects under it, to dstPath
+func MoveS3ObjectMeta(srcPath, dstPath string) error {
+	return db.MoveS3ObjectMeta(utils.FixAndCleanPath(srcPath), utils.FixAndCleanPath(dstPath))
+}
+
+// GetS3ObjectVersion returns the noncurrent version or the delete marker of the object at the full path, nil if there is none
+func GetS3ObjectVersion(path, versionID string) (*model.S3ObjectVersion, error) {
+	v, err := db.GetS3ObjectVersion(utils.FixAndCleanPath(path), versionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// GetS3ObjectVersions returns the noncurrent versions and the delete markers of the object at the full path, the newest first
+func GetS3ObjectVersions(path string) ([]model.S3ObjectVersion, error) {
+	return db.GetS3ObjectVersions(utils.FixAndCleanPath(path))
+}
+
+// GetS3ObjectVersionsByPrefix returns the versions of the objects whose full paths start with prefix, sorted by path and the newest first
+func GetS3ObjectVersionsByPrefix(prefix string) ([]model.S3ObjectVersion, error) {
+	return db.GetS3ObjectVersionsByPrefix(prefix)
+}
+
+func CreateS3ObjectVersion(v *model.S3ObjectVersion) error {
+	v.Path = utils.FixAndCleanPath(v.Path)
+	return db.CreateS3ObjectVersion(v)
+}
+
+func DeleteS3ObjectVersion(id uint) error {
+	return db.DeleteS3ObjectVersion(id)
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
 	"github.com/OpenListTeam/OpenList/v4/internal/db"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
@@ -30,6 +31,11 @@ func RegisterSettingChangingCallback(f func()) {
 
 func SettingCacheUpdate() {
 	Cache.ClearAll()
+	runSettingChangingCallbacks()
+	coord.Publish(eventSettings, "")
+}
+
+func runSettingChangingCallbacks() {
 	for _, cb := range settingChangingCallbacks {
 		cb()
 	}
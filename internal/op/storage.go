@@ -285,6 +285,20 @@ func DeleteStorageById(ctx context.Context, id uint) error {
 	return dropErr
 }
 
+// UnloadAllStorages drops all loaded storages and removes them from memory,
+// the database is not touched
+func UnloadAllStorages(ctx context.Context) {
+	for _, storageDriver := range storagesMap.Values() {
+		if err := storageDriver.Drop(ctx); err != nil {
+			log.Errorf("failed drop storage [%s]: %+v", storageDriver.GetStorage().MountPath, err)
+		}
+		storagesMap.Delete(storageDriver.GetStorage().MountPath)
+		Cache.DeleteDirectoryTree(storageDriver, "/")
+		Cache.InvalidateStorageDetails(storageDriver)
+		go callStorageHooks("del", storageDriver)
+	}
+}
+
 // MustSaveDriverStorage call from specific driver
 func MustSaveDriverStorage(driver driver.Driver) {
 	err := saveDriverStorage(driver)
@@ -444,6 +458,16 @@ func getStorageVirtualFilesByPath(prefix string, rootCallback func(driver.Driver
 
 var balanceMap generic_sync.MapOf[string, int]
 
+// GetStorageOfPath returns the storage path belongs to without moving the balance,
+// for balanced storages it is the first one
+func GetStorageOfPath(path string) driver.Driver {
+	storages := getStoragesByPath(utils.FixAndCleanPath(path))
+	if len(storages) == 0 {
+		return nil
+	}
+	return storages[0]
+}
+
 // GetBalancedStorage get storage by path
 func GetBalancedStorage(path string) driver.Driver {
 	path = utils.FixAndCleanPath(path)
@@ -488,3 +512,32 @@ func GetStorageDetails(ctx context.Context, storage driver.Driver, refresh ...bo
 	})
 	return details, err
 }
+
+// GetStorageDetailsByPath returns the details of the storage the path is in,
+// the details of the storages under a virtual path are summed up
+func GetStorageDetailsByPath(ctx context.Context, path string) (*model.StorageDetails, error) {
+	path = utils.FixAndCleanPath(path)
+	if storage, _, err := GetStorageAndActualPath(path); err == nil {
+		return GetStorageDetails(ctx, storage)
+	}
+	var sum model.StorageDetails
+	found := false
+	for _, storage := range GetAllStorages() {
+		mountPath := storage.GetStorage().MountPath
+		// the balanced storages share the details of the main one
+		if utils.GetActualMountPath(mountPath) != mountPath || !utils.IsSubPath(path, mountPath) {
+			continue
+		}
+		details, err := GetStorageDetails(ctx, storage)
+		if err != nil {
+			continue
+		}
+		sum.TotalSpace += details.TotalSpace
+		sum.UsedSpace += details.UsedSpace
+		found = true
+	}
+	if !found {
+		return nil, errs.NotImplement
+	}
+	return &sum, nil
+}
@@ -0,0 +1,206 @@
+package op
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	healthProbeTimeout = 30 * time.Second
+	healthMinBackoff   = time.Minute
+)
+
+// StorageHealthHook is called when a storage turns healthy or unhealthy
+type StorageHealthHook func(prev, cur model.StorageHealth)
+
+var (
+	healthMu      sync.Mutex
+	healthMap     = make(map[string]*model.StorageHealth)
+	healthHooks   []StorageHealthHook
+	healthRunning sync.Mutex
+)
+
+func RegisterStorageHealthHook(hook StorageHealthHook) {
+	healthHooks = append(healthHooks, hook)
+}
+
+// GetStoragesHealth returns the health of all loaded storages sorted by mount path,
+// storages which were not checked yet are reported by their status only
+func GetStoragesHealth() []model.StorageHealth {
+	storages := GetAllStorages()
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	ret := make([]model.StorageHealth, 0, len(storages))
+	for _, storage := range storages {
+		s := storage.GetStorage()
+		if h, ok := healthMap[s.MountPath]; ok {
+			h.Status = s.Status
+			ret = append(ret, *h)
+			continue
+		}
+		ret = append(ret, model.StorageHealth{
+			ID:        s.ID,
+			MountPath: s.MountPath,
+			Driver:    s.Driver,
+			Status:    s.Status,
+			Healthy:   s.Status == WORK,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].MountPath < ret[j].MountPath })
+	return ret
+}
+
+// CheckStoragesHealth checks every storage whose next check is due.
+// A healthy storage is checked again after interval, a failing one sooner with a growing backoff.
+// It returns at once if the previous run is still going.
+func CheckStoragesHealth(ctx context.Context, interval time.Duration) {
+	if !healthRunning.TryLock() {
+		return
+	}
+	defer healthRunning.Unlock()
+	now := time.Now()
+	loaded := make(map[string]struct{})
+	for _, storage := range GetAllStorages() {
+		s := storage.GetStorage()
+		loaded[s.MountPath] = struct{}{}
+		if s.Disabled {
+			continue
+		}
+		healthMu.Lock()
+		h, ok := healthMap[s.MountPath]
+		healthMu.Unlock()
+		if ok && now.Before(h.NextCheck) {
+			continue
+		}
+		CheckStorageHealth(ctx, storage, interval)
+	}
+	// forget storages which were removed or renamed
+	healthMu.Lock()
+	for mountPath := range healthMap {
+		if _, ok := loaded[mountPath]; !ok {
+			delete(healthMap, mountPath)
+		}
+	}
+	healthMu.Unlock()
+}
+
+// CheckStorageHealth probes the storage at once by listing its root.
+// If the probe fails with what looks like an authorization error, or the storage failed to init,
+// the storage is initialized again so expired tokens get refreshed.
+func CheckStorageHealth(ctx context.Context, storage driver.Driver, interval time.Duration) model.StorageHealth {
+	s := storage.GetStorage()
+	healthMu.Lock()
+	prev, ok := healthMap[s.MountPath]
+	if !ok {
+		prev = &model.StorageHealth{Healthy: s.Status == WORK}
+	}
+	cur := *prev
+	healthMu.Unlock()
+
+	var err error
+	if s.Status == WORK {
+		err = probeStorage(ctx, storage)
+		if err != nil && isAuthError(err) {
+			log.Warnf("storage [%s] seems to lose its authorization, init it again: %s", s.MountPath, err)
+			err = reinitStorage(ctx, storage)
+		}
+	} else {
+		err = reinitStorage(ctx, storage)
+	}
+	if err != nil && s.Status == WORK {
+		// the storage stays in use only while it works, the next check initializes it again
+		if IsUseOnlineAPI(storage) {
+			s.SetStatus(utils.SanitizeHTML(err.Error()))
+		} else {
+			s.SetStatus(err.Error())
+		}
+		MustSaveDriverStorage(storage)
+	}
+
+	now := time.Now()
+	cur.ID, cur.MountPath, cur.Driver, cur.Status = s.ID, s.MountPath, s.Driver, s.Status
+	cur.LastCheck = now
+	if err == nil {
+		cur.Healthy = true
+		cur.Failures = 0
+		cur.LastSuccess = now
+		cur.NextCheck = now.Add(interval)
+	} else {
+		cur.Healthy = false
+		cur.Failures++
+		cur.LastError = err.Error()
+		cur.LastErrorAt = now
+		backoff := healthMinBackoff << min(cur.Failures-1, 16)
+		cur.NextCheck = now.Add(min(backoff, max(interval, healthMinBackoff)))
+	}
+	healthMu.Lock()
+	healthMap[s.MountPath] = &cur
+	healthMu.Unlock()
+	if cur.Healthy != prev.Healthy {
+		if cur.Healthy {
+			log.Infof("storage [%s] is healthy again", s.MountPath)
+		} else {
+			log.Warnf("storage [%s] is unhealthy: %s", s.MountPath, cur.LastError)
+		}
+		for _, hook := range healthHooks {
+			hook(*prev, cur)
+		}
+	}
+	return cur
+}
+
+func probeStorage(ctx context.Context, storage driver.Driver) error {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+	root, err := getRoot(ctx, storage)
+	if err != nil {
+		return err
+	}
+	_, err = storage.List(ctx, root, model.ListArgs{})
+	return errors.WithMessage(err, "failed list root")
+}
+
+// reinitStorage drops the driver and initializes it again from the database copy of the storage
+func reinitStorage(ctx context.Context, storage driver.Driver) error {
+	s, err := db.GetStorageById(storage.GetStorage().ID)
+	if err != nil {
+		return errors.WithMessage(err, "failed get storage")
+	}
+	if s.Disabled || s.MountPath != storage.GetStorage().MountPath {
+		// changed meanwhile, UpdateStorage or DisableStorage takes care of it
+		return nil
+	}
+	if err = storage.Drop(ctx); err != nil {
+		log.Warnf("failed drop storage [%s]: %+v", s.MountPath, err)
+	}
+	if err = initStorage(ctx, *s, storage); err != nil {
+		return err
+	}
+	Cache.DeleteDirectoryTree(storage, "/")
+	Cache.InvalidateStorageDetails(storage)
+	go callStorageHooks("update", storage)
+	return probeStorage(ctx, storage)
+}
+
+// authErrorPattern matches the messages of failed authorizations as whole words,
+// a 401 only next to what tells it is a status code
+var authErrorPattern = regexp.MustCompile(`(?i)\b(?:unauthori[sz]ed|unauthenticated|invalid_grant|` +
+	`(?:access|refresh) token (?:is |has )?(?:expired|invalid)|(?:expired|invalid) (?:access |refresh )?token|` +
+	`token (?:is |has )?expired|not logged in|login (?:required|expired)|log ?in again|re-?login)\b|` +
+	`\b(?:status(?: ?code)?|http(?:/[\d.]+)?|code)[\s:=]*401\b`)
+
+// isAuthError guesses from the message whether the request failed because of the credentials,
+// drivers report these errors in many different ways
+func isAuthError(err error) bool {
+	return authErrorPattern.MatchString(err.Error())
+}
@@ -0,0 +1,67 @@
+package op_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+func TestCheckStorageHealth(t *testing.T) {
+	var storages = []struct {
+		storage model.Storage
+		healthy bool
+	}{
+		{storage: model.Storage{Driver: "Local", MountPath: "/health/ok", Addition: `{"root_folder_path":"."}`}, healthy: true},
+		{storage: model.Storage{Driver: "Local", MountPath: "/health/lost", Addition: `{"root_folder_path":"./not_exist"}`}, healthy: false},
+	}
+	for _, s := range storages {
+		_, _ = op.CreateStorage(context.Background(), s.storage)
+		storage, err := op.GetStorageByMountPath(s.storage.MountPath)
+		if err != nil {
+			t.Fatalf("failed get storage: %+v", err)
+		}
+		h := op.CheckStorageHealth(context.Background(), storage, time.Hour)
+		if h.Healthy != s.healthy {
+			t.Errorf("%s: expected healthy %v, got %+v", s.storage.MountPath, s.healthy, h)
+		}
+		if !s.healthy && (h.Failures != 1 || h.LastError == "" || !h.NextCheck.Before(time.Now().Add(time.Hour))) {
+			t.Errorf("%s: expected a failure checked again sooner, got %+v", s.storage.MountPath, h)
+		}
+	}
+}
+
+func TestCheckStorageHealthStatus(t *testing.T) {
+	root := t.TempDir()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	_, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: "/health/gone", Addition: addition})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := op.GetStorageByMountPath("/health/gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(root); err != nil {
+		t.Fatal(err)
+	}
+	if h := op.CheckStorageHealth(context.Background(), storage, time.Hour); h.Healthy {
+		t.Fatalf("expected the probe to fail, got %+v", h)
+	}
+	status := storage.GetStorage().Status
+	if status == op.WORK {
+		t.Errorf("expected the status to tell the failure")
+	}
+	saved, err := db.GetStorageById(storage.GetStorage().ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != status {
+		t.Errorf("expected the status %q to be saved, got %q", status, saved.Status)
+	}
+}
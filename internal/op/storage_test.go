@@ -71,6 +71,25 @@ func TestGetBalancedStorage(t *testing.T) {
 	}
 }
 
+func TestGetStorageDetailsByPath(t *testing.T) {
+	ctx := context.Background()
+	single, err := op.GetStorageDetailsByPath(ctx, "/a/b/x")
+	if err != nil {
+		t.Fatalf("failed get details: %+v", err)
+	}
+	// /a/b, /a/c, /a/d, /a/d/e1 and /a/d/e, the balanced storage is not counted
+	sum, err := op.GetStorageDetailsByPath(ctx, "/a")
+	if err != nil {
+		t.Fatalf("failed get details: %+v", err)
+	}
+	if sum.TotalSpace != 5*single.TotalSpace {
+		t.Errorf("expected total space %d, got %d", 5*single.TotalSpace, sum.TotalSpace)
+	}
+	if _, err = op.GetStorageDetailsByPath(ctx, "/none"); err == nil {
+		t.Errorf("expected error for a path without storages")
+	}
+}
+
 func setupStorages(t *testing.T) {
 	var storages = []model.Storage{
 		{Driver: "Local", MountPath: "/a/b", Order: 0, Addition: `{"root_folder_path":"."}`},
@@ -0,0 +1,240 @@
+// Package resumable keeps uploads that arrive in several requests.
+// The data is staged in a file under the temp dir and the session is saved in the database,
+// so an upload can continue after the connection dropped or the server restarted.
+package resumable
+
+import (
+	"context"
+	"io"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DirName is the folder in the temp dir holding the staged uploads, it is kept by CleanTempDir
+const DirName = "resumable"
+
+var (
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrSessionBusy    = errors.New("upload session is being written")
+	ErrSessionExpired = errors.New("upload session expired")
+
+	locks sync.Map // session id -> *sync.Mutex
+	clean *cron.Cron
+)
+
+func stagingDir() string {
+	return filepath.Join(conf.Conf.TempDir, DirName)
+}
+
+func stagingPath(id string) string {
+	return filepath.Join(stagingDir(), id)
+}
+
+func expireAfter() time.Duration {
+	return time.Duration(setting.GetInt(conf.ResumableUploadExpire, 24)) * time.Hour
+}
+
+// Create starts a session for a file of the given size, path is the full path of the file
+func Create(s *model.UploadSession) error {
+	if s.Size < 0 {
+		return errors.New("upload length is required")
+	}
+	if err := os.MkdirAll(stagingDir(), 0o777); err != nil {
+		return errors.WithStack(err)
+	}
+	s.ID = uuid.NewString()
+	s.Offset = 0
+	s.ExpiresAt = time.Now().Add(expireAfter())
+	f, err := os.Create(stagingPath(s.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_ = f.Close()
+	if err = db.CreateUploadSession(s); err != nil {
+		_ = os.Remove(stagingPath(s.ID))
+		return err
+	}
+	return nil
+}
+
+func lock(id string) *sync.Mutex {
+	l, _ := locks.LoadOrStore(id, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+// Get returns the session, with the offset corrected to what the staged file really holds
+func Get(id string) (*model.UploadSession, error) {
+	mu := lock(id)
+	if !mu.TryLock() {
+		// a write is going on, it saves the offset when it is done
+		return db.GetUploadSessionById(id)
+	}
+	defer mu.Unlock()
+	return load(id)
+}
+
+// load reads the session, the caller holds its lock
+func load(id string) (*model.UploadSession, error) {
+	s, err := db.GetUploadSessionById(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.ExpiresAt) {
+		if err = remove(id); err != nil {
+			log.Warnf("failed remove expired upload session %s: %+v", id, err)
+		}
+		return nil, ErrSessionExpired
+	}
+	info, err := os.Stat(stagingPath(id))
+	if err != nil {
+		_ = db.DeleteUploadSessionById(id)
+		return nil, errors.WithMessage(err, "staged file of upload session is lost")
+	}
+	// the offset is saved after the data is written, a crash in between leaves more data than recorded
+	if info.Size() != s.Offset {
+		s.Offset = min(info.Size(), s.Size)
+		if err = db.UpdateUploadSession(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Write appends the data read from r at offset, which must be the current offset of the session.
+// The session is read again once it is locked, since another request may have written meanwhile.
+// It returns the new offset.
+func Write(s *model.UploadSession, offset int64, r io.Reader) (int64, error) {
+	mu := lock(s.ID)
+	if !mu.TryLock() {
+		return s.Offset, ErrSessionBusy
+	}
+	defer mu.Unlock()
+	cur, err := load(s.ID)
+	if err != nil {
+		return s.Offset, err
+	}
+	*s = *cur
+	if offset != s.Offset {
+		return s.Offset, ErrOffsetMismatch
+	}
+	f, err := os.OpenFile(stagingPath(s.ID), os.O_WRONLY, 0o666)
+	if err != nil {
+		return s.Offset, errors.WithStack(err)
+	}
+	if err = f.Truncate(offset); err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	var n int64
+	if err == nil {
+		n, err = utils.CopyWithBuffer(f, io.LimitReader(r, s.Size-offset))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	// keep what arrived even if the connection broke, the client continues from here
+	s.Offset += n
+	s.ExpiresAt = time.Now().Add(expireAfter())
+	if uerr := db.UpdateUploadSession(s); uerr != nil && err == nil {
+		err = uerr
+	}
+	return s.Offset, errors.WithStack(err)
+}
+
+// Finish hands the complete staged file to an upload task.
+// The staged file and the session are removed once the put succeeded, so a failed one can be finished again.
+func Finish(ctx context.Context, s *model.UploadSession) (task.TaskExtensionInfo, error) {
+	if s.Offset != s.Size {
+		return nil, errors.Errorf("upload is incomplete, %d of %d bytes received", s.Offset, s.Size)
+	}
+	f, err := os.Open(stagingPath(s.ID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dir, name := stdpath.Split(s.Path)
+	id := s.ID
+	file := &stream.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     s.Size,
+			Modified: s.Modified,
+		},
+		Reader:       f,
+		Mimetype:     s.Mimetype,
+		WebPutAsTask: true,
+		Closers:      utils.NewClosers(f),
+	}
+	t, err := fs.PutAsTask(ctx, dir, file, func() {
+		if err := remove(id); err != nil {
+			log.Warnf("failed remove upload session %s: %+v", id, err)
+		}
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Delete aborts the upload
+func Delete(s *model.UploadSession) error {
+	return remove(s.ID)
+}
+
+func remove(id string) error {
+	locks.Delete(id)
+	if err := os.Remove(stagingPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("failed remove staged upload %s: %+v", id, err)
+	}
+	return db.DeleteUploadSessionById(id)
+}
+
+// Clean removes expired sessions and staged files which have no session
+func Clean() {
+	sessions, err := db.GetExpiredUploadSessions(time.Now())
+	if err != nil {
+		log.Errorf("failed get expired upload sessions: %+v", err)
+		return
+	}
+	for _, s := range sessions {
+		if err = remove(s.ID); err != nil {
+			log.Errorf("failed remove upload session %s: %+v", s.ID, err)
+		}
+	}
+	ids, err := db.GetUploadSessionIds()
+	if err != nil {
+		log.Errorf("failed get upload sessions: %+v", err)
+		return
+	}
+	entries, err := os.ReadDir(stagingDir())
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !utils.SliceContains(ids, e.Name()) {
+			_ = os.Remove(filepath.Join(stagingDir(), e.Name()))
+		}
+	}
+}
+
+// Init cleans up once and then every hour
+func Init() {
+	Clean()
+	clean = cron.NewCron(time.Hour)
+	clean.Do(Clean)
+}
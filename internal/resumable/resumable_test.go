@@ -0,0 +1,225 @@
+package resumable
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/tache"
+	"github.com/glebarez/sqlite"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+func newSession(t *testing.T, size int64) *model.UploadSession {
+	conf.Conf.TempDir = t.TempDir()
+	s := &model.UploadSession{Path: "/resumable/file.txt", Size: size}
+	if err := Create(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func staged(t *testing.T, s *model.UploadSession) string {
+	data, err := os.ReadFile(stagingPath(s.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteOffsetMismatch(t *testing.T) {
+	s := newSession(t, 6)
+	if off, err := Write(s, 0, strings.NewReader("abc")); err != nil || off != 3 {
+		t.Fatalf("unexpected write: %d %v", off, err)
+	}
+	off, err := Write(s, 1, strings.NewReader("xyz"))
+	if !errors.Is(err, ErrOffsetMismatch) || off != 3 {
+		t.Errorf("expected a mismatch at 3, got %d %v", off, err)
+	}
+	if got := staged(t, s); got != "abc" {
+		t.Errorf("staged data changed: %q", got)
+	}
+}
+
+func TestWriteConcurrent(t *testing.T) {
+	s := newSession(t, 6)
+	// both requests read the session before either wrote
+	first, _ := Get(s.ID)
+	second, _ := Get(s.ID)
+
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := Write(first, 0, pr)
+		done <- err
+	}()
+	if _, err := pw.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(second, 0, strings.NewReader("xyz")); !errors.Is(err, ErrSessionBusy) {
+		t.Errorf("expected the session to be busy, got %v", err)
+	}
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale session is read again, so the data already written is not truncated
+	off, err := Write(second, 0, strings.NewReader("xyz"))
+	if !errors.Is(err, ErrOffsetMismatch) || off != 3 {
+		t.Errorf("expected a mismatch at 3, got %d %v", off, err)
+	}
+	if got := staged(t, s); got != "abc" {
+		t.Errorf("staged data changed: %q", got)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s := newSession(t, 6)
+	s.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := db.UpdateUploadSession(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(s, 0, strings.NewReader("abc")); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected the session to be expired, got %v", err)
+	}
+	if _, err := os.Stat(stagingPath(s.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the staged file to be removed, got %v", err)
+	}
+	if _, err := Get(s.ID); err == nil {
+		t.Errorf("expected the session to be removed")
+	}
+}
+
+func TestFinish(t *testing.T) {
+	root := t.TempDir()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: "/resumable", Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	fs.UploadTaskManager = tache.NewManager[*fs.UploadTask](tache.WithWorks(1))
+	ctx := context.WithValue(context.Background(), conf.UserKey, &model.User{ID: 1, Role: model.ADMIN})
+
+	s := newSession(t, 6)
+	if _, err := Write(s, 0, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Finish(ctx, s); err == nil {
+		t.Fatal("expected an incomplete upload to be refused")
+	}
+	if _, err := Write(s, 3, strings.NewReader("def")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Finish(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	// the task closes the stream after the upload, which removes the session
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := db.GetUploadSessionById(s.ID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session not removed after the upload")
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "file.txt"))
+	if err != nil || string(data) != "abcdef" {
+		t.Errorf("unexpected uploaded file %q: %v", data, err)
+	}
+	if _, err = os.Stat(stagingPath(s.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the staged file to be removed, got %v", err)
+	}
+}
+
+func TestFinishFailed(t *testing.T) {
+	root := t.TempDir()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: "/resumable_failed", Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	fs.UploadTaskManager = tache.NewManager[*fs.UploadTask](tache.WithWorks(1))
+	ctx := context.WithValue(context.Background(), conf.UserKey, &model.User{ID: 1, Role: model.ADMIN})
+
+	conf.Conf.TempDir = t.TempDir()
+	s := &model.UploadSession{Path: "/resumable_failed/file.txt", Size: 3}
+	if err := Create(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(s, 0, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	// the put fails since the root of the storage is a file
+	if err := os.Remove(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(root, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ut, err := Finish(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ut.GetState() != tache.StateFailed; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the put did not fail: %v", ut.GetState())
+		}
+	}
+	if _, err = db.GetUploadSessionById(s.ID); err != nil {
+		t.Fatalf("the session is removed after a failed put: %v", err)
+	}
+	if got := staged(t, s); got != "abc" {
+		t.Fatalf("staged data changed: %q", got)
+	}
+
+	// a failure to add the task keeps it as well
+	s.Path = "/resumable_missing/file.txt"
+	if _, err = Finish(ctx, s); err == nil {
+		t.Fatal("expected a put to a missing storage to fail")
+	}
+	if _, err = db.GetUploadSessionById(s.ID); err != nil {
+		t.Fatalf("the session is removed after a failed finish: %v", err)
+	}
+
+	// the upload is finished again once the storage works
+	s.Path = "/resumable_failed/file.txt"
+	_ = os.Remove(root)
+	if err = os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Finish(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := db.GetUploadSessionById(s.ID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session not removed after the upload")
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "file.txt"))
+	if err != nil || string(data) != "abc" {
+		t.Errorf("unexpected uploaded file %q: %v", data, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -206,6 +207,7 @@ func Update(ctx context.Context, parent string, objs []model.Obj) {
 	if isIgnorePath(parent) {
 		return
 	}
+	objs = model.HideS3Versions(slices.Clone(objs))
 	// only update when index have built
 	progress, err := Progress()
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/search/searcher"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -51,6 +52,27 @@ func Search(ctx context.Context, req model.SearchReq) ([]model.SearchNode, int64
 	return instance.Search(ctx, req)
 }
 
+// Get returns the indexed children of the parent
+func Get(ctx context.Context, parent string) ([]model.SearchNode, error) {
+	if instance == nil {
+		return nil, errs.SearchNotAvailable
+	}
+	return instance.Get(ctx, parent)
+}
+
+// Covers reports whether the index has been built and is kept up to date for the path,
+// so that it can stand in for listing the path
+func Covers(path string) bool {
+	if instance == nil || !instance.Config().AutoUpdate || !setting.GetBool(conf.AutoUpdateIndex) || Running() {
+		return false
+	}
+	if isIgnorePath(path) {
+		return false
+	}
+	progress, err := Progress()
+	return err == nil && progress.IsDone && progress.Error == ""
+}
+
 func Index(ctx context.Context, parent string, obj model.Obj) error {
 	if instance == nil {
 		return errs.SearchNotAvailable
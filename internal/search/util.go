@@ -73,6 +73,9 @@ func updateIgnorePaths(customIgnorePaths string) {
 }
 
 func isIgnorePath(path string) bool {
+	if model.IsS3VersionsPath(path) {
+		return true
+	}
 	for _, ignorePath := range conf.SlicesMap[conf.IgnorePaths] {
 		if strings.HasPrefix(path, ignorePath) {
 			return true
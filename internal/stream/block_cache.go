@@ -0,0 +1,336 @@
+package stream
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadCache keeps the byte ranges served by the proxy on the local disk, nil if disabled
+var ReadCache *BlockCache
+
+// BlockCache stores fixed size blocks of files in a directory,
+// the least recently used blocks are evicted when the size exceeds maxSize.
+// A block is stored in dir/<key[:2]>/<key>-<index>, the key identifies the content of the file.
+type BlockCache struct {
+	dir       string
+	blockSize int64
+	maxSize   int64
+
+	mu    sync.Mutex
+	lru   *list.List // *cachedBlock, the front is the most recently used
+	index map[string]*list.Element
+	size  int64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cachedBlock struct {
+	name string
+	size int64
+}
+
+// BlockCacheKey identifies a version of a file, a modified file gets a new key.
+// The files without a modified time must not be cached, their key doesn't change.
+func BlockCacheKey(storageID uint, path string, size int64, modified time.Time) string {
+	h := sha1.Sum(fmt.Appendf(nil, "%d\x00%s\x00%d\x00%d", storageID, path, size, modified.UnixNano()))
+	return hex.EncodeToString(h[:])
+}
+
+// NewBlockCache opens the cache in dir, the blocks stored before are kept
+func NewBlockCache(dir string, blockSize, maxSize int64) (*BlockCache, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("invalid block size")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c := &BlockCache{
+		dir:       dir,
+		blockSize: blockSize,
+		maxSize:   maxSize,
+		lru:       list.New(),
+		index:     make(map[string]*list.Element),
+	}
+	type stored struct {
+		cachedBlock
+		modified time.Time
+	}
+	var blocks []stored
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(d.Name(), ".tmp") {
+			_ = os.Remove(path)
+			return nil
+		}
+		// the other files in dir aren't blocks
+		if !blockNameRe.MatchString(d.Name()) || path != c.path(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		blocks = append(blocks, stored{cachedBlock{name: d.Name(), size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// the blocks written last are considered the most recently used
+	slices.SortFunc(blocks, func(a, b stored) int { return a.modified.Compare(b.modified) })
+	for _, b := range blocks {
+		c.index[b.name] = c.lru.PushFront(&b.cachedBlock)
+		c.size += b.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Stats returns the number of blocks read from the cache and from the upstream, and the size in bytes
+func (c *BlockCache) Stats() (hits, misses, size int64) {
+	c.mu.Lock()
+	size = c.size
+	c.mu.Unlock()
+	return c.hits.Load(), c.misses.Load(), size
+}
+
+func (c *BlockCache) path(name string) string {
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+var blockNameRe = regexp.MustCompile(`^[0-9a-f]{40}-\d+$`)
+
+func blockName(key string, index int64) string {
+	return key + "-" + strconv.FormatInt(index, 10)
+}
+
+func (c *BlockCache) has(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.index[name]
+	return ok
+}
+
+// load reads the block into buf, which has the expected size of the block
+func (c *BlockCache) load(name string, buf []byte) bool {
+	c.mu.Lock()
+	e, ok := c.index[name]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	f, err := os.Open(c.path(name))
+	if err == nil {
+		_, err = io.ReadFull(f, buf)
+		_ = f.Close()
+	}
+	if err != nil {
+		log.Warnf("failed read block %s of read cache: %+v", name, err)
+		c.remove(name)
+		return false
+	}
+	return true
+}
+
+func (c *BlockCache) store(name string, data []byte) {
+	path := c.path(name)
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err == nil {
+		// another reader may store the same block, the rename keeps the file complete
+		tmp := fmt.Sprintf("%s.%d.tmp", path, time.Now().UnixNano())
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			if err = os.Rename(tmp, path); err != nil {
+				_ = os.Remove(tmp)
+			}
+		}
+	}
+	if err != nil {
+		log.Warnf("failed write block %s of read cache: %+v", name, err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.index[name]; ok {
+		b := e.Value.(*cachedBlock)
+		c.size += int64(len(data)) - b.size
+		b.size = int64(len(data))
+		c.lru.MoveToFront(e)
+	} else {
+		c.index[name] = c.lru.PushFront(&cachedBlock{name: name, size: int64(len(data))})
+		c.size += int64(len(data))
+	}
+	c.evict()
+}
+
+func (c *BlockCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.index[name]; ok {
+		c.drop(e)
+	}
+}
+
+// evict removes the least recently used blocks until the size is below maxSize, c.mu must be held
+func (c *BlockCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.drop(c.lru.Back())
+	}
+}
+
+func (c *BlockCache) drop(e *list.Element) {
+	b := c.lru.Remove(e).(*cachedBlock)
+	delete(c.index, b.name)
+	c.size -= b.size
+	if err := os.Remove(c.path(b.name)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("failed remove block %s of read cache: %+v", b.name, err)
+	}
+}
+
+// RangeReader returns a RangeReaderIF reading the blocks of the file from the cache,
+// the missing blocks are fetched with rr and stored
+func (c *BlockCache) RangeReader(key string, size int64, rr model.RangeReaderIF) model.RangeReaderIF {
+	return RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+		if httpRange.Length < 0 || httpRange.Start+httpRange.Length > size {
+			httpRange.Length = size - httpRange.Start
+		}
+		r := &blockReader{
+			ctx:  ctx,
+			c:    c,
+			rr:   rr,
+			key:  key,
+			size: size,
+			pos:  httpRange.Start,
+			end:  httpRange.Start + httpRange.Length,
+		}
+		if r.pos >= r.end {
+			return r, nil
+		}
+		// the first block is read now, so the errors of the upstream are returned before anything is sent
+		if err := r.fill(); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		return r, nil
+	})
+}
+
+type blockReader struct {
+	ctx  context.Context
+	c    *BlockCache
+	rr   model.RangeReaderIF
+	key  string
+	size int64
+	// pos and end are the remaining part of the requested range
+	pos, end int64
+	block    []byte
+	// buf is the part of the current block which is not read yet
+	buf []byte
+	// upstream reads the missing blocks from upPos until upEnd
+	upstream     io.ReadCloser
+	upPos, upEnd int64
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	if r.pos >= r.end {
+		return 0, io.EOF
+	}
+	if len(r.buf) == 0 {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// fill reads the block containing pos into buf
+func (r *blockReader) fill() error {
+	bs := r.c.blockSize
+	index := r.pos / bs
+	start := index * bs
+	length := min(bs, r.size-start)
+	if r.block == nil {
+		r.block = make([]byte, bs)
+	}
+	data := r.block[:length]
+	name := blockName(r.key, index)
+	if r.c.load(name, data) {
+		r.c.hits.Add(1)
+	} else {
+		r.c.misses.Add(1)
+		if err := r.fetch(name, start, data); err != nil {
+			return err
+		}
+	}
+	r.buf = data[r.pos-start : min(length, r.end-start)]
+	return nil
+}
+
+// fetch reads the block from the upstream, one request covers the following missing blocks of the range
+func (r *blockReader) fetch(name string, start int64, data []byte) error {
+	if r.upstream == nil || r.upPos != start {
+		r.closeUpstream()
+		bs := r.c.blockSize
+		end := start + bs
+		for end < r.end && !r.c.has(blockName(r.key, end/bs)) {
+			end += bs
+		}
+		end = min(end, r.size)
+		rc, err := r.rr.RangeRead(r.ctx, http_range.Range{Start: start, Length: end - start})
+		if err != nil {
+			return err
+		}
+		r.upstream, r.upPos, r.upEnd = rc, start, end
+	}
+	if _, err := io.ReadFull(r.upstream, data); err != nil {
+		r.closeUpstream()
+		return errors.WithStack(err)
+	}
+	r.upPos += int64(len(data))
+	if r.upPos >= r.upEnd {
+		r.closeUpstream()
+	}
+	r.c.store(name, data)
+	return nil
+}
+
+func (r *blockReader) closeUpstream() {
+	if r.upstream != nil {
+		_ = r.upstream.Close()
+		r.upstream = nil
+	}
+}
+
+func (r *blockReader) Close() error {
+	r.closeUpstream()
+	return nil
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+func TestBlockCache(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var calls []http_range.Range
+	upstream := RangeReaderFunc(func(ctx context.Context, r http_range.Range) (io.ReadCloser, error) {
+		calls = append(calls, r)
+		return io.NopCloser(bytes.NewReader(data[r.Start : r.Start+r.Length])), nil
+	})
+	dir := t.TempDir()
+	c, err := NewBlockCache(dir, 1024, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := BlockCacheKey(1, "/a/b.mkv", int64(len(data)), time.Unix(1, 0))
+	read := func(c *BlockCache, start, length int64) {
+		t.Helper()
+		rc, err := c.RangeReader(key, int64(len(data)), upstream).RangeRead(context.Background(), http_range.Range{Start: start, Length: length})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := int64(len(data))
+		if length >= 0 {
+			end = start + length
+		}
+		if !bytes.Equal(got, data[start:end]) {
+			t.Fatalf("wrong content of range %d-%d", start, end)
+		}
+	}
+
+	read(c, 1500, 3000)
+	if len(calls) != 1 || calls[0] != (http_range.Range{Start: 1024, Length: 4096}) {
+		t.Fatalf("missing blocks are not fetched at once: %v", calls)
+	}
+	read(c, 1024, 4096)
+	if len(calls) != 1 {
+		t.Fatalf("cached blocks are fetched again: %v", calls)
+	}
+	read(c, 0, -1)
+	if len(calls) != 3 || calls[1] != (http_range.Range{Start: 0, Length: 1024}) || calls[2] != (http_range.Range{Start: 5120, Length: 4880}) {
+		t.Fatalf("only the missing runs should be fetched: %v", calls)
+	}
+	if hits, misses, size := c.Stats(); hits != 8 || misses != 10 || size != int64(len(data)) {
+		t.Fatalf("stats: %d hits, %d misses, size %d", hits, misses, size)
+	}
+
+	// the blocks are kept after a restart
+	c, err = NewBlockCache(dir, 1024, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	read(c, 0, -1)
+	if len(calls) != 0 {
+		t.Fatalf("blocks are fetched again after restart: %v", calls)
+	}
+
+	// the least recently used blocks are evicted to fit the max size
+	c, err = NewBlockCache(dir, 1024, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, size := c.Stats(); size == 0 || size > 4096 {
+		t.Fatalf("size %d exceeds max size", size)
+	}
+	read(c, 0, -1)
+	if _, _, size := c.Stats(); size > 4096 {
+		t.Fatalf("size %d exceeds max size", size)
+	}
+}
+
+func TestBlockCacheForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := BlockCacheKey(1, "/a", 1, time.Unix(1, 0))
+	files := map[string]string{
+		"a":                                    "x",
+		"README.md":                            "x",
+		filepath.Join("ab", "c"):               "x",
+		filepath.Join(key[:2], key+"-x"):       "x",
+		filepath.Join("zz", blockName(key, 0)): "x",
+		filepath.Join(key[:2], blockName(key, 0)): "block",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewBlockCache(dir, 1024, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, size := c.Stats(); size != int64(len("block")) || len(c.index) != 1 || !c.has(blockName(key, 0)) {
+		t.Errorf("only the block should be indexed, got %d blocks of %d bytes", len(c.index), size)
+	}
+}
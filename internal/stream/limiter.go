@@ -0,0 +1,191 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type blockBurstLimiter struct {
+	*rate.Limiter
+}
+
+func (l blockBurstLimiter) WaitN(ctx context.Context, total int) error {
+	for total > 0 {
+		n := l.Burst()
+		if l.Limiter.Limit() == rate.Inf || n > total {
+			n = total
+		}
+		err := l.Limiter.WaitN(ctx, n)
+		if err != nil {
+			return err
+		}
+		total -= n
+	}
+	return nil
+}
+
+// SpeedToLimit converts a speed in KB/s to a rate, negative means unlimited
+func SpeedToLimit(speed int) (rate.Limit, int) {
+	if speed < 0 {
+		return rate.Inf, 0
+	}
+	return rate.Limit(speed) * 1024.0, speed * 1024
+}
+
+// NewLimiter creates a limiter of speed KB/s, a wait larger than the burst is split instead of failing
+func NewLimiter(speed int) Limiter {
+	return blockBurstLimiter{Limiter: rate.NewLimiter(SpeedToLimit(speed))}
+}
+
+// meteredLimiter counts the bytes passing through the limiter to report the throughput
+type meteredLimiter struct {
+	Limiter
+	name  string
+	total atomic.Int64
+
+	mu       sync.Mutex
+	lastTime time.Time
+	lastSum  int64
+	rate     float64
+}
+
+func (m *meteredLimiter) WaitN(ctx context.Context, n int) error {
+	m.total.Add(int64(n))
+	return m.Limiter.WaitN(ctx, n)
+}
+
+func (m *meteredLimiter) setSpeed(speed int) {
+	limit, burst := SpeedToLimit(speed)
+	if m.Limit() != limit {
+		m.SetLimit(limit)
+		m.SetBurst(burst)
+	}
+}
+
+// throughput in bytes per second since the previous call, sampled at most once per second
+func (m *meteredLimiter) throughput() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	total := m.total.Load()
+	if m.lastTime.IsZero() {
+		m.lastTime, m.lastSum = now, total
+		return 0
+	}
+	if elapsed := now.Sub(m.lastTime); elapsed >= time.Second {
+		m.rate = float64(total-m.lastSum) / elapsed.Seconds()
+		m.lastTime, m.lastSum = now, total
+	}
+	return m.rate
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*meteredLimiter)
+)
+
+// RegisterLimiter makes the limiter report its throughput under name
+func RegisterLimiter(name string, l Limiter) Limiter {
+	m := &meteredLimiter{Limiter: l, name: name}
+	limitersMu.Lock()
+	limiters[name] = m
+	limitersMu.Unlock()
+	return m
+}
+
+// NamedLimiter returns the shared limiter of name with speed KB/s.
+// Requests of the same user, storage or sharing get the same limiter and so share the bandwidth.
+// It is nil if speed is not positive and the name never had a limit.
+func NamedLimiter(name string, speed int) Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	m, ok := limiters[name]
+	if speed <= 0 {
+		if !ok {
+			return nil
+		}
+		// the limit was removed, keep counting so the throughput stays visible
+		m.setSpeed(-1)
+		return m
+	}
+	if !ok {
+		m = &meteredLimiter{Limiter: NewLimiter(speed), name: name}
+		limiters[name] = m
+		return m
+	}
+	m.setSpeed(speed)
+	return m
+}
+
+type LimiterStat struct {
+	Name       string  `json:"name"`
+	Speed      int64   `json:"speed"` // KB/s, negative means unlimited
+	Total      int64   `json:"total"` // bytes passed since startup
+	Throughput float64 `json:"throughput"`
+}
+
+// LimiterStats reports all limiters sorted by name
+func LimiterStats() []LimiterStat {
+	limitersMu.Lock()
+	ms := make([]*meteredLimiter, 0, len(limiters))
+	for _, m := range limiters {
+		ms = append(ms, m)
+	}
+	limitersMu.Unlock()
+	stats := make([]LimiterStat, 0, len(ms))
+	for _, m := range ms {
+		speed := int64(-1)
+		if limit := m.Limit(); limit != rate.Inf {
+			speed = int64(limit / 1024)
+		}
+		stats = append(stats, LimiterStat{
+			Name:       m.name,
+			Speed:      speed,
+			Total:      m.total.Load(),
+			Throughput: m.throughput(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// chainLimiter waits on all limiters, the other methods are those of the first one
+type chainLimiter struct {
+	Limiter
+	rest []Limiter
+}
+
+func (c chainLimiter) WaitN(ctx context.Context, n int) error {
+	if err := c.Limiter.WaitN(ctx, n); err != nil {
+		return err
+	}
+	for _, l := range c.rest {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChainLimiters composes limiters so the slowest one wins, nil ones are skipped
+func ChainLimiters(ls ...Limiter) Limiter {
+	var valid []Limiter
+	for _, l := range ls {
+		if l != nil {
+			valid = append(valid, l)
+		}
+	}
+	switch len(valid) {
+	case 0:
+		return nil
+	case 1:
+		return valid[0]
+	default:
+		return chainLimiter{Limiter: valid[0], rest: valid[1:]}
+	}
+}
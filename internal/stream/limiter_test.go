@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNamedLimiter(t *testing.T) {
+	if l := NamedLimiter("test:none", 0); l != nil {
+		t.Fatalf("expected no limiter without a limit")
+	}
+	l := NamedLimiter("test:user", 100)
+	if l == nil {
+		t.Fatalf("expected a limiter")
+	}
+	if l2 := NamedLimiter("test:user", 200); l2 != l {
+		t.Fatalf("expected the same limiter for the same name")
+	}
+	if err := ChainLimiters(nil, l).WaitN(context.Background(), 1024); err != nil {
+		t.Fatal(err)
+	}
+	// the limit is removed, the limiter stays to report the throughput
+	if l3 := NamedLimiter("test:user", 0); l3 != l {
+		t.Fatalf("expected the limiter to be kept after the limit is removed")
+	}
+	for _, s := range LimiterStats() {
+		if s.Name == "test:user" {
+			if s.Speed != -1 || s.Total != 1024 {
+				t.Fatalf("unexpected stat %+v", s)
+			}
+			return
+		}
+	}
+	t.Fatalf("limiter not reported")
+}
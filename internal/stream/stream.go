@@ -291,6 +291,8 @@ type SeekableStream struct {
 	*FileStream
 	// should have one of belows to support rangeRead
 	rangeReader model.RangeReaderIF
+	// tee gets a copy of the data read from the full stream
+	tee io.Writer
 }
 
 // NewSeekableStream create a SeekableStream from FileStream and Link
@@ -364,10 +366,23 @@ func (ss *SeekableStream) generateReader() error {
 		}
 		ss.Add(rc)
 		ss.Reader = rc
+		if ss.tee != nil {
+			ss.Reader = io.TeeReader(rc, ss.tee)
+		}
 	}
 	return nil
 }
 
+// Tee writes a copy of the data read from the full stream to w, which Read and CacheFullAndWriter use.
+// RangeRead before the stream is cached reads the source again and doesn't pass w.
+func (ss *SeekableStream) Tee(w io.Writer) {
+	if ss.Reader != nil {
+		ss.Reader = io.TeeReader(ss.Reader, w)
+		return
+	}
+	ss.tee = w
+}
+
 func (ss *SeekableStream) CacheFullAndWriter(up *model.UpdateProgress, writer io.Writer) (model.File, error) {
 	if err := ss.generateReader(); err != nil {
 		return nil, err
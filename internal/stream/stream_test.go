@@ -2,6 +2,7 @@ package stream
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -107,3 +108,44 @@ func TestFileStream_With_PreHash(t *testing.T) {
 		t.Errorf("fullHash and fileFullHash should match: fullHash=%s fileFullHash=%s", fullHash, fileFullHash)
 	}
 }
+
+func TestSeekableStream_Tee(t *testing.T) {
+	buf := []byte("github.com/OpenListTeam/OpenList")
+	newStream := func() *SeekableStream {
+		link := &model.Link{RangeReader: RangeReaderFunc(func(ctx context.Context, r http_range.Range) (io.ReadCloser, error) {
+			if r.Length < 0 {
+				r.Length = int64(len(buf)) - r.Start
+			}
+			return io.NopCloser(bytes.NewReader(buf[r.Start : r.Start+r.Length])), nil
+		})}
+		ss, err := NewSeekableStream(&FileStream{Obj: &model.Object{Size: int64(len(buf))}, Ctx: context.Background()}, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss
+	}
+
+	ss := newStream()
+	h := utils.NewMultiHasher([]*utils.HashType{utils.SHA1})
+	ss.Tee(h)
+	if _, err := io.Copy(io.Discard, ss); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := utils.HashReader(utils.SHA1, bytes.NewReader(buf))
+	if got := h.GetHashInfo().GetHash(utils.SHA1); h.Size() != int64(len(buf)) || got != want {
+		t.Errorf("tee got %d bytes with hash %s, want %d bytes with hash %s", h.Size(), got, len(buf), want)
+	}
+
+	// a range read goes to the source again and isn't teed
+	ss = newStream()
+	h = utils.NewMultiHasher([]*utils.HashType{utils.SHA1})
+	ss.Tee(h)
+	r, err := ss.RangeRead(http_range.Range{Start: 0, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, r)
+	if h.Size() != 0 {
+		t.Errorf("range read was teed: %d bytes", h.Size())
+	}
+}
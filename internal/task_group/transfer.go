@@ -84,7 +84,18 @@ func verifyAndRemove(ctx context.Context, srcStorage, dstStorage driver.Driver,
 		return errors.WithMessagef(err, "failed get dst [%s] file", path.Join(dstStorage.GetStorage().MountPath, dstObjPath))
 	}
 
+	moveProps := func() {
+		src := utils.GetFullPath(srcStorage.GetStorage().MountPath, srcPath)
+		dst := utils.GetFullPath(dstStorage.GetStorage().MountPath, dstObjPath)
+		if err := op.MoveDavProps(src, dst); err != nil {
+			log.Errorf("failed move dav props of %s to %s: %+v", src, dst, err)
+		}
+		if err := op.MoveS3ObjectMeta(src, dst); err != nil {
+			log.Errorf("failed move s3 metadata of %s to %s: %+v", src, dst, err)
+		}
+	}
 	if !dstObj.IsDir() {
+		moveProps()
 		err = op.Remove(ctx, srcStorage, srcPath)
 		if err != nil {
 			return fmt.Errorf("failed remove %s: %+v", path.Join(srcStorage.GetStorage().MountPath, srcPath), err)
@@ -110,6 +121,7 @@ func verifyAndRemove(ctx context.Context, srcStorage, dstStorage driver.Driver,
 	if hasErr {
 		return errors.Errorf("some subitems of [%s] failed to verify and remove", path.Join(srcStorage.GetStorage().MountPath, srcPath))
 	}
+	moveProps()
 	err = op.Remove(ctx, srcStorage, srcPath)
 	if err != nil {
 		return fmt.Errorf("failed remove %s: %+v", path.Join(srcStorage.GetStorage().MountPath, srcPath), err)
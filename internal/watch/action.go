@@ -0,0 +1,179 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/sign"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/pkg/errors"
+)
+
+// maxURLFileSize limits how much of a .url file is read
+const maxURLFileSize = 64 * 1024
+
+func handle(ctx context.Context, w *watcher, e entry) error {
+	admin, err := op.GetAdmin()
+	if err != nil {
+		return errors.WithMessage(err, "failed get admin user")
+	}
+	api := common.GetApiUrlFromRequest(nil)
+	ctx = context.WithValue(ctx, conf.UserKey, admin)
+	ctx = context.WithValue(ctx, conf.ApiUrlKey, api)
+	r := &w.rule
+	switch r.Action {
+	case model.WatchActionCopy:
+		return transfer(ctx, r, e.Path, false)
+	case model.WatchActionMove:
+		return transfer(ctx, r, e.Path, true)
+	case model.WatchActionDecompress:
+		_, err = fs.ArchiveDecompress(ctx, e.Path, r.DstPath, model.ArchiveDecompressArgs{
+			ArchiveInnerArgs: model.ArchiveInnerArgs{
+				ArchiveArgs: model.ArchiveArgs{
+					LinkArgs: model.LinkArgs{Header: http.Header{}},
+					Password: r.ArchivePass,
+				},
+				InnerPath: "/",
+			},
+			PutIntoNewDir: r.PutIntoNewDir,
+		})
+		return err
+	case model.WatchActionOfflineDownload:
+		return offlineDownload(ctx, r, e, api)
+	case model.WatchActionRename:
+		return rename(ctx, w, e)
+	default:
+		return errors.Errorf("unknown action: %s", r.Action)
+	}
+}
+
+func transfer(ctx context.Context, r *model.WatchRule, srcPath string, move bool) error {
+	var err error
+	switch {
+	case r.Local && move:
+		_, err = tool.TransferLocal(ctx, srcPath, r.DstPath, tool.DeleteOnUploadSucceed)
+	case r.Local:
+		_, err = tool.TransferLocal(ctx, srcPath, r.DstPath, tool.DeleteNever)
+	case move:
+		_, err = fs.Move(ctx, srcPath, r.DstPath)
+	default:
+		_, err = fs.Copy(ctx, srcPath, r.DstPath)
+	}
+	return err
+}
+
+func offlineDownload(ctx context.Context, r *model.WatchRule, e entry, api string) error {
+	var url string
+	switch utils.Ext(e.Name) {
+	case "url":
+		content, err := readFile(ctx, r, e.Path)
+		if err != nil {
+			return err
+		}
+		url = parseURLFile(content)
+		if url == "" {
+			return errors.New("no url found in file")
+		}
+	case "torrent":
+		if r.Local {
+			return errors.New("torrent of local source is not supported")
+		}
+		if api == "" {
+			return errors.New("site_url is required to pass the torrent to the offline download tool")
+		}
+		url = api + "/d" + utils.EncodePath(e.Path, true) + "?sign=" + sign.Sign(e.Path)
+	default:
+		return errors.Errorf("only .url and .torrent files could be offline downloaded")
+	}
+	_, err := tool.AddURL(ctx, &tool.AddURLArgs{
+		URL:          url,
+		DstDirPath:   r.DstPath,
+		Tool:         r.Tool,
+		DeletePolicy: tool.DeleteOnUploadSucceed,
+	})
+	return err
+}
+
+func readFile(ctx context.Context, r *model.WatchRule, path string) ([]byte, error) {
+	if r.Local {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxURLFileSize))
+	}
+	link, obj, err := fs.Link(ctx, path, model.LinkArgs{Header: http.Header{}})
+	if err != nil {
+		return nil, err
+	}
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Obj: obj, Ctx: ctx}, link)
+	if err != nil {
+		_ = link.Close()
+		return nil, err
+	}
+	defer ss.Close()
+	return io.ReadAll(io.LimitReader(ss, maxURLFileSize))
+}
+
+// parseURLFile supports Windows internet shortcuts ("URL=...") and plain text with a link per line
+func parseURLFile(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	var first string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if v, ok := strings.CutPrefix(line, "URL="); ok {
+			return strings.TrimSpace(v)
+		}
+		if first == "" && (strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") ||
+			strings.HasPrefix(line, "magnet:") || strings.HasPrefix(line, "ftp://")) {
+			first = line
+		}
+	}
+	return first
+}
+
+func rename(ctx context.Context, w *watcher, e entry) error {
+	r := &w.rule
+	name, err := renderName(r.RenameTemplate, e)
+	if err != nil {
+		return err
+	}
+	dst := e
+	dst.Name = name
+	if name != e.Name {
+		if r.Local {
+			dst.Path = filepath.Join(filepath.Dir(e.Path), name)
+		} else {
+			dst.Path = stdpath.Join(stdpath.Dir(e.Path), name)
+		}
+		// the renamed file stays in the watched folder, don't pick it up again
+		w.markHandled(dst)
+		if r.Local {
+			err = os.Rename(e.Path, dst.Path)
+		} else {
+			err = fs.Rename(ctx, e.Path, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.DstPath == "" {
+		return nil
+	}
+	return transfer(ctx, r, dst.Path, true)
+}
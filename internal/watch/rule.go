@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"fmt"
+	stdpath "path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+type entry struct {
+	Path     string
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+type filter struct {
+	reg  *regexp.Regexp
+	exts []string
+	min  int64
+	max  int64
+}
+
+func newFilter(r *model.WatchRule) (*filter, error) {
+	f := &filter{min: r.MinSize, max: r.MaxSize}
+	if r.NameRegex != "" {
+		reg, err := regexp.Compile(r.NameRegex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid name regex")
+		}
+		f.reg = reg
+	}
+	for _, ext := range strings.Split(r.Extensions, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			f.exts = append(f.exts, ext)
+		}
+	}
+	return f, nil
+}
+
+func (f *filter) Match(e entry) bool {
+	if f.reg != nil && !f.reg.MatchString(e.Name) {
+		return false
+	}
+	if len(f.exts) > 0 && !utils.SliceContains(f.exts, utils.Ext(e.Name)) {
+		return false
+	}
+	if e.Size < f.min {
+		return false
+	}
+	return f.max <= 0 || e.Size <= f.max
+}
+
+// renderName fills the rename template with the properties of the entry.
+// Supported variables: {name} {base} {ext} {size} {year} {month} {day} {date} {time}
+func renderName(template string, e entry) (string, error) {
+	ext := utils.SourceExt(e.Name)
+	base := strings.TrimSuffix(e.Name, stdpath.Ext(e.Name))
+	m := e.Modified
+	name := strings.NewReplacer(
+		"{name}", e.Name,
+		"{base}", base,
+		"{ext}", ext,
+		"{size}", strconv.FormatInt(e.Size, 10),
+		"{year}", fmt.Sprintf("%04d", m.Year()),
+		"{month}", fmt.Sprintf("%02d", m.Month()),
+		"{day}", fmt.Sprintf("%02d", m.Day()),
+		"{date}", m.Format("2006-01-02"),
+		"{time}", m.Format("150405"),
+	).Replace(template)
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		return "", errors.Errorf("invalid name rendered by template: %s", name)
+	}
+	return name, nil
+}
+
+func validate(r *model.WatchRule) error {
+	switch r.Action {
+	case model.WatchActionCopy, model.WatchActionMove, model.WatchActionDecompress, model.WatchActionOfflineDownload:
+		if r.DstPath == "" {
+			return errors.New("dst path is required")
+		}
+	case model.WatchActionRename:
+		if r.RenameTemplate == "" {
+			return errors.New("rename template is required")
+		}
+	default:
+		return errors.Errorf("unknown action: %s", r.Action)
+	}
+	if r.Local && r.Action == model.WatchActionDecompress {
+		return errors.New("decompress is not supported for local source")
+	}
+	if r.Interval < 0 {
+		return errors.New("interval can not be negative")
+	}
+	if r.Interval == 0 && r.Local {
+		return errors.New("local source requires a listing interval")
+	}
+	_, err := newFilter(r)
+	return err
+}
@@ -0,0 +1,87 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := newFilter(&model.WatchRule{NameRegex: `^scan_`, Extensions: "pdf, .JPG", MinSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"scan_001.pdf": true,
+		"scan_002.jpg": true,
+		"scan_003.txt": false,
+		"doc_004.pdf":  false,
+	}
+	for name, expected := range cases {
+		if got := f.Match(entry{Name: name, Size: 100}); got != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+	if f.Match(entry{Name: "scan_005.pdf", Size: 5}) {
+		t.Errorf("expected file smaller than min size to be filtered")
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	e := entry{Name: "scan.PDF", Size: 42, Modified: time.Date(2024, 3, 9, 8, 5, 1, 0, time.UTC)}
+	name, err := renderName("{date}_{base}_{size}.{ext}", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "2024-03-09_scan_42.PDF" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	if _, err = renderName("{year}/{name}", e); err == nil {
+		t.Errorf("expected error for name containing separator")
+	}
+}
+
+func TestPruneHandled(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+	w := &watcher{
+		rule:    model.WatchRule{ID: 1, Name: "prune", SrcPath: "/w", Recursive: true, IgnoreExisting: true},
+		seen:    make(map[string]entry),
+		handled: make(map[string]entry),
+	}
+	now := time.Now().Truncate(time.Second)
+	w.saveHandled([]entry{
+		{Path: "/w/a.txt", Size: 1, Modified: now},
+		{Path: "/w/b.txt", Size: 2, Modified: now},
+		{Path: "/w/sub/c.txt", Size: 3, Modified: now},
+		{Path: "/other/d.txt", Size: 4, Modified: now},
+	}, nil)
+	if w.handled, err = loadHandled(1); err != nil || len(w.handled) != 4 {
+		t.Fatalf("expected 4 handled files, got %d: %v", len(w.handled), err)
+	}
+
+	// a listing of /w without b.txt and sub, with no interval this is the only pruning
+	w.onEvent(context.Background(), "/w", []model.Obj{&model.Object{Name: "a.txt", Size: 1, Modified: now}})
+	handled, err := loadHandled(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/w/a.txt", "/other/d.txt"} {
+		if _, ok := handled[p]; !ok {
+			t.Errorf("expected %s to be kept", p)
+		}
+	}
+	if len(handled) != 2 {
+		t.Errorf("expected the deleted files to be pruned, got %v", handled)
+	}
+}
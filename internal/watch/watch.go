@@ -0,0 +1,415 @@
+package watch
+
+import (
+	"context"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// watcher keeps the runtime state of an enabled rule.
+// A file found by periodic listing is handled once it shows the same size and
+// modified time on two consecutive listings, so files still being written are skipped.
+// The handled files are kept in the database, so they aren't handled again after a restart
+// or by the next leader of the cluster.
+type watcher struct {
+	rule     model.WatchRule
+	filter   *filter
+	cron     *cron.Cron
+	scanning atomic.Bool
+
+	mu          sync.Mutex
+	initialized bool
+	seen        map[string]entry
+	handled     map[string]entry
+	// follower is set while another node of the cluster is the leader
+	follower bool
+}
+
+var (
+	watchersMu sync.RWMutex
+	watchers   = make(map[uint]*watcher)
+)
+
+// Init starts watchers of all enabled rules
+func Init() {
+	rules, err := db.GetEnabledWatchRules()
+	if err != nil {
+		log.Errorf("failed get watch rules: %+v", err)
+		return
+	}
+	for i := range rules {
+		if err = start(rules[i]); err != nil {
+			log.Errorf("failed start watch rule [%s]: %+v", rules[i].Name, err)
+		}
+	}
+	log.Infof("started %d watch rules", len(rules))
+}
+
+func start(rule model.WatchRule) error {
+	stop(rule.ID)
+	if rule.Disabled {
+		return nil
+	}
+	f, err := newFilter(&rule)
+	if err != nil {
+		return err
+	}
+	if rule.Local {
+		rule.SrcPath = filepath.Clean(rule.SrcPath)
+	} else {
+		rule.SrcPath = utils.FixAndCleanPath(rule.SrcPath)
+	}
+	handled, err := loadHandled(rule.ID)
+	if err != nil {
+		return err
+	}
+	w := &watcher{
+		rule:    rule,
+		filter:  f,
+		seen:    make(map[string]entry),
+		handled: handled,
+		// IgnoreExisting only applies to the first start of the rule
+		initialized: len(handled) > 0,
+	}
+	// the first listing only records the current state, or marks it as handled if IgnoreExisting
+	go w.scan()
+	if rule.Interval > 0 {
+		w.cron = cron.NewCron(time.Duration(rule.Interval) * time.Second)
+		w.cron.Do(w.scan)
+	}
+	watchersMu.Lock()
+	watchers[rule.ID] = w
+	watchersMu.Unlock()
+	return nil
+}
+
+func stop(id uint) {
+	watchersMu.Lock()
+	w, ok := watchers[id]
+	delete(watchers, id)
+	watchersMu.Unlock()
+	if ok && w.cron != nil {
+		w.cron.Stop()
+	}
+}
+
+func sameEntry(a, b entry) bool {
+	return a.Size == b.Size && a.Modified.Equal(b.Modified)
+}
+
+func loadHandled(ruleID uint) (map[string]entry, error) {
+	rows, err := db.GetWatchHandled(ruleID)
+	if err != nil {
+		return nil, err
+	}
+	handled := make(map[string]entry, len(rows))
+	for _, h := range rows {
+		handled[h.Path] = entry{Path: h.Path, Size: h.Size, Modified: h.Modified}
+	}
+	return handled, nil
+}
+
+// saveHandled writes the changes of the handled files to the database
+func (w *watcher) saveHandled(saved []entry, removed []string) {
+	rows := make([]model.WatchHandled, 0, len(saved))
+	for _, e := range saved {
+		rows = append(rows, model.WatchHandled{RuleID: w.rule.ID, Path: e.Path, Size: e.Size, Modified: e.Modified})
+	}
+	if err := db.SaveWatchHandled(rows); err != nil {
+		log.Errorf("watch rule [%s]: failed save handled files: %+v", w.rule.Name, err)
+	}
+	if err := db.DeleteWatchHandled(w.rule.ID, removed); err != nil {
+		log.Errorf("watch rule [%s]: failed delete handled files: %+v", w.rule.Name, err)
+	}
+}
+
+func (w *watcher) scan() {
+	if !w.scanning.CompareAndSwap(false, true) {
+		return
+	}
+	defer w.scanning.Store(false)
+	if !coord.IsLeader() {
+		// the leader of the cluster handles the changes
+		w.mu.Lock()
+		w.follower = true
+		w.mu.Unlock()
+		return
+	}
+	ctx := context.Background()
+	var entries []entry
+	var err error
+	if w.rule.Local {
+		entries, err = listLocal(w.rule.SrcPath, w.rule.Recursive)
+	} else {
+		entries, err = listStorage(ctx, w.rule.SrcPath, w.rule.Recursive)
+	}
+	if err != nil {
+		log.Warnf("watch rule [%s]: failed list %s: %+v", w.rule.Name, w.rule.SrcPath, err)
+		return
+	}
+	var ready, saved []entry
+	var removed []string
+	w.mu.Lock()
+	if w.follower {
+		// the previous leader kept the files it handled in the database
+		handled, err := loadHandled(w.rule.ID)
+		if err != nil {
+			w.mu.Unlock()
+			log.Warnf("watch rule [%s]: %+v", w.rule.Name, err)
+			return
+		}
+		w.handled = handled
+		w.follower = false
+	}
+	current := make(map[string]entry, len(entries))
+	for _, e := range entries {
+		if !w.filter.Match(e) {
+			continue
+		}
+		current[e.Path] = e
+		if h, ok := w.handled[e.Path]; ok && sameEntry(h, e) {
+			continue
+		}
+		if !w.initialized && w.rule.IgnoreExisting {
+			w.handled[e.Path] = e
+			saved = append(saved, e)
+			continue
+		}
+		if s, ok := w.seen[e.Path]; ok && sameEntry(s, e) {
+			w.handled[e.Path] = e
+			saved = append(saved, e)
+			ready = append(ready, e)
+		}
+	}
+	for p := range w.handled {
+		if _, ok := current[p]; !ok {
+			delete(w.handled, p)
+			removed = append(removed, p)
+		}
+	}
+	w.seen = current
+	w.initialized = true
+	w.mu.Unlock()
+	w.saveHandled(saved, removed)
+	for _, e := range ready {
+		w.handle(ctx, e)
+	}
+}
+
+// onEvent is called with objects reported by RegisterObjsUpdateHook,
+// they are complete already so no stability check is needed
+func (w *watcher) onEvent(ctx context.Context, parent string, objs []model.Obj) {
+	var ready []entry
+	w.mu.Lock()
+	if w.follower || !coord.IsLeader() {
+		w.mu.Unlock()
+		return
+	}
+	// the listing is complete, so the handled files under parent it doesn't show were deleted,
+	// this is the only pruning if the rule has no interval
+	removed := w.prune(parent, objs)
+	if !w.initialized && w.rule.IgnoreExisting {
+		w.mu.Unlock()
+		w.saveHandled(nil, removed)
+		return
+	}
+	for _, obj := range objs {
+		if obj.IsDir() {
+			continue
+		}
+		e := entry{
+			Path:     stdpath.Join(parent, obj.GetName()),
+			Name:     obj.GetName(),
+			Size:     obj.GetSize(),
+			Modified: obj.ModTime(),
+		}
+		if !w.filter.Match(e) {
+			continue
+		}
+		if h, ok := w.handled[e.Path]; ok && sameEntry(h, e) {
+			continue
+		}
+		w.handled[e.Path] = e
+		w.seen[e.Path] = e
+		ready = append(ready, e)
+	}
+	w.mu.Unlock()
+	w.saveHandled(ready, removed)
+	for _, e := range ready {
+		w.handle(ctx, e)
+	}
+}
+
+// prune removes the handled files under parent whose name, or the name of whose folder in parent, isn't in objs
+func (w *watcher) prune(parent string, objs []model.Obj) []string {
+	names := make(map[string]struct{}, len(objs))
+	for _, obj := range objs {
+		names[obj.GetName()] = struct{}{}
+	}
+	prefix := strings.TrimSuffix(utils.FixAndCleanPath(parent), "/") + "/"
+	var removed []string
+	for p := range w.handled {
+		rel, ok := strings.CutPrefix(p, prefix)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rel, "/")
+		if _, ok = names[name]; !ok {
+			delete(w.handled, p)
+			delete(w.seen, p)
+			removed = append(removed, p)
+		}
+	}
+	return removed
+}
+
+func (w *watcher) markHandled(e entry) {
+	w.mu.Lock()
+	w.handled[e.Path] = e
+	w.seen[e.Path] = e
+	w.mu.Unlock()
+	w.saveHandled([]entry{e}, nil)
+}
+
+func (w *watcher) matchParent(parent string) bool {
+	if w.rule.Local {
+		return false
+	}
+	if w.rule.Recursive {
+		return utils.IsSubPath(w.rule.SrcPath, parent)
+	}
+	return utils.FixAndCleanPath(parent) == w.rule.SrcPath
+}
+
+func (w *watcher) handle(ctx context.Context, e entry) {
+	if err := handle(ctx, w, e); err != nil {
+		log.Errorf("watch rule [%s]: failed %s %s: %+v", w.rule.Name, w.rule.Action, e.Path, err)
+		return
+	}
+	log.Infof("watch rule [%s]: %s %s", w.rule.Name, w.rule.Action, e.Path)
+}
+
+func listStorage(ctx context.Context, dirPath string, recursive bool) ([]entry, error) {
+	storage, actualPath, err := op.GetStorageAndActualPath(dirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get storage")
+	}
+	objs, err := op.List(ctx, storage, actualPath, model.ListArgs{Refresh: true, SkipHook: true})
+	if err != nil {
+		return nil, err
+	}
+	var entries []entry
+	for _, obj := range objs {
+		p := stdpath.Join(dirPath, obj.GetName())
+		if obj.IsDir() {
+			if recursive {
+				sub, err := listStorage(ctx, p, recursive)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, sub...)
+			}
+			continue
+		}
+		entries = append(entries, entry{Path: p, Name: obj.GetName(), Size: obj.GetSize(), Modified: obj.ModTime()})
+	}
+	return entries, nil
+}
+
+func listLocal(dirPath string, recursive bool) ([]entry, error) {
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var entries []entry
+	for _, de := range dirEntries {
+		p := filepath.Join(dirPath, de.Name())
+		if de.IsDir() {
+			if recursive {
+				sub, err := listLocal(p, recursive)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, sub...)
+			}
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{Path: p, Name: de.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return entries, nil
+}
+
+func objsUpdateHook(ctx context.Context, parent string, objs []model.Obj) {
+	watchersMu.RLock()
+	var matched []*watcher
+	for _, w := range watchers {
+		if w.matchParent(parent) {
+			matched = append(matched, w)
+		}
+	}
+	watchersMu.RUnlock()
+	for _, w := range matched {
+		w.onEvent(ctx, parent, objs)
+	}
+}
+
+func init() {
+	op.RegisterObjsUpdateHook(objsUpdateHook)
+}
+
+func GetRules(pageIndex, pageSize int) ([]model.WatchRule, int64, error) {
+	return db.GetWatchRules(pageIndex, pageSize)
+}
+
+func GetRule(id uint) (*model.WatchRule, error) {
+	return db.GetWatchRuleById(id)
+}
+
+func CreateRule(r *model.WatchRule) error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	if err := db.CreateWatchRule(r); err != nil {
+		return err
+	}
+	return start(*r)
+}
+
+func UpdateRule(r *model.WatchRule) error {
+	if err := validate(r); err != nil {
+		return err
+	}
+	if _, err := db.GetWatchRuleById(r.ID); err != nil {
+		return err
+	}
+	if err := db.UpdateWatchRule(r); err != nil {
+		return err
+	}
+	return start(*r)
+}
+
+func DeleteRule(id uint) error {
+	if err := db.DeleteWatchRuleById(id); err != nil {
+		return err
+	}
+	stop(id)
+	return nil
+}
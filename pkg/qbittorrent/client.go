@@ -18,6 +18,8 @@ type Client interface {
 	GetInfo(id string) (TorrentInfo, error)
 	GetFiles(id string) ([]FileInfo, error)
 	Delete(id string, deleteFiles bool) error
+	Pause(id string) error
+	Resume(id string) error
 }
 
 type client struct {
@@ -384,3 +386,43 @@ func (c *client) Delete(id string, deleteFiles bool) error {
 	}
 	return nil
 }
+
+// Pause stops the torrent tagged with the given id. qBittorrent 5.x renamed
+// the endpoint to /stop, so fall back to it when /pause is missing.
+func (c *client) Pause(id string) error {
+	return c.torrentsAction(id, "/api/v2/torrents/pause", "/api/v2/torrents/stop")
+}
+
+// Resume restarts the torrent tagged with the given id, see Pause.
+func (c *client) Resume(id string) error {
+	return c.torrentsAction(id, "/api/v2/torrents/resume", "/api/v2/torrents/start")
+}
+
+func (c *client) torrentsAction(id string, paths ...string) error {
+	err := c.checkAuthorization()
+	if err != nil {
+		return err
+	}
+
+	info, err := c.GetInfo(id)
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("hashes", info.Hash)
+	for _, path := range paths {
+		resp, err := c.post(path, v)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if resp.StatusCode != 200 {
+			return errors.New("failed to call qbittorrent " + path)
+		}
+		return nil
+	}
+	return errors.New("qbittorrent webui does not support pausing torrents")
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"context"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+)
+
+func speedOf(l model.SpeedLimit, upload bool) int {
+	if upload {
+		return l.MaxUploadSpeed
+	}
+	return l.MaxDownloadSpeed
+}
+
+func scopedLimiter(kind, name string, l model.SpeedLimit, upload bool) stream.Limiter {
+	direction := "download"
+	if upload {
+		direction = "upload"
+	}
+	return stream.NamedLimiter(kind+":"+name+":"+direction, speedOf(l, upload))
+}
+
+// ClientLimiter composes the global limiter with the ones of the user in ctx,
+// the storage of path and the sharing in ctx. path is a full path and can be empty.
+func ClientLimiter(ctx context.Context, global stream.Limiter, path string, upload bool) stream.Limiter {
+	limiters := []stream.Limiter{global}
+	if user, ok := ctx.Value(conf.UserKey).(*model.User); ok && user != nil {
+		limiters = append(limiters, scopedLimiter("user", user.Username, user.SpeedLimit, upload))
+	}
+	if sid, ok := ctx.Value(conf.SharingIDKey).(string); ok && sid != "" {
+		if s, err := op.GetSharingById(sid); err == nil {
+			limiters = append(limiters, scopedLimiter("sharing", sid, s.SpeedLimit, upload))
+		}
+	} else if path != "" {
+		if storage := op.GetStorageOfPath(path); storage != nil {
+			s := storage.GetStorage()
+			limiters = append(limiters, scopedLimiter("storage", s.MountPath, s.SpeedLimit, upload))
+		}
+	}
+	return stream.ChainLimiters(limiters...)
+}
+
+func ClientDownloadLimiter(ctx context.Context, path string) stream.Limiter {
+	return ClientLimiter(ctx, stream.ClientDownloadLimit, path, false)
+}
+
+func ClientUploadLimiter(ctx context.Context, path string) stream.Limiter {
+	return ClientLimiter(ctx, stream.ClientUploadLimit, path, true)
+}
@@ -116,6 +116,32 @@ func ProxyRange(ctx context.Context, link *model.Link, size int64) *model.Link {
 	return link
 }
 
+// ReadCacheRange serves the link through the read cache if the storage enables it,
+// path is the full path of the file
+func ReadCacheRange(ctx context.Context, storage *model.Storage, path string, link *model.Link, file model.Obj) *model.Link {
+	// the key of a file without a modified time doesn't change with its content
+	if stream.ReadCache == nil || !storage.ReadCache || file.ModTime().IsZero() {
+		return link
+	}
+	size := link.ContentLength
+	if size <= 0 {
+		size = file.GetSize()
+	}
+	if link.RangeReader == nil && strings.HasPrefix(link.URL, GetApiUrl(ctx)+"/") {
+		return link
+	}
+	rrf, err := stream.GetRangeReaderFromLink(size, link)
+	if err != nil {
+		return link
+	}
+	key := stream.BlockCacheKey(storage.ID, path, size, file.ModTime())
+	return &model.Link{
+		RangeReader:   stream.ReadCache.RangeReader(key, size, rrf),
+		ContentLength: size,
+		Header:        link.Header,
+	}
+}
+
 type InterceptResponseWriter struct {
 	http.ResponseWriter
 	io.Writer
@@ -15,6 +15,7 @@ import (
 
 	"github.com/OpenListTeam/OpenList/v4/drivers/base"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
@@ -67,13 +68,13 @@ func NewMainDriver() (*FtpMainDriver, error) {
 			ConnectionTimeout:        conf.Conf.FTP.ConnectionTimeout,
 			DisableMLSD:              false,
 			DisableMLST:              false,
-			DisableMFMT:              true,
+			DisableMFMT:              false,
 			Banner:                   setting.GetStr(conf.Announcement),
 			TLSRequired:              tlsRequired,
 			DisableLISTArgs:          false,
 			DisableSite:              false,
 			DisableActiveMode:        conf.Conf.FTP.DisableActiveMode,
-			EnableHASH:               false,
+			EnableHASH:               true,
 			DisableSTAT:              false,
 			DisableSYST:              false,
 			EnableCOMB:               false,
@@ -101,6 +102,7 @@ func (d *FtpMainDriver) ClientConnected(cc ftpserver.ClientContext) (string, err
 	}
 	defer d.shutdownLock.RUnlock()
 	d.clients[cc.ID()] = cc
+	metrics.SessionOpened("ftp")
 	return "OpenList FTP Endpoint", nil
 }
 
@@ -109,7 +111,10 @@ func (d *FtpMainDriver) ClientDisconnected(cc ftpserver.ClientContext) {
 	if err != nil {
 		utils.Log.Errorf("failed to close client: %v", err)
 	}
-	delete(d.clients, cc.ID())
+	if _, ok := d.clients[cc.ID()]; ok {
+		delete(d.clients, cc.ID())
+		metrics.SessionClosed("ftp")
+	}
 }
 
 func (d *FtpMainDriver) AuthUser(cc ftpserver.ClientContext, user, pass string) (ftpserver.ClientDriver, error) {
@@ -137,12 +142,12 @@ func (d *FtpMainDriver) AuthUser(cc ftpserver.ClientContext, user, pass string)
 			userObj, err = tryLdapLoginAndRegister(user, pass)
 		}
 		if err != nil {
-			model.LoginCache.Set(ip, count+1)
+			model.LoginCache.Incr(ip)
 			return nil, err
 		}
 	}
 	if userObj.Disabled || !userObj.CanFTPAccess() {
-		model.LoginCache.Set(ip, count+1)
+		model.LoginCache.Incr(ip)
 		return nil, errors.New("user is not allowed to access via FTP")
 	}
 	model.LoginCache.Del(ip)
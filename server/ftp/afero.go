@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	stdpath "path"
 	"strings"
 	"time"
 
@@ -77,8 +78,8 @@ func (a *AferoAdapter) Chown(_ string, _, _ int) error {
 	return errs.NotSupport
 }
 
-func (a *AferoAdapter) Chtimes(_ string, _ time.Time, _ time.Time) error {
-	return errs.NotSupport
+func (a *AferoAdapter) Chtimes(name string, _ time.Time, mtime time.Time) error {
+	return Chtimes(a.ctx, name, mtime)
 }
 
 func (a *AferoAdapter) ReadDir(name string) ([]os.FileInfo, error) {
@@ -128,6 +129,9 @@ func (a *AferoAdapter) GetHandle(name string, flags int, offset int64) (ftpserve
 		if offset != 0 {
 			return nil, errs.NotSupport
 		}
+		if fs.IsWriteBack(stdpath.Dir(path)) {
+			return OpenWriteBack(a.ctx, path)
+		}
 		trunc := (flags & os.O_TRUNC) != 0
 		if fileSize > 0 {
 			return OpenUploadWithLength(a.ctx, path, trunc, fileSize)
@@ -3,6 +3,7 @@ package ftp
 import (
 	"context"
 	stdpath "path"
+	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
@@ -36,6 +37,33 @@ func Mkdir(ctx context.Context, path string) error {
 	return fs.MakeDir(ctx, reqPath)
 }
 
+func Chtimes(ctx context.Context, path string, modified time.Time) error {
+	user := ctx.Value(conf.UserKey).(*model.User)
+	if !user.CanFTPManage() {
+		return errs.PermissionDenied
+	}
+	reqPath, err := user.JoinPath(path)
+	if err != nil {
+		return err
+	}
+	meta, err := op.GetNearestMeta(reqPath)
+	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+		return err
+	}
+	if !common.CanWrite(user, meta, reqPath) {
+		return errs.PermissionDenied
+	}
+	// clients send MFMT right after the upload, which may still be running
+	if err = SetStageModTime(reqPath, modified); !errors.Is(err, errs.ObjectNotFound) {
+		return err
+	}
+	err = fs.SetModTime(ctx, reqPath, modified)
+	if errors.Is(err, errs.NotImplement) {
+		return errs.NotSupport
+	}
+	return err
+}
+
 func Remove(ctx context.Context, path string) error {
 	user := ctx.Value(conf.UserKey).(*model.User)
 	if !user.CanRemove() || !user.CanFTPManage() {
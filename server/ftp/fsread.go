@@ -21,7 +21,8 @@ import (
 type FileDownloadProxy struct {
 	model.File
 	io.Closer
-	ctx context.Context
+	ctx     context.Context
+	limiter stream.Limiter
 }
 
 func OpenDownload(ctx context.Context, reqPath string, offset int64) (*FileDownloadProxy, error) {
@@ -55,7 +56,7 @@ func OpenDownload(ctx context.Context, reqPath string, offset int64) (*FileDownl
 		_ = ss.Close()
 		return nil, err
 	}
-	return &FileDownloadProxy{File: reader, Closer: ss, ctx: ctx}, nil
+	return &FileDownloadProxy{File: reader, Closer: ss, ctx: ctx, limiter: common.ClientDownloadLimiter(ctx, reqPath)}, nil
 }
 
 func (f *FileDownloadProxy) Read(p []byte) (n int, err error) {
@@ -63,7 +64,7 @@ func (f *FileDownloadProxy) Read(p []byte) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientDownloadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -72,7 +73,7 @@ func (f *FileDownloadProxy) ReadAt(p []byte, off int64) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientDownloadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -89,7 +90,8 @@ func (o *OsFileInfoAdapter) Name() string {
 }
 
 func (o *OsFileInfoAdapter) Size() int64 {
-	return o.obj.GetSize()
+	// some drivers report -1 for an unknown size
+	return max(o.obj.GetSize(), 0)
 }
 
 func (o *OsFileInfoAdapter) Mode() fs2.FileMode {
@@ -101,7 +103,11 @@ func (o *OsFileInfoAdapter) Mode() fs2.FileMode {
 }
 
 func (o *OsFileInfoAdapter) ModTime() time.Time {
-	return o.obj.ModTime()
+	// MLSD would report year 1 for the objects without a modification time
+	if m := o.obj.ModTime(); !m.IsZero() {
+		return m
+	}
+	return o.obj.CreateTime()
 }
 
 func (o *OsFileInfoAdapter) IsDir() bool {
@@ -25,10 +25,12 @@ import (
 
 type FileUploadProxy struct {
 	ftpserver.FileTransfer
-	buffer *os.File
-	path   string
-	ctx    context.Context
-	trunc  bool
+	buffer  *os.File
+	path    string
+	ctx     context.Context
+	trunc   bool
+	limiter stream.Limiter
+	err     error
 }
 
 func uploadAuth(ctx context.Context, path string) error {
@@ -64,7 +66,7 @@ func OpenUpload(ctx context.Context, path string, trunc bool) (*FileUploadProxy,
 	if err != nil {
 		return nil, err
 	}
-	return &FileUploadProxy{buffer: tmpFile, path: path, ctx: ctx, trunc: trunc}, nil
+	return &FileUploadProxy{buffer: tmpFile, path: path, ctx: ctx, trunc: trunc, limiter: common.ClientUploadLimiter(ctx, path)}, nil
 }
 
 func (f *FileUploadProxy) Read(p []byte) (n int, err error) {
@@ -76,7 +78,7 @@ func (f *FileUploadProxy) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientUploadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -84,7 +86,17 @@ func (f *FileUploadProxy) Seek(offset int64, whence int) (int64, error) {
 	return f.buffer.Seek(offset, whence)
 }
 
+// TransferError is called by ftpserverlib if the transfer failed, the upload is dropped on Close
+func (f *FileUploadProxy) TransferError(err error) {
+	f.err = err
+}
+
 func (f *FileUploadProxy) Close() error {
+	if f.err != nil {
+		_ = f.buffer.Close()
+		_ = os.Remove(f.buffer.Name())
+		return f.err
+	}
 	dir, name := stdpath.Split(f.path)
 	size, err := f.buffer.Seek(0, io.SeekCurrent)
 	if err != nil {
@@ -94,10 +106,11 @@ func (f *FileUploadProxy) Close() error {
 		return err
 	}
 	arr := make([]byte, 512)
-	if _, err := f.buffer.Read(arr); err != nil {
+	n, err := f.buffer.Read(arr)
+	if err != nil && err != io.EOF {
 		return err
 	}
-	contentType := http.DetectContentType(arr)
+	contentType := http.DetectContentType(arr[:n])
 	if _, err := f.buffer.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
@@ -145,6 +158,65 @@ func (f *FileUploadProxy) Close() error {
 	return nil
 }
 
+// FileWriteBackProxy writes the upload to a staged file, the put to the storage runs in the background after Close
+type FileWriteBackProxy struct {
+	ftpserver.FileTransfer
+	buffer  *os.File
+	path    string
+	ctx     context.Context
+	limiter stream.Limiter
+	err     error
+}
+
+func OpenWriteBack(ctx context.Context, path string) (*FileWriteBackProxy, error) {
+	err := uploadAuth(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	// Check if system file should be ignored
+	_, name := stdpath.Split(path)
+	if setting.GetBool(conf.IgnoreSystemFiles) && utils.IsSystemFile(name) {
+		return nil, errs.IgnoredSystemFile
+	}
+	tmpFile, err := fs.CreateStageFile()
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriteBackProxy{buffer: tmpFile, path: path, ctx: ctx, limiter: common.ClientUploadLimiter(ctx, path)}, nil
+}
+
+func (f *FileWriteBackProxy) Read(p []byte) (n int, err error) {
+	return 0, errs.NotSupport
+}
+
+func (f *FileWriteBackProxy) Write(p []byte) (n int, err error) {
+	n, err = f.buffer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	err = f.limiter.WaitN(f.ctx, n)
+	return n, err
+}
+
+func (f *FileWriteBackProxy) Seek(offset int64, whence int) (int64, error) {
+	return f.buffer.Seek(offset, whence)
+}
+
+// TransferError is called by ftpserverlib if the transfer failed, the upload is dropped on Close
+func (f *FileWriteBackProxy) TransferError(err error) {
+	f.err = err
+}
+
+func (f *FileWriteBackProxy) Close() error {
+	if f.err != nil {
+		_ = f.buffer.Close()
+		_ = os.Remove(f.buffer.Name())
+		return f.err
+	}
+	// the staged upload replaces the existing file, so it is not removed before
+	return fs.CommitStage(f.ctx, f.path, f.buffer, time.Now(), utils.GetMimeType(f.path))
+}
+
 type FileUploadWithLengthProxy struct {
 	ftpserver.FileTransfer
 	ctx           context.Context
@@ -152,8 +224,10 @@ type FileUploadWithLengthProxy struct {
 	length        int64
 	first512Bytes [512]byte
 	pFirst        int
-	pipeWriter    io.WriteCloser
+	pipeWriter    *io.PipeWriter
 	errChan       chan error
+	limiter       stream.Limiter
+	err           error
 }
 
 func OpenUploadWithLength(ctx context.Context, path string, trunc bool, length int64) (*FileUploadWithLengthProxy, error) {
@@ -169,7 +243,7 @@ func OpenUploadWithLength(ctx context.Context, path string, trunc bool, length i
 	if trunc {
 		_ = fs.Remove(ctx, path)
 	}
-	return &FileUploadWithLengthProxy{ctx: ctx, path: path, length: length}, nil
+	return &FileUploadWithLengthProxy{ctx: ctx, path: path, length: length, limiter: common.ClientUploadLimiter(ctx, path)}, nil
 }
 
 func (f *FileUploadWithLengthProxy) Read(p []byte) (n int, err error) {
@@ -228,7 +302,7 @@ func (f *FileUploadWithLengthProxy) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientUploadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -236,7 +310,19 @@ func (f *FileUploadWithLengthProxy) Seek(offset int64, whence int) (int64, error
 	return 0, errs.NotSupport
 }
 
+// TransferError is called by ftpserverlib if the transfer failed, the upload is dropped on Close
+func (f *FileUploadWithLengthProxy) TransferError(err error) {
+	f.err = err
+}
+
 func (f *FileUploadWithLengthProxy) Close() error {
+	if f.err != nil {
+		if f.pipeWriter != nil {
+			_ = f.pipeWriter.CloseWithError(f.err)
+			<-f.errChan
+		}
+		return f.err
+	}
 	if f.pipeWriter != nil {
 		err := f.pipeWriter.Close()
 		if err != nil {
@@ -0,0 +1,67 @@
+package ftp
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	ftpserver "github.com/fclairamb/ftpserverlib"
+)
+
+// ComputeHash answers the HASH family of commands, the hash reported by the storage is used
+// if the whole file is requested, otherwise the range is read and hashed
+func (a *AferoAdapter) ComputeHash(name string, algo ftpserver.HASHAlgo, startOffset, endOffset int64) (string, error) {
+	var (
+		ht      *utils.HashType
+		newHash func() hash.Hash
+	)
+	switch algo {
+	case ftpserver.HASHAlgoCRC32:
+		newHash = func() hash.Hash { return crc32.NewIEEE() }
+	case ftpserver.HASHAlgoMD5:
+		ht, newHash = utils.MD5, md5.New
+	case ftpserver.HASHAlgoSHA1:
+		ht, newHash = utils.SHA1, sha1.New
+	case ftpserver.HASHAlgoSHA256:
+		ht, newHash = utils.SHA256, sha256.New
+	case ftpserver.HASHAlgoSHA512:
+		newHash = sha512.New
+	default:
+		return "", errs.NotSupport
+	}
+	if ht != nil && startOffset == 0 {
+		info, err := a.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		if obj, ok := info.Sys().(model.Obj); ok && obj.GetSize() == endOffset {
+			if sum := obj.GetHash().GetHash(ht); sum != "" {
+				return strings.ToLower(sum), nil
+			}
+		}
+	}
+	// reading doesn't consume the size announced for the next upload
+	nextFileSize := a.nextFileSize
+	f, err := a.GetHandle(name, os.O_RDONLY, startOffset)
+	a.nextFileSize = nextFileSize
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err = io.CopyN(h, f, endOffset-startOffset); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
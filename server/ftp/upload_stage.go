@@ -10,8 +10,10 @@ import (
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/tchap/go-patricia/v2/patricia"
 )
@@ -34,6 +36,7 @@ type UploadingFile struct {
 	name        string
 	size        int64
 	modTime     time.Time
+	modTimeSet  bool // set by MFMT, applied to the storage after the upload
 	refCount    int
 	currentPath string
 	softLinks   []patricia.Prefix
@@ -69,9 +72,10 @@ func MakeStage(ctx context.Context, buffer *os.File, size int64, path string, mv
 	}
 	log.Debugf("[ftp-stage] succeed to make [%s] stage", buffer.Name())
 	return f, &BorrowedFile{
-		file: buffer,
-		path: prefix,
-		ctx:  ctx,
+		file:    buffer,
+		path:    prefix,
+		ctx:     ctx,
+		limiter: common.ClientDownloadLimiter(ctx, path),
 	}, nil
 }
 
@@ -97,9 +101,10 @@ func Borrow(ctx context.Context, path string) (*BorrowedFile, error) {
 	s.refCount++
 	log.Debugf("[ftp-stage] borrow [%s] succeed", s.name)
 	return &BorrowedFile{
-		file: borrowed,
-		path: prefix,
-		ctx:  ctx,
+		file:    borrowed,
+		path:    prefix,
+		ctx:     ctx,
+		limiter: common.ClientDownloadLimiter(ctx, path),
 	}, nil
 }
 
@@ -126,10 +131,18 @@ func drop(path patricia.Prefix) {
 			stage.Delete(sl)
 		}
 		stage.Delete(path)
-		if s.currentPath != string(path) {
-			if s.currentPath != "" {
-				go s.mvCallback(s.currentPath)
-			}
+		if s.currentPath != "" && (s.currentPath != string(path) || s.modTimeSet) {
+			go func(target string) {
+				if target != string(path) {
+					s.mvCallback(target)
+				}
+				if s.modTimeSet {
+					err := fs.SetModTime(context.Background(), target, s.modTime)
+					if err != nil && !errors.Is(err, errs.NotImplement) {
+						log.Warnf("[ftp-stage] failed set modification time of [%s]: %+v", target, err)
+					}
+				}
+			}(s.currentPath)
 		}
 	}
 }
@@ -183,6 +196,26 @@ func StatStage(path string) (os.FileInfo, error) {
 	return os.Stat(s.name)
 }
 
+// SetStageModTime sets the modification time of the uploading file, errs.ObjectNotFound is returned if there is none
+func SetStageModTime(path string, modified time.Time) error {
+	stageMutex.Lock()
+	defer stageMutex.Unlock()
+	v := stage.Get(patricia.Prefix(path))
+	if v == nil {
+		return errs.ObjectNotFound
+	}
+	s, ok := v.(*UploadingFile)
+	if !ok {
+		s = v.(*softLink).target
+	}
+	if s.currentPath != path {
+		return ErrStageMoved
+	}
+	s.modTime = modified
+	s.modTimeSet = true
+	return nil
+}
+
 func MoveStage(from, to string) error {
 	stageMutex.Lock()
 	defer stageMutex.Unlock()
@@ -231,9 +264,10 @@ func RemoveStage(path string) error {
 }
 
 type BorrowedFile struct {
-	file *os.File
-	path patricia.Prefix
-	ctx  context.Context
+	file    *os.File
+	path    patricia.Prefix
+	ctx     context.Context
+	limiter stream.Limiter
 }
 
 func (f *BorrowedFile) Read(p []byte) (n int, err error) {
@@ -241,7 +275,7 @@ func (f *BorrowedFile) Read(p []byte) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientDownloadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -250,7 +284,7 @@ func (f *BorrowedFile) ReadAt(p []byte, off int64) (n int, err error) {
 	if err != nil {
 		return n, err
 	}
-	err = stream.ClientDownloadLimit.WaitN(f.ctx, n)
+	err = f.limiter.WaitN(f.ctx, n)
 	return n, err
 }
 
@@ -0,0 +1,104 @@
+package handles
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/backup"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type ExportBackupReq struct {
+	Passphrase string `json:"passphrase"`
+	Zip        bool   `json:"zip"`
+}
+
+func ExportBackup(c *gin.Context) {
+	var req ExportBackupReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	b, err := backup.Export(req.Passphrase)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	var buf bytes.Buffer
+	if err = b.Write(&buf, req.Zip); err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	name, contentType := "openlist-backup-"+b.CreatedAt.Format("20060102-150405"), "application/json"
+	if req.Zip {
+		name, contentType = name+".zip", "application/zip"
+	} else {
+		name += ".json"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	c.Data(200, contentType, buf.Bytes())
+}
+
+// ImportBackup imports the backup uploaded as the form file "file",
+// the storages are loaded again from the database afterwards
+func ImportBackup(c *gin.Context) {
+	mode := c.DefaultPostForm("mode", backup.ModeMerge)
+	file, err := c.FormFile("file")
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	defer f.Close()
+	b, err := backup.Read(f)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	res, err := backup.Import(b, mode, c.PostForm("passphrase"))
+	if err != nil {
+		if errors.Is(err, backup.ErrWrongPassphrase) {
+			common.ErrorResp(c, err, 400)
+		} else {
+			common.ErrorResp(c, err, 500, true)
+		}
+		return
+	}
+	reloadStorages()
+	common.SuccessResp(c, res)
+}
+
+// reloadStorages unloads all storages and loads the enabled ones of the database in the background
+func reloadStorages() {
+	conf.ResetStoragesLoadSignal()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		op.UnloadAllStorages(ctx)
+		storages, err := db.GetEnabledStorages()
+		if err != nil {
+			log.Errorf("failed get enabled storages: %+v", err)
+		}
+		for _, storage := range storages {
+			if err := op.LoadStorage(ctx, storage); err != nil {
+				log.Errorf("failed load storage [%s]: %+v", storage.MountPath, err)
+				continue
+			}
+			log.Infof("success load storage: [%s], driver: [%s]",
+				storage.MountPath, storage.Driver)
+		}
+		conf.SendStoragesLoadedSignal()
+	}()
+}
@@ -71,7 +71,7 @@ func Proxy(c *gin.Context) {
 			common.ErrorPage(c, err, 500)
 			return
 		}
-		proxy(c, link, file, storage.GetStorage().ProxyRange)
+		proxy(c, link, file, storage.GetStorage(), rawPath)
 	} else {
 		common.ErrorPage(c, errors.New("proxy not allowed"), 403)
 		return
@@ -97,7 +97,7 @@ func redirect(c *gin.Context, link *model.Link) {
 	c.Redirect(302, link.URL)
 }
 
-func proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) {
+func proxy(c *gin.Context, link *model.Link, file model.Obj, storage *model.Storage, path string) {
 	defer link.Close()
 	var err error
 	if link.URL != "" && setting.GetBool(conf.ForwardDirectLinkParams) {
@@ -111,9 +111,10 @@ func proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) {
 			return
 		}
 	}
-	if proxyRange {
+	if storage.ProxyRange {
 		link = common.ProxyRange(c, link, file.GetSize())
 	}
+	link = common.ReadCacheRange(c, storage, path, link, file)
 	Writer := &common.WrittenResponseWriter{ResponseWriter: c.Writer}
 	raw, _ := strconv.ParseBool(c.DefaultQuery("raw", "false"))
 	if utils.Ext(file.GetName()) == "md" && setting.GetBool(conf.FilterReadMeScripts) && !raw {
@@ -269,6 +269,48 @@ func FsCopy(c *gin.Context) {
 	}
 }
 
+type VerifyReq struct {
+	SrcDir string `json:"src_dir"`
+	DstDir string `json:"dst_dir"`
+	Deep   bool   `json:"deep"`
+}
+
+// FsVerify adds a task comparing the tree of dst_dir with src_dir
+func FsVerify(c *gin.Context) {
+	var req VerifyReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	dirs := make([]string, 0, 2)
+	for _, dir := range []string{req.SrcDir, req.DstDir} {
+		reqPath, err := user.JoinPath(dir)
+		if err != nil {
+			common.ErrorResp(c, err, 403)
+			return
+		}
+		meta, err := op.GetNearestMeta(reqPath)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			common.ErrorResp(c, err, 500, true)
+			return
+		}
+		if !common.CanRead(user, meta, reqPath) {
+			common.ErrorResp(c, errs.PermissionDenied, 403)
+			return
+		}
+		dirs = append(dirs, reqPath)
+	}
+	t, err := fs.VerifyTree(c.Request.Context(), dirs[0], dirs[1], req.Deep)
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c, gin.H{
+		"task": getTaskInfo(t),
+	})
+}
+
 type RenameReq struct {
 	Path      string `json:"path"`
 	Name      string `json:"name"`
@@ -0,0 +1,225 @@
+package handles
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	stdpath "path"
+	"strconv"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/resumable"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// resumable uploads following the tus 1.0 protocol, with the creation, expiration and termination extensions.
+// The target is given by the File-Path header on creation, like /fs/put.
+
+const tusVersion = "1.0.0"
+
+// tusError replies with a real status code, tus clients decide whether to retry by it
+func tusError(c *gin.Context, err error, code int) {
+	if code >= 500 {
+		log.Errorf("resumable upload: %+v", err)
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.String(code, err.Error())
+	c.Abort()
+}
+
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
+
+func getTusSession(c *gin.Context) (*model.UploadSession, bool) {
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	s, err := resumable.Get(c.Param("id"))
+	if err != nil || s.UserID != user.ID {
+		tusError(c, errors.New("upload not found"), http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,expiration,termination")
+	c.Status(http.StatusNoContent)
+}
+
+func TusCreate(c *gin.Context) {
+	path, err := url.PathUnescape(c.GetHeader("File-Path"))
+	if err != nil {
+		tusError(c, err, http.StatusBadRequest)
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	path, err = user.JoinPath(path)
+	if err != nil {
+		tusError(c, err, http.StatusForbidden)
+		return
+	}
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		tusError(c, errors.New("invalid Upload-Length"), http.StatusBadRequest)
+		return
+	}
+	overwrite := c.GetHeader("Overwrite") != "false"
+	if !overwrite {
+		if res, _ := fs.Get(c.Request.Context(), path, &fs.GetArgs{NoLog: true}); res != nil {
+			tusError(c, errors.New("file exists"), http.StatusForbidden)
+			return
+		}
+	}
+	name := stdpath.Base(path)
+	if shouldIgnoreSystemFile(name) {
+		tusError(c, errs.IgnoredSystemFile, http.StatusForbidden)
+		return
+	}
+	metadata := c.GetHeader("Upload-Metadata")
+	mimetype := parseTusMetadata(metadata)["filetype"]
+	if mimetype == "" {
+		mimetype = utils.GetMimeType(name)
+	}
+	s := &model.UploadSession{
+		UserID:    user.ID,
+		Path:      path,
+		Size:      size,
+		Mimetype:  mimetype,
+		Overwrite: overwrite,
+		Modified:  getLastModified(c),
+		Metadata:  metadata,
+	}
+	if err = resumable.Create(s); err != nil {
+		tusError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+s.ID)
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	if size == 0 {
+		tusFinish(c, s, http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+func TusHead(c *gin.Context) {
+	s, ok := getTusSession(c)
+	if !ok {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(s.Size, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	if s.Metadata != "" {
+		c.Header("Upload-Metadata", s.Metadata)
+	}
+	c.Status(http.StatusOK)
+}
+
+func TusPatch(c *gin.Context) {
+	defer func() {
+		_, _ = utils.CopyWithBuffer(io.Discard, c.Request.Body)
+		_ = c.Request.Body.Close()
+	}()
+	if c.ContentType() != "application/offset+octet-stream" {
+		tusError(c, errors.New("content type must be application/offset+octet-stream"), http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		tusError(c, errors.New("invalid Upload-Offset"), http.StatusBadRequest)
+		return
+	}
+	s, ok := getTusSession(c)
+	if !ok {
+		return
+	}
+	if !s.Overwrite && s.Offset == 0 {
+		if res, _ := fs.Get(c.Request.Context(), s.Path, &fs.GetArgs{NoLog: true}); res != nil {
+			tusError(c, errors.New("file exists"), http.StatusForbidden)
+			return
+		}
+	}
+	// the path is only known from the session, so the body is limited here
+	body := &stream.RateLimitReader{
+		Reader:  c.Request.Body,
+		Limiter: common.ClientUploadLimiter(c.Request.Context(), s.Path),
+		Ctx:     c,
+	}
+	newOffset, err := resumable.Write(s, offset, body)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	switch {
+	case errors.Is(err, resumable.ErrOffsetMismatch):
+		tusError(c, err, http.StatusConflict)
+		return
+	case errors.Is(err, resumable.ErrSessionBusy):
+		tusError(c, err, http.StatusLocked)
+		return
+	case errors.Is(err, resumable.ErrSessionExpired):
+		tusError(c, err, http.StatusGone)
+		return
+	case err != nil:
+		tusError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if newOffset == s.Size {
+		tusFinish(c, s, http.StatusNoContent)
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// tusFinish hands the complete upload to an upload task, the task id is returned in the Upload-Task header
+func tusFinish(c *gin.Context, s *model.UploadSession, code int) {
+	t, err := resumable.Finish(c.Request.Context(), s)
+	if err != nil {
+		tusError(c, fmt.Errorf("failed put %s: %w", s.Path, err), http.StatusInternalServerError)
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Task", t.GetID())
+	c.Status(code)
+}
+
+func TusDelete(c *gin.Context) {
+	s, ok := getTusSession(c)
+	if !ok {
+		return
+	}
+	if err := resumable.Delete(s); err != nil {
+		tusError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,12 @@
+package handles
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+// ListLimiters reports the speed and live throughput of every bandwidth limiter
+func ListLimiters(c *gin.Context) {
+	common.SuccessResp(c, stream.LimiterStats())
+}
@@ -482,6 +482,7 @@ type AddOfflineDownloadReq struct {
 	Path         string   `json:"path"`
 	Tool         string   `json:"tool"`
 	DeletePolicy string   `json:"delete_policy"`
+	Priority     int      `json:"priority"`
 }
 
 func AddOfflineDownload(c *gin.Context) {
@@ -523,6 +524,7 @@ func AddOfflineDownload(c *gin.Context) {
 			DstDirPath:   reqPath,
 			Tool:         req.Tool,
 			DeletePolicy: tool.DeletePolicy(req.DeletePolicy),
+			Priority:     req.Priority,
 		})
 		if err != nil {
 			common.ErrorResp(c, err, 500)
@@ -231,7 +231,7 @@ func SharingDown(c *gin.Context) {
 			return
 		}
 		_ = countAccess(c.ClientIP(), s)
-		proxy(c, link, obj, storage.GetStorage().ProxyRange)
+		proxy(c, link, obj, storage.GetStorage(), unwrapPath)
 	} else {
 		link, _, err := op.Link(c.Request.Context(), storage, actualPath, model.LinkArgs{
 			IP:       c.ClientIP(),
@@ -297,7 +297,7 @@ func SharingArchiveExtract(c *gin.Context) {
 			if dealErrorPage(c, err) {
 				return
 			}
-			proxy(c, link, obj, storage.GetStorage().ProxyRange)
+			proxy(c, link, obj, storage.GetStorage(), unwrapPath)
 		} else {
 			args.Redirect = true
 			link, _, err := op.DriverExtract(c.Request.Context(), storage, actualPath, args)
@@ -413,6 +413,7 @@ type UpdateSharingReq struct {
 	Readme      string     `json:"readme"`
 	Header      string     `json:"header"`
 	model.Sort
+	model.SpeedLimit
 	CreatorName string `json:"creator"`
 	Accessed    int    `json:"accessed"`
 	ID          string `json:"id"`
@@ -467,6 +468,7 @@ func UpdateSharing(c *gin.Context) {
 	s.MaxAccessed = req.MaxAccessed
 	s.Disabled = req.Disabled
 	s.Sort = req.Sort
+	s.SpeedLimit = req.SpeedLimit
 	s.Header = req.Header
 	s.Readme = req.Readme
 	s.Remark = req.Remark
@@ -525,6 +527,7 @@ func CreateSharing(c *gin.Context) {
 			MaxAccessed: req.MaxAccessed,
 			Disabled:    req.Disabled,
 			Sort:        req.Sort,
+			SpeedLimit:  req.SpeedLimit,
 			Remark:      req.Remark,
 			Readme:      req.Readme,
 			Header:      req.Header,
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/drivers/crypt"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/db"
 	"github.com/OpenListTeam/OpenList/v4/internal/driver"
@@ -208,3 +209,82 @@ func LoadAllStorages(c *gin.Context) {
 	}(storages)
 	common.SuccessResp(c)
 }
+
+func ListStoragesHealth(c *gin.Context) {
+	common.SuccessResp(c, op.GetStoragesHealth())
+}
+
+// CheckStorageHealth checks a storage at once instead of waiting for its next check
+func CheckStorageHealth(c *gin.Context) {
+	idStr := c.Query("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	storage, err := db.GetStorageById(uint(id))
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	storageDriver, err := op.GetStorageByMountPath(storage.MountPath)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	interval := time.Duration(setting.GetInt(conf.StorageHealthInterval, 30)) * time.Minute
+	// the storage may be initialized again, which must not stop when the client goes away
+	ctx := context.WithoutCancel(c.Request.Context())
+	common.SuccessResp(c, op.CheckStorageHealth(ctx, storageDriver, interval))
+}
+
+func getStorageMountPath(c *gin.Context) (string, bool) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return "", false
+	}
+	storage, err := db.GetStorageById(uint(id))
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return "", false
+	}
+	return storage.MountPath, true
+}
+
+// CryptRekey adds a task re-encrypting a crypt storage with new settings into another folder
+func CryptRekey(c *gin.Context) {
+	var req crypt.RekeyArgs
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	mountPath, ok := getStorageMountPath(c)
+	if !ok {
+		return
+	}
+	t, err := crypt.Rekey(c.Request.Context(), mountPath, req)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.SuccessResp(c, gin.H{
+		"task": getTaskInfo(t),
+	})
+}
+
+// CryptEncrypt adds a task encrypting the plaintext files in the remote of a crypt storage in place
+func CryptEncrypt(c *gin.Context) {
+	mountPath, ok := getStorageMountPath(c)
+	if !ok {
+		return
+	}
+	t, err := crypt.EncryptPlaintext(c.Request.Context(), mountPath)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.SuccessResp(c, gin.H{
+		"task": getTaskInfo(t),
+	})
+}
@@ -2,8 +2,10 @@ package handles
 
 import (
 	"math"
+	"strconv"
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/drivers/crypt"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
@@ -219,10 +221,35 @@ func taskRoute[T task.TaskExtensionInfo](g *gin.RouterGroup, manager task.Manage
 
 func SetupTaskRoute(g *gin.RouterGroup) {
 	taskRoute(g.Group("/upload"), fs.UploadTaskManager)
+	taskRoute(g.Group("/write_back"), fs.WriteBackTaskManager)
 	taskRoute(g.Group("/copy"), fs.CopyTaskManager)
 	taskRoute(g.Group("/move"), fs.MoveTaskManager)
-	taskRoute(g.Group("/offline_download"), tool.DownloadTaskManager)
+	offlineDownload := g.Group("/offline_download")
+	taskRoute(offlineDownload, tool.DownloadTaskManager)
+	offlineDownload.POST("/pause", getTargetedHandler(tool.DownloadTaskManager, func(c *gin.Context, task *tool.DownloadTask) {
+		task.Pause()
+		common.SuccessResp(c)
+	}))
+	offlineDownload.POST("/resume", getTargetedHandler(tool.DownloadTaskManager, func(c *gin.Context, task *tool.DownloadTask) {
+		task.Resume()
+		common.SuccessResp(c)
+	}))
+	offlineDownload.POST("/set_priority", getTargetedHandler(tool.DownloadTaskManager, func(c *gin.Context, task *tool.DownloadTask) {
+		priority, err := strconv.Atoi(c.Query("priority"))
+		if err != nil {
+			common.ErrorStrResp(c, "invalid priority", 400)
+			return
+		}
+		task.SetPriority(priority)
+		common.SuccessResp(c)
+	}))
+	verify := g.Group("/verify")
+	taskRoute(verify, fs.VerifyTaskManager)
+	verify.POST("/report", getTargetedHandler(fs.VerifyTaskManager, func(c *gin.Context, task *fs.VerifyTask) {
+		common.SuccessResp(c, task.GetReport())
+	}))
 	taskRoute(g.Group("/offline_download_transfer"), tool.TransferTaskManager)
 	taskRoute(g.Group("/decompress"), fs.ArchiveDownloadTaskManager)
 	taskRoute(g.Group("/decompress_upload"), fs.ArchiveContentUploadTaskManager)
+	taskRoute(g.Group("/crypt_migrate"), crypt.MigrateTaskManager)
 }
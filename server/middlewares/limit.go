@@ -2,8 +2,14 @@ package middlewares
 
 import (
 	"io"
+	"net/url"
+	stdpath "path"
+	"strings"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,11 +24,61 @@ func MaxAllowed(n int) gin.HandlerFunc {
 	}
 }
 
+// requestPath finds the full path a transfer request works on, to apply the limit of its storage.
+// The handlers which know the path only from their own state, like tus or S3, limit the transfer themselves.
+func requestPath(c *gin.Context) string {
+	if p, ok := c.Request.Context().Value(conf.PathKey).(string); ok {
+		return p
+	}
+	user, ok := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if !ok {
+		return ""
+	}
+	var p string
+	if filePath := c.GetHeader("File-Path"); filePath != "" {
+		p, _ = url.PathUnescape(filePath)
+	} else if p, ok = davPath(c.Request.URL.Path); !ok {
+		return ""
+	}
+	p, err := user.JoinPath(p)
+	if err != nil {
+		return ""
+	}
+	return p
+}
+
+// davPath returns the path below the base path of the user a request to a WebDAV endpoint works on
+func davPath(p string) (string, bool) {
+	for _, mount := range []string{"/dav", "/remote.php/webdav"} {
+		if rest, ok := cutMount(p, stdpath.Join(conf.URL.Path, mount)); ok {
+			return rest, true
+		}
+	}
+	if rest, ok := cutMount(p, stdpath.Join(conf.URL.Path, "/remote.php/dav/files")); ok {
+		// the name of the user comes first
+		_, rest, _ = strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		return "/" + rest, true
+	}
+	return "", false
+}
+
+// cutMount removes mount from the start of p, only if it ends there or at a slash
+func cutMount(p, mount string) (string, bool) {
+	if p == mount {
+		return "/", true
+	}
+	if rest, ok := strings.CutPrefix(p, mount+"/"); ok {
+		return "/" + rest, true
+	}
+	return "", false
+}
+
+// UploadRateLimiter limits the request body by limiter together with the limiters of the user, storage and sharing
 func UploadRateLimiter(limiter stream.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Request.Body = &stream.RateLimitReader{
 			Reader:  c.Request.Body,
-			Limiter: limiter,
+			Limiter: common.ClientLimiter(c.Request.Context(), limiter, requestPath(c), true),
 			Ctx:     c,
 		}
 		c.Next()
@@ -38,13 +94,14 @@ func (w *ResponseWriterWrapper) Write(p []byte) (n int, err error) {
 	return w.WrapWriter.Write(p)
 }
 
+// DownloadRateLimiter limits the response by limiter together with the limiters of the user, storage and sharing
 func DownloadRateLimiter(limiter stream.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer = &ResponseWriterWrapper{
 			ResponseWriter: c.Writer,
 			WrapWriter: &stream.RateLimitWriter{
 				Writer:  c.Writer,
-				Limiter: limiter,
+				Limiter: common.ClientLimiter(c.Request.Context(), limiter, requestPath(c), false),
 				Ctx:     c,
 			},
 		}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+var routeGroups = []struct {
+	prefix string
+	group  string
+}{
+	{"/d/", "d"},
+	{"/p/", "p"},
+	{"/api/fs/", "fs"},
+	{"/api/", "api"},
+	{"/dav", "dav"},
+	{"/s3", "s3"},
+}
+
+func routeGroup(path string) string {
+	path = strings.TrimPrefix(path, strings.TrimSuffix(conf.URL.Path, "/"))
+	for _, g := range routeGroups {
+		if strings.HasPrefix(path, g.prefix) {
+			return g.group
+		}
+	}
+	return "other"
+}
+
+// Metrics counts the requests and their latency, an empty group is derived from the path
+func Metrics(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		g := group
+		if g == "" {
+			g = routeGroup(c.Request.URL.Path)
+		}
+		c.Next()
+		metrics.ObserveRequest(g, c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// MetricsToken checks the bearer token of /metrics if one is configured
+func MetricsToken(c *gin.Context) {
+	token := conf.Conf.Metrics.Token
+	if token == "" {
+		c.Next()
+		return
+	}
+	got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
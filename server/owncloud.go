@@ -0,0 +1,146 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
+	"github.com/OpenListTeam/OpenList/v4/server/webdav"
+	"github.com/gin-gonic/gin"
+)
+
+// ocVersion is the server version told to the ownCloud and Nextcloud clients, which refuse the versions they don't support
+const ocVersion = "28.0.0"
+
+var davMethods = []string{"PROPFIND", "MKCOL", "LOCK", "UNLOCK", "PROPPATCH", "COPY", "MOVE"}
+
+var (
+	cleanUploadsOnce sync.Once
+	cleanUploadsCron *cron.Cron
+)
+
+// OwnCloud serves the endpoints the ownCloud and Nextcloud sync clients use, when webdav_owncloud_compat is enabled.
+// It must be registered after WebDav, whose locks it shares.
+func OwnCloud(g *gin.RouterGroup) {
+	g = g.Group("", ownCloudEnabled)
+	g.GET("/status.php", ownCloudStatus)
+	for _, v := range []string{"/ocs/v1.php", "/ocs/v2.php"} {
+		ocs := g.Group(v, WebDAVAuth)
+		ocs.GET("/cloud/capabilities", ocsCapabilities)
+		ocs.GET("/cloud/user", ocsUser)
+	}
+
+	uploadLimiter := middlewares.UploadRateLimiter(stream.ClientUploadLimit)
+	downloadLimiter := middlewares.DownloadRateLimiter(stream.ClientDownloadLimit)
+	remote := g.Group("/remote.php", WebDAVAuth, uploadLimiter, downloadLimiter)
+	for _, p := range []string{"/webdav", "/webdav/*path"} {
+		remote.Any(p, serveOwnCloudWebDAV)
+		for _, m := range davMethods {
+			remote.Handle(m, p, serveOwnCloudWebDAV)
+		}
+	}
+	for _, p := range []string{"/dav/files/:user", "/dav/files/:user/*path", "/dav/uploads/:user", "/dav/uploads/:user/*path"} {
+		remote.Any(p, serveOwnCloudDAV)
+		for _, m := range davMethods {
+			remote.Handle(m, p, serveOwnCloudDAV)
+		}
+	}
+
+	cleanUploadsOnce.Do(func() {
+		cleanUploadsCron = cron.NewCron(time.Hour)
+		cleanUploadsCron.Do(webdav.CleanUploads)
+	})
+}
+
+func ownCloudEnabled(c *gin.Context) {
+	if !setting.GetBool(conf.WebdavOwnCloudCompat) {
+		c.Status(http.StatusNotFound)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func ownCloudStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"installed":       true,
+		"maintenance":     false,
+		"needsDbUpgrade":  false,
+		"version":         ocVersion + ".0",
+		"versionstring":   ocVersion,
+		"edition":         "",
+		"productname":     "OpenList",
+		"extendedSupport": false,
+	})
+}
+
+// ocsResponse wraps data in the OCS envelope, the clients always ask for json
+func ocsResponse(c *gin.Context, data any) {
+	// the status code of OCS v1 is 100 while v2 uses the HTTP one
+	code := http.StatusOK
+	if strings.Contains(c.FullPath(), "/ocs/v1.php/") {
+		code = 100
+	}
+	c.JSON(http.StatusOK, gin.H{"ocs": gin.H{
+		"meta": gin.H{"status": "ok", "statuscode": code, "message": "OK"},
+		"data": data,
+	}})
+}
+
+func ocsCapabilities(c *gin.Context) {
+	ocsResponse(c, gin.H{
+		"version": gin.H{"major": 28, "minor": 0, "micro": 0, "string": ocVersion, "edition": "", "extendedSupport": false},
+		"capabilities": gin.H{
+			"core": gin.H{"pollinterval": 60, "webdav-root": "remote.php/webdav"},
+			"dav":  gin.H{"chunking": "1.0"},
+			"files": gin.H{
+				"bigfilechunking": true,
+				"undelete":        false,
+				"versioning":      false,
+			},
+			"checksums": gin.H{"supportedTypes": []string{"SHA1", "MD5"}, "preferredUploadType": "SHA1"},
+		},
+	})
+}
+
+func ocsUser(c *gin.Context) {
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	ocsResponse(c, gin.H{"id": user.Username, "display-name": user.Username, "email": ""})
+}
+
+// serveOwnCloudWebDAV serves the legacy /remote.php/webdav, which is the root of the user like /dav
+func serveOwnCloudWebDAV(c *gin.Context) {
+	h := &webdav.Handler{
+		Prefix:     path.Join(conf.URL.Path, "/remote.php/webdav"),
+		LockSystem: handler.LockSystem,
+		Logger:     handler.Logger,
+		OwnCloud:   true,
+	}
+	h.ServeHTTP(c.Writer, c.Request)
+}
+
+// serveOwnCloudDAV serves the files and the chunked uploads of the user named in the path, who must be the one logged in
+func serveOwnCloudDAV(c *gin.Context) {
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if c.Param("user") != user.Username {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	dav := path.Join(conf.URL.Path, "/remote.php/dav")
+	h := &webdav.Handler{
+		Prefix:        path.Join(dav, "files", user.Username),
+		UploadsPrefix: path.Join(dav, "uploads", user.Username),
+		LockSystem:    handler.LockSystem,
+		Logger:        handler.Logger,
+		OwnCloud:      true,
+	}
+	h.ServeHTTP(c.Writer, c.Request)
+}
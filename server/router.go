@@ -4,6 +4,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/message"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/sign"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
@@ -24,6 +25,10 @@ func Init(e *gin.Engine) {
 	}
 	Cors(e)
 	g := e.Group(conf.URL.Path)
+	if conf.Conf.Metrics.Enable {
+		g.Use(middlewares.Metrics(""))
+		g.GET("/metrics", middlewares.MetricsToken, gin.WrapH(metrics.Handler()))
+	}
 	if conf.Conf.Scheme.HttpPort != -1 && conf.Conf.Scheme.HttpsPort != -1 && conf.Conf.Scheme.ForceHttps {
 		e.Use(middlewares.ForceHttps)
 	}
@@ -40,6 +45,7 @@ func Init(e *gin.Engine) {
 		g.Use(middlewares.MaxAllowed(conf.Conf.MaxConnections))
 	}
 	WebDav(g.Group("/dav"))
+	OwnCloud(g)
 	S3(g.Group("/s3"))
 
 	downloadLimiter := middlewares.DownloadRateLimiter(stream.ClientDownloadLimit)
@@ -122,6 +128,13 @@ func admin(g *gin.RouterGroup) {
 	meta.POST("/update", handles.UpdateMeta)
 	meta.POST("/delete", handles.DeleteMeta)
 
+	watch := g.Group("/watch")
+	watch.GET("/list", handles.ListWatchRules)
+	watch.GET("/get", handles.GetWatchRule)
+	watch.POST("/create", handles.CreateWatchRule)
+	watch.POST("/update", handles.UpdateWatchRule)
+	watch.POST("/delete", handles.DeleteWatchRule)
+
 	user := g.Group("/user")
 	user.GET("/list", handles.ListUsers)
 	user.GET("/get", handles.GetUser)
@@ -142,6 +155,10 @@ func admin(g *gin.RouterGroup) {
 	storage.POST("/enable", handles.EnableStorage)
 	storage.POST("/disable", handles.DisableStorage)
 	storage.POST("/load_all", handles.LoadAllStorages)
+	storage.GET("/health", handles.ListStoragesHealth)
+	storage.POST("/health/check", handles.CheckStorageHealth)
+	storage.POST("/crypt/rekey", handles.CryptRekey)
+	storage.POST("/crypt/encrypt", handles.CryptEncrypt)
 
 	driver := g.Group("/driver")
 	driver.GET("/list", handles.ListDriverInfo)
@@ -185,6 +202,13 @@ func admin(g *gin.RouterGroup) {
 	scan.POST("/start", handles.StartManualScan)
 	scan.POST("/stop", handles.StopManualScan)
 	scan.GET("/progress", handles.GetManualScanProgress)
+
+	traffic := g.Group("/traffic")
+	traffic.GET("/limiters", handles.ListLimiters)
+
+	backup := g.Group("/backup")
+	backup.POST("/export", handles.ExportBackup)
+	backup.POST("/import", handles.ImportBackup)
 }
 
 func fsAndShare(g *gin.RouterGroup) {
@@ -206,11 +230,18 @@ func _fs(g *gin.RouterGroup) {
 	g.POST("/move", handles.FsMove)
 	g.POST("/recursive_move", handles.FsRecursiveMove)
 	g.POST("/copy", handles.FsCopy)
+	g.POST("/verify", handles.FsVerify)
 	g.POST("/remove", handles.FsRemove)
 	g.POST("/remove_empty_directory", handles.FsRemoveEmptyDirectory)
 	uploadLimiter := middlewares.UploadRateLimiter(stream.ClientUploadLimit)
 	g.PUT("/put", middlewares.FsUp, uploadLimiter, handles.FsStream)
 	g.PUT("/form", middlewares.FsUp, uploadLimiter, handles.FsForm)
+	tus := g.Group("/tus")
+	tus.OPTIONS("", handles.TusOptions)
+	tus.POST("", middlewares.FsUp, handles.TusCreate)
+	tus.HEAD("/:id", handles.TusHead)
+	tus.PATCH("/:id", handles.TusPatch)
+	tus.DELETE("/:id", handles.TusDelete)
 	g.POST("/link", middlewares.AuthAdmin, handles.Link)
 	// g.POST("/add_aria2", handles.AddOfflineDownload)
 	// g.POST("/add_qbit", handles.AddQbittorrent)
@@ -246,5 +277,8 @@ func Cors(r *gin.Engine) {
 
 func InitS3(e *gin.Engine) {
 	Cors(e)
+	if conf.Conf.Metrics.Enable {
+		e.Use(middlewares.Metrics("s3"))
+	}
 	S3Server(e.Group("/"))
 }
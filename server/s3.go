@@ -3,7 +3,6 @@ package server
 import (
 	"context"
 	"path"
-	"strings"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
@@ -24,16 +23,11 @@ func S3(g *gin.RouterGroup) {
 		})
 		return
 	}
-	h, _ := s3.NewServer(context.Background())
-
-	g.Any("/*path", func(c *gin.Context) {
-		adjustedPath := strings.TrimPrefix(c.Request.URL.Path, path.Join(conf.URL.Path, "/s3"))
-		c.Request.URL.Path = adjustedPath
-		gin.WrapH(h)(c)
-	})
+	h, _ := s3.NewServer(context.Background(), path.Join(conf.URL.Path, "/s3"))
+	g.Any("/*path", gin.WrapH(h))
 }
 
 func S3Server(g *gin.RouterGroup) {
-	h, _ := s3.NewServer(context.Background())
+	h, _ := s3.NewServer(context.Background(), "")
 	g.Any("/*path", gin.WrapH(h))
 }
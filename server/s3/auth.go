@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itsHenry35/gofakes3/signature"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPresignExpires is the longest validity of a presigned url, the same as AWS
+const maxPresignExpires = 7 * 24 * time.Hour
+
+// authMiddleware verifies the signature before prefix is stripped from the path, so that it matches the signed path.
+// It replaces the one of gofakes3, which doesn't bound the expiry of the presigned urls.
+func authMiddleware(prefix string, keys map[string]string, next http.Handler) http.Handler {
+	signature.ReloadKeys(keys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(keys) > 0 {
+			if apiErr := verifyRequest(r); apiErr != nil {
+				log.Warnf("[s3] access denied: %s => %s: %s", r.RemoteAddr, r.URL, apiErr.Description)
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(apiErr.HTTPStatusCode)
+				_, _ = w.Write(signature.EncodeAPIErrorToResponse(*apiErr))
+				return
+			}
+		}
+		if prefix != "" {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func verifyRequest(r *http.Request) *signature.APIError {
+	q := r.URL.Query()
+	if r.Header.Get("Authorization") == "" && q.Get("X-Amz-Signature") != "" {
+		if apiErr := checkPresignExpiry(q.Get("X-Amz-Date"), q.Get("X-Amz-Expires"), time.Now()); apiErr != nil {
+			return apiErr
+		}
+	}
+	code := signature.V4SignVerify(r)
+	if code == signature.ErrUnsupportAlgorithm {
+		code = signature.V2SignVerify(r)
+	}
+	if code != signature.ErrNone {
+		apiErr := signature.GetAPIError(code)
+		return &apiErr
+	}
+	return nil
+}
+
+// checkPresignExpiry checks the query of a presigned url like AWS does, the signature is verified by gofakes3
+func checkPresignExpiry(date, expires string, now time.Time) *signature.APIError {
+	t, err := time.Parse("20060102T150405Z", date)
+	if err != nil {
+		return &signature.APIError{
+			Code:           "AuthorizationQueryParametersError",
+			Description:    "X-Amz-Date must be in the ISO8601 Long Format \"yyyyMMdd'T'HHmmss'Z'\"",
+			HTTPStatusCode: http.StatusBadRequest,
+		}
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || seconds < 0 {
+		return &signature.APIError{
+			Code:           "AuthorizationQueryParametersError",
+			Description:    "X-Amz-Expires should be a number",
+			HTTPStatusCode: http.StatusBadRequest,
+		}
+	}
+	if time.Duration(seconds)*time.Second > maxPresignExpires {
+		return &signature.APIError{
+			Code:           "AuthorizationQueryParametersError",
+			Description:    "X-Amz-Expires must be less than a week (in seconds) that is 604800",
+			HTTPStatusCode: http.StatusBadRequest,
+		}
+	}
+	if t.After(now.Add(15 * time.Minute)) {
+		return &signature.APIError{
+			Code:           "AccessDenied",
+			Description:    "Request is not valid yet",
+			HTTPStatusCode: http.StatusForbidden,
+		}
+	}
+	if now.After(t.Add(time.Duration(seconds) * time.Second)) {
+		return &signature.APIError{
+			Code:           "AccessDenied",
+			Description:    "Request has expired",
+			HTTPStatusCode: http.StatusForbidden,
+		}
+	}
+	return nil
+}
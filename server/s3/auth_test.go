@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckPresignExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		date    string
+		expires string
+		wantErr string
+	}{
+		{name: "valid", date: "20240501T113000Z", expires: "3600"},
+		{name: "a week", date: "20240501T113000Z", expires: "604800"},
+		{name: "expired", date: "20240501T103000Z", expires: "3600", wantErr: "AccessDenied"},
+		{name: "too long", date: "20240501T113000Z", expires: "604801", wantErr: "AuthorizationQueryParametersError"},
+		{name: "negative", date: "20240501T113000Z", expires: "-1", wantErr: "AuthorizationQueryParametersError"},
+		{name: "bad date", date: "2024-05-01", expires: "3600", wantErr: "AuthorizationQueryParametersError"},
+		{name: "future", date: "20240501T130000Z", expires: "3600", wantErr: "AccessDenied"},
+	}
+	for _, tt := range tests {
+		err := checkPresignExpiry(tt.date, tt.expires, now)
+		switch {
+		case err == nil && tt.wantErr != "":
+			t.Errorf("%s: expected %s, got nil", tt.name, tt.wantErr)
+		case err != nil && err.Code != tt.wantErr:
+			t.Errorf("%s: expected %q, got %s: %s", tt.name, tt.wantErr, err.Code, err.Description)
+		}
+	}
+}
+
+func TestParseTaggingHeader(t *testing.T) {
+	tags, err := parseTaggingHeader("a=1&b=x%20y")
+	if err != nil || len(tags) != 2 || tags["a"] != "1" || tags["b"] != "x y" {
+		t.Errorf("unexpected tags %v, err %v", tags, err)
+	}
+	if _, err = parseTaggingHeader("a=1&a=2"); err == nil {
+		t.Error("expected an error for duplicated keys")
+	}
+	if _, err = parseTaggingHeader("1&2&3&4&5&6&7&8&9&10&11"); err == nil {
+		t.Error("expected an error for more than 10 tags")
+	}
+}
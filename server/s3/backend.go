@@ -8,8 +8,9 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -23,6 +24,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/itsHenry35/gofakes3"
 	"github.com/ncw/swift/v2"
 	log "github.com/sirupsen/logrus"
@@ -35,15 +37,44 @@ var (
 
 // s3Backend implements the gofacess3.Backend interface to make an S3
 // backend for gofakes3
-type s3Backend struct {
-	meta *sync.Map
-}
+type s3Backend struct{}
 
 // newBackend creates a new SimpleBucketBackend.
-func newBackend() gofakes3.Backend {
-	return &s3Backend{
-		meta: new(sync.Map),
+func newBackend() *s3Backend {
+	return &s3Backend{}
+}
+
+// storedHeaders are the headers kept with the object besides the x-amz-meta-* ones
+var storedHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type"}
+
+// userMetadata picks the metadata of a request which is stored with the object
+func userMetadata(meta map[string]string) map[string]string {
+	res := make(map[string]string)
+	for k, v := range meta {
+		if strings.HasPrefix(k, "X-Amz-Meta-") || slices.Contains(storedHeaders, k) {
+			res[k] = v
+		}
 	}
+	return res
+}
+
+// applyObjectMeta adds the stored metadata and the number of tags of the object to meta, the version id of the object is returned
+func applyObjectMeta(fp string, meta map[string]string) gofakes3.VersionID {
+	m, err := op.GetS3ObjectMeta(fp)
+	if err != nil {
+		log.Warnf("failed get s3 metadata of %s: %+v", fp, err)
+		return ""
+	}
+	if m == nil {
+		return ""
+	}
+	for k, v := range m.Metadata {
+		meta[k] = v
+	}
+	if len(m.Tags) > 0 {
+		meta["X-Amz-Tagging-Count"] = strconv.Itoa(len(m.Tags))
+	}
+	return gofakes3.VersionID(m.VersionID)
 }
 
 // ListBuckets always returns the default bucket.
@@ -84,31 +115,36 @@ func (b *s3Backend) ListBucket(ctx context.Context, bucketName string, prefix *g
 		prefix.HasDelimiter = false
 	}
 
-	response := gofakes3.NewObjectList()
 	path, remaining := prefixParser(prefix)
 
-	err = b.entryListR(bucketPath, path, remaining, prefix.HasDelimiter, response)
+	var entries []listEntry
+	if prefix.HasDelimiter {
+		entries, err = b.entryList(bucketPath, path, remaining)
+	} else {
+		// the listings without delimiter are recursive, which rclone and restic issue constantly
+		entries, err = b.entryListR(ctx, bucketPath, path, remaining)
+	}
 	if err == gofakes3.ErrNoSuchKey {
 		// AWS just returns an empty list
-		response = gofakes3.NewObjectList()
+		entries = nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	return b.pager(response, page)
+	return b.pager(entries, page)
 }
 
 // HeadObject returns the fileinfo for the given object name.
-//
-// Note that the metadata is not supported yet.
 func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName string) (*gofakes3.Object, error) {
 	bucket, err := getBucketByName(bucketName)
 	if err != nil {
 		return nil, err
 	}
-	bucketPath := bucket.Path
+	return headObject(ctx, path.Join(bucket.Path, objectName), objectName)
+}
 
-	fp := path.Join(bucketPath, objectName)
+// headObject returns the fileinfo of the object at fp, which is a version of objectName
+func headObject(ctx context.Context, fp, objectName string) (*gofakes3.Object, error) {
 	fmeta, _ := op.GetNearestMeta(fp)
 	node, err := fs.Get(context.WithValue(ctx, conf.MetaKey, fmeta), fp, &fs.GetArgs{})
 	if err != nil {
@@ -127,19 +163,15 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 		"Content-Type":  utils.GetMimeType(fp),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
-	}
+	versionID := applyObjectMeta(fp, meta)
 
 	return &gofakes3.Object{
 		Name: objectName,
 		// Hash:     hash,
-		Metadata: meta,
-		Size:     size,
-		Contents: noOpReadCloser{},
+		Metadata:  meta,
+		Size:      size,
+		VersionID: versionID,
+		Contents:  noOpReadCloser{},
 	}, nil
 }
 
@@ -149,9 +181,11 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	if err != nil {
 		return nil, err
 	}
-	bucketPath := bucket.Path
+	return getObject(ctx, path.Join(bucket.Path, objectName), objectName, rangeRequest)
+}
 
-	fp := path.Join(bucketPath, objectName)
+// getObject fetchs the object at fp, which is a version of objectName
+func getObject(ctx context.Context, fp, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (s3Obj *gofakes3.Object, err error) {
 	fmeta, _ := op.GetNearestMeta(fp)
 	node, err := fs.Get(context.WithValue(ctx, conf.MetaKey, fmeta), fp, &fs.GetArgs{})
 	if err != nil {
@@ -202,21 +236,21 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		"Content-Type":        utils.GetMimeType(fp),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
-	}
+	versionID := applyObjectMeta(fp, meta)
 
 	return &gofakes3.Object{
 		// Name: gofakes3.URLEncode(objectName),
 		Name: objectName,
 		// Hash:     "",
-		Metadata: meta,
-		Size:     size,
-		Range:    rnge,
-		Contents: utils.ReadCloser{Reader: rd, Closer: link},
+		Metadata:  meta,
+		Size:      size,
+		Range:     rnge,
+		VersionID: versionID,
+		Contents: utils.ReadCloser{Reader: &stream.RateLimitReader{
+			Reader:  rd,
+			Limiter: common.ClientDownloadLimiter(ctx, fp),
+			Ctx:     ctx,
+		}, Closer: link},
 	}, nil
 }
 
@@ -237,6 +271,12 @@ func (b *s3Backend) PutObject(
 		return result, err
 	}
 	bucketPath := bucket.Path
+	defer dropListings()
+
+	tags, err := parseTaggingHeader(meta["X-Amz-Tagging"])
+	if err != nil {
+		return result, err
+	}
 
 	isDir := strings.HasSuffix(objectName, "/")
 	log.Debugf("isDir: %v", isDir)
@@ -271,6 +311,14 @@ func (b *s3Backend) PutObject(
 		return result, nil
 	}
 
+	if isVersionsPath(objectName) {
+		return result, gofakes3.ErrorInvalidArgument("key", objectName, "The key is reserved for the versions of the objects")
+	}
+	versionID, err := newVersion(ctx, bucket, fp)
+	if err != nil {
+		return result, err
+	}
+
 	var ti time.Time
 
 	if val, ok := meta["X-Amz-Meta-Mtime"]; ok {
@@ -297,13 +345,20 @@ func (b *s3Backend) PutObject(
 		return result, errs.IgnoredSystemFile
 	}
 	stream := &stream.FileStream{
-		Obj:      &obj,
-		Reader:   input,
+		Obj: &obj,
+		Reader: &stream.RateLimitReader{
+			Reader:  input,
+			Limiter: common.ClientUploadLimiter(ctx, fp),
+			Ctx:     ctx,
+		},
 		Mimetype: meta["Content-Type"],
 	}
 
 	err = fs.PutDirectly(ctx, reqPath, stream)
 	if err != nil {
+		if bucket.Versioning != "" {
+			restoreLatest(ctx, fp)
+		}
 		return result, err
 	}
 
@@ -313,7 +368,13 @@ func (b *s3Backend) PutObject(
 	// 	return result, err
 	// }
 
-	b.meta.Store(fp, meta)
+	err = op.SaveS3ObjectMeta(&model.S3ObjectMeta{Path: fp, Metadata: userMetadata(meta), Tags: tags, VersionID: versionID})
+	if err != nil {
+		return result, errors.WithMessage(err, "failed to save metadata")
+	}
+	if bucket.Versioning != "" {
+		result.VersionID = apiVersionID(versionID)
+	}
 
 	return result, nil
 }
@@ -321,7 +382,7 @@ func (b *s3Backend) PutObject(
 // DeleteMulti deletes multiple objects in a single request.
 func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, rerr error) {
 	for _, object := range objects {
-		if err := b.deleteObject(ctx, bucketName, object); err != nil {
+		if _, err := b.deleteObject(ctx, bucketName, object); err != nil {
 			log.Errorf("delete object failed: %v", err)
 			result.Error = append(result.Error, gofakes3.ErrorResult{
 				Code:    gofakes3.ErrInternal,
@@ -340,27 +401,35 @@ func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects
 
 // DeleteObject deletes the object with the given name.
 func (b *s3Backend) DeleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
-	return result, b.deleteObject(ctx, bucketName, objectName)
+	return b.deleteObject(ctx, bucketName, objectName)
 }
 
-// deleteObject deletes the object from the filesystem.
-func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) error {
+// deleteObject deletes the object from the filesystem, in a versioned bucket the object is kept as a noncurrent version.
+func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, err error) {
 	bucket, err := getBucketByName(bucketName)
 	if err != nil {
-		return err
+		return result, err
 	}
 	bucketPath := bucket.Path
+	defer dropListings()
 
 	fp := path.Join(bucketPath, objectName)
 	fmeta, _ := op.GetNearestMeta(fp)
 	// S3 does not report an error when attemping to delete a key that does not exist, so
 	// we need to skip IsNotExist errors.
-	if _, err := fs.Get(context.WithValue(ctx, conf.MetaKey, fmeta), fp, &fs.GetArgs{}); err != nil && !errs.IsObjectNotFound(err) {
-		return err
+	node, err := fs.Get(context.WithValue(ctx, conf.MetaKey, fmeta), fp, &fs.GetArgs{})
+	if err != nil {
+		if !errs.IsObjectNotFound(err) {
+			return result, err
+		}
+		return result, nil
 	}
 
+	if bucket.Versioning != "" && !node.IsDir() {
+		return markDeleted(ctx, fp, bucket.Versioning == string(gofakes3.VersioningEnabled))
+	}
 	fs.Remove(ctx, fp)
-	return nil
+	return result, nil
 }
 
 // CreateBucket creates a new bucket.
@@ -388,12 +457,9 @@ func (b *s3Backend) BucketExists(ctx context.Context, name string) (exists bool,
 }
 
 // CopyObject copy specified object from srcKey to dstKey.
+//
+// Like S3 the metadata and the tags are copied, unless the directives of the request replace them.
 func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (result gofakes3.CopyObjectResult, err error) {
-	if srcBucket == dstBucket && srcKey == dstKey {
-		//TODO: update meta
-		return result, nil
-	}
-
 	srcB, err := getBucketByName(srcBucket)
 	if err != nil {
 		return result, err
@@ -403,6 +469,38 @@ func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket
 	srcFp := path.Join(srcBucketPath, srcKey)
 	fmeta, _ := op.GetNearestMeta(srcFp)
 	srcNode, err := fs.Get(context.WithValue(ctx, conf.MetaKey, fmeta), srcFp, &fs.GetArgs{})
+	if err != nil || srcNode.IsDir() {
+		return result, gofakes3.KeyNotFound(srcKey)
+	}
+
+	srcMeta, err := op.GetS3ObjectMeta(srcFp)
+	if err != nil {
+		return result, err
+	}
+	if srcMeta == nil {
+		srcMeta = &model.S3ObjectMeta{}
+	}
+	metadata, tags := srcMeta.Metadata, srcMeta.Tags
+	if strings.EqualFold(meta["X-Amz-Metadata-Directive"], "REPLACE") {
+		metadata = userMetadata(meta)
+	}
+	if strings.EqualFold(meta["X-Amz-Tagging-Directive"], "REPLACE") {
+		if tags, err = parseTaggingHeader(meta["X-Amz-Tagging"]); err != nil {
+			return result, err
+		}
+	}
+
+	if srcBucket == dstBucket && srcKey == dstKey {
+		// copying an object onto itself only updates its metadata
+		err = op.SaveS3ObjectMeta(&model.S3ObjectMeta{Path: srcFp, Metadata: metadata, Tags: tags, VersionID: srcMeta.VersionID})
+		if err != nil {
+			return result, err
+		}
+		return gofakes3.CopyObjectResult{
+			ETag:         `""`,
+			LastModified: gofakes3.NewContentTime(srcNode.ModTime()),
+		}, nil
+	}
 
 	c, err := b.GetObject(ctx, srcBucket, srcKey, nil)
 	if err != nil {
@@ -412,16 +510,20 @@ func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket
 		_ = c.Contents.Close()
 	}()
 
-	for k, v := range c.Metadata {
-		if _, found := meta[k]; !found && k != "X-Amz-Acl" {
-			meta[k] = v
-		}
+	putMeta := map[string]string{
+		"X-Amz-Tagging": encodeTaggingHeader(tags),
+	}
+	for k, v := range metadata {
+		putMeta[k] = v
+	}
+	if _, ok := putMeta["Content-Type"]; !ok {
+		putMeta["Content-Type"] = c.Metadata["Content-Type"]
 	}
-	if _, ok := meta["mtime"]; !ok {
-		meta["mtime"] = swift.TimeToFloatString(srcNode.ModTime())
+	if _, ok := putMeta["X-Amz-Meta-Mtime"]; !ok {
+		putMeta["mtime"] = swift.TimeToFloatString(srcNode.ModTime())
 	}
 
-	_, err = b.PutObject(ctx, dstBucket, dstKey, meta, c.Contents, c.Size)
+	_, err = b.PutObject(ctx, dstBucket, dstKey, putMeta, c.Contents, c.Size)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,352 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/itsHenry35/gofakes3"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxLifecycleRules = 1000
+
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+type lifecycleRule struct {
+	ID     string           `xml:"ID,omitempty"`
+	Prefix *string          `xml:"Prefix"` // deprecated in favor of Filter, but still sent by some clients
+	Filter *lifecycleFilter `xml:"Filter"`
+	Status string           `xml:"Status"`
+
+	Expiration                     *lifecycleExpiration   `xml:"Expiration"`
+	NoncurrentVersionExpiration    *noncurrentExpiration  `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *abortIncompleteUpload `xml:"AbortIncompleteMultipartUpload"`
+	Transitions                    []struct{}             `xml:"Transition"`
+	NoncurrentVersionTransitions   []struct{}             `xml:"NoncurrentVersionTransition"`
+}
+
+type lifecycleFilter struct {
+	Prefix *string   `xml:"Prefix"`
+	Tag    *struct{} `xml:"Tag"`
+	And    *struct{} `xml:"And"`
+}
+
+type lifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type noncurrentExpiration struct {
+	NoncurrentDays int `xml:"NoncurrentDays"`
+}
+
+type abortIncompleteUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// parseLifecycle turns the lifecycle configuration of the s3 api into the rules of the bucket
+func parseLifecycle(r io.Reader) ([]LifecycleRule, error) {
+	var c lifecycleConfiguration
+	if err := xml.NewDecoder(io.LimitReader(r, 1024*1024)).Decode(&c); err != nil {
+		return nil, gofakes3.ErrMalformedXML
+	}
+	if len(c.Rules) == 0 || len(c.Rules) > maxLifecycleRules {
+		return nil, gofakes3.ErrMalformedXML
+	}
+	rules := make([]LifecycleRule, 0, len(c.Rules))
+	ids := make(map[string]struct{}, len(c.Rules))
+	for _, r := range c.Rules {
+		if r.ID != "" {
+			if _, ok := ids[r.ID]; ok {
+				return nil, gofakes3.ErrorInvalidArgument("ID", r.ID, "Rule ID must be unique. Found same ID for more than one rule")
+			}
+			ids[r.ID] = struct{}{}
+		}
+		rule := LifecycleRule{ID: r.ID}
+		switch r.Status {
+		case "Enabled":
+			rule.Enabled = true
+		case "Disabled":
+		default:
+			return nil, gofakes3.ErrMalformedXML
+		}
+		if r.Filter != nil {
+			// filtering by tags isn't supported
+			if r.Filter.Tag != nil || r.Filter.And != nil {
+				return nil, gofakes3.ErrNotImplemented
+			}
+			if r.Filter.Prefix != nil {
+				rule.Prefix = *r.Filter.Prefix
+			}
+		} else if r.Prefix != nil {
+			rule.Prefix = *r.Prefix
+		}
+		// the objects stay in their storage, there is nothing to transition to
+		if len(r.Transitions) > 0 || len(r.NoncurrentVersionTransitions) > 0 {
+			return nil, gofakes3.ErrNotImplemented
+		}
+		if e := r.Expiration; e != nil {
+			if e.Date != "" {
+				return nil, gofakes3.ErrNotImplemented
+			}
+			if e.Days < 0 || (e.Days == 0 && !e.ExpiredObjectDeleteMarker) || (e.Days > 0 && e.ExpiredObjectDeleteMarker) {
+				return nil, gofakes3.ErrorInvalidArgument("Days", "", "'Days' in Expiration action must be a positive integer")
+			}
+			rule.ExpirationDays = e.Days
+			rule.ExpireDeleteMarkers = e.ExpiredObjectDeleteMarker
+		}
+		if e := r.NoncurrentVersionExpiration; e != nil {
+			if e.NoncurrentDays <= 0 {
+				return nil, gofakes3.ErrorInvalidArgument("NoncurrentDays", "", "'NoncurrentDays' in NoncurrentVersionExpiration action must be a positive integer")
+			}
+			rule.NoncurrentDays = e.NoncurrentDays
+		}
+		if a := r.AbortIncompleteMultipartUpload; a != nil {
+			if a.DaysAfterInitiation <= 0 {
+				return nil, gofakes3.ErrorInvalidArgument("DaysAfterInitiation", "", "'DaysAfterInitiation' in AbortIncompleteMultipartUpload action must be a positive integer")
+			}
+			rule.AbortIncompleteDays = a.DaysAfterInitiation
+		}
+		if rule.ExpirationDays == 0 && !rule.ExpireDeleteMarkers && rule.NoncurrentDays == 0 && rule.AbortIncompleteDays == 0 {
+			return nil, gofakes3.ErrorInvalidArgument("Rule", rule.ID, "At least one action needs to be specified in a rule")
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// encodeLifecycle turns the rules of the bucket into the lifecycle configuration of the s3 api
+func encodeLifecycle(rules []LifecycleRule) lifecycleConfiguration {
+	c := lifecycleConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	for _, rule := range rules {
+		r := lifecycleRule{ID: rule.ID, Status: "Disabled", Filter: &lifecycleFilter{Prefix: &rule.Prefix}}
+		if rule.Enabled {
+			r.Status = "Enabled"
+		}
+		if rule.ExpirationDays > 0 || rule.ExpireDeleteMarkers {
+			r.Expiration = &lifecycleExpiration{Days: rule.ExpirationDays, ExpiredObjectDeleteMarker: rule.ExpireDeleteMarkers}
+		}
+		if rule.NoncurrentDays > 0 {
+			r.NoncurrentVersionExpiration = &noncurrentExpiration{NoncurrentDays: rule.NoncurrentDays}
+		}
+		if rule.AbortIncompleteDays > 0 {
+			r.AbortIncompleteMultipartUpload = &abortIncompleteUpload{DaysAfterInitiation: rule.AbortIncompleteDays}
+		}
+		c.Rules = append(c.Rules, r)
+	}
+	return c
+}
+
+// lifecycleMiddleware serves the lifecycle subresource of the buckets, which gofakes3 doesn't route
+func lifecycleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if _, ok := r.URL.Query()["lifecycle"]; !ok || bucket == "" || key != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := serveLifecycle(w, r, bucket); err != nil {
+			writeError(w, r, err)
+		}
+	})
+}
+
+func serveLifecycle(w http.ResponseWriter, r *http.Request, bucketName string) error {
+	bucket, err := getBucketByName(bucketName)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if len(bucket.Lifecycle) == 0 {
+			writeErrorResponse(w, r, http.StatusNotFound, &gofakes3.ErrorResponse{
+				Code:    "NoSuchLifecycleConfiguration",
+				Message: "The lifecycle configuration does not exist",
+			})
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(xml.Header))
+		return xml.NewEncoder(w).Encode(encodeLifecycle(bucket.Lifecycle))
+	case http.MethodPut:
+		rules, err := parseLifecycle(r.Body)
+		if err != nil {
+			return err
+		}
+		if err := updateBucket(bucketName, func(b *Bucket) { b.Lifecycle = rules }); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodDelete:
+		if err := updateBucket(bucketName, func(b *Bucket) { b.Lifecycle = nil }); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	default:
+		return gofakes3.ErrMethodNotAllowed
+	}
+}
+
+var (
+	lifecycleOnce sync.Once
+	lifecycleCron *cron.Cron
+
+	// uploadHandlers are the gofakes3 handlers of the servers, which keep their incomplete multipart uploads
+	uploadHandlers   []http.Handler
+	uploadHandlersMu sync.Mutex
+)
+
+// startLifecycle registers the handler for the aborts of the incomplete uploads, and runs the lifecycle rules daily
+func startLifecycle(h http.Handler) {
+	uploadHandlersMu.Lock()
+	uploadHandlers = append(uploadHandlers, h)
+	uploadHandlersMu.Unlock()
+	lifecycleOnce.Do(func() {
+		lifecycleCron = cron.NewCron(24 * time.Hour)
+		lifecycleCron.Do(runLifecycle)
+	})
+}
+
+// runLifecycle applies the enabled lifecycle rules of all the buckets.
+// In a cluster only the leader changes the shared storages, but every instance aborts
+// its own incomplete uploads, which are kept in its memory.
+func runLifecycle() {
+	buckets, err := getAndParseBuckets()
+	if err != nil {
+		log.Errorf("[s3] failed get the buckets for the lifecycle: %+v", err)
+		return
+	}
+	if !coord.IsLeader() {
+		abortExpiredUploads(buckets, time.Now())
+		return
+	}
+	ctx := context.Background()
+	b := &s3Backend{}
+	for _, bucket := range buckets {
+		for _, rule := range bucket.Lifecycle {
+			if !rule.Enabled {
+				continue
+			}
+			if err := applyLifecycleRule(ctx, b, bucket, rule, time.Now()); err != nil {
+				log.Errorf("[s3] failed apply the lifecycle rule %q of the bucket %s: %+v", rule.ID, bucket.Name, err)
+			}
+		}
+	}
+}
+
+// abortExpiredUploads applies only the aborts of the incomplete uploads of the lifecycle rules
+func abortExpiredUploads(buckets []Bucket, now time.Time) {
+	for _, bucket := range buckets {
+		for _, rule := range bucket.Lifecycle {
+			if rule.Enabled && rule.AbortIncompleteDays > 0 {
+				abortUploads(bucket.Name, rule.Prefix, now.AddDate(0, 0, -rule.AbortIncompleteDays))
+			}
+		}
+	}
+}
+
+func applyLifecycleRule(ctx context.Context, b *s3Backend, bucket Bucket, rule LifecycleRule, now time.Time) error {
+	base := strings.TrimSuffix(bucket.Path, "/") + "/"
+	if rule.ExpirationDays > 0 {
+		before := now.AddDate(0, 0, -rule.ExpirationDays)
+		dir, name := path.Split(rule.Prefix)
+		entries, err := walkListR(bucket.Path, dir, name)
+		if err != nil && err != gofakes3.ErrNoSuchKey {
+			return err
+		}
+		for _, e := range entries {
+			if path.Base(e.Key) == emptyObjectName || !e.Modified.Before(before) {
+				continue
+			}
+			if _, err := b.deleteObject(ctx, bucket.Name, e.Key); err != nil {
+				return err
+			}
+		}
+	}
+	if rule.NoncurrentDays > 0 || rule.ExpireDeleteMarkers {
+		versions, err := op.GetS3ObjectVersionsByPrefix(base + rule.Prefix)
+		if err != nil {
+			return err
+		}
+		before := now.AddDate(0, 0, -rule.NoncurrentDays)
+		counts := make(map[string]int)
+		for _, v := range versions {
+			counts[v.Path]++
+		}
+		for i, v := range versions {
+			// the newest delete marker is the current version if the object doesn't exist
+			isCurrent := false
+			if v.DeleteMarker && (i == 0 || versions[i-1].Path != v.Path) {
+				node, _, err := currentVersion(ctx, v.Path)
+				isCurrent = err == nil && node == nil
+			}
+			expired := !isCurrent && rule.NoncurrentDays > 0 && v.CreatedAt.Before(before)
+			// a delete marker with no versions left behind is of no use
+			if isCurrent && rule.ExpireDeleteMarkers && counts[v.Path] == 1 {
+				expired = true
+			}
+			if !expired {
+				continue
+			}
+			if err := removeVersionOf(ctx, &v); err != nil {
+				return err
+			}
+			counts[v.Path]--
+		}
+		dropListings()
+	}
+	if rule.AbortIncompleteDays > 0 {
+		abortUploads(bucket.Name, rule.Prefix, now.AddDate(0, 0, -rule.AbortIncompleteDays))
+	}
+	return nil
+}
+
+// abortUploads aborts the multipart uploads under prefix initiated before the time, they are only reachable through gofakes3
+func abortUploads(bucketName, prefix string, before time.Time) {
+	uploadHandlersMu.Lock()
+	handlers := uploadHandlers
+	uploadHandlersMu.Unlock()
+	for _, h := range handlers {
+		q := url.Values{"uploads": {""}, "prefix": {prefix}}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+bucketName+"?"+q.Encode(), nil))
+		if rec.Code != http.StatusOK {
+			log.Warnf("[s3] failed list the uploads of the bucket %s: %s", bucketName, rec.Body.String())
+			continue
+		}
+		var result gofakes3.ListMultipartUploadsResult
+		if err := xml.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			log.Warnf("[s3] failed parse the uploads of the bucket %s: %+v", bucketName, err)
+			continue
+		}
+		for _, u := range result.Uploads {
+			if !u.Initiated.Before(before) {
+				continue
+			}
+			target := "/" + bucketName + "/" + (&url.URL{Path: u.Key}).EscapedPath() + "?" + url.Values{"uploadId": {string(u.UploadID)}}.Encode()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+			if rec.Code != http.StatusNoContent {
+				log.Warnf("[s3] failed abort the upload %s of %s: %s", u.UploadID, u.Key, rec.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLifecycle(t *testing.T) {
+	tests := []struct {
+		body    string
+		want    []LifecycleRule
+		wantErr bool
+	}{
+		{
+			body: `<LifecycleConfiguration><Rule><ID>r1</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status>` +
+				`<Expiration><Days>30</Days></Expiration><NoncurrentVersionExpiration><NoncurrentDays>7</NoncurrentDays></NoncurrentVersionExpiration>` +
+				`<AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule></LifecycleConfiguration>`,
+			want: []LifecycleRule{{ID: "r1", Prefix: "logs/", Enabled: true, ExpirationDays: 30, NoncurrentDays: 7, AbortIncompleteDays: 1}},
+		},
+		// the deprecated prefix of the rule
+		{
+			body: `<LifecycleConfiguration><Rule><Prefix>tmp/</Prefix><Status>Disabled</Status><Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration></Rule></LifecycleConfiguration>`,
+			want: []LifecycleRule{{Prefix: "tmp/", ExpireDeleteMarkers: true}},
+		},
+		{body: `<LifecycleConfiguration><Rule><Filter/><Status>Enabled</Status></Rule></LifecycleConfiguration>`, wantErr: true},
+		{body: `<LifecycleConfiguration><Rule><Status>On</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`, wantErr: true},
+		{body: `<LifecycleConfiguration><Rule><Status>Enabled</Status><Expiration><Days>0</Days></Expiration></Rule></LifecycleConfiguration>`, wantErr: true},
+		{body: `<LifecycleConfiguration><Rule><Filter><Tag><Key>a</Key><Value>b</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`, wantErr: true},
+		{body: `<LifecycleConfiguration><Rule><ID>a</ID><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule><Rule><ID>a</ID><Status>Enabled</Status><Expiration><Days>2</Days></Expiration></Rule></LifecycleConfiguration>`, wantErr: true},
+		{body: `<LifecycleConfiguration>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLifecycle(strings.NewReader(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLifecycle(%s) error = %v, wantErr %v", tt.body, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLifecycle(%s) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
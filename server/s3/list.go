@@ -3,68 +3,184 @@
 package s3
 
 import (
-	"path"
+	"context"
+	stdpath "path"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/search"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/itsHenry35/gofakes3"
 	log "github.com/sirupsen/logrus"
 )
 
-func (b *s3Backend) entryListR(bucket, fdPath, name string, addPrefix bool, response *gofakes3.ObjectList) error {
-	fp := path.Join(bucket, fdPath)
+// listEntry is an object or a common prefix of a listing
+type listEntry struct {
+	Key      string
+	IsPrefix bool
+	Size     int64
+	Modified time.Time
+}
+
+func compareListEntry(a, b listEntry) int {
+	return strings.Compare(a.Key, b.Key)
+}
+
+// snapshotTTL is how long a recursive listing is reused, so that the pages of a listing don't walk the tree again
+const snapshotTTL = time.Minute
+
+var snapshots = cache.NewKeyedCache[[]listEntry](snapshotTTL)
+
+// dropListings forgets the recursive listings after the bucket is changed through s3
+func dropListings() {
+	snapshots.Clear()
+}
 
-	dirEntries, err := getDirEntries(fp)
+// emptyDirEntry is the placeholder of an empty directory, as s3 can't have empty directories, useful in deletions
+func emptyDirEntry(fdPath string) listEntry {
+	return listEntry{Key: stdpath.Join(fdPath, emptyObjectName), Modified: time.Now()}
+}
+
+// entryList lists the direct children of fdPath whose names start with name, the directories are common prefixes
+func (b *s3Backend) entryList(bucket, fdPath, name string) ([]listEntry, error) {
+	dirEntries, err := getDirEntries(stdpath.Join(bucket, fdPath))
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// workaround as s3 can't have empty files in directories, useful in deletions
 	if len(dirEntries) == 0 {
-		item := &gofakes3.Content{
-			// Key:          gofakes3.URLEncode(path.Join(fdPath, emptyObjectName)),
-			Key:          path.Join(fdPath, emptyObjectName),
-			LastModified: gofakes3.NewContentTime(time.Now()),
-			ETag:         getFileHash(nil), // No entry, so no hash
-			Size:         0,
-			StorageClass: gofakes3.StorageStandard,
-		}
-		response.Add(item)
-		log.Debugf("Adding empty object %s to response", item.Key)
-		return nil
+		return []listEntry{emptyDirEntry(fdPath)}, nil
 	}
-
+	var entries []listEntry
 	for _, entry := range dirEntries {
-		object := entry.GetName()
+		if !strings.HasPrefix(entry.GetName(), name) || entry.GetName() == versionsDirName {
+			continue
+		}
+		objectPath := stdpath.Join(fdPath, entry.GetName())
+		if entry.IsDir() {
+			entries = append(entries, listEntry{Key: objectPath, IsPrefix: true})
+			continue
+		}
+		entries = append(entries, listEntry{Key: objectPath, Size: entry.GetSize(), Modified: entry.ModTime()})
+	}
+	slices.SortFunc(entries, compareListEntry)
+	return entries, nil
+}
 
-		// workround for control-chars detect
-		objectPath := path.Join(fdPath, object)
+// entryListR lists the objects below fdPath whose keys start with path.Join(fdPath, name), sorted by key.
+// The listings are kept for a while, and come from the search index if it is allowed and covers the path.
+func (b *s3Backend) entryListR(ctx context.Context, bucket, fdPath, name string) ([]listEntry, error) {
+	root := stdpath.Join(bucket, fdPath)
+	key := root + "\x00" + name
+	if entries, ok := snapshots.Get(key); ok {
+		return entries, nil
+	}
+	var entries []listEntry
+	err := errs.SearchNotAvailable
+	if setting.GetBool(conf.S3ListFromIndex) {
+		entries, err = indexListR(ctx, root, fdPath, name)
+		if err != nil {
+			log.Debugf("[s3] failed list %s from the index: %v", root, err)
+		}
+	}
+	if err != nil {
+		if entries, err = walkListR(bucket, fdPath, name); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(entries, compareListEntry)
+	snapshots.Set(key, entries)
+	return entries, nil
+}
 
-		if !strings.HasPrefix(object, name) {
+// walkListR lists the objects below fdPath through the storages
+func walkListR(bucket, fdPath, name string) ([]listEntry, error) {
+	dirEntries, err := getDirEntries(stdpath.Join(bucket, fdPath))
+	if err != nil {
+		return nil, err
+	}
+	if len(dirEntries) == 0 {
+		return []listEntry{emptyDirEntry(fdPath)}, nil
+	}
+	var entries []listEntry
+	for _, entry := range dirEntries {
+		if !strings.HasPrefix(entry.GetName(), name) || entry.GetName() == versionsDirName {
 			continue
 		}
-
+		objectPath := stdpath.Join(fdPath, entry.GetName())
 		if entry.IsDir() {
-			if addPrefix {
-				// response.AddPrefix(gofakes3.URLEncode(objectPath))
-				response.AddPrefix(objectPath)
-				continue
-			}
-			err := b.entryListR(bucket, path.Join(fdPath, object), "", false, response)
+			children, err := walkListR(bucket, objectPath, "")
 			if err != nil {
-				return err
+				return nil, err
+			}
+			entries = append(entries, children...)
+			continue
+		}
+		entries = append(entries, listEntry{Key: objectPath, Size: entry.GetSize(), Modified: entry.ModTime()})
+	}
+	return entries, nil
+}
+
+// indexListR lists the objects below root from the search index.
+// The index doesn't keep the modification time, the objects carry the time the index was built.
+func indexListR(ctx context.Context, root, fdPath, name string) ([]listEntry, error) {
+	progress, err := search.Progress()
+	if err != nil {
+		return nil, err
+	}
+	modified := time.Now()
+	if progress.LastDoneTime != nil {
+		modified = *progress.LastDoneTime
+	}
+	maxDepth := setting.GetInt(conf.MaxIndexDepth, 20)
+	var walk func(dir, key, name string) ([]listEntry, error)
+	walk = func(dir, key, name string) ([]listEntry, error) {
+		// the children of the directories at the max depth or in the ignored paths are not indexed
+		if strings.Count(strings.TrimSuffix(dir, "/"), "/") >= maxDepth || !search.Covers(dir) {
+			return nil, errs.SearchNotAvailable
+		}
+		nodes, err := search.Get(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			if dir == root {
+				// it may be missing from the index, let the storage tell
+				return nil, errs.SearchNotAvailable
 			}
-		} else {
-			item := &gofakes3.Content{
-				// Key:          gofakes3.URLEncode(objectPath),
-				Key:          objectPath,
-				LastModified: gofakes3.NewContentTime(entry.ModTime()),
-				ETag:         getFileHash(entry),
-				Size:         entry.GetSize(),
-				StorageClass: gofakes3.StorageStandard,
+			return []listEntry{emptyDirEntry(key)}, nil
+		}
+		var entries []listEntry
+		for _, node := range nodes {
+			if !strings.HasPrefix(node.Name, name) || node.Name == versionsDirName {
+				continue
+			}
+			objectPath := stdpath.Join(key, node.Name)
+			if node.IsDir {
+				children, err := walk(stdpath.Join(dir, node.Name), objectPath, "")
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, children...)
+				continue
 			}
-			response.Add(item)
+			entries = append(entries, listEntry{Key: objectPath, Size: node.Size, Modified: modified})
 		}
+		return entries, nil
+	}
+	return walk(root, fdPath, name)
+}
+
+func (e listEntry) content() *gofakes3.Content {
+	return &gofakes3.Content{
+		// Key:          gofakes3.URLEncode(e.Key),
+		Key:          e.Key,
+		LastModified: gofakes3.NewContentTime(e.Modified),
+		ETag:         getFileHash(nil),
+		Size:         e.Size,
+		StorageClass: gofakes3.StorageStandard,
 	}
-	return nil
 }
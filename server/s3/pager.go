@@ -8,60 +8,32 @@ import (
 	"github.com/itsHenry35/gofakes3"
 )
 
-// pager splits the object list into smulitply pages.
-func (db *s3Backend) pager(list *gofakes3.ObjectList, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
-	// sort by alphabet
-	sort.Slice(list.CommonPrefixes, func(i, j int) bool {
-		return list.CommonPrefixes[i].Prefix < list.CommonPrefixes[j].Prefix
-	})
-	// sort by modtime
-	sort.Slice(list.Contents, func(i, j int) bool {
-		return list.Contents[i].LastModified.Before(list.Contents[j].LastModified.Time)
-	})
-	tokens := page.MaxKeys
+// pager splits the listing sorted by key into multiple pages.
+// The marker is the continuation token or StartAfter, the page begins at the first key after it, which doesn't have to exist.
+func (db *s3Backend) pager(entries []listEntry, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
+	tokens := int(page.MaxKeys)
 	if tokens == 0 {
 		tokens = 1000
 	}
+	start := 0
 	if page.HasMarker {
-		for i, obj := range list.Contents {
-			if obj.Key == page.Marker {
-				list.Contents = list.Contents[i+1:]
-				break
-			}
-		}
-		for i, obj := range list.CommonPrefixes {
-			if obj.Prefix == page.Marker {
-				list.CommonPrefixes = list.CommonPrefixes[i+1:]
-				break
-			}
-		}
+		start = sort.Search(len(entries), func(i int) bool {
+			return entries[i].Key > page.Marker
+		})
 	}
+	end := min(start+tokens, len(entries))
 
 	response := gofakes3.NewObjectList()
-	for _, obj := range list.CommonPrefixes {
-		if tokens <= 0 {
-			break
-		}
-		response.AddPrefix(obj.Prefix)
-		tokens--
-	}
-
-	for _, obj := range list.Contents {
-		if tokens <= 0 {
-			break
+	for _, entry := range entries[start:end] {
+		if entry.IsPrefix {
+			response.AddPrefix(entry.Key)
+		} else {
+			response.Add(entry.content())
 		}
-		response.Add(obj)
-		tokens--
 	}
-
-	if len(list.CommonPrefixes)+len(list.Contents) > int(page.MaxKeys) {
+	if end < len(entries) {
 		response.IsTruncated = true
-		if len(response.Contents) > 0 {
-			response.NextMarker = response.Contents[len(response.Contents)-1].Key
-		} else {
-			response.NextMarker = response.CommonPrefixes[len(response.CommonPrefixes)-1].Prefix
-		}
+		response.NextMarker = entries[end-1].Key
 	}
-
 	return response, nil
 }
@@ -0,0 +1,41 @@
+package s3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/itsHenry35/gofakes3"
+)
+
+func TestPager(t *testing.T) {
+	entries := []listEntry{{Key: "a", IsPrefix: true}, {Key: "b/1"}, {Key: "b/2"}, {Key: "c"}}
+	tests := []struct {
+		page     gofakes3.ListBucketPage
+		want     []string
+		nextMark string
+	}{
+		{page: gofakes3.ListBucketPage{MaxKeys: 2}, want: []string{"a", "b/1"}, nextMark: "b/1"},
+		{page: gofakes3.ListBucketPage{MaxKeys: 2, Marker: "b/1", HasMarker: true}, want: []string{"b/2", "c"}},
+		// StartAfter doesn't have to be an existing key
+		{page: gofakes3.ListBucketPage{MaxKeys: 2, Marker: "b/15", HasMarker: true}, want: []string{"b/2", "c"}},
+		{page: gofakes3.ListBucketPage{MaxKeys: 2, Marker: "d", HasMarker: true}, want: nil},
+		{page: gofakes3.ListBucketPage{}, want: []string{"a", "b/1", "b/2", "c"}},
+	}
+	b := &s3Backend{}
+	for _, tt := range tests {
+		resp, err := b.pager(entries, tt.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range resp.CommonPrefixes {
+			got = append(got, p.Prefix)
+		}
+		for _, c := range resp.Contents {
+			got = append(got, c.Key)
+		}
+		if !reflect.DeepEqual(got, tt.want) || resp.NextMarker != tt.nextMark || resp.IsTruncated != (tt.nextMark != "") {
+			t.Errorf("pager(%+v) = %q next %q, want %q next %q", tt.page, got, resp.NextMarker, tt.want, tt.nextMark)
+		}
+	}
+}
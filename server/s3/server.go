@@ -10,18 +10,19 @@ import (
 	"github.com/itsHenry35/gofakes3"
 )
 
-// Make a new S3 Server to serve the remote
-func NewServer(ctx context.Context) (h http.Handler, err error) {
+// Make a new S3 Server to serve the remote, prefix is stripped from the path of the requests after their signature is verified
+func NewServer(ctx context.Context, prefix string) (h http.Handler, err error) {
 	var newLogger logger
+	backend := newBackend()
 	faker := gofakes3.New(
-		newBackend(),
+		backend,
 		// gofakes3.WithHostBucket(!opt.pathBucketMode),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
-		gofakes3.WithV4Auth(authlistResolver()),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
 	)
 
-	return faker.Server(), nil
+	h = faker.Server()
+	startLifecycle(h)
+	return authMiddleware(prefix, authlistResolver(), lifecycleMiddleware(versionMiddleware(backend, taggingMiddleware(h)))), nil
 }
@@ -0,0 +1,179 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/itsHenry35/gofakes3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the limits of the tags of an object, the same as AWS
+const (
+	maxTags        = 10
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+)
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return gofakes3.ErrorInvalidArgument("tagging", "", "Object tags cannot be greater than 10")
+	}
+	for k, v := range tags {
+		if k == "" || len(k) > maxTagKeyLen {
+			return gofakes3.ErrorInvalidArgument("tagging", k, "The TagKey you have provided is invalid")
+		}
+		if len(v) > maxTagValueLen {
+			return gofakes3.ErrorInvalidArgument("tagging", v, "The TagValue you have provided is invalid")
+		}
+	}
+	return nil
+}
+
+// parseTaggingHeader parses the url encoded tags of the x-amz-tagging header
+func parseTaggingHeader(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, gofakes3.ErrorInvalidArgument("x-amz-tagging", s, "The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.")
+	}
+	tags := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 1 {
+			return nil, gofakes3.ErrorInvalidArgument("x-amz-tagging", s, "Cannot provide multiple Tags with the same key")
+		}
+		tags[k] = v[0]
+	}
+	return tags, validateTags(tags)
+}
+
+func encodeTaggingHeader(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// taggingMiddleware serves the tagging subresource of the objects, which gofakes3 would take for the object itself
+func taggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if _, ok := r.URL.Query()["tagging"]; !ok || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := serveObjectTagging(w, r, bucket, key); err != nil {
+			writeError(w, r, err)
+		}
+	})
+}
+
+func serveObjectTagging(w http.ResponseWriter, r *http.Request, bucketName, key string) error {
+	bucket, err := getBucketByName(bucketName)
+	if err != nil {
+		return err
+	}
+	fp := path.Join(bucket.Path, key)
+	fmeta, _ := op.GetNearestMeta(fp)
+	node, err := fs.Get(context.WithValue(r.Context(), conf.MetaKey, fmeta), fp, &fs.GetArgs{})
+	if err != nil || node.IsDir() {
+		return gofakes3.KeyNotFound(key)
+	}
+	m, err := op.GetS3ObjectMeta(fp)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = &model.S3ObjectMeta{Path: fp}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		t := tagging{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", TagSet: []tag{}}
+		for k, v := range m.Tags {
+			t.TagSet = append(t.TagSet, tag{Key: k, Value: v})
+		}
+		slices.SortFunc(t.TagSet, func(a, b tag) int { return strings.Compare(a.Key, b.Key) })
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(xml.Header))
+		return xml.NewEncoder(w).Encode(t)
+	case http.MethodPut:
+		var t tagging
+		if err := xml.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&t); err != nil {
+			return gofakes3.ErrMalformedXML
+		}
+		tags := make(map[string]string, len(t.TagSet))
+		for _, tg := range t.TagSet {
+			if _, ok := tags[tg.Key]; ok {
+				return gofakes3.ErrorInvalidArgument("tagging", tg.Key, "Cannot provide multiple Tags with the same key")
+			}
+			tags[tg.Key] = tg.Value
+		}
+		if err := validateTags(tags); err != nil {
+			return err
+		}
+		m.Tags = tags
+		if err := op.SaveS3ObjectMeta(m); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodDelete:
+		if len(m.Tags) > 0 {
+			m.Tags = nil
+			if err := op.SaveS3ObjectMeta(m); err != nil {
+				return err
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	default:
+		return gofakes3.ErrMethodNotAllowed
+	}
+}
+
+// writeError writes the error like gofakes3 does
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var resp gofakes3.Error
+	if !errors.As(err, &resp) {
+		log.Errorf("[s3] %s %s: %+v", r.Method, r.URL, err)
+		resp = &gofakes3.ErrorResponse{Code: gofakes3.ErrInternal, Message: "Internal Error"}
+	} else if code, ok := resp.(gofakes3.ErrorCode); ok {
+		resp = &gofakes3.ErrorResponse{Code: code, Message: string(code)}
+	}
+	writeErrorResponse(w, r, resp.ErrorCode().Status(), resp)
+}
+
+// writeErrorResponse writes the error with the status, for the error codes gofakes3 doesn't know
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, resp gofakes3.Error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(xml.Header))
+		_ = xml.NewEncoder(w).Encode(resp)
+	}
+}
@@ -5,7 +5,9 @@ package s3
 import (
 	"context"
 	"encoding/json"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
@@ -17,8 +19,48 @@ import (
 )
 
 type Bucket struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name       string          `json:"name"`
+	Path       string          `json:"path"`
+	Versioning string          `json:"versioning,omitempty"` // Enabled or Suspended once it is set through the s3 api
+	Lifecycle  []LifecycleRule `json:"lifecycle,omitempty"`
+}
+
+// LifecycleRule expires the objects, the noncurrent versions and the incomplete multipart uploads under Prefix after the days
+type LifecycleRule struct {
+	ID                  string `json:"id,omitempty"`
+	Prefix              string `json:"prefix,omitempty"`
+	Enabled             bool   `json:"enabled"`
+	ExpirationDays      int    `json:"expiration_days,omitempty"`
+	ExpireDeleteMarkers bool   `json:"expire_delete_markers,omitempty"`
+	NoncurrentDays      int    `json:"noncurrent_days,omitempty"`
+	AbortIncompleteDays int    `json:"abort_incomplete_days,omitempty"`
+}
+
+var bucketsMu sync.Mutex
+
+// updateBucket changes the bucket in the s3 buckets setting
+func updateBucket(name string, update func(b *Bucket)) error {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	buckets, err := getAndParseBuckets()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(buckets, func(b Bucket) bool { return b.Name == name })
+	if i < 0 {
+		return gofakes3.BucketNotFound(name)
+	}
+	update(&buckets[i])
+	item, err := op.GetSettingItemByKey(conf.S3Buckets)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(buckets)
+	if err != nil {
+		return err
+	}
+	item.Value = string(value)
+	return op.SaveSettingItem(item)
 }
 
 const emptyObjectName = "ThisIsAnEmptyFolderInTheS3Bucket"
@@ -0,0 +1,482 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/google/uuid"
+	"github.com/itsHenry35/gofakes3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// versionsDirName is the folder next to the objects of a versioned bucket which keeps their noncurrent versions,
+// a version is kept at <dir>/.s3versions/<name>/<version id>/<name> so that it is in the same storage as the object
+// it is hidden from fs.List, so WebDAV, FTP, the web UI and the search index don't show the versions
+const versionsDirName = model.S3VersionsDirName
+
+// nullVersionID is how the version of the objects put while the versioning isn't enabled is called in the s3 api
+const nullVersionID = "null"
+
+// nullVersionAlias stands for the null version in the requests passed to gofakes3, which takes the null version for the current object
+const nullVersionAlias = "~null"
+
+func isVersionsPath(key string) bool {
+	return model.IsS3VersionsPath(key)
+}
+
+func versionPath(fp, versionID string) string {
+	if versionID == "" {
+		versionID = nullVersionID
+	}
+	dir, name := path.Split(fp)
+	return path.Join(dir, versionsDirName, name, versionID, name)
+}
+
+func parseVersionID(id gofakes3.VersionID) string {
+	if id == nullVersionID || id == nullVersionAlias {
+		return ""
+	}
+	return string(id)
+}
+
+func apiVersionID(id string) gofakes3.VersionID {
+	if id == "" {
+		return nullVersionID
+	}
+	return gofakes3.VersionID(id)
+}
+
+func newVersionID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// currentVersion returns the current object at fp and its version id, nil if the object doesn't exist
+func currentVersion(ctx context.Context, fp string) (model.Obj, string, error) {
+	node, err := fs.Get(ctx, fp, &fs.GetArgs{})
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	if node.IsDir() {
+		return nil, "", nil
+	}
+	m, err := op.GetS3ObjectMeta(fp)
+	if err != nil || m == nil {
+		return node, "", err
+	}
+	return node, m.VersionID, nil
+}
+
+// newVersion keeps the current version of the object at fp before it is overwritten, the id of the new version is returned
+func newVersion(ctx context.Context, bucket Bucket, fp string) (string, error) {
+	switch gofakes3.VersioningStatus(bucket.Versioning) {
+	case gofakes3.VersioningEnabled:
+		if err := archiveCurrent(ctx, fp, true); err != nil {
+			return "", err
+		}
+		return newVersionID(), nil
+	case gofakes3.VersioningSuspended:
+		// the new object replaces the null version
+		if err := archiveCurrent(ctx, fp, false); err != nil {
+			return "", err
+		}
+		return "", removeVersion(ctx, fp, "")
+	}
+	return "", nil
+}
+
+// archiveCurrent moves the current version of the object at fp to the versions folder.
+// The null version is left in place unless keepNull, as there is only one null version of an object.
+func archiveCurrent(ctx context.Context, fp string, keepNull bool) error {
+	node, versionID, err := currentVersion(ctx, fp)
+	if err != nil || node == nil {
+		return err
+	}
+	if versionID == "" {
+		if !keepNull {
+			return nil
+		}
+		if err := removeVersion(ctx, fp, ""); err != nil {
+			return err
+		}
+	}
+	dstDir := path.Dir(versionPath(fp, versionID))
+	if err := fs.MakeDir(ctx, dstDir); err != nil {
+		return errors.WithMessage(err, "failed make the folder of the version")
+	}
+	// the s3 metadata follows the moved object
+	if _, err := fs.Move(context.WithValue(ctx, conf.NoTaskKey, struct{}{}), fp, dstDir); err != nil {
+		return errors.WithMessage(err, "failed keep the current version")
+	}
+	return op.CreateS3ObjectVersion(&model.S3ObjectVersion{
+		Path:      fp,
+		VersionID: versionID,
+		Size:      node.GetSize(),
+		Modified:  node.ModTime(),
+	})
+}
+
+// markDeleted replaces the current version of the object at fp with a delete marker
+func markDeleted(ctx context.Context, fp string, enabled bool) (result gofakes3.ObjectDeleteResult, err error) {
+	if err := archiveCurrent(ctx, fp, enabled); err != nil {
+		return result, err
+	}
+	versionID := ""
+	if enabled {
+		versionID = newVersionID()
+	} else {
+		// the delete marker is the null version in a suspended bucket
+		if err := fs.Remove(ctx, fp); err != nil && !errs.IsObjectNotFound(err) {
+			return result, err
+		}
+		if err := removeVersion(ctx, fp, ""); err != nil {
+			return result, err
+		}
+	}
+	err = op.CreateS3ObjectVersion(&model.S3ObjectVersion{
+		Path:         fp,
+		VersionID:    versionID,
+		DeleteMarker: true,
+		Modified:     time.Now(),
+	})
+	if err != nil {
+		return result, err
+	}
+	return gofakes3.ObjectDeleteResult{IsDeleteMarker: true, VersionID: apiVersionID(versionID)}, nil
+}
+
+// removeVersion permanently removes a noncurrent version or a delete marker of the object at fp, if there is one
+func removeVersion(ctx context.Context, fp, versionID string) error {
+	v, err := op.GetS3ObjectVersion(fp, versionID)
+	if err != nil || v == nil {
+		return err
+	}
+	return removeVersionOf(ctx, v)
+}
+
+func removeVersionOf(ctx context.Context, v *model.S3ObjectVersion) error {
+	if !v.DeleteMarker {
+		if err := fs.Remove(ctx, path.Dir(versionPath(v.Path, v.VersionID))); err != nil && !errs.IsObjectNotFound(err) {
+			return err
+		}
+		pruneVersionsDir(ctx, v.Path)
+	}
+	return op.DeleteS3ObjectVersion(v.ID)
+}
+
+// pruneVersionsDir removes the folders of the versions of the object at fp once they are empty
+func pruneVersionsDir(ctx context.Context, fp string) {
+	dir, name := path.Split(fp)
+	for _, p := range []string{path.Join(dir, versionsDirName, name), path.Join(dir, versionsDirName)} {
+		objs, err := fs.List(ctx, p, &fs.ListArgs{Refresh: true})
+		if err != nil || len(objs) > 0 {
+			return
+		}
+		if err := fs.Remove(ctx, p); err != nil {
+			return
+		}
+	}
+}
+
+// restoreLatest makes the newest noncurrent version of the object at fp current again,
+// if the object doesn't exist and the newest version isn't a delete marker
+func restoreLatest(ctx context.Context, fp string) {
+	if node, _, err := currentVersion(ctx, fp); err != nil || node != nil {
+		return
+	}
+	versions, err := op.GetS3ObjectVersions(fp)
+	if err != nil || len(versions) == 0 || versions[0].DeleteMarker {
+		return
+	}
+	v := versions[0]
+	src := versionPath(fp, v.VersionID)
+	if _, err := fs.Move(context.WithValue(ctx, conf.NoTaskKey, struct{}{}), src, path.Dir(fp)); err != nil {
+		log.Errorf("[s3] failed restore the version %s of %s: %+v", apiVersionID(v.VersionID), fp, err)
+		return
+	}
+	if err := op.DeleteS3ObjectVersion(v.ID); err != nil {
+		log.Errorf("[s3] failed remove the version %s of %s: %+v", apiVersionID(v.VersionID), fp, err)
+	}
+	_ = fs.Remove(ctx, path.Dir(src))
+	pruneVersionsDir(ctx, fp)
+}
+
+// VersioningConfiguration returns the versioning status of the bucket, which is empty if it has never been set
+func (b *s3Backend) VersioningConfiguration(bucketName string) (gofakes3.VersioningConfiguration, error) {
+	bucket, err := getBucketByName(bucketName)
+	if err != nil {
+		return gofakes3.VersioningConfiguration{}, err
+	}
+	return gofakes3.VersioningConfiguration{Status: gofakes3.VersioningStatus(bucket.Versioning)}, nil
+}
+
+func (b *s3Backend) SetVersioningConfiguration(bucketName string, v gofakes3.VersioningConfiguration) error {
+	if v.MFADelete == gofakes3.MFADeleteEnabled {
+		return gofakes3.ErrNotImplemented
+	}
+	if v.Status == gofakes3.VersioningNone {
+		return nil
+	}
+	return updateBucket(bucketName, func(bucket *Bucket) {
+		bucket.Versioning = string(v.Status)
+	})
+}
+
+// objectVersion returns the path of the version of the object, and the version itself unless it is the current one
+func objectVersion(ctx context.Context, bucketName, objectName string, versionID gofakes3.VersionID) (string, *model.S3ObjectVersion, error) {
+	bucket, err := getBucketByName(bucketName)
+	if err != nil {
+		return "", nil, err
+	}
+	fp := path.Join(bucket.Path, objectName)
+	id := parseVersionID(versionID)
+	node, current, err := currentVersion(ctx, fp)
+	if err != nil {
+		return "", nil, err
+	}
+	if node != nil && current == id {
+		return fp, nil, nil
+	}
+	v, err := op.GetS3ObjectVersion(fp, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if v == nil {
+		return "", nil, gofakes3.ErrNoSuchVersion
+	}
+	return versionPath(fp, id), v, nil
+}
+
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	ctx := context.Background()
+	fp, v, err := objectVersion(ctx, bucketName, objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil && v.DeleteMarker {
+		return &gofakes3.Object{Name: objectName, VersionID: apiVersionID(v.VersionID), IsDeleteMarker: true, Contents: noOpReadCloser{}}, nil
+	}
+	obj, err := getObject(ctx, fp, objectName, rangeRequest)
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = apiVersionID(parseVersionID(versionID))
+	return obj, nil
+}
+
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	ctx := context.Background()
+	fp, v, err := objectVersion(ctx, bucketName, objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil && v.DeleteMarker {
+		return &gofakes3.Object{Name: objectName, VersionID: apiVersionID(v.VersionID), IsDeleteMarker: true, Contents: noOpReadCloser{}}, nil
+	}
+	obj, err := headObject(ctx, fp, objectName)
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = apiVersionID(parseVersionID(versionID))
+	return obj, nil
+}
+
+// DeleteObjectVersion permanently deletes a version, the newest noncurrent version becomes current if the current one is deleted
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	ctx := context.Background()
+	defer dropListings()
+	fp, v, err := objectVersion(ctx, bucketName, objectName, versionID)
+	if errors.Is(err, gofakes3.ErrNoSuchVersion) {
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+	result.VersionID = apiVersionID(parseVersionID(versionID))
+	if v == nil {
+		if err := fs.Remove(ctx, fp); err != nil {
+			return result, err
+		}
+	} else {
+		if err := removeVersionOf(ctx, v); err != nil {
+			return result, err
+		}
+		result.IsDeleteMarker = v.DeleteMarker
+		fp = v.Path
+	}
+	restoreLatest(ctx, fp)
+	return result, nil
+}
+
+// ListBucketVersions lists the current objects along with their noncurrent versions and delete markers
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	ctx := context.Background()
+	bucket, err := getBucketByName(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == nil {
+		prefix = emptyPrefix
+	}
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+	hasDelimiter := prefix.HasDelimiter && prefix.Delimiter != ""
+	dir, name := prefixParser(prefix)
+	var entries []listEntry
+	if hasDelimiter {
+		entries, err = b.entryList(bucket.Path, dir, name)
+	} else {
+		entries, err = b.entryListR(ctx, bucket.Path, dir, name)
+	}
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+	base := strings.TrimSuffix(bucket.Path, "/") + "/"
+	rows, err := op.GetS3ObjectVersionsByPrefix(base + prefix.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+	type item struct {
+		key     string
+		version gofakes3.VersionItem
+	}
+	var items []item
+	current := make(map[string]bool)
+	for _, e := range entries {
+		if e.IsPrefix {
+			result.AddPrefix(e.Key)
+			continue
+		}
+		current[e.Key] = true
+		versionID := ""
+		if m, err := op.GetS3ObjectMeta(base + e.Key); err == nil && m != nil {
+			versionID = m.VersionID
+		}
+		items = append(items, item{key: e.Key, version: &gofakes3.Version{
+			Key:          e.Key,
+			VersionID:    apiVersionID(versionID),
+			IsLatest:     true,
+			LastModified: gofakes3.NewContentTime(e.Modified),
+			Size:         e.Size,
+			StorageClass: gofakes3.StorageStandard,
+			ETag:         `""`,
+		}})
+	}
+	for i, v := range rows {
+		key := strings.TrimPrefix(v.Path, base)
+		if hasDelimiter {
+			if idx := strings.Index(key[len(prefix.Prefix):], prefix.Delimiter); idx >= 0 {
+				result.AddPrefix(key[:len(prefix.Prefix)+idx])
+				continue
+			}
+		}
+		latest := !current[key] && (i == 0 || rows[i-1].Path != v.Path)
+		var version gofakes3.VersionItem
+		if v.DeleteMarker {
+			version = &gofakes3.DeleteMarker{
+				Key:          key,
+				VersionID:    apiVersionID(v.VersionID),
+				IsLatest:     latest,
+				LastModified: gofakes3.NewContentTime(v.Modified),
+			}
+		} else {
+			version = &gofakes3.Version{
+				Key:          key,
+				VersionID:    apiVersionID(v.VersionID),
+				IsLatest:     latest,
+				LastModified: gofakes3.NewContentTime(v.Modified),
+				Size:         v.Size,
+				StorageClass: gofakes3.StorageStandard,
+				ETag:         `""`,
+			}
+		}
+		items = append(items, item{key: key, version: version})
+	}
+	// the versions of a key are kept in order, the current one first
+	slices.SortStableFunc(items, func(a, b item) int { return strings.Compare(a.key, b.key) })
+
+	start := 0
+	if page.HasKeyMarker {
+		start = len(items)
+		for i, it := range items {
+			if it.key > page.KeyMarker {
+				start = i
+				break
+			}
+			if page.HasVersionIDMarker && it.key == page.KeyMarker && it.version.GetVersionID() == page.VersionIDMarker {
+				start = i + 1
+				break
+			}
+		}
+	}
+	maxKeys := int(page.MaxKeys)
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	end := min(start+maxKeys, len(items))
+	for _, it := range items[start:end] {
+		result.Versions = append(result.Versions, it.version)
+	}
+	if end < len(items) {
+		last := items[end-1]
+		result.IsTruncated = true
+		result.NextKeyMarker = last.key
+		result.NextVersionIDMarker = last.version.GetVersionID()
+	}
+	return result, nil
+}
+
+// versionMiddleware serves HEAD with a versionId and passes the null version to gofakes3,
+// which would answer both with the current object
+func versionMiddleware(b *s3Backend, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		query := r.URL.Query()
+		versionID := query.Get("versionId")
+		if versionID == "" || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodHead {
+			if versionID == nullVersionID {
+				query.Set("versionId", nullVersionAlias)
+				r.URL.RawQuery = query.Encode()
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		obj, err := b.HeadObjectVersion(bucket, key, gofakes3.VersionID(versionID))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+		if obj.IsDeleteMarker {
+			w.Header().Set("x-amz-delete-marker", "true")
+			writeError(w, r, gofakes3.ErrMethodNotAllowed)
+			return
+		}
+		for k, v := range obj.Metadata {
+			w.Header().Set(k, v)
+		}
+		w.Header().Set("ETag", `""`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	})
+}
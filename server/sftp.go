@@ -7,6 +7,7 @@ import (
 
 	"github.com/OpenListTeam/OpenList/v4/drivers/base"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/metrics"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
@@ -62,7 +63,7 @@ func (d *SftpDriver) GetConfig() *sftpd.Config {
 	return d.config
 }
 
-func (d *SftpDriver) GetFileSystem(sc *ssh.ServerConn) (sftpd.FileSystem, error) {
+func (d *SftpDriver) userContext(sc *ssh.ServerConn) (context.Context, error) {
 	userObj, err := op.GetUserByName(sc.User())
 	if err != nil {
 		return nil, err
@@ -72,9 +73,26 @@ func (d *SftpDriver) GetFileSystem(sc *ssh.ServerConn) (sftpd.FileSystem, error)
 	ctx = context.WithValue(ctx, conf.MetaPassKey, "")
 	ctx = context.WithValue(ctx, conf.ClientIPKey, sc.RemoteAddr().String())
 	ctx = context.WithValue(ctx, conf.ProxyHeaderKey, d.proxyHeader)
+	return ctx, nil
+}
+
+func (d *SftpDriver) GetFileSystem(sc *ssh.ServerConn) (sftpd.FileSystem, error) {
+	ctx, err := d.userContext(sc)
+	if err != nil {
+		return nil, err
+	}
+	metrics.SessionOpened("sftp")
+	go func() {
+		_ = sc.Wait()
+		metrics.SessionClosed("sftp")
+	}()
 	return &sftp.DriverAdapter{FtpDriver: ftp.NewAferoAdapter(ctx)}, nil
 }
 
+func (d *SftpDriver) GetExecContext(sc *ssh.ServerConn) (context.Context, error) {
+	return d.userContext(sc)
+}
+
 func (d *SftpDriver) Close() {
 }
 
@@ -110,11 +128,11 @@ func (d *SftpDriver) PasswordAuth(conn ssh.ConnMetadata, password []byte) (*ssh.
 		userObj, err = tryLdapLoginAndRegister(conn.User(), pass)
 	}
 	if err != nil {
-		model.LoginCache.Set(ip, count+1)
+		model.LoginCache.Incr(ip)
 		return nil, err
 	}
 	if userObj.Disabled || !userObj.CanFTPAccess() {
-		model.LoginCache.Set(ip, count+1)
+		model.LoginCache.Incr(ip)
 		return nil, errors.New("user is not allowed to access via SFTP")
 	}
 	model.LoginCache.Del(ip)
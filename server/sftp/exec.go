@@ -0,0 +1,381 @@
+package sftp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"fmt"
+	"hash"
+	"io"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/ftp"
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// execCommands are the commands served over the exec channel, the paths are relative to the home of the user like in sftp
+var execCommands = map[string]func(e *execEnv, args []string) uint32{
+	"md5sum":    hashCommand("md5sum", ftpserver.HASHAlgoMD5, md5.New),
+	"sha1sum":   hashCommand("sha1sum", ftpserver.HASHAlgoSHA1, sha1.New),
+	"sha256sum": hashCommand("sha256sum", ftpserver.HASHAlgoSHA256, sha256.New),
+	"cp":        execCopy,
+	"mv":        execMove,
+	"df":        execDf,
+	"echo":      execEcho,
+	"scp":       execScp,
+}
+
+type execEnv struct {
+	ctx    context.Context
+	user   *model.User
+	fs     *ftp.AferoAdapter
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (e *execEnv) errorf(format string, a ...any) {
+	_, _ = fmt.Fprintf(e.stderr, format+"\n", a...)
+}
+
+// Exec runs a command line of the exec channel and returns the exit status
+func Exec(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) uint32 {
+	e := &execEnv{
+		ctx:    ctx,
+		user:   ctx.Value(conf.UserKey).(*model.User),
+		fs:     ftp.NewAferoAdapter(ctx),
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	args, err := splitCommand(command)
+	if err != nil {
+		e.errorf("openlist: %v", err)
+		return 2
+	}
+	if len(args) == 0 {
+		return 0
+	}
+	name := stdpath.Base(args[0])
+	if name == "rsync" {
+		e.errorf("rsync: the rsync protocol is not supported, use sftp instead")
+		return 127
+	}
+	f, ok := execCommands[name]
+	if !ok {
+		e.errorf("openlist: %s: command not found", args[0])
+		return 127
+	}
+	return f(e, args[1:])
+}
+
+// splitCommand splits the command line like a POSIX shell does, variables expand to empty strings.
+// Pipes, redirections and command lists are not supported.
+func splitCommand(s string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		inArg bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			inArg = true
+			if i+1 < len(s) {
+				i++
+				if s[i] != '\n' {
+					cur.WriteByte(s[i])
+				}
+			}
+		case c == '\'':
+			inArg = true
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			cur.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+		case c == '"':
+			inArg = true
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				switch {
+				case s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0:
+					i++
+					if s[i] != '\n' {
+						cur.WriteByte(s[i])
+					}
+				case s[i] == '$' && variableEnd(s, i) > i:
+					i = variableEnd(s, i) - 1
+				default:
+					cur.WriteByte(s[i])
+				}
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated quote")
+			}
+		case c == '$' && variableEnd(s, i) > i:
+			i = variableEnd(s, i) - 1
+		case strings.IndexByte("|&;<>()`", c) >= 0:
+			return nil, fmt.Errorf("unsupported shell syntax %q", c)
+		default:
+			inArg = true
+			cur.WriteByte(c)
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// variableEnd returns the end of the variable reference starting with the $ at i, or i if it is a plain $
+func variableEnd(s string, i int) int {
+	if i+1 >= len(s) {
+		return i
+	}
+	if s[i+1] == '{' {
+		if j := strings.IndexByte(s[i+2:], '}'); j >= 0 {
+			return i + 3 + j
+		}
+		return i
+	}
+	j := i + 1
+	for j < len(s) && (s[j] == '_' || 'a' <= s[j] && s[j] <= 'z' || 'A' <= s[j] && s[j] <= 'Z' || '0' <= s[j] && s[j] <= '9') {
+		j++
+	}
+	if j == i+1 {
+		return i
+	}
+	return j
+}
+
+// splitOptions separates the short options from the operands, the long options are ignored
+func splitOptions(args []string) (opts string, operands []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return opts, append(operands, args[i+1:]...)
+		}
+		if len(arg) > 1 && arg[0] == '-' {
+			if arg[1] != '-' {
+				opts += arg[1:]
+			}
+			continue
+		}
+		operands = append(operands, arg)
+	}
+	return opts, operands
+}
+
+func hashCommand(name string, algo ftpserver.HASHAlgo, newHash func() hash.Hash) func(e *execEnv, args []string) uint32 {
+	return func(e *execEnv, args []string) uint32 {
+		_, paths := splitOptions(args)
+		if len(paths) == 0 {
+			// the input is hashed like coreutils does, clients use it to check the command is available
+			h := newHash()
+			if _, err := io.Copy(h, e.stdin); err != nil {
+				e.errorf("%s: -: %v", name, err)
+				return 1
+			}
+			_, _ = fmt.Fprintf(e.stdout, "%s  -\n", hex.EncodeToString(h.Sum(nil)))
+			return 0
+		}
+		var status uint32
+		for _, p := range paths {
+			info, err := e.fs.Stat(p)
+			if err == nil && info.IsDir() {
+				err = errors.New("is a directory")
+			}
+			var sum string
+			if err == nil {
+				sum, err = e.fs.ComputeHash(p, algo, 0, info.Size())
+			}
+			if err != nil {
+				e.errorf("%s: %s: %v", name, p, err)
+				status = 1
+				continue
+			}
+			_, _ = fmt.Fprintf(e.stdout, "%s  %s\n", sum, p)
+		}
+		return status
+	}
+}
+
+// transfer calls f for each source with the target path, the last operand is the target or the directory to put the sources in
+func (e *execEnv) transfer(name string, operands []string, f func(src, dst string, isDir bool) error) uint32 {
+	if len(operands) < 2 {
+		e.errorf("%s: missing destination operand", name)
+		return 1
+	}
+	srcs, dst := operands[:len(operands)-1], operands[len(operands)-1]
+	info, err := e.fs.Stat(dst)
+	dstIsDir := err == nil && info.IsDir()
+	if len(srcs) > 1 && !dstIsDir {
+		e.errorf("%s: target %s is not a directory", name, dst)
+		return 1
+	}
+	var status uint32
+	for _, src := range srcs {
+		target := dst
+		if dstIsDir {
+			target = stdpath.Join(dst, stdpath.Base(src))
+		}
+		info, err := e.fs.Stat(src)
+		if err == nil {
+			err = f(src, target, info.IsDir())
+		}
+		if err != nil {
+			e.errorf("%s: %s: %v", name, src, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// execCopy copies with fs.Copy and waits for the copy, so the exit status tells whether it succeeded
+func execCopy(e *execEnv, args []string) uint32 {
+	opts, operands := splitOptions(args)
+	recursive := strings.ContainsAny(opts, "rRa")
+	if !e.user.CanCopy() || !e.user.CanFTPManage() {
+		e.errorf("cp: %v", errs.PermissionDenied)
+		return 1
+	}
+	return e.transfer("cp", operands, func(src, dst string, isDir bool) error {
+		if isDir && !recursive {
+			return errors.New("-r not specified, omitting directory")
+		}
+		srcPath, err := e.user.JoinPath(src)
+		if err != nil {
+			return err
+		}
+		dstPath, err := e.user.JoinPath(dst)
+		if err != nil {
+			return err
+		}
+		srcDir, srcName := stdpath.Split(srcPath)
+		dstDir, dstName := stdpath.Split(dstPath)
+		srcMeta, err := op.GetNearestMeta(srcDir)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			return err
+		}
+		if !common.CanRead(e.user, srcMeta, srcDir) {
+			return errs.PermissionDenied
+		}
+		dstMeta, err := op.GetNearestMeta(dstDir)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			return err
+		}
+		if !common.CanWrite(e.user, dstMeta, dstDir) {
+			return errs.PermissionDenied
+		}
+		ctx := context.WithValue(e.ctx, conf.NoTaskKey, struct{}{})
+		if srcName == dstName {
+			_, err = fs.Copy(ctx, srcPath, dstDir)
+			return err
+		}
+		if !e.user.CanRename() {
+			return errs.PermissionDenied
+		}
+		if _, err = fs.Get(e.ctx, dstPath, &fs.GetArgs{NoLog: true}); err == nil {
+			return fmt.Errorf("%s exists", dst)
+		}
+		return copyRenamed(ctx, srcPath, dstDir, dstName)
+	})
+}
+
+// copyRenamed copies srcPath to dstDir under another name, the copy gets the source name so it is made
+// in a temporary folder of dstDir, where it is renamed before it is moved next to the other files
+func copyRenamed(ctx context.Context, srcPath, dstDir, dstName string) error {
+	tmpDir := stdpath.Join(dstDir, ".openlist-cp-"+random.String(8))
+	if err := fs.MakeDir(ctx, tmpDir); err != nil {
+		return err
+	}
+	defer func() {
+		if err := fs.Remove(ctx, tmpDir); err != nil {
+			log.Warnf("failed remove %s: %+v", tmpDir, err)
+		}
+	}()
+	if _, err := fs.Copy(ctx, srcPath, tmpDir); err != nil {
+		return err
+	}
+	if err := fs.Rename(ctx, stdpath.Join(tmpDir, stdpath.Base(srcPath)), dstName); err != nil {
+		return err
+	}
+	_, err := fs.Move(ctx, stdpath.Join(tmpDir, dstName), dstDir)
+	return err
+}
+
+func execMove(e *execEnv, args []string) uint32 {
+	_, operands := splitOptions(args)
+	return e.transfer("mv", operands, func(src, dst string, _ bool) error {
+		return e.fs.Rename(src, dst)
+	})
+}
+
+// execDf prints the space of the storages in 1K blocks like df -k
+func execDf(e *execEnv, args []string) uint32 {
+	_, paths := splitOptions(args)
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	_, _ = fmt.Fprintf(e.stdout, "%-15s %14s %14s %14s %4s %s\n", "Filesystem", "1K-blocks", "Used", "Available", "Use%", "Mounted on")
+	var status uint32
+	for _, p := range paths {
+		if _, err := e.fs.Stat(p); err != nil {
+			e.errorf("df: %s: %v", p, err)
+			status = 1
+			continue
+		}
+		reqPath, err := e.user.JoinPath(p)
+		if err != nil {
+			e.errorf("df: %s: %v", p, err)
+			status = 1
+			continue
+		}
+		details, err := op.GetStorageDetailsByPath(e.ctx, reqPath)
+		if err != nil {
+			if errors.Is(err, errs.NotImplement) {
+				err = errors.New("the storage doesn't report its space")
+			}
+			e.errorf("df: %s: %v", p, err)
+			status = 1
+			continue
+		}
+		use := "-"
+		if details.TotalSpace > 0 {
+			use = fmt.Sprintf("%d%%", (details.UsedSpace*100+details.TotalSpace-1)/details.TotalSpace)
+		}
+		_, _ = fmt.Fprintf(e.stdout, "%-15s %14d %14d %14d %4s %s\n", "openlist",
+			details.TotalSpace/1024, details.UsedSpace/1024, max(details.FreeSpace(), 0)/1024, use, p)
+	}
+	return status
+}
+
+func execEcho(e *execEnv, args []string) uint32 {
+	newline := "\n"
+	if len(args) > 0 && args[0] == "-n" {
+		newline = ""
+		args = args[1:]
+	}
+	_, _ = fmt.Fprint(e.stdout, strings.Join(args, " ")+newline)
+	return 0
+}
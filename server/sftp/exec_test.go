@@ -0,0 +1,34 @@
+package sftp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{command: "md5sum /a/b", want: []string{"md5sum", "/a/b"}},
+		{command: "  sha1sum  'a b'   \"c d\" ", want: []string{"sha1sum", "a b", "c d"}},
+		{command: `cp -r a\ b "x\"y" 'it'\''s'`, want: []string{"cp", "-r", "a b", `x"y`, "it's"}},
+		{command: "echo ${ShellId}%ComSpec%", want: []string{"echo", "%ComSpec%"}},
+		{command: `echo $HOME "$HOME" $ "a$"`, want: []string{"echo", "", "$", "a$"}},
+		{command: "", want: nil},
+		{command: "md5sum 'a", wantErr: true},
+		{command: "md5sum a | sh", wantErr: true},
+		{command: "md5sum a; rm b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.command)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
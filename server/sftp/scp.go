@@ -0,0 +1,370 @@
+package sftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	stdpath "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// scp is the remote side of the legacy scp protocol, the uploads go through the same staging as ftp
+type scp struct {
+	*execEnv
+	in        *bufio.Reader
+	recursive bool
+	preserve  bool
+	status    uint32
+}
+
+// execScp serves `scp -t` which receives the files from the client and `scp -f` which sends them
+func execScp(e *execEnv, args []string) uint32 {
+	opts, operands := splitOptions(args)
+	s := &scp{
+		execEnv:   e,
+		in:        bufio.NewReader(e.stdin),
+		recursive: strings.Contains(opts, "r"),
+		preserve:  strings.Contains(opts, "p"),
+	}
+	var err error
+	switch {
+	case strings.Contains(opts, "t"):
+		if len(operands) != 1 {
+			s.fatal(errors.New("ambiguous target"))
+			return 1
+		}
+		err = s.sink(operands[0], strings.Contains(opts, "d"))
+	case strings.Contains(opts, "f"):
+		err = s.source(operands)
+	default:
+		e.errorf("scp: only the remote side of scp is supported")
+		return 1
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.fatal(err)
+		}
+		return 1
+	}
+	return s.status
+}
+
+// warn reports an error to the client which goes on with the next file
+func (s *scp) warn(err error) {
+	s.status = 1
+	_, _ = fmt.Fprintf(s.stdout, "\x01scp: %v\n", err)
+}
+
+func (s *scp) fatal(err error) {
+	_, _ = fmt.Fprintf(s.stdout, "\x02scp: %v\n", err)
+}
+
+func (s *scp) ack() error {
+	_, err := s.stdout.Write([]byte{0})
+	return err
+}
+
+// response reads the reply of the client, false is returned if the client reported an error for the current file
+func (s *scp) response() (bool, error) {
+	b, err := s.in.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	if b == 0 {
+		return true, nil
+	}
+	msg, err := s.in.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+	if b != 1 {
+		return false, errors.New(msg)
+	}
+	s.errorf("%s", msg)
+	s.status = 1
+	return false, nil
+}
+
+func (s *scp) sink(target string, targetMustBeDir bool) error {
+	info, err := s.fs.Stat(target)
+	targetIsDir := err == nil && info.IsDir()
+	if targetMustBeDir && !targetIsDir {
+		return fmt.Errorf("%s: not a directory", target)
+	}
+	err = s.receive(target, targetIsDir)
+	if errors.Is(err, io.EOF) {
+		// the client closes the input after the last file
+		return nil
+	}
+	return err
+}
+
+// receive handles the lines sent to a directory until the matching E line, the entries are put in target if it is a directory
+func (s *scp) receive(target string, targetIsDir bool) error {
+	if err := s.ack(); err != nil {
+		return err
+	}
+	var modified time.Time
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return errors.New("protocol error: empty line")
+		}
+		switch line[0] {
+		case 1:
+			s.errorf("%s", line[1:])
+			s.status = 1
+			continue
+		case 2:
+			return errors.New(line[1:])
+		case 'E':
+			return s.ack()
+		case 'T':
+			var mtime, mtimeUsec, atime, atimeUsec int64
+			if _, err := fmt.Sscanf(line[1:], "%d %d %d %d", &mtime, &mtimeUsec, &atime, &atimeUsec); err != nil {
+				return fmt.Errorf("protocol error: %s", line)
+			}
+			modified = time.Unix(mtime, mtimeUsec*1000)
+			if err := s.ack(); err != nil {
+				return err
+			}
+			continue
+		case 'C', 'D':
+		default:
+			return fmt.Errorf("protocol error: unexpected %q", line)
+		}
+		parts := strings.SplitN(line[1:], " ", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("protocol error: %s", line)
+		}
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("protocol error: bad size %s", parts[1])
+		}
+		name := parts[2]
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return fmt.Errorf("protocol error: unexpected filename %s", name)
+		}
+		p := target
+		if targetIsDir {
+			p = stdpath.Join(target, name)
+		}
+		mtime := modified
+		modified = time.Time{}
+		if line[0] == 'C' {
+			if err := s.receiveFile(p, size, mtime); err != nil {
+				return err
+			}
+			continue
+		}
+		if !s.recursive {
+			return errors.New("received directory without -r")
+		}
+		if err := s.mkdir(p); err != nil {
+			s.warn(fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+		if err := s.receive(p, true); err != nil {
+			if errors.Is(err, io.EOF) {
+				// the input ended before the E line of the directory
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if s.preserve && !mtime.IsZero() {
+			if err := s.fs.Chtimes(p, mtime, mtime); err != nil && !errors.Is(err, errs.NotSupport) {
+				log.Warnf("[scp] failed set modification time of [%s]: %+v", p, err)
+			}
+		}
+	}
+}
+
+func (s *scp) mkdir(p string) error {
+	info, err := s.fs.Stat(p)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return errors.New("not a directory")
+	}
+	return s.fs.Mkdir(p, 0)
+}
+
+// discard drops the content written to f instead of putting it on Close
+func discard(f ftpserver.FileTransfer, err error) {
+	if t, ok := f.(ftpserver.FileTransferError); ok {
+		t.TransferError(err)
+	}
+	_ = f.Close()
+}
+
+// receiveFile reads the content of a C line, the errors of the storage are reported after the content is consumed.
+// A file which isn't received completely is dropped.
+func (s *scp) receiveFile(p string, size int64, modified time.Time) error {
+	if err := s.ack(); err != nil {
+		return err
+	}
+	f, werr := s.fs.GetHandle(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0)
+	opened := werr == nil
+	buf := make([]byte, 32*1024)
+	for remaining := size; remaining > 0; {
+		n, err := s.in.Read(buf[:min(int64(len(buf)), remaining)])
+		if n > 0 && werr == nil {
+			_, werr = f.Write(buf[:n])
+		}
+		remaining -= int64(n)
+		if err != nil && remaining > 0 {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			if opened {
+				discard(f, err)
+			}
+			return err
+		}
+	}
+	ok, err := s.response()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if opened {
+			discard(f, err)
+		}
+		return err
+	}
+	if !ok && werr == nil {
+		werr = errors.New("the client failed to send the file")
+	}
+	if opened {
+		if werr != nil {
+			discard(f, werr)
+		} else {
+			werr = f.Close()
+		}
+	}
+	if werr == nil && s.preserve && !modified.IsZero() {
+		// the upload is still staged, the time is applied when it is done
+		if err := s.fs.Chtimes(p, modified, modified); !errors.Is(err, errs.NotSupport) {
+			werr = err
+		}
+	}
+	if werr != nil {
+		s.warn(fmt.Errorf("%s: %w", p, werr))
+		return nil
+	}
+	return s.ack()
+}
+
+func (s *scp) source(paths []string) error {
+	if _, err := s.response(); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := s.send(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a file or a directory, only the errors which break the protocol are returned
+func (s *scp) send(p string) error {
+	info, err := s.fs.Stat(p)
+	if err != nil {
+		s.warn(fmt.Errorf("%s: %w", p, err))
+		return nil
+	}
+	name := stdpath.Base(p)
+	if name == "/" || name == "." || name == ".." {
+		s.warn(fmt.Errorf("%s: invalid path", p))
+		return nil
+	}
+	if info.IsDir() && !s.recursive {
+		s.warn(fmt.Errorf("%s: not a regular file", p))
+		return nil
+	}
+	if s.preserve {
+		mtime := info.ModTime().Unix()
+		if _, err := fmt.Fprintf(s.stdout, "T%d 0 %d 0\n", mtime, mtime); err != nil {
+			return err
+		}
+		if ok, err := s.response(); !ok {
+			return err
+		}
+	}
+	if info.IsDir() {
+		return s.sendDir(p, name)
+	}
+	f, err := s.fs.GetHandle(p, os.O_RDONLY, 0)
+	if err != nil {
+		s.warn(fmt.Errorf("%s: %w", p, err))
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+	size := info.Size()
+	if _, err := fmt.Fprintf(s.stdout, "C%04o %d %s\n", 0o644, size, name); err != nil {
+		return err
+	}
+	if ok, err := s.response(); !ok {
+		return err
+	}
+	n, err := io.CopyN(s.stdout, f, size)
+	if err != nil {
+		// the client expects exactly size bytes before the status
+		if _, err := io.CopyN(s.stdout, zeroReader{}, size-n); err != nil {
+			return err
+		}
+		s.warn(fmt.Errorf("%s: %w", p, err))
+	} else if err := s.ack(); err != nil {
+		return err
+	}
+	_, err = s.response()
+	return err
+}
+
+func (s *scp) sendDir(p, name string) error {
+	if _, err := fmt.Fprintf(s.stdout, "D%04o 0 %s\n", 0o755, name); err != nil {
+		return err
+	}
+	if ok, err := s.response(); !ok {
+		return err
+	}
+	infos, err := s.fs.ReadDir(p)
+	if err != nil {
+		s.warn(fmt.Errorf("%s: %w", p, err))
+	}
+	for _, info := range infos {
+		if err := s.send(stdpath.Join(p, info.Name())); err != nil {
+			return err
+		}
+	}
+	if _, err := s.stdout.Write([]byte("E\n")); err != nil {
+		return err
+	}
+	_, err = s.response()
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
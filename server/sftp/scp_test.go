@@ -0,0 +1,226 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/ftp"
+	"github.com/OpenListTeam/tache"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+	ftp.InitStage()
+	stream.ClientDownloadLimit = stream.NewLimiter(-1)
+	stream.ClientUploadLimit = stream.NewLimiter(-1)
+}
+
+// newScpStorage mounts a local storage at /<test name> and returns its root and the context of an admin
+func newScpStorage(t *testing.T) (context.Context, string, string) {
+	conf.Conf.TempDir = t.TempDir()
+	root := t.TempDir()
+	mount := "/" + t.Name()
+	addition, _ := utils.Json.MarshalToString(map[string]string{"root_folder_path": root})
+	if _, err := op.CreateStorage(context.Background(), model.Storage{Driver: "Local", MountPath: mount, Addition: addition}); err != nil {
+		t.Fatal(err)
+	}
+	fs.UploadTaskManager = tache.NewManager[*fs.UploadTask](tache.WithWorks(1))
+	user := &model.User{ID: 1, Role: model.ADMIN, BasePath: "/", Permission: 0xFFFF}
+	ctx := context.WithValue(context.Background(), conf.UserKey, user)
+	return context.WithValue(ctx, conf.MetaPassKey, ""), root, mount
+}
+
+// execPiped runs the command with the input of the client on stdin, and returns the exit status and stdout
+func execPiped(ctx context.Context, command, stdin string) (uint32, string) {
+	var stdout, stderr bytes.Buffer
+	status := Exec(ctx, command, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String()
+}
+
+func waitFile(t *testing.T, p, content string) os.FileInfo {
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(p)
+		if err == nil && string(data) == content {
+			info, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not uploaded, got %q: %v", p, data, err)
+		}
+	}
+}
+
+func TestScpSink(t *testing.T) {
+	ctx, root, mount := newScpStorage(t)
+	const mtime = "T1700000000 0 1700000000 0\n"
+	stdin := mtime + "D0755 0 dir\n" + mtime + "C0644 5 a.txt\nhello\x00" + "E\n"
+	status, stdout := execPiped(ctx, "scp -r -p -t "+mount, stdin)
+	if status != 0 || stdout != strings.Repeat("\x00", 7) {
+		t.Fatalf("unexpected result %d %q", status, stdout)
+	}
+	waitFile(t, filepath.Join(root, "dir", "a.txt"), "hello")
+	// the modification time is applied when the staged upload is done
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		info, err := os.Stat(filepath.Join(root, "dir", "a.txt"))
+		if err == nil && info.ModTime().Unix() == 1700000000 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("modification time not preserved: %v %v", info.ModTime(), err)
+		}
+	}
+}
+
+func TestScpSource(t *testing.T) {
+	ctx, root, mount := newScpStorage(t)
+	mtime := time.Unix(1700000000, 0)
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for p, content := range map[string]string{"dir/a.txt": "hello", "dir/sub/b.txt": "world"} {
+		if err := os.WriteFile(filepath.Join(root, p), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{"dir/a.txt", "dir/sub/b.txt", "dir/sub", "dir"} {
+		if err := os.Chtimes(filepath.Join(root, p), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the client acknowledges every line and every file
+	status, stdout := execPiped(ctx, "scp -r -p -f "+mount+"/dir", strings.Repeat("\x00", 64))
+	const T = "T1700000000 0 1700000000 0\n"
+	want := T + "D0755 0 dir\n" +
+		T + "C0644 5 a.txt\nhello\x00" +
+		T + "D0755 0 sub\n" +
+		T + "C0644 5 b.txt\nworld\x00" +
+		"E\n" + "E\n"
+	if status != 0 || stdout != want {
+		t.Errorf("unexpected result %d\n%q\nwant\n%q", status, stdout, want)
+	}
+}
+
+func TestScpBadFilename(t *testing.T) {
+	ctx, root, mount := newScpStorage(t)
+	tests := []struct {
+		stdin string
+		name  string
+	}{
+		{"C0644 3 ../x\nabc\x00", "../x"},
+		{"C0644 3 a/b\nabc\x00", "a/b"},
+		{"D0755 0 ..\nE\n", ".."},
+	}
+	for _, tt := range tests {
+		status, stdout := execPiped(ctx, "scp -r -t "+mount, tt.stdin)
+		want := "\x00\x02scp: protocol error: unexpected filename " + tt.name + "\n"
+		if status != 1 || stdout != want {
+			t.Errorf("%q: unexpected result %d %q", tt.stdin, status, stdout)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("expected nothing to be written, got %v", entries)
+	}
+	if tasks := fs.UploadTaskManager.GetAll(); len(tasks) != 0 {
+		t.Errorf("expected no upload, got %d", len(tasks))
+	}
+}
+
+func TestScpTruncated(t *testing.T) {
+	ctx, root, mount := newScpStorage(t)
+	// the input ends in the content of the file
+	status, stdout := execPiped(ctx, "scp -t "+mount, "C0644 10 t.txt\nhello")
+	if status != 1 || stdout != "\x00\x00\x02scp: unexpected EOF\n" {
+		t.Errorf("unexpected result %d %q", status, stdout)
+	}
+	if tasks := fs.UploadTaskManager.GetAll(); len(tasks) != 0 {
+		t.Errorf("expected the partial file to be dropped, got %d uploads", len(tasks))
+	}
+
+	// the input ends in a line
+	status, stdout = execPiped(ctx, "scp -t "+mount, "C0644 10 t.t")
+	if status != 1 || stdout != "\x00\x02scp: unexpected EOF\n" {
+		t.Errorf("unexpected result %d %q", status, stdout)
+	}
+
+	// the input ends before the end of the directory, the complete file is kept
+	status, stdout = execPiped(ctx, "scp -r -t "+mount, "D0755 0 d\nC0644 5 a.txt\nhello\x00")
+	if status != 1 || stdout != "\x00\x00\x00\x00\x02scp: unexpected EOF\n" {
+		t.Errorf("unexpected result %d %q", status, stdout)
+	}
+	waitFile(t, filepath.Join(root, "d", "a.txt"), "hello")
+	if _, err := os.Stat(filepath.Join(root, "t.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the truncated file not to be uploaded, got %v", err)
+	}
+}
+
+func TestExecCopyRenamed(t *testing.T) {
+	ctx, root, mount := newScpStorage(t)
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for p, content := range map[string]string{"a.txt": "hello", "sub/a.txt": "other"} {
+		if err := os.WriteFile(filepath.Join(root, p), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// in the same directory
+	if status, _ := execPiped(ctx, "cp "+mount+"/a.txt "+mount+"/b.txt", ""); status != 0 {
+		t.Fatalf("cp to the same directory failed with %d", status)
+	}
+	// to a directory holding a file with the source name
+	if status, _ := execPiped(ctx, "cp "+mount+"/a.txt "+mount+"/sub/c.txt", ""); status != 0 {
+		t.Fatalf("cp to another name failed with %d", status)
+	}
+	for p, want := range map[string]string{"a.txt": "hello", "b.txt": "hello", "sub/a.txt": "other", "sub/c.txt": "hello"} {
+		if data, err := os.ReadFile(filepath.Join(root, p)); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, want %q: %v", p, data, want, err)
+		}
+	}
+	for _, dir := range []string{root, filepath.Join(root, "sub")} {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".openlist-cp-") {
+				t.Errorf("temporary folder %s is left in %s", e.Name(), dir)
+			}
+		}
+	}
+	// an existing target is not overwritten
+	if status, _ := execPiped(ctx, "cp "+mount+"/sub/a.txt "+mount+"/b.txt", ""); status != 1 {
+		t.Errorf("cp over an existing file exited with %d", status)
+	}
+
+	// renaming the copy needs the rename permission
+	user := &model.User{ID: 1, Role: model.ADMIN, BasePath: "/", Permission: 0xFFFF &^ (1 << 4)}
+	ctx = context.WithValue(ctx, conf.UserKey, user)
+	var stderr bytes.Buffer
+	if status := Exec(ctx, "cp "+mount+"/a.txt "+mount+"/d.txt", strings.NewReader(""), &bytes.Buffer{}, &stderr); status != 1 ||
+		!strings.Contains(stderr.String(), "permission denied") {
+		t.Errorf("cp without the rename permission: %d %q", status, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "d.txt")); !os.IsNotExist(err) {
+		t.Errorf("d.txt is copied without the rename permission: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package sftp
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/sftpd-openlist"
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecDriver is a sftpd.SftpDriver which can also run the commands of the exec channel
+type ExecDriver interface {
+	sftpd.SftpDriver
+	GetExecContext(sc *ssh.ServerConn) (context.Context, error)
+}
+
+// Server serves the sftp subsystem like sftpd.SftpServer, and the exec requests of the sessions
+type Server struct {
+	driver   ExecDriver
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+func NewServer(driver ExecDriver) *Server {
+	return &Server{driver: driver}
+}
+
+func (s *Server) RunServer() error {
+	listener, err := net.Listen("tcp", s.driver.GetConfig().HostPort)
+	if err != nil {
+		s.logError("sftpd server failed:", err)
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return listener.Close()
+	}
+	s.listener = listener
+	s.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			s.logError("sftpd server failed:", err)
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Unlock()
+	s.driver.Close()
+	return err
+}
+
+func (s *Server) logError(v ...any) {
+	if f := s.driver.GetConfig().ErrorLogFunc; f != nil {
+		f(v...)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	sc, chans, reqs, err := ssh.NewServerConn(conn, &s.driver.GetConfig().ServerConfig)
+	if err != nil {
+		s.logError("sftpd connection error:", err)
+		return
+	}
+	defer func() { _ = sc.Close() }()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.logError("sftpd connection error:", err)
+			return
+		}
+		go s.handleSession(sc, channel, requests)
+	}
+}
+
+// handleSession serves the first sftp or exec request of the session, the env and pty requests are accepted and ignored
+func (s *Server) handleSession(sc *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	started := false
+	for req := range requests {
+		ok := false
+		switch {
+		case started:
+		case sftpd.IsSftpRequest(req):
+			ok, started = true, true
+			go s.serveSftp(sc, channel)
+		case req.Type == "exec" && conf.Conf.SFTP.Exec:
+			var payload struct{ Command string }
+			if ssh.Unmarshal(req.Payload, &payload) == nil {
+				ok, started = true, true
+				go s.serveExec(sc, channel, payload.Command)
+			}
+		case req.Type == "env" || req.Type == "pty-req":
+			ok = true
+		}
+		if req.WantReply {
+			_ = req.Reply(ok, nil)
+		}
+	}
+}
+
+func (s *Server) serveSftp(sc *ssh.ServerConn, channel ssh.Channel) {
+	fs, err := s.driver.GetFileSystem(sc)
+	if err == nil {
+		debugf := s.driver.GetConfig().DebugLogFunc
+		if debugf == nil {
+			debugf = func(string, ...any) {}
+		}
+		err = sftpd.ServeChannel(channel, fs, debugf)
+	} else {
+		_ = channel.Close()
+	}
+	if err != nil {
+		s.logError("sftpd servechannel failed:", err)
+	}
+}
+
+func (s *Server) serveExec(sc *ssh.ServerConn, channel ssh.Channel, command string) {
+	defer func() { _ = channel.Close() }()
+	var status uint32
+	ctx, err := s.driver.GetExecContext(sc)
+	if err != nil {
+		_, _ = channel.Stderr().Write([]byte(err.Error() + "\n"))
+		status = 1
+	} else {
+		status = Exec(ctx, command, channel, channel, channel.Stderr())
+	}
+	_ = channel.CloseWrite()
+	_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
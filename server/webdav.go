@@ -100,7 +100,7 @@ func WebDAVAuth(c *gin.Context) {
 			c.Next()
 			return
 		}
-		model.LoginCache.Set(ip, count+1)
+		model.LoginCache.Incr(ip)
 		c.Status(http.StatusUnauthorized)
 		c.Abort()
 		return
@@ -0,0 +1,359 @@
+package webdav
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// UploadsDirName is the folder in the temp dir holding the chunks of the uploads of the ownCloud clients.
+// The clients upload a big file in a collection of numbered chunks, then MOVE its .file to the destination.
+const UploadsDirName = "owncloud-uploads"
+
+// assembledName is the source of the MOVE which assembles the chunks
+const assembledName = ".file"
+
+func (h *Handler) isUpload(r *http.Request) bool {
+	return h.UploadsPrefix != "" && (r.URL.Path == h.UploadsPrefix || strings.HasPrefix(r.URL.Path, h.UploadsPrefix+"/"))
+}
+
+// uploadDir is the folder of the chunks of the transfer of the user, or of all the transfers if transfer is empty
+func uploadDir(user *model.User, transfer string) string {
+	return filepath.Join(conf.Conf.TempDir, UploadsDirName, strconv.FormatUint(uint64(user.ID), 10), transfer)
+}
+
+// splitUploadPath splits the path of the request under UploadsPrefix into the transfer and the chunk
+func (h *Handler) splitUploadPath(p string) (transfer, chunk string, ok bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(p, h.UploadsPrefix), "/"), "/")
+	if len(parts) > 2 {
+		return "", "", false
+	}
+	for _, part := range parts {
+		if part == "." || part == ".." || strings.ContainsRune(part, '\\') {
+			return "", "", false
+		}
+	}
+	if len(parts) == 2 {
+		chunk = parts[1]
+	}
+	return parts[0], chunk, true
+}
+
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	transfer, chunk, ok := h.splitUploadPath(r.URL.Path)
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	user := r.Context().Value(conf.UserKey).(*model.User)
+	if ok, err := h.canUpload(r, user); err != nil {
+		return http.StatusInternalServerError, err
+	} else if !ok {
+		return http.StatusForbidden, nil
+	}
+	dir := uploadDir(user, transfer)
+	switch r.Method {
+	case "MKCOL":
+		if transfer == "" || chunk != "" {
+			return http.StatusMethodNotAllowed, nil
+		}
+		if _, err := os.Stat(dir); err == nil {
+			return http.StatusMethodNotAllowed, nil
+		}
+		if err := os.MkdirAll(dir, 0o777); err != nil {
+			return http.StatusInternalServerError, errors.WithStack(err)
+		}
+		return http.StatusCreated, nil
+	case "PUT":
+		defer r.Body.Close()
+		if chunk == "" || chunk == assembledName {
+			return http.StatusMethodNotAllowed, nil
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return http.StatusConflict, nil
+		}
+		return writeChunk(filepath.Join(dir, chunk), r.Body)
+	case "PROPFIND":
+		return h.handleUploadPropfind(w, r, transfer, chunk)
+	case "DELETE":
+		if transfer == "" {
+			return http.StatusForbidden, nil
+		}
+		p := filepath.Join(dir, chunk)
+		if _, err := os.Stat(p); err != nil {
+			return http.StatusNotFound, nil
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return http.StatusInternalServerError, errors.WithStack(err)
+		}
+		return http.StatusNoContent, nil
+	case "MOVE":
+		if transfer == "" || chunk != assembledName {
+			return http.StatusForbidden, nil
+		}
+		return h.assembleUpload(w, r, dir)
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+// canUpload checks the requests of an upload like put checks the file, as far as the folder of the file is known.
+// It is given by the Destination header, which some clients send with every request and the others with the last one,
+// so without it only the users who may write anywhere pass. The assembled file is checked by put in any case.
+func (h *Handler) canUpload(r *http.Request, user *model.User) (bool, error) {
+	if user.CanWriteContent() {
+		return true, nil
+	}
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || u.Path == "" {
+		return false, nil
+	}
+	dst, _, err := h.stripPrefix(u.Path)
+	if err != nil {
+		return false, nil
+	}
+	if dst, err = user.JoinPath(dst); err != nil {
+		return false, nil
+	}
+	return canPut(user, path.Dir(dst))
+}
+
+func writeChunk(name string, r io.Reader) (int, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return http.StatusInternalServerError, errors.WithStack(err)
+	}
+	_, err = utils.CopyWithBuffer(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// a partial chunk must not be assembled
+		_ = os.Remove(name)
+		return http.StatusInternalServerError, errors.WithStack(err)
+	}
+	return http.StatusCreated, nil
+}
+
+// handleUploadPropfind lists the transfers or the chunks of a transfer, which the clients read to resume an upload
+func (h *Handler) handleUploadPropfind(w http.ResponseWriter, r *http.Request, transfer, chunk string) (int, error) {
+	user := r.Context().Value(conf.UserKey).(*model.User)
+	name := filepath.Join(uploadDir(user, transfer), chunk)
+	fi, err := os.Stat(name)
+	if err != nil {
+		if transfer != "" {
+			return http.StatusNotFound, nil
+		}
+		// no transfer was started yet
+		fi = uploadRoot{}
+	}
+	href := path.Join(h.UploadsPrefix, transfer, chunk)
+	mw := multistatusWriter{w: w}
+	err = mw.write(makePropstatResponse(uploadHref(href, fi), uploadPropstats(fi)))
+	if err == nil && fi.IsDir() && r.Header.Get("Depth") != "0" {
+		entries, _ := os.ReadDir(name)
+		for _, e := range entries {
+			info, ierr := e.Info()
+			if ierr != nil || e.Name() == assembledName {
+				continue
+			}
+			if err = mw.write(makePropstatResponse(uploadHref(path.Join(href, e.Name()), info), uploadPropstats(info))); err != nil {
+				break
+			}
+		}
+	}
+	if closeErr := mw.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+func uploadHref(href string, fi os.FileInfo) string {
+	if fi.IsDir() {
+		return href + "/"
+	}
+	return href
+}
+
+func uploadPropstats(fi os.FileInfo) []Propstat {
+	pstat := Propstat{Status: http.StatusOK}
+	add := func(local, innerXML string) {
+		pstat.Props = append(pstat.Props, Property{XMLName: xml.Name{Space: "DAV:", Local: local}, InnerXML: []byte(innerXML)})
+	}
+	if fi.IsDir() {
+		add("resourcetype", `<D:collection xmlns:D="DAV:"/>`)
+	} else {
+		add("resourcetype", "")
+		add("getcontentlength", strconv.FormatInt(fi.Size(), 10))
+	}
+	add("getlastmodified", fi.ModTime().UTC().Format(http.TimeFormat))
+	add("getetag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	return []Propstat{pstat}
+}
+
+// uploadRoot stands for the uploads of a user before the first one created the folder
+type uploadRoot struct{}
+
+func (uploadRoot) Name() string       { return "" }
+func (uploadRoot) Size() int64        { return 0 }
+func (uploadRoot) Mode() os.FileMode  { return os.ModeDir }
+func (uploadRoot) ModTime() time.Time { return time.Time{} }
+func (uploadRoot) IsDir() bool        { return true }
+func (uploadRoot) Sys() any           { return nil }
+
+// sortChunks orders the chunks by their number, the names which aren't numbers come last
+func sortChunks(names []string) {
+	slices.SortFunc(names, func(a, b string) int {
+		x, errA := strconv.ParseUint(a, 10, 64)
+		y, errB := strconv.ParseUint(b, 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			return cmp.Compare(x, y)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// assembleUpload joins the chunks in the folder dir into the file at the Destination and removes them
+func (h *Handler) assembleUpload(w http.ResponseWriter, r *http.Request, dir string) (int, error) {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || u.Path == "" {
+		return http.StatusBadRequest, errInvalidDestination
+	}
+	if u.Host != "" && u.Host != r.Host {
+		return http.StatusBadGateway, errInvalidDestination
+	}
+	dst, status, err := h.stripPrefix(u.Path)
+	if err != nil {
+		return status, err
+	}
+	if dst == "" || dst == "/" {
+		return http.StatusBadGateway, errInvalidDestination
+	}
+	release, status, err := h.confirmLocks(r, "", dst)
+	if err != nil {
+		return status, err
+	}
+	defer release()
+	ctx := r.Context()
+	user := ctx.Value(conf.UserKey).(*model.User)
+	dst, err = user.JoinPath(dst)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return http.StatusNotFound, nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() != assembledName {
+			names = append(names, e.Name())
+		}
+	}
+	sortChunks(names)
+	f, err := os.Create(filepath.Join(dir, assembledName))
+	if err != nil {
+		return http.StatusInternalServerError, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	var size int64
+	for _, name := range names {
+		n, err := appendChunk(f, filepath.Join(dir, name))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		size += n
+	}
+	if total := r.Header.Get("OC-Total-Length"); total != "" && total != strconv.FormatInt(size, 10) {
+		return http.StatusBadRequest, errors.Errorf("the chunks hold %d bytes, %s expected", size, total)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, errors.WithStack(err)
+	}
+
+	_, existErr := fs.Get(ctx, dst, &fs.GetArgs{})
+	obj := model.Object{
+		Name:     path.Base(dst),
+		Size:     size,
+		Modified: h.getModTime(r),
+		Ctime:    h.getCreateTime(r),
+	}
+	fi, status, err := h.put(ctx, dst, f, &obj, "")
+	if err != nil {
+		// the chunks are kept for another try until they expire
+		return status, err
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		log.Warnf("failed remove the chunks of %s: %+v", dst, err)
+	}
+	if err = h.setPutHeaders(w, r, dst, fi); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if existErr == nil {
+		return http.StatusNoContent, nil
+	}
+	return http.StatusCreated, nil
+}
+
+func appendChunk(w io.Writer, name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+	n, err := utils.CopyWithBuffer(w, f)
+	return n, errors.WithStack(err)
+}
+
+// CleanUploads removes the chunked uploads which weren't written for longer than the resumable uploads are kept
+func CleanUploads() {
+	expire := time.Duration(setting.GetInt(conf.ResumableUploadExpire, 24)) * time.Hour
+	users, err := os.ReadDir(filepath.Join(conf.Conf.TempDir, UploadsDirName))
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		userDir := filepath.Join(conf.Conf.TempDir, UploadsDirName, u.Name())
+		transfers, err := os.ReadDir(userDir)
+		if err != nil {
+			continue
+		}
+		for _, t := range transfers {
+			info, err := t.Info()
+			if err != nil || time.Since(info.ModTime()) < expire {
+				continue
+			}
+			if err = os.RemoveAll(filepath.Join(userDir, t.Name())); err != nil {
+				log.Warnf("failed remove expired chunked upload %s: %+v", t.Name(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package webdav
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSortChunks(t *testing.T) {
+	names := []string{"10", "2", "00000000000000000000", "1", "x", "0000000000000000001024"}
+	sortChunks(names)
+	want := []string{"00000000000000000000", "1", "2", "10", "0000000000000000001024", "x"}
+	if !slices.Equal(names, want) {
+		t.Errorf("sortChunks() = %v, want %v", names, want)
+	}
+}
+
+func TestSplitUploadPath(t *testing.T) {
+	h := &Handler{UploadsPrefix: "/remote.php/dav/uploads/admin"}
+	tests := []struct {
+		path, transfer, chunk string
+		ok                    bool
+	}{
+		{"/remote.php/dav/uploads/admin", "", "", true},
+		{"/remote.php/dav/uploads/admin/t1/", "t1", "", true},
+		{"/remote.php/dav/uploads/admin/t1/00042", "t1", "00042", true},
+		{"/remote.php/dav/uploads/admin/t1/a/b", "", "", false},
+		{"/remote.php/dav/uploads/admin/../x", "", "", false},
+	}
+	for _, tt := range tests {
+		transfer, chunk, ok := h.splitUploadPath(tt.path)
+		if transfer != tt.transfer || chunk != tt.chunk || ok != tt.ok {
+			t.Errorf("splitUploadPath(%s) = %q, %q, %v, want %q, %q, %v", tt.path, transfer, chunk, ok, tt.transfer, tt.chunk, tt.ok)
+		}
+	}
+}
+
+func TestCanUpload(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+	if err = db.CreateMeta(&model.Meta{Path: "/public", Write: true, WSub: true}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{Prefix: "/remote.php/dav/files/guest"}
+	user := &model.User{ID: 2, Role: model.GENERAL, BasePath: "/"}
+	tests := []struct {
+		destination string
+		ok          bool
+	}{
+		{"", false},
+		{"/remote.php/dav/files/guest/private/a.bin", false},
+		{"/remote.php/dav/files/guest/public/a.bin", true},
+		{"/remote.php/dav/files/guest/public/sub/a.bin", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("MKCOL", "/remote.php/dav/uploads/guest/t1", nil)
+		r = r.WithContext(context.WithValue(r.Context(), conf.UserKey, user))
+		if tt.destination != "" {
+			r.Header.Set("Destination", "http://example.com"+tt.destination)
+		}
+		ok, err := h.canUpload(r, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("canUpload(%q) = %v, want %v", tt.destination, ok, tt.ok)
+		}
+	}
+}
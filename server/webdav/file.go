@@ -15,6 +15,8 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/pkg/errors"
 )
@@ -32,78 +34,151 @@ func slashClean(name string) string {
 // Individual item permission checks are skipped for performance reasons.
 //
 // See section 9.9.4 for when various HTTP status codes apply.
-func moveFiles(ctx context.Context, src, dst string, overwrite bool) (status int, err error) {
+// A move across storages larger than the async threshold runs as a background task which is returned.
+func moveFiles(ctx context.Context, src, dst string, overwrite bool) (t task.TaskExtensionInfo, status int, err error) {
 	srcDir := path.Dir(src)
 	dstDir := path.Dir(dst)
 	srcName := path.Base(src)
 	dstName := path.Base(dst)
 	user := ctx.Value(conf.UserKey).(*model.User)
 	if srcDir != dstDir && !user.CanMove() {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
 	}
 	if srcName != dstName && !user.CanRename() {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
 	}
 	srcMeta, err := op.GetNearestMeta(srcDir)
 	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	dstMeta, err := op.GetNearestMeta(dstDir)
 	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	if !common.CanWrite(user, srcMeta, srcDir) || !common.CanWrite(user, dstMeta, dstDir) {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
 	}
 	if srcDir == dstDir {
 		err = fs.Rename(ctx, src, dstName)
+	} else if asyncTransfer(ctx, src, dst) {
+		t, err = fs.Move(ctx, src, dstDir)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		// a pending write-back upload is staged to dst at once
+		if t == nil {
+			return nil, http.StatusCreated, nil
+		}
+		return t, http.StatusAccepted, nil
 	} else {
 		_, err = fs.Move(context.WithValue(ctx, conf.NoTaskKey, struct{}{}), src, dstDir)
 		if err != nil {
-			return http.StatusInternalServerError, err
+			return nil, http.StatusInternalServerError, err
 		}
 		if srcName != dstName {
 			err = fs.Rename(ctx, path.Join(dstDir, srcName), dstName)
 		}
 	}
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	// TODO if there are no files copy, should return 204
-	return http.StatusCreated, nil
+	return nil, http.StatusCreated, nil
 }
 
 // copyFiles copies files and/or directories from src to dst.
 // Individual item permission checks are skipped for performance reasons.
 //
 // See section 9.8.5 for when various HTTP status codes apply.
-func copyFiles(ctx context.Context, src, dst string, overwrite bool) (status int, err error) {
+// A copy across storages larger than the async threshold runs as a background task which is returned.
+func copyFiles(ctx context.Context, src, dst string, overwrite bool) (t task.TaskExtensionInfo, status int, err error) {
 	srcDir := path.Dir(src)
 	dstDir := path.Dir(dst)
 	user := ctx.Value(conf.UserKey).(*model.User)
 	if !user.CanCopy() {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
 	}
 	srcMeta, err := op.GetNearestMeta(srcDir)
 	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	if !common.CanRead(user, srcMeta, srcDir) {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
 	}
 	dstMeta, err := op.GetNearestMeta(dstDir)
 	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	if !common.CanWrite(user, dstMeta, dstDir) {
-		return http.StatusForbidden, nil
+		return nil, http.StatusForbidden, nil
+	}
+	if asyncTransfer(ctx, src, dst) {
+		t, err = fs.Copy(ctx, src, dstDir)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		// a pending write-back upload is staged to dst at once
+		if t == nil {
+			return nil, http.StatusCreated, nil
+		}
+		return t, http.StatusAccepted, nil
 	}
 	_, err = fs.Copy(context.WithValue(ctx, conf.NoTaskKey, struct{}{}), src, dstDir)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
 	// TODO if there are no files copy, should return 204
-	return http.StatusCreated, nil
+	return nil, http.StatusCreated, nil
+}
+
+var errAsyncThresholdExceeded = errors.New("async transfer threshold exceeded")
+
+// asyncTransferMaxObjects bounds the walk of asyncTransfer, a folder with more objects runs as a background task
+const asyncTransferMaxObjects = 1000
+
+// asyncTransfer reports whether the copy or move of src to dst should run as a background task,
+// which is when it crosses storages, keeps the name, and the files at src add up to more than the async threshold
+// or there are more than asyncTransferMaxObjects of them
+func asyncTransfer(ctx context.Context, src, dst string) bool {
+	threshold := setting.GetInt(conf.WebdavAsyncTransferThreshold, -1)
+	// a renamed object can't be renamed back once the task is done
+	if threshold < 0 || path.Base(src) != path.Base(dst) {
+		return false
+	}
+	srcStorage, _, err := op.GetStorageAndActualPath(src)
+	if err != nil {
+		return false
+	}
+	dstStorage, _, err := op.GetStorageAndActualPath(path.Dir(dst))
+	if err != nil || srcStorage.GetStorage() == dstStorage.GetStorage() {
+		return false
+	}
+	obj, err := fs.Get(ctx, src, &fs.GetArgs{})
+	if err != nil {
+		return false
+	}
+	limit := int64(threshold) * 1024 * 1024
+	if !obj.IsDir() {
+		return obj.GetSize() > limit
+	}
+	var total int64
+	objects := 0
+	err = walkFS(ctx, infiniteDepth, src, obj, func(reqPath string, info model.Obj, err error) error {
+		if err != nil {
+			return err
+		}
+		if objects++; objects > asyncTransferMaxObjects {
+			return errAsyncThresholdExceeded
+		}
+		if !info.IsDir() {
+			total += info.GetSize()
+			if total > limit {
+				return errAsyncThresholdExceeded
+			}
+		}
+		return nil
+	})
+	return errors.Is(err, errAsyncThresholdExceeded)
 }
 
 // walkFS traverses filesystem fs starting at name up to depth levels.
@@ -0,0 +1,175 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/cache"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/coord"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	ownCloudNS = "http://owncloud.org/ns"
+	// ocInstanceID follows the file id in oc:id, the clients only need it to be the same for all the files
+	ocInstanceID = "ocopenlist"
+)
+
+// changes holds the last time something under a folder was written through WebDAV, by the full path of the folder.
+// It is part of the ETag of the folder, so the sync clients find the changes made deep in the tree from the root,
+// the writes made elsewhere show when the storage updates the modification time of the folder.
+// An entry expiring changes the ETag once more, which only makes the clients check the folder again.
+var changes = cache.NewKeyedCache[int64](changesTTL)
+
+const (
+	changesTTL = 24 * time.Hour
+	// eventChanged tells the other nodes of a cluster about a write, its key is the time and the path of the object
+	eventChanged = "dav_changed"
+)
+
+func init() {
+	coord.Handle(eventChanged, func(key string) {
+		t, p, ok := strings.Cut(key, ":")
+		if !ok {
+			return
+		}
+		if changed, err := strconv.ParseInt(t, 10, 64); err == nil {
+			recordChange(p, changed)
+		}
+	})
+}
+
+func isOwnCloud(ctx context.Context) bool {
+	v, _ := ctx.Value(conf.OwnCloudKey).(bool)
+	return v
+}
+
+// recordChange stores the time of the write of the object at the full path p in the folders above it
+func recordChange(p string, changed int64) {
+	for p != "/" && p != "." {
+		p = path.Dir(p)
+		changes.Set(p, changed)
+	}
+}
+
+// touch records the write of the request in the folders above the objects it wrote.
+func (h *Handler) touch(r *http.Request) {
+	switch r.Method {
+	case "PUT", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH":
+	default:
+		return
+	}
+	user, ok := r.Context().Value(conf.UserKey).(*model.User)
+	if !ok {
+		return
+	}
+	paths := []string{r.URL.Path}
+	if u, err := url.Parse(r.Header.Get("Destination")); err == nil && u.Path != "" {
+		paths = append(paths, u.Path)
+	}
+	now := time.Now().UnixNano()
+	for _, p := range paths {
+		p, _, err := h.stripPrefix(p)
+		if err != nil {
+			continue
+		}
+		if p, err = user.JoinPath(p); err != nil {
+			continue
+		}
+		recordChange(p, now)
+		coord.Publish(eventChanged, strconv.FormatInt(now, 10)+":"+p)
+	}
+}
+
+// collectionETag leaves the size out, since the storages don't agree on the size of a folder between a list and a get
+func collectionETag(name string, fi model.Obj) string {
+	var changed int64
+	if t, ok := changes.Get(name); ok {
+		changed = t
+	}
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().Unix(), changed)
+}
+
+// ocFileID is the numeric id of the object at the full path name, it changes when the object is renamed
+func ocFileID(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// ocID is the id of the object as the clients expect in oc:id and the OC-FileId header
+func ocID(name string) string {
+	return fmt.Sprintf("%08d%s", ocFileID(name), ocInstanceID)
+}
+
+func findOCID(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
+	return ocID(name), nil
+}
+
+func findOCFileID(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
+	return strconv.FormatInt(ocFileID(name), 10), nil
+}
+
+// findOCPermissions returns what the user may do with the object in the letters of the ownCloud clients:
+// D delete, N rename, V move, W write the file and C, K create files and folders in the folder.
+func findOCPermissions(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
+	user := ctx.Value(conf.UserKey).(*model.User)
+	if !user.CanWebdavManage() {
+		return "", nil
+	}
+	canWrite := func(p string) (bool, error) {
+		meta, err := op.GetNearestMeta(p)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			return false, err
+		}
+		return common.CanWrite(user, meta, p), nil
+	}
+	canWriteContent := func(p string) (bool, error) {
+		return canPut(user, p)
+	}
+	mask := model.GetObjMask(fi)
+	perms := ""
+	parentPath := path.Dir(name)
+	if ok, err := canWrite(parentPath); err != nil {
+		return "", err
+	} else if ok && name != utils.FixAndCleanPath(user.BasePath) {
+		if user.CanRemove() && mask&model.NoRemove == 0 {
+			perms += "D"
+		}
+		if user.CanRename() && mask&model.NoRename == 0 {
+			perms += "N"
+		}
+		if user.CanMove() && mask&model.NoMove == 0 {
+			perms += "V"
+		}
+	}
+	if mask&model.NoWrite != 0 {
+		return perms, nil
+	}
+	if fi.IsDir() {
+		if ok, err := canWriteContent(name); err != nil {
+			return "", err
+		} else if ok {
+			perms += "CK"
+		}
+	} else if ok, err := canWriteContent(parentPath); err != nil {
+		return "", err
+	} else if ok {
+		perms += "W"
+	}
+	return perms, nil
+}
@@ -16,9 +16,13 @@ import (
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
+	log "github.com/sirupsen/logrus"
 )
 
 // Proppatch describes a property update instruction as defined in RFC 4918.
@@ -109,6 +113,8 @@ var liveProps = map[xml.Name]struct {
 	findFn func(context.Context, LockSystem, string, model.Obj) (string, error)
 	// dir is true if the property applies to directories.
 	dir bool
+	// ownCloud is true if the property is only served in the ownCloud mode.
+	ownCloud bool
 }{
 	{Space: "DAV:", Local: "resourcetype"}: {
 		findFn: findResourceType,
@@ -161,10 +167,52 @@ var liveProps = map[xml.Name]struct {
 		findFn: findSupportedLock,
 		dir:    true,
 	},
-	{Space: "http://owncloud.org/ns", Local: "checksums"}: {
+	// https://www.rfc-editor.org/rfc/rfc4331
+	quotaAvailableBytes: {
+		findFn: findQuotaAvailableBytes,
+		dir:    true,
+	},
+	quotaUsedBytes: {
+		findFn: findQuotaUsedBytes,
+		dir:    true,
+	},
+	{Space: ownCloudNS, Local: "checksums"}: {
 		findFn: findChecksums,
 		dir:    false,
 	},
+	{Space: ownCloudNS, Local: "id"}: {
+		findFn:   findOCID,
+		dir:      true,
+		ownCloud: true,
+	},
+	{Space: ownCloudNS, Local: "fileid"}: {
+		findFn:   findOCFileID,
+		dir:      true,
+		ownCloud: true,
+	},
+	{Space: ownCloudNS, Local: "permissions"}: {
+		findFn:   findOCPermissions,
+		dir:      true,
+		ownCloud: true,
+	},
+	{Space: ownCloudNS, Local: "size"}: {
+		findFn:   findContentLength,
+		dir:      true,
+		ownCloud: true,
+	},
+}
+
+// liveProp returns the findFn of the live property pn if it is served for the resource.
+func liveProp(ctx context.Context, pn xml.Name, isDir bool) func(context.Context, LockSystem, string, model.Obj) (string, error) {
+	prop := liveProps[pn]
+	if prop.ownCloud && !isOwnCloud(ctx) {
+		return nil
+	}
+	// the ownCloud clients only look into the collections whose ETag changed
+	if isDir && !prop.dir && !(pn == getETag && isOwnCloud(ctx)) {
+		return nil
+	}
+	return prop.findFn
 }
 
 // TODO(nigeltao) merge props and allprop?
@@ -173,26 +221,12 @@ var liveProps = map[xml.Name]struct {
 //
 // Each Propstat has a unique status and each property name will only be part
 // of one Propstat element.
-func props(ctx context.Context, ls LockSystem, fi model.Obj, pnames []xml.Name) ([]Propstat, error) {
-	//f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//defer f.Close()
-	//fi, err := f.Stat()
-	//if err != nil {
-	//	return nil, err
-	//}
+func props(ctx context.Context, ls LockSystem, name string, fi model.Obj, pnames []xml.Name) ([]Propstat, error) {
 	isDir := fi.IsDir()
-
-	var deadProps map[xml.Name]Property
-	// ??? what is this for?
-	//if dph, ok := f.(DeadPropsHolder); ok {
-	//	deadProps, err = dph.DeadProps()
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//}
+	deadProps, err := getDeadProps(name)
+	if err != nil {
+		return nil, err
+	}
 
 	pstatOK := Propstat{Status: http.StatusOK}
 	pstatNotFound := Propstat{Status: http.StatusNotFound}
@@ -203,8 +237,14 @@ func props(ctx context.Context, ls LockSystem, fi model.Obj, pnames []xml.Name)
 			continue
 		}
 		// Otherwise, it must either be a live property or we don't know it.
-		if prop := liveProps[pn]; prop.findFn != nil && (prop.dir || !isDir) {
-			innerXML, err := prop.findFn(ctx, ls, fi.GetName(), fi)
+		if findFn := liveProp(ctx, pn, isDir); findFn != nil {
+			innerXML, err := findFn(ctx, ls, name, fi)
+			if errors.Is(err, errPropNotFound) {
+				pstatNotFound.Props = append(pstatNotFound.Props, Property{
+					XMLName: pn,
+				})
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -222,30 +262,16 @@ func props(ctx context.Context, ls LockSystem, fi model.Obj, pnames []xml.Name)
 }
 
 // Propnames returns the property names defined for resource name.
-func propnames(ctx context.Context, ls LockSystem, fi model.Obj) ([]xml.Name, error) {
-	//f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//defer f.Close()
-	//fi, err := f.Stat()
-	//if err != nil {
-	//	return nil, err
-	//}
+func propnames(ctx context.Context, ls LockSystem, name string, fi model.Obj) ([]xml.Name, error) {
 	isDir := fi.IsDir()
-
-	var deadProps map[xml.Name]Property
-	// ??? what is this for?
-	//if dph, ok := f.(DeadPropsHolder); ok {
-	//	deadProps, err = dph.DeadProps()
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//}
+	deadProps, err := getDeadProps(name)
+	if err != nil {
+		return nil, err
+	}
 
 	pnames := make([]xml.Name, 0, len(liveProps)+len(deadProps))
-	for pn, prop := range liveProps {
-		if prop.findFn != nil && (prop.dir || !isDir) {
+	for pn := range liveProps {
+		if liveProp(ctx, pn, isDir) != nil {
 			pnames = append(pnames, pn)
 		}
 	}
@@ -263,11 +289,18 @@ func propnames(ctx context.Context, ls LockSystem, fi model.Obj) ([]xml.Name, er
 // returned if they are named in 'include'.
 //
 // See http://www.webdav.org/specs/rfc4918.html#METHOD_PROPFIND
-func allprop(ctx context.Context, ls LockSystem, fi model.Obj, include []xml.Name) ([]Propstat, error) {
-	pnames, err := propnames(ctx, ls, fi)
+func allprop(ctx context.Context, ls LockSystem, name string, fi model.Obj, include []xml.Name) ([]Propstat, error) {
+	names, err := propnames(ctx, ls, name, fi)
 	if err != nil {
 		return nil, err
 	}
+	// RFC 4331 says the quota properties are not returned by allprop
+	pnames := names[:0]
+	for _, pn := range names {
+		if pn != quotaAvailableBytes && pn != quotaUsedBytes {
+			pnames = append(pnames, pn)
+		}
+	}
 	// Add names from include if they are not already covered in pnames.
 	nameset := make(map[xml.Name]bool)
 	for _, pn := range pnames {
@@ -278,76 +311,137 @@ func allprop(ctx context.Context, ls LockSystem, fi model.Obj, include []xml.Nam
 			pnames = append(pnames, pn)
 		}
 	}
-	return props(ctx, ls, fi, pnames)
+	return props(ctx, ls, name, fi, pnames)
+}
+
+var (
+	getETag           = xml.Name{Space: "DAV:", Local: "getetag"}
+	getLastModified   = xml.Name{Space: "DAV:", Local: "getlastmodified"}
+	win32LastModified = xml.Name{Space: "urn:schemas-microsoft-com:", Local: "Win32LastModifiedTime"}
+)
+
+// getDeadProps returns the props set by PROPPATCH on the object at the full path name
+func getDeadProps(name string) (map[xml.Name]Property, error) {
+	dps, err := op.GetDavProps(name)
+	if err != nil {
+		return nil, err
+	}
+	deadProps := make(map[xml.Name]Property, len(dps))
+	for _, p := range dps {
+		pn := xml.Name{Space: p.Namespace, Local: p.Name}
+		deadProps[pn] = Property{XMLName: pn, Lang: p.Lang, InnerXML: []byte(p.Value)}
+	}
+	return deadProps, nil
 }
 
 // Patch patches the properties of resource name. The return values are
 // constrained in the same manner as DeadPropsHolder.Patch.
+//
+// Setting getlastmodified or Win32LastModifiedTime changes the modification
+// time on the storage, the latter is kept as a dead property as well since
+// Windows reads it back. The other properties are kept in the database.
 func patch(ctx context.Context, ls LockSystem, name string, patches []Proppatch) ([]Propstat, error) {
-	conflict := false
-loop:
+	var (
+		modified   time.Time
+		setModTime bool
+		// the status of the properties which can't be patched
+		failed = make(map[xml.Name]int)
+	)
 	for _, patch := range patches {
 		for _, p := range patch.Props {
+			if p.XMLName == getLastModified || p.XMLName == win32LastModified {
+				if patch.Remove {
+					if p.XMLName == getLastModified {
+						failed[p.XMLName] = http.StatusForbidden
+					}
+					continue
+				}
+				t, err := http.ParseTime(strings.TrimSpace(string(p.InnerXML)))
+				if err != nil {
+					failed[p.XMLName] = http.StatusConflict
+					continue
+				}
+				modified, setModTime = t, true
+				continue
+			}
 			if _, ok := liveProps[p.XMLName]; ok {
-				conflict = true
-				break loop
+				failed[p.XMLName] = http.StatusForbidden
 			}
 		}
 	}
-	if conflict {
-		pstatForbidden := Propstat{
-			Status:   http.StatusForbidden,
-			XMLError: `<D:cannot-modify-protected-property xmlns:D="DAV:"/>`,
-		}
-		pstatFailedDep := Propstat{
-			Status: StatusFailedDependency,
-		}
-		for _, patch := range patches {
-			for _, p := range patch.Props {
-				if _, ok := liveProps[p.XMLName]; ok {
-					pstatForbidden.Props = append(pstatForbidden.Props, Property{XMLName: p.XMLName})
-				} else {
-					pstatFailedDep.Props = append(pstatFailedDep.Props, Property{XMLName: p.XMLName})
+	if len(failed) == 0 && setModTime {
+		err := fs.SetModTime(ctx, name, modified)
+		if errors.Is(err, errs.NotImplement) {
+			// the storage can't set it, so getlastmodified stays protected
+			for _, patch := range patches {
+				for _, p := range patch.Props {
+					if p.XMLName == getLastModified {
+						failed[p.XMLName] = http.StatusForbidden
+					}
 				}
 			}
+		} else if err != nil {
+			return nil, err
 		}
-		return makePropstats(pstatForbidden, pstatFailedDep), nil
+	}
+	if len(failed) > 0 {
+		return failedPatch(patches, failed), nil
 	}
 
-	// ------------------------------------------------------------
-	//f, err := fs.OpenFile(ctx, name, os.O_RDWR, 0)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//defer f.Close()
-	//if dph, ok := f.(DeadPropsHolder); ok {
-	//	ret, err := dph.Patch(patches)
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//	// http://www.webdav.org/specs/rfc4918.html#ELEMENT_propstat says that
-	//	// "The contents of the prop XML element must only list the names of
-	//	// properties to which the result in the status element applies."
-	//	for _, pstat := range ret {
-	//		for i, p := range pstat.Props {
-	//			pstat.Props[i] = Property{XMLName: p.XMLName}
-	//		}
-	//	}
-	//	return ret, nil
-	//}
-	// ------------------------------------------------------------
-
-	// The file doesn't implement the optional DeadPropsHolder interface, so
-	// all patches are forbidden.
-	pstat := Propstat{Status: http.StatusForbidden}
+	var set, remove []model.DavProp
+	pstat := Propstat{Status: http.StatusOK}
 	for _, patch := range patches {
 		for _, p := range patch.Props {
+			// http://www.webdav.org/specs/rfc4918.html#ELEMENT_propstat says that
+			// "The contents of the prop XML element must only list the names of
+			// properties to which the result in the status element applies."
 			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+			if p.XMLName == getLastModified {
+				continue
+			}
+			dp := model.DavProp{Namespace: p.XMLName.Space, Name: p.XMLName.Local, Lang: p.Lang, Value: string(p.InnerXML)}
+			if patch.Remove {
+				remove = append(remove, dp)
+			} else {
+				set = append(set, dp)
+			}
 		}
 	}
+	if err := op.PatchDavProps(name, set, remove); err != nil {
+		return nil, err
+	}
 	return []Propstat{pstat}, nil
 }
 
+// failedPatch reports the properties in failed with their status, the others
+// failed since the patch is atomic.
+func failedPatch(patches []Proppatch, failed map[xml.Name]int) []Propstat {
+	byStatus := make(map[int]int)
+	var pstats []Propstat
+	add := func(pn xml.Name, status int) {
+		i, ok := byStatus[status]
+		if !ok {
+			i = len(pstats)
+			byStatus[status] = i
+			pstats = append(pstats, Propstat{Status: status})
+			if status == http.StatusForbidden {
+				pstats[i].XMLError = `<D:cannot-modify-protected-property xmlns:D="DAV:"/>`
+			}
+		}
+		pstats[i].Props = append(pstats[i].Props, Property{XMLName: pn})
+	}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if status, ok := failed[p.XMLName]; ok {
+				add(p.XMLName, status)
+			} else {
+				add(p.XMLName, StatusFailedDependency)
+			}
+		}
+	}
+	return pstats
+}
+
 func escapeXML(s string) string {
 	for i := 0; i < len(s); i++ {
 		// As an optimization, if s contains only ASCII letters, digits or a
@@ -376,7 +470,7 @@ func findResourceType(ctx context.Context, ls LockSystem, name string, fi model.
 }
 
 func findDisplayName(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
-	if slashClean(name) == "/" {
+	if slashClean(fi.GetName()) == "/" {
 		// Hide the real name of a possibly prefixed root directory.
 		return "", nil
 	}
@@ -398,6 +492,45 @@ func findCreationDate(ctx context.Context, ls LockSystem, name string, fi model.
 	return fi.CreateTime().UTC().Format(time.RFC3339), nil
 }
 
+// errPropNotFound is returned by a findFn if the property is not available for the resource.
+var errPropNotFound = errors.New("property not found")
+
+var (
+	quotaAvailableBytes = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedBytes      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+// getQuota returns the details of the storages the collection name is in.
+func getQuota(ctx context.Context, name string, fi model.Obj) (*model.StorageDetails, error) {
+	if !fi.IsDir() {
+		return nil, errPropNotFound
+	}
+	details, err := op.GetStorageDetailsByPath(ctx, name)
+	if err != nil {
+		if !errors.Is(err, errs.NotImplement) {
+			log.Warnf("failed get storage details of %s: %+v", name, err)
+		}
+		return nil, errPropNotFound
+	}
+	return details, nil
+}
+
+func findQuotaAvailableBytes(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
+	details, err := getQuota(ctx, name, fi)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(max(details.FreeSpace(), 0), 10), nil
+}
+
+func findQuotaUsedBytes(ctx context.Context, ls LockSystem, name string, fi model.Obj) (string, error) {
+	details, err := getQuota(ctx, name, fi)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(details.UsedSpace, 10), nil
+}
+
 // ErrNotImplemented should be returned by optional interfaces if they
 // want the original implementation to be used.
 var ErrNotImplemented = errors.New("not implemented")
@@ -475,6 +608,9 @@ func findETag(ctx context.Context, ls LockSystem, name string, fi model.Obj) (st
 			return etag, err
 		}
 	}
+	if fi.IsDir() {
+		return collectionETag(name, fi), nil
+	}
 	return common.GetEtag(fi, fi.GetSize()), nil
 }
 
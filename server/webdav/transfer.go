@@ -0,0 +1,103 @@
+package webdav
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/tache"
+)
+
+// transferQuery is the query parameter of the status resource of a COPY or MOVE running as a background task
+const transferQuery = "transfer"
+
+// transferStatus is the status resource of a COPY or MOVE running as a background task,
+// the transfer of a folder is made of the tasks of its objects
+type transferStatus struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	State    string  `json:"state"` // running, succeeded or failed
+	Tasks    int     `json:"tasks"`
+	Done     int     `json:"done"`
+	Progress float64 `json:"progress"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// acceptTransfer answers a COPY or MOVE handed off to a background task with 202 Accepted and the location of its status
+func (h *Handler) acceptTransfer(w http.ResponseWriter, t task.TaskExtensionInfo) (int, error) {
+	w.Header().Set("Location", strings.TrimSuffix(h.Prefix, "/")+"/?"+url.Values{transferQuery: {t.GetID()}}.Encode())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return 0, json.NewEncoder(w).Encode(transferStatus{ID: t.GetID(), Name: t.GetName(), State: "running", Tasks: 1})
+}
+
+// isTransferStatus reports whether the request is for the status resource of a transfer, which is a query on the root
+func (h *Handler) isTransferStatus(r *http.Request) bool {
+	if r.Method != http.MethodGet || !r.URL.Query().Has(transferQuery) {
+		return false
+	}
+	p, _, err := h.stripPrefix(r.URL.Path)
+	return err == nil && (p == "" || p == "/")
+}
+
+func (h *Handler) handleTransferStatus(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	id := r.URL.Query().Get(transferQuery)
+	user := r.Context().Value(conf.UserKey).(*model.User)
+	for _, m := range []*tache.Manager[*fs.FileTransferTask]{fs.CopyTaskManager, fs.MoveTaskManager} {
+		if m == nil {
+			continue
+		}
+		t, ok := m.GetByID(id)
+		if !ok {
+			continue
+		}
+		// the tasks of the other users are as good as missing
+		if !user.IsAdmin() && (t.GetCreator() == nil || t.GetCreator().ID != user.ID) {
+			return http.StatusNotFound, nil
+		}
+		s := transferStatus{ID: t.GetID(), Name: t.GetName(), State: "succeeded"}
+		failed := false
+		group := []*fs.FileTransferTask{t}
+		// the tasks persisted before the transfers had an id are on their own
+		if t.TransferID != "" {
+			group = m.GetByCondition(func(sub *fs.FileTransferTask) bool { return sub.TransferID == t.TransferID })
+		}
+		for _, sub := range group {
+			s.Tasks++
+			progress := sub.GetProgress()
+			switch sub.GetState() {
+			case tache.StateSucceeded:
+				// the tasks of the folders don't report their progress
+				progress = 100
+				s.Done++
+			case tache.StateFailed, tache.StateCanceled:
+				s.Done++
+				failed = true
+				if s.Error == "" && sub.GetErr() != nil {
+					s.Error = sub.GetErr().Error()
+				}
+			}
+			if !math.IsNaN(progress) {
+				s.Progress += progress
+			}
+		}
+		if s.Tasks > 0 {
+			s.Progress /= float64(s.Tasks)
+		}
+		if s.Done < s.Tasks {
+			s.State = "running"
+		} else if failed {
+			s.State = "failed"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return 0, json.NewEncoder(w).Encode(s)
+	}
+	return http.StatusNotFound, nil
+}
@@ -0,0 +1,103 @@
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/tache"
+)
+
+func newTransferTask(creator *model.User, transferID, dst string, state tache.State, progress float64) *fs.FileTransferTask {
+	t := &fs.FileTransferTask{
+		TaskData: fs.TaskData{
+			TaskExtension: task.TaskExtension{Creator: creator},
+			DstStorageMp:  "/dst",
+			DstActualPath: dst,
+		},
+		TransferID: transferID,
+	}
+	t.SetState(state)
+	t.SetProgress(progress)
+	return t
+}
+
+func getTransferStatus(t *testing.T, user *model.User, id string) (int, transferStatus) {
+	t.Helper()
+	h := &Handler{Prefix: "/dav"}
+	r := httptest.NewRequest(http.MethodGet, "/dav/?transfer="+id, nil)
+	r = r.WithContext(context.WithValue(r.Context(), conf.UserKey, user))
+	if !h.isTransferStatus(r) {
+		t.Fatal("not a transfer status request")
+	}
+	w := httptest.NewRecorder()
+	status, err := h.handleTransferStatus(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s transferStatus
+	if status == 0 {
+		status = w.Code
+		if err = json.NewDecoder(w.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return status, s
+}
+
+func TestTransferStatus(t *testing.T) {
+	conf.Conf = conf.DefaultConfig("data")
+	fs.CopyTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithRunning(false))
+	fs.MoveTaskManager = tache.NewManager[*fs.FileTransferTask](tache.WithRunning(false))
+	owner := &model.User{ID: 2, Role: model.GENERAL}
+	other := &model.User{ID: 3, Role: model.GENERAL}
+
+	// an earlier transfer into the same folder failed and is still in the manager
+	old := newTransferTask(owner, "old", "/folder", tache.StateFailed, 0)
+	old.SetErr(errors.New("old failure"))
+	fs.CopyTaskManager.Add(old)
+
+	root := newTransferTask(owner, "t1", "/folder", tache.StateSucceeded, 0)
+	fs.CopyTaskManager.Add(root)
+	fs.CopyTaskManager.Add(newTransferTask(owner, "t1", "/folder/sub", tache.StateSucceeded, 0))
+	fs.CopyTaskManager.Add(newTransferTask(owner, "t1", "/folder/sub", tache.StatePending, 50))
+
+	status, s := getTransferStatus(t, owner, root.GetID())
+	if status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if s.Tasks != 3 || s.Done != 2 || s.State != "running" || s.Error != "" {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if want := (100 + 100 + 50) / 3.0; s.Progress != want {
+		t.Errorf("progress %v, want %v", s.Progress, want)
+	}
+
+	if _, s = getTransferStatus(t, owner, old.GetID()); s.Tasks != 1 || s.State != "failed" || s.Error != "old failure" {
+		t.Errorf("unexpected status of the old transfer %+v", s)
+	}
+	if status, _ = getTransferStatus(t, other, root.GetID()); status != http.StatusNotFound {
+		t.Errorf("another user gets the status: %d", status)
+	}
+	if _, s = getTransferStatus(t, &model.User{ID: 1, Role: model.ADMIN}, root.GetID()); s.Tasks != 3 {
+		t.Errorf("the admin gets %+v", s)
+	}
+	if status, _ = getTransferStatus(t, owner, "missing"); status != http.StatusNotFound {
+		t.Errorf("a missing transfer answers %d", status)
+	}
+
+	// a task persisted without a transfer id is on its own
+	legacy := newTransferTask(owner, "", "/folder", tache.StateSucceeded, 0)
+	fs.MoveTaskManager.Add(legacy)
+	fs.MoveTaskManager.Add(newTransferTask(owner, "", "/folder", tache.StatePending, 0))
+	if _, s = getTransferStatus(t, owner, legacy.GetID()); s.Tasks != 1 || s.State != "succeeded" {
+		t.Errorf("unexpected status of a task without transfer id %+v", s)
+	}
+}
@@ -39,6 +39,11 @@ type Handler struct {
 	// Logger is an optional error logger. If non-nil, it will be called
 	// for all HTTP requests.
 	Logger func(*http.Request, error)
+	// OwnCloud serves the properties the ownCloud and Nextcloud clients sync with.
+	OwnCloud bool
+	// UploadsPrefix is the URL path prefix of the chunked uploads of the ownCloud clients,
+	// the assembled files are moved under Prefix.
+	UploadsPrefix string
 }
 
 func (h *Handler) stripPrefix(p string) (string, int, error) {
@@ -55,13 +60,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	status, err := http.StatusBadRequest, errUnsupportedMethod
 	brw := newBufferedResponseWriter()
 	useBufferedWriter := true
+	if h.OwnCloud {
+		r = r.WithContext(context.WithValue(r.Context(), conf.OwnCloudKey, true))
+	}
 	if h.LockSystem == nil {
 		status, err = http.StatusInternalServerError, errNoLockSystem
+	} else if h.isUpload(r) {
+		status, err = h.handleUpload(brw, r)
 	} else {
 		switch r.Method {
 		case "OPTIONS":
 			status, err = h.handleOptions(brw, r)
 		case "GET", "HEAD", "POST":
+			if h.isTransferStatus(r) {
+				status, err = h.handleTransferStatus(brw, r)
+				break
+			}
 			useBufferedWriter = false
 			Writer := &common.WrittenResponseWriter{ResponseWriter: w}
 			status, err = h.handleGetHeadPost(Writer, r)
@@ -91,7 +105,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err == nil && status < 300 {
+		h.touch(r)
+	}
 	if status != 0 {
+		for k, v := range brw.Header() {
+			w.Header()[k] = v
+		}
 		w.WriteHeader(status)
 		if status != http.StatusNoContent {
 			w.Write([]byte(StatusText(status)))
@@ -280,6 +300,7 @@ func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request) (sta
 	if storage.GetStorage().ProxyRange {
 		link = common.ProxyRange(ctx, link, fi.GetSize())
 	}
+	link = common.ReadCacheRange(ctx, storage.GetStorage(), reqPath, link, fi)
 	err = common.Proxy(w, r, link, fi)
 	if err != nil {
 		if statusCode, ok := errs.UnwrapOrSelf(err).(net.HttpStatusCodeError); ok {
@@ -379,48 +400,89 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) (status int,
 		Modified: h.getModTime(r),
 		Ctime:    h.getCreateTime(r),
 	}
+	fi, status, err := h.put(ctx, reqPath, r.Body, &obj, r.Header.Get("Content-Type"))
+	if err != nil {
+		return status, err
+	}
+	if err = h.setPutHeaders(w, r, reqPath, fi); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// canPut reports whether the user may write files in the folder at the full path dir
+func canPut(user *model.User, dir string) (bool, error) {
+	meta, err := op.GetNearestMeta(dir)
+	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+		return false, err
+	}
+	if !user.CanWriteContent() && !common.CanWriteContentBypassUserPerms(meta, dir) {
+		return false, nil
+	}
+	return common.CanWrite(user, meta, dir), nil
+}
+
+// put writes the content of r to the file at the full path reqPath and returns the file written
+func (h *Handler) put(ctx context.Context, reqPath string, r io.Reader, obj *model.Object, mimetype string) (model.Obj, int, error) {
 	// Check if system file should be ignored
 	if setting.GetBool(conf.IgnoreSystemFiles) && utils.IsSystemFile(obj.Name) {
-		return http.StatusForbidden, errs.IgnoredSystemFile
+		return nil, http.StatusForbidden, errs.IgnoredSystemFile
 	}
+	user := ctx.Value(conf.UserKey).(*model.User)
 	parentPath := path.Dir(reqPath)
-	parentMeta, err := op.GetNearestMeta(parentPath)
-	if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
-		return http.StatusInternalServerError, err
-	}
-	if !user.CanWriteContent() && !common.CanWriteContentBypassUserPerms(parentMeta, parentPath) {
-		return http.StatusForbidden, errs.PermissionDenied
+	ok, err := canPut(user, parentPath)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
-	if !common.CanWrite(user, parentMeta, parentPath) {
-		return http.StatusForbidden, errs.PermissionDenied
+	if !ok {
+		return nil, http.StatusForbidden, errs.PermissionDenied
 	}
 	fsStream := &stream.FileStream{
-		Obj:      &obj,
-		Reader:   r.Body,
-		Mimetype: r.Header.Get("Content-Type"),
+		Obj:      obj,
+		Reader:   r,
+		Mimetype: mimetype,
 	}
 	if fsStream.Mimetype == "" {
 		fsStream.Mimetype = utils.GetMimeType(reqPath)
 	}
-	err = fs.PutDirectly(ctx, path.Dir(reqPath), fsStream)
+	if fs.IsWriteBack(parentPath) {
+		// completed once staged, the put to the storage runs in the background
+		err = fs.StageUpload(ctx, reqPath, r, obj.Size, obj.Modified, fsStream.Mimetype)
+	} else {
+		err = fs.PutDirectly(ctx, parentPath, fsStream)
+	}
 	if errs.IsNotFoundError(err) {
-		return http.StatusNotFound, err
+		return nil, http.StatusNotFound, err
 	}
 
 	// TODO(rost): Returning 405 Method Not Allowed might not be appropriate.
 	if err != nil {
-		return http.StatusMethodNotAllowed, err
+		return nil, http.StatusMethodNotAllowed, err
 	}
 	fi, err := fs.Get(ctx, reqPath, &fs.GetArgs{})
 	if err != nil {
-		fi = &obj
+		fi = obj
 	}
+	return fi, 0, nil
+}
+
+// setPutHeaders tells the client the ETag of the file written, and its id in the ownCloud mode
+func (h *Handler) setPutHeaders(w http.ResponseWriter, r *http.Request, reqPath string, fi model.Obj) error {
+	ctx := r.Context()
 	etag, err := findETag(ctx, h.LockSystem, reqPath, fi)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return err
 	}
 	w.Header().Set("Etag", etag)
-	return http.StatusCreated, nil
+	if !isOwnCloud(ctx) {
+		return nil
+	}
+	w.Header().Set("OC-ETag", etag)
+	w.Header().Set("OC-FileId", ocID(reqPath))
+	if r.Header.Get("X-OC-Mtime") != "" {
+		w.Header().Set("X-OC-MTime", "accepted")
+	}
+	return nil
 }
 
 func (h *Handler) handleMkcol(w http.ResponseWriter, r *http.Request) (status int, err error) {
@@ -542,7 +604,11 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 				return http.StatusBadRequest, errInvalidDepth
 			}
 		}
-		return copyFiles(ctx, src, dst, r.Header.Get("Overwrite") != "F")
+		t, status, err := copyFiles(ctx, src, dst, r.Header.Get("Overwrite") != "F")
+		if t != nil {
+			return h.acceptTransfer(w, t)
+		}
+		return status, err
 	}
 
 	release, status, err := h.confirmLocks(r, src, dst)
@@ -559,7 +625,11 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 			return http.StatusBadRequest, errInvalidDepth
 		}
 	}
-	return moveFiles(ctx, src, dst, r.Header.Get("Overwrite") == "T")
+	t, status, err := moveFiles(ctx, src, dst, r.Header.Get("Overwrite") == "T")
+	if t != nil {
+		return h.acceptTransfer(w, t)
+	}
+	return status, err
 }
 
 func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus int, retErr error) {
@@ -758,7 +828,7 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status
 		}
 		var pstats []Propstat
 		if pf.Propname != nil {
-			pnames, err := propnames(ctx, h.LockSystem, info)
+			pnames, err := propnames(ctx, h.LockSystem, reqPath, info)
 			if err != nil {
 				return err
 			}
@@ -768,9 +838,9 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status
 			}
 			pstats = append(pstats, pstat)
 		} else if pf.Allprop != nil {
-			pstats, err = allprop(ctx, h.LockSystem, info, pf.Prop)
+			pstats, err = allprop(ctx, h.LockSystem, reqPath, info, pf.Prop)
 		} else {
-			pstats, err = props(ctx, h.LockSystem, info, pf.Prop)
+			pstats, err = props(ctx, h.LockSystem, reqPath, info, pf.Prop)
 		}
 		if err != nil {
 			return err